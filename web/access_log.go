@@ -0,0 +1,147 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	myLog "github.com/ygb616/web/log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// AccessLogFormats 访问日志的预置格式，app.toml 中 [log.access] 的 format 可以使用这些名称
+var AccessLogFormats = map[string]LoggerFormatter{
+	"default":  defaultFormatter,
+	"combined": combinedFormatter,
+	"json":     jsonAccessFormatter,
+}
+
+// combinedFormatter Apache/Nginx 的 combined 格式，没有响应大小，输出为 -
+var combinedFormatter = func(params *LogFormatterParams) string {
+	r := params.Request
+	return fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d - %q %q",
+		params.ClientIP, params.TimeStamp.Format("02/Jan/2006:15:04:05 -0700"),
+		params.Method, params.Path, r.Proto, params.StatusCode,
+		r.Referer(), r.UserAgent(),
+	)
+}
+
+// jsonAccessFormatter 每条访问日志输出为一行 json
+var jsonAccessFormatter = func(params *LogFormatterParams) string {
+	b, _ := json.Marshal(map[string]any{
+		"time":       params.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		"status":     params.StatusCode,
+		"latency_ms": float64(params.Latency.Microseconds()) / 1000,
+		"ip":         params.ClientIP.String(),
+		"method":     params.Method,
+		"path":       params.Path,
+		"request_id": params.RequestID,
+		"user_agent": params.Request.UserAgent(),
+	})
+	return string(b)
+}
+
+// accessLogVars 模板中可以使用的变量
+var accessLogVars = map[string]func(p *LogFormatterParams) string{
+	"time":       func(p *LogFormatterParams) string { return p.TimeStamp.Format("2006/01/02 - 15:04:05") },
+	"status":     func(p *LogFormatterParams) string { return strconv.Itoa(p.StatusCode) },
+	"latency":    func(p *LogFormatterParams) string { return p.Latency.String() },
+	"ip":         func(p *LogFormatterParams) string { return p.ClientIP.String() },
+	"method":     func(p *LogFormatterParams) string { return p.Method },
+	"path":       func(p *LogFormatterParams) string { return p.Path },
+	"request_id": func(p *LogFormatterParams) string { return p.RequestID },
+	"proto":      func(p *LogFormatterParams) string { return p.Request.Proto },
+	"host":       func(p *LogFormatterParams) string { return p.Request.Host },
+	"referer":    func(p *LogFormatterParams) string { return p.Request.Referer() },
+	"user_agent": func(p *LogFormatterParams) string { return p.Request.UserAgent() },
+}
+
+// TemplateFormatter 按模板输出访问日志，变量写作 ${name}，如：
+//
+//	${time} | ${status} | ${latency} | ${ip} | ${method} ${path} | ${request_id}
+//
+// 可用的变量见 accessLogVars，另外 ${header:X-Name} 输出请求头
+func TemplateFormatter(tmpl string) (LoggerFormatter, error) {
+	var parts []func(p *LogFormatterParams) string
+	for tmpl != "" {
+		i := strings.Index(tmpl, "${")
+		if i < 0 {
+			text := tmpl
+			parts = append(parts, func(*LogFormatterParams) string { return text })
+			break
+		}
+		if i > 0 {
+			text := tmpl[:i]
+			parts = append(parts, func(*LogFormatterParams) string { return text })
+		}
+		end := strings.IndexByte(tmpl[i:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("web: access log template: unclosed ${ in %q", tmpl[i:])
+		}
+		name := tmpl[i+2 : i+end]
+		if header, ok := strings.CutPrefix(name, "header:"); ok {
+			parts = append(parts, func(p *LogFormatterParams) string { return p.Request.Header.Get(header) })
+		} else if fn, ok := accessLogVars[name]; ok {
+			parts = append(parts, fn)
+		} else {
+			return nil, fmt.Errorf("web: access log template: unknown variable %q", name)
+		}
+		tmpl = tmpl[i+end+1:]
+	}
+	return func(params *LogFormatterParams) string {
+		var sb strings.Builder
+		for _, part := range parts {
+			sb.WriteString(part(params))
+		}
+		return sb.String()
+	}, nil
+}
+
+// LoggingConfigFromMap 从 app.toml 的 [log] 中读取访问日志的配置：
+//
+//	[log.access]
+//	format = "combined"          # 预置格式 default、combined、json，或 ${name} 模板
+//	file = "./log/access.log"    # 输出文件，不设置时输出到标准输出
+//	color = false                # 是否带颜色，默认输出到标准输出时带颜色
+//	max_size = 100               # 文件切割配置，同 [log] 的 max_size、max_backups、max_age、compress
+//
+// 没有 [log.access] 时返回空的配置，即默认的格式和输出
+func LoggingConfigFromMap(m map[string]any) (LoggingConfig, error) {
+	var conf LoggingConfig
+	access, ok := m["access"].(map[string]any)
+	if !ok {
+		return conf, nil
+	}
+	if format, ok := access["format"].(string); ok && format != "" {
+		if formatter, ok := AccessLogFormats[format]; ok {
+			conf.Formatter = formatter
+		} else if strings.Contains(format, "${") {
+			formatter, err := TemplateFormatter(format)
+			if err != nil {
+				return conf, err
+			}
+			conf.Formatter = formatter
+		} else {
+			return conf, fmt.Errorf("web: unknown access log format %q", format)
+		}
+	}
+	file, _ := access["file"].(string)
+	color, hasColor := access["color"].(bool)
+	switch file {
+	case "":
+		if hasColor {
+			conf.Out = DefaultWriter
+			conf.IsColor = color
+		}
+	case "stdout":
+		conf.Out = os.Stdout
+		conf.IsColor = color || !hasColor
+	case "stderr":
+		conf.Out = os.Stderr
+		conf.IsColor = color
+	default:
+		conf.Out = myLog.NewRotateWriter(file, myLog.RotateConfFromMap(access))
+		conf.IsColor = color
+	}
+	return conf, nil
+}
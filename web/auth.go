@@ -1,19 +1,33 @@
 package web
 
 import (
+	"crypto/subtle"
 	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
 	"net/http"
+	"strings"
 )
 
 // Accounts 类型包含用户信息和未授权处理器
 type Accounts struct {
-	Users         map[string]string  // 存储用户名和密码的映射
-	UnAuthHandler func(ctx *Context) // 未授权时的处理函数
+	Users         map[string]string            // 存储用户名和密码的映射，密码可以是明文、bcrypt 或 argon2id 哈希
+	Validator     func(user, pass string) bool // 自定义的用户名密码校验，设置后不使用 Users
+	Realm         string                       // 401 响应 WWW-Authenticate 中的 realm，默认 Authorization Required
+	UnAuthHandler func(ctx *Context)           // 未授权时的处理函数
+	SkipPaths     []string                     // 不需要认证的路径，规则同 SkipRequest
+	SkipFunc      func(ctx *Context) bool      // 返回 true 时不需要认证
 }
 
 // BasicAuth 中间件函数，进行基本身份验证
 func (a *Accounts) BasicAuth(next HandlerFunc) HandlerFunc {
 	return func(ctx *Context) {
+		// 公开的路由不需要认证
+		if SkipRequest(ctx, a.SkipPaths, a.SkipFunc) {
+			next(ctx)
+			return
+		}
 		// 判断请求中是否有 Authorization 的 Header，并解析用户名和密码
 		username, password, ok := ctx.R.BasicAuth()
 		if !ok {
@@ -22,17 +36,9 @@ func (a *Accounts) BasicAuth(next HandlerFunc) HandlerFunc {
 			return
 		}
 
-		// 检查用户名是否存在
-		pw, ok := a.Users[username]
-		if !ok {
-			// 如果用户名不存在，调用未授权处理函数
-			a.UnAuthHandlers(ctx)
-			return
-		}
-
-		// 检查密码是否正确
-		if pw != password {
-			// 如果密码不正确，调用未授权处理函数
+		// 检查用户名和密码是否正确
+		if !a.validate(username, password) {
+			// 如果用户名不存在或密码不正确，调用未授权处理函数
 			a.UnAuthHandlers(ctx)
 			return
 		}
@@ -44,8 +50,31 @@ func (a *Accounts) BasicAuth(next HandlerFunc) HandlerFunc {
 	}
 }
 
+// validate 校验用户名和密码，设置了 Validator 时使用 Validator
+func (a *Accounts) validate(username, password string) bool {
+	if a.Validator != nil {
+		return a.Validator(username, password)
+	}
+	pw, ok := a.Users[username]
+	if !ok {
+		// 用户不存在时仍然和一个已配置的密码比较，结果丢弃，所有用户使用同一种哈希（或都是明文）时
+		// 校验耗时与用户存在时一致，防止通过耗时枚举用户名
+		for _, dummy := range a.Users {
+			CheckPassword(dummy, password)
+			break
+		}
+		return false
+	}
+	return CheckPassword(pw, password)
+}
+
 // UnAuthHandlers 处理未授权的请求
 func (a *Accounts) UnAuthHandlers(ctx *Context) {
+	realm := a.Realm
+	if realm == "" {
+		realm = "Authorization Required"
+	}
+	ctx.W.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", realm))
 	if a.UnAuthHandler != nil {
 		// 如果有自定义的未授权处理函数，则调用它
 		a.UnAuthHandler(ctx)
@@ -55,6 +84,51 @@ func (a *Accounts) UnAuthHandlers(ctx *Context) {
 	}
 }
 
+// HashPassword 使用 bcrypt 生成密码哈希，用于 Accounts.Users
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// CheckPassword 校验密码，hashed 支持 bcrypt（$2a$、$2b$、$2y$）、argon2id（$argon2id$v=19$m=,t=,p=$salt$hash）和明文，
+// 明文使用常量时间比较
+func CheckPassword(hashed, password string) bool {
+	switch {
+	case strings.HasPrefix(hashed, "$2a$"), strings.HasPrefix(hashed, "$2b$"), strings.HasPrefix(hashed, "$2y$"):
+		return bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password)) == nil
+	case strings.HasPrefix(hashed, "$argon2id$"):
+		return checkArgon2id(hashed, password)
+	}
+	return subtle.ConstantTimeCompare([]byte(hashed), []byte(password)) == 1
+}
+
+// checkArgon2id 校验 PHC 格式的 argon2id 哈希
+func checkArgon2id(hashed, password string) bool {
+	parts := strings.Split(hashed, "$")
+	if len(parts) != 6 {
+		return false
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return false
+	}
+	derived := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(derived, key) == 1
+}
+
 // BasicAuth 返回一个基本身份验证的字符串（Base64 编码）
 func basicAuth(username, password string) string {
 	// 拼接用户名和密码，格式为 "username:password"
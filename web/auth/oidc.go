@@ -0,0 +1,416 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/ygb616/web"
+	"github.com/ygb616/web/token"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrState 回调的 state 与登录时的不一致，或登录状态的 Cookie 已经过期
+	ErrState = errors.New("auth: invalid oidc state")
+	// ErrNonce ID token 的 nonce 与登录时的不一致
+	ErrNonce = errors.New("auth: invalid id token nonce")
+)
+
+// stateMaxAge 登录状态 Cookie 的有效期，需要在这段时间内完成登录
+const stateMaxAge = 10 * time.Minute
+
+// Identity OIDC 登录得到的用户身份
+type Identity struct {
+	Subject      string        // 用户唯一标识（sub）
+	Email        string        // 邮箱
+	Name         string        // 名称
+	Claims       jwt.MapClaims // ID token 中的所有 claims
+	IDToken      string
+	AccessToken  string
+	RefreshToken string
+	Next         string // 登录前传给 LoginHandler 的 next，登录后跳转的本站路径
+}
+
+// OIDC OpenID Connect 授权码模式客户端，支持 state、nonce 和 PKCE，用于 Keycloak、Azure AD 等单点登录：
+//
+//	o := &auth.OIDC{
+//		Issuer:       "https://sso.example.com/realms/demo",
+//		ClientID:     "web",
+//		ClientSecret: "secret",
+//		RedirectURL:  "https://app.example.com/auth/callback",
+//		OnLogin:      auth.JWTLogin(jwtHandler, nil),
+//	}
+//	engine.Get("/auth/login", o.LoginHandler)
+//	engine.Get("/auth/callback", o.CallbackHandler)
+type OIDC struct {
+	Issuer       string   // 签发者，如 https://login.microsoftonline.com/{tenant}/v2.0
+	ClientID     string   // 客户端 ID
+	ClientSecret string   // 客户端密钥，公共客户端为空，只使用 PKCE
+	RedirectURL  string   // 回调地址，需要在身份提供方注册
+	Scopes       []string // 默认 openid profile email
+
+	// AuthURL、TokenURL、JWKSURL 为空时从 Issuer/.well-known/openid-configuration 获取
+	AuthURL  string
+	TokenURL string
+	JWKSURL  string
+
+	HTTPClient   *http.Client // 访问身份提供方使用，默认超时 10 秒
+	CookieName   string       // 保存登录状态的 Cookie 名称，默认 web_oidc
+	SecureCookie bool
+
+	// OnLogin 登录成功后调用，负责写入本地的登录状态并响应，如 JWTLogin 签发本地 jwt
+	OnLogin func(ctx *web.Context, id *Identity) error
+	// ErrorHandler 登录失败的处理函数，默认返回 401
+	ErrorHandler func(ctx *web.Context, err error)
+
+	mu   sync.Mutex
+	disc *discovery
+	jwks *token.JWKS
+}
+
+// discovery OpenID 提供方的配置
+type discovery struct {
+	Issuer   string `json:"issuer"`
+	AuthURL  string `json:"authorization_endpoint"`
+	TokenURL string `json:"token_endpoint"`
+	JWKSURL  string `json:"jwks_uri"`
+}
+
+// tokenResponse token 接口的响应
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token"`
+	Error        string `json:"error"`
+	ErrorDesc    string `json:"error_description"`
+}
+
+// LoginHandler 跳转到身份提供方登录，查询参数 next 为登录后跳转的本站路径
+func (o *OIDC) LoginHandler(ctx *web.Context) {
+	disc, err := o.discover(ctx.R.Context())
+	if err != nil {
+		o.fail(ctx, err)
+		return
+	}
+	st := loginState{
+		State:    randomString(),
+		Nonce:    randomString(),
+		Verifier: randomString(),
+		Next:     safeNext(ctx.R.URL.Query().Get("next")),
+	}
+	value, err := json.Marshal(st)
+	if err != nil {
+		o.fail(ctx, err)
+		return
+	}
+	// 回调是身份提供方跳转过来的顶级导航，SameSite=Lax 时会带上 Cookie
+	http.SetCookie(ctx.W, &http.Cookie{
+		Name:     o.cookieName(),
+		Value:    base64.RawURLEncoding.EncodeToString(value),
+		Path:     "/",
+		MaxAge:   int(stateMaxAge.Seconds()),
+		Secure:   o.SecureCookie,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	challenge := sha256.Sum256([]byte(st.Verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.ClientID},
+		"redirect_uri":          {o.RedirectURL},
+		"scope":                 {strings.Join(o.scopes(), " ")},
+		"state":                 {st.State},
+		"nonce":                 {st.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(disc.AuthURL, "?") {
+		sep = "&"
+	}
+	_ = ctx.Redirect(http.StatusFound, disc.AuthURL+sep+q.Encode())
+}
+
+// CallbackHandler 处理身份提供方的回调：校验 state，用授权码换取 token，校验 ID token 后调用 OnLogin
+func (o *OIDC) CallbackHandler(ctx *web.Context) {
+	id, err := o.callback(ctx)
+	if err != nil {
+		o.fail(ctx, err)
+		return
+	}
+	if o.OnLogin == nil {
+		o.fail(ctx, errors.New("auth: OIDC.OnLogin is nil"))
+		return
+	}
+	if err := o.OnLogin(ctx, id); err != nil {
+		o.fail(ctx, err)
+	}
+}
+
+func (o *OIDC) callback(ctx *web.Context) (*Identity, error) {
+	q := ctx.R.URL.Query()
+	if e := q.Get("error"); e != "" {
+		return nil, fmt.Errorf("auth: oidc error %s: %s", e, q.Get("error_description"))
+	}
+	st, err := o.readState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// 登录状态只能使用一次
+	http.SetCookie(ctx.W, &http.Cookie{Name: o.cookieName(), Path: "/", MaxAge: -1, Secure: o.SecureCookie, HttpOnly: true})
+	if subtle.ConstantTimeCompare([]byte(st.State), []byte(q.Get("state"))) != 1 {
+		return nil, ErrState
+	}
+	code := q.Get("code")
+	if code == "" {
+		return nil, errors.New("auth: missing authorization code")
+	}
+	disc, err := o.discover(ctx.R.Context())
+	if err != nil {
+		return nil, err
+	}
+	tr, err := o.exchange(ctx.R.Context(), disc, code, st.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := o.VerifyIDToken(ctx.R.Context(), tr.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if nonce, _ := claims["nonce"].(string); subtle.ConstantTimeCompare([]byte(nonce), []byte(st.Nonce)) != 1 {
+		return nil, ErrNonce
+	}
+	id := &Identity{
+		Claims:       claims,
+		IDToken:      tr.IDToken,
+		AccessToken:  tr.AccessToken,
+		RefreshToken: tr.RefreshToken,
+		Next:         st.Next,
+	}
+	id.Subject, _ = claims["sub"].(string)
+	id.Email, _ = claims["email"].(string)
+	id.Name, _ = claims["name"].(string)
+	if id.Email == "" {
+		id.Email, _ = claims["preferred_username"].(string) // Azure AD 使用 preferred_username
+	}
+	return id, nil
+}
+
+// exchange 用授权码换取 token
+func (o *OIDC) exchange(ctx context.Context, disc *discovery, code, verifier string) (*tokenResponse, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.RedirectURL},
+		"client_id":     {o.ClientID},
+		"code_verifier": {verifier},
+	}
+	if o.ClientSecret != "" {
+		form.Set("client_secret", o.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, disc.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := o.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var tr tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return nil, fmt.Errorf("auth: decode token response: %w", err)
+	}
+	if tr.Error != "" {
+		return nil, fmt.Errorf("auth: token error %s: %s", tr.Error, tr.ErrorDesc)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("auth: token endpoint: %s", resp.Status)
+	}
+	if tr.IDToken == "" {
+		return nil, errors.New("auth: token response has no id_token, is the openid scope missing?")
+	}
+	return &tr, nil
+}
+
+// VerifyIDToken 校验 ID token 的签名、签发者、受众和有效期，返回 claims
+func (o *OIDC) VerifyIDToken(ctx context.Context, idToken string) (jwt.MapClaims, error) {
+	disc, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	o.mu.Lock()
+	if o.jwks == nil {
+		o.jwks = token.NewJWKS(disc.JWKSURL, 0)
+	}
+	jwks := o.jwks
+	o.mu.Unlock()
+
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(idToken, claims, jwks.Keyfunc); err != nil {
+		return nil, err
+	}
+	if !claims.VerifyIssuer(disc.Issuer, true) {
+		return nil, fmt.Errorf("auth: unexpected issuer %v", claims["iss"])
+	}
+	if !claims.VerifyAudience(o.ClientID, true) {
+		return nil, fmt.Errorf("auth: unexpected audience %v", claims["aud"])
+	}
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, errors.New("auth: id token has no exp")
+	}
+	return claims, nil
+}
+
+// discover 获取提供方的配置，手动设置的地址优先；失败时下次请求重试
+func (o *OIDC) discover(ctx context.Context) (*discovery, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.disc != nil {
+		return o.disc, nil
+	}
+	d := &discovery{Issuer: o.Issuer, AuthURL: o.AuthURL, TokenURL: o.TokenURL, JWKSURL: o.JWKSURL}
+	if d.AuthURL == "" || d.TokenURL == "" || d.JWKSURL == "" {
+		wellKnown := strings.TrimSuffix(o.Issuer, "/") + "/.well-known/openid-configuration"
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := o.client().Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("auth: fetch %s: %s", wellKnown, resp.Status)
+		}
+		var remote discovery
+		if err := json.NewDecoder(resp.Body).Decode(&remote); err != nil {
+			return nil, err
+		}
+		if remote.Issuer != "" && strings.TrimSuffix(remote.Issuer, "/") != strings.TrimSuffix(o.Issuer, "/") {
+			return nil, fmt.Errorf("auth: issuer mismatch %s != %s", remote.Issuer, o.Issuer)
+		}
+		if remote.Issuer != "" {
+			d.Issuer = remote.Issuer // 使用提供方返回的原始写法校验 iss
+		}
+		if d.AuthURL == "" {
+			d.AuthURL = remote.AuthURL
+		}
+		if d.TokenURL == "" {
+			d.TokenURL = remote.TokenURL
+		}
+		if d.JWKSURL == "" {
+			d.JWKSURL = remote.JWKSURL
+		}
+	}
+	if d.AuthURL == "" || d.TokenURL == "" || d.JWKSURL == "" {
+		return nil, errors.New("auth: incomplete oidc configuration")
+	}
+	o.disc = d
+	return d, nil
+}
+
+// loginState 登录时保存在 Cookie 中的状态
+type loginState struct {
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"`
+	Next     string `json:"r,omitempty"`
+}
+
+func (o *OIDC) readState(ctx *web.Context) (*loginState, error) {
+	cookie, err := ctx.R.Cookie(o.cookieName())
+	if err != nil {
+		return nil, ErrState
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return nil, ErrState
+	}
+	var st loginState
+	if err := json.Unmarshal(data, &st); err != nil || st.State == "" {
+		return nil, ErrState
+	}
+	return &st, nil
+}
+
+func (o *OIDC) fail(ctx *web.Context, err error) {
+	if o.ErrorHandler != nil {
+		o.ErrorHandler(ctx, err)
+		return
+	}
+	ctx.W.WriteHeader(http.StatusUnauthorized)
+}
+
+func (o *OIDC) scopes() []string {
+	if len(o.Scopes) == 0 {
+		return []string{"openid", "profile", "email"}
+	}
+	return o.Scopes
+}
+
+func (o *OIDC) cookieName() string {
+	if o.CookieName == "" {
+		return "web_oidc"
+	}
+	return o.CookieName
+}
+
+func (o *OIDC) client() *http.Client {
+	if o.HTTPClient == nil {
+		return &http.Client{Timeout: 10 * time.Second}
+	}
+	return o.HTTPClient
+}
+
+// randomString 生成随机字符串，用于 state、nonce 和 PKCE verifier
+func randomString() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// safeNext 只允许跳转到本站的路径，防止开放重定向
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return ""
+	}
+	return next
+}
+
+// JWTLogin OIDC 登录成功后用 j 签发本地的 jwt，claims 返回写入 token 的数据，为 nil 时写入 sub、email、name；
+// j.SendCookie 时 token 写入 Cookie 并跳转到 next（默认 /），否则以 json 返回 token
+func JWTLogin(j *token.JwtHandler, claims func(id *Identity) map[string]any) func(ctx *web.Context, id *Identity) error {
+	if claims == nil {
+		claims = func(id *Identity) map[string]any {
+			return map[string]any{"sub": id.Subject, "email": id.Email, "name": id.Name}
+		}
+	}
+	return func(ctx *web.Context, id *Identity) error {
+		jr, err := j.Issue(ctx, claims(id))
+		if err != nil {
+			return err
+		}
+		if !j.SendCookie {
+			return ctx.JSON(http.StatusOK, jr)
+		}
+		next := id.Next
+		if next == "" {
+			next = "/"
+		}
+		return ctx.Redirect(http.StatusFound, next)
+	}
+}
@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/ygb616/web"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeProvider 测试用的身份提供方，token 接口用 claims 签发 ID token
+type fakeProvider struct {
+	srv    *httptest.Server
+	key    *ecdsa.PrivateKey
+	claims func(nonce string) jwt.MapClaims
+
+	mu       sync.Mutex
+	nonce    string // 登录时的 nonce，由测试设置
+	verifier string // token 接口收到的 code_verifier
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		enc := base64.RawURLEncoding.EncodeToString
+		fmt.Fprintf(w, `{"keys":[{"kty":"EC","kid":"k1","use":"sig","crv":"P-256","x":%q,"y":%q}]}`,
+			enc(key.X.Bytes()), enc(key.Y.Bytes()))
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		p.mu.Lock()
+		p.verifier = r.PostForm.Get("code_verifier")
+		nonce := p.nonce
+		p.mu.Unlock()
+		tok := jwt.NewWithClaims(jwt.SigningMethodES256, p.claims(nonce))
+		tok.Header["kid"] = "k1"
+		signed, err := tok.SignedString(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"at","id_token":%q}`, signed)
+	})
+	p.srv = httptest.NewServer(mux)
+	t.Cleanup(p.srv.Close)
+	p.claims = func(nonce string) jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   p.srv.URL,
+			"aud":   "web",
+			"sub":   "u1",
+			"email": "u1@example.com",
+			"nonce": nonce,
+			"exp":   time.Now().Add(time.Minute).Unix(),
+		}
+	}
+	return p
+}
+
+// oidc 返回使用该提供方的客户端，登录失败时把错误写入 *errp
+func (p *fakeProvider) oidc(errp *error, id **Identity) *OIDC {
+	return &OIDC{
+		Issuer:      p.srv.URL,
+		ClientID:    "web",
+		RedirectURL: "https://app.example.com/auth/callback",
+		AuthURL:     p.srv.URL + "/authorize",
+		TokenURL:    p.srv.URL + "/token",
+		JWKSURL:     p.srv.URL + "/jwks",
+		OnLogin: func(ctx *web.Context, identity *Identity) error {
+			*id = identity
+			return nil
+		},
+		ErrorHandler: func(ctx *web.Context, err error) {
+			*errp = err
+			ctx.W.WriteHeader(http.StatusUnauthorized)
+		},
+	}
+}
+
+// login 调用 LoginHandler，返回登录状态的 Cookie 和跳转到身份提供方的参数
+func login(t *testing.T, o *OIDC, next string) (*http.Cookie, url.Values) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	o.LoginHandler(&web.Context{W: w, R: httptest.NewRequest(http.MethodGet, "/auth/login?next="+url.QueryEscape(next), nil)})
+	if w.Code != http.StatusFound {
+		t.Fatalf("login status = %d, want %d", w.Code, http.StatusFound)
+	}
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("login set %d cookies, want 1", len(cookies))
+	}
+	return cookies[0], loc.Query()
+}
+
+// callback 以 state 回调 CallbackHandler
+func callback(o *OIDC, cookie *http.Cookie, state string) int {
+	r := httptest.NewRequest(http.MethodGet, "/auth/callback?code=abc&state="+url.QueryEscape(state), nil)
+	r.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	o.CallbackHandler(&web.Context{W: w, R: r})
+	return w.Code
+}
+
+func TestOIDCCallback(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   func(state string) string
+		nonce   func(nonce string) string
+		claims  func(c jwt.MapClaims)
+		wantErr error  // 期望的错误，wantMsg 为空时比较
+		wantMsg string // 期望错误信息中包含的内容
+	}{
+		{name: "ok"},
+		{name: "state mismatch", state: func(string) string { return "forged" }, wantErr: ErrState},
+		{name: "nonce mismatch", nonce: func(string) string { return "replayed" }, wantErr: ErrNonce},
+		{name: "wrong issuer", claims: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, wantMsg: "unexpected issuer"},
+		{name: "wrong audience", claims: func(c jwt.MapClaims) { c["aud"] = "other" }, wantMsg: "unexpected audience"},
+		{name: "missing exp", claims: func(c jwt.MapClaims) { delete(c, "exp") }, wantMsg: "no exp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newFakeProvider(t)
+			if tt.claims != nil {
+				base := p.claims
+				p.claims = func(nonce string) jwt.MapClaims {
+					c := base(nonce)
+					tt.claims(c)
+					return c
+				}
+			}
+			var err error
+			var id *Identity
+			o := p.oidc(&err, &id)
+			cookie, q := login(t, o, "/dashboard")
+			nonce, state := q.Get("nonce"), q.Get("state")
+			if tt.nonce != nil {
+				nonce = tt.nonce(nonce)
+			}
+			if tt.state != nil {
+				state = tt.state(state)
+			}
+			p.mu.Lock()
+			p.nonce = nonce
+			p.mu.Unlock()
+
+			code := callback(o, cookie, state)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantMsg != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantMsg) {
+					t.Fatalf("err = %v, want containing %q", err, tt.wantMsg)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("callback failed: %v", err)
+				}
+				if id == nil || id.Subject != "u1" || id.Email != "u1@example.com" || id.Next != "/dashboard" {
+					t.Fatalf("identity = %+v", id)
+				}
+				return
+			}
+			if code != http.StatusUnauthorized || id != nil {
+				t.Fatalf("failed login: status = %d, identity = %+v", code, id)
+			}
+		})
+	}
+}
+
+// TestOIDCSendsPKCEVerifier token 接口收到的 code_verifier 与登录时的 code_challenge 对应
+func TestOIDCSendsPKCEVerifier(t *testing.T) {
+	p := newFakeProvider(t)
+	var err error
+	var id *Identity
+	o := p.oidc(&err, &id)
+	cookie, q := login(t, o, "")
+	if q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("code_challenge_method = %q, want S256", q.Get("code_challenge_method"))
+	}
+	p.mu.Lock()
+	p.nonce = q.Get("nonce")
+	p.mu.Unlock()
+	callback(o, cookie, q.Get("state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.mu.Lock()
+	verifier := p.verifier
+	p.mu.Unlock()
+	sum := sha256.Sum256([]byte(verifier))
+	if verifier == "" || base64.RawURLEncoding.EncodeToString(sum[:]) != q.Get("code_challenge") {
+		t.Fatalf("code_verifier %q does not match code_challenge %q", verifier, q.Get("code_challenge"))
+	}
+}
+
+func TestSafeNext(t *testing.T) {
+	tests := []struct {
+		next string
+		want string
+	}{
+		{"/dashboard?tab=1", "/dashboard?tab=1"},
+		{"", ""},
+		{"https://evil.example.com", ""},
+		{"//evil.example.com", ""},
+		{"/\\evil.example.com", ""},
+		{"evil", ""},
+	}
+	for _, tt := range tests {
+		if got := safeNext(tt.next); got != tt.want {
+			t.Errorf("safeNext(%q) = %q, want %q", tt.next, got, tt.want)
+		}
+	}
+}
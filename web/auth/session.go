@@ -0,0 +1,424 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ygb616/web"
+	"github.com/ygb616/web/internal/redis"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SessionKey SessionAuth.Interceptor 把当前会话保存到上下文中使用的 key
+const SessionKey = "auth_session"
+
+// ErrNoSession 没有登录、会话不存在或已经过期
+var ErrNoSession = errors.New("auth: no valid session")
+
+// Session 登录会话，保存在服务端，Cookie 中只有会话 ID
+type Session struct {
+	ID        string         `json:"id"`
+	UserID    string         `json:"uid"`
+	Values    map[string]any `json:"values,omitempty"`
+	CreatedAt time.Time      `json:"created"`
+	LastSeen  time.Time      `json:"seen"`
+}
+
+// SessionStore 会话存储
+type SessionStore interface {
+	// Get 获取会话，不存在时返回 (nil, nil)
+	Get(ctx context.Context, id string) (*Session, error)
+	// Save 保存会话，ttl 后过期
+	Save(ctx context.Context, s *Session, ttl time.Duration) error
+	// Delete 删除会话
+	Delete(ctx context.Context, id string) error
+	// DeleteUser 删除用户的所有会话，用于在所有设备上退出登录
+	DeleteUser(ctx context.Context, userID string) error
+}
+
+// SessionAuth 基于 Cookie 会话的登录，适合服务端渲染的应用，是 jwt 之外的另一种登录方式：
+//
+//	sa := &auth.SessionAuth{Store: auth.NewMemorySessionStore(), Authenticator: checkPassword}
+//	engine.Post("/login", func(ctx *web.Context) { ... sa.LoginHandler(ctx) ... })
+//	g.Use(sa.Interceptor)
+type SessionAuth struct {
+	Store SessionStore
+	// Authenticator 校验登录请求，返回用户 ID 和保存到会话中的数据
+	Authenticator func(ctx *web.Context) (userID string, values map[string]any, err error)
+
+	IdleTimeout     time.Duration // 空闲超时，超过这段时间没有请求需要重新登录，默认 30 分钟
+	AbsoluteTimeout time.Duration // 绝对超时，登录后超过这段时间需要重新登录，默认 24 小时
+
+	CookieName   string // 默认 web_session
+	CookieDomain string
+	SecureCookie bool
+	SameSite     http.SameSite // 默认 Lax
+
+	// ErrorHandler Interceptor 中没有有效会话时的处理函数，默认返回 401
+	ErrorHandler func(ctx *web.Context, err error)
+}
+
+// LoginHandler 调用 Authenticator 校验登录请求，成功后创建新的会话
+func (sa *SessionAuth) LoginHandler(ctx *web.Context) (*Session, error) {
+	userID, values, err := sa.Authenticator(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return sa.Login(ctx, userID, values)
+}
+
+// Login 为已经认证的用户创建会话并写入 Cookie；登录前的会话会被删除，
+// 登录后总是使用新的会话 ID，防止会话固定攻击
+func (sa *SessionAuth) Login(ctx *web.Context, userID string, values map[string]any) (*Session, error) {
+	if cookie, err := ctx.R.Cookie(sa.cookieName()); err == nil && cookie.Value != "" {
+		_ = sa.Store.Delete(ctx.R.Context(), cookie.Value)
+	}
+	now := time.Now()
+	s := &Session{ID: randomString(), UserID: userID, Values: values, CreatedAt: now, LastSeen: now}
+	if err := sa.Store.Save(ctx.R.Context(), s, sa.ttl(s, now)); err != nil {
+		return nil, err
+	}
+	sa.setCookie(ctx, s.ID, int(sa.absoluteTimeout().Seconds()))
+	return s, nil
+}
+
+// LogoutHandler 删除当前会话和 Cookie
+func (sa *SessionAuth) LogoutHandler(ctx *web.Context) error {
+	sa.setCookie(ctx, "", -1)
+	cookie, err := ctx.R.Cookie(sa.cookieName())
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+	return sa.Store.Delete(ctx.R.Context(), cookie.Value)
+}
+
+// LogoutEverywhere 删除当前用户在所有设备上的会话
+func (sa *SessionAuth) LogoutEverywhere(ctx *web.Context) error {
+	s, err := sa.load(ctx)
+	sa.setCookie(ctx, "", -1)
+	if err != nil {
+		return nil
+	}
+	return sa.Store.DeleteUser(ctx.R.Context(), s.UserID)
+}
+
+// Interceptor 会话登录中间件，检查会话是否存在、是否超时，通过后保存到上下文中并延长空闲超时
+func (sa *SessionAuth) Interceptor(next web.HandlerFunc) web.HandlerFunc {
+	return func(ctx *web.Context) {
+		s, err := sa.load(ctx)
+		if err != nil {
+			if errors.Is(err, ErrNoSession) {
+				sa.setCookie(ctx, "", -1)
+			}
+			sa.fail(ctx, err)
+			return
+		}
+		// 距离上次保存超过空闲超时的 1/10 才写入，避免每个请求都写存储
+		now := time.Now()
+		if now.Sub(s.LastSeen) > sa.idleTimeout()/10 {
+			s.LastSeen = now
+			_ = sa.Store.Save(ctx.R.Context(), s, sa.ttl(s, now))
+		}
+		ctx.Set(SessionKey, s)
+		next(ctx)
+	}
+}
+
+// SessionFromCtx 返回 Interceptor 保存到上下文中的会话
+func SessionFromCtx(ctx *web.Context) (*Session, bool) {
+	v, ok := ctx.Get(SessionKey)
+	if !ok {
+		return nil, false
+	}
+	s, ok := v.(*Session)
+	return s, ok
+}
+
+// load 读取并校验当前请求的会话
+func (sa *SessionAuth) load(ctx *web.Context) (*Session, error) {
+	cookie, err := ctx.R.Cookie(sa.cookieName())
+	if err != nil || cookie.Value == "" {
+		return nil, ErrNoSession
+	}
+	s, err := sa.Store.Get(ctx.R.Context(), cookie.Value)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, ErrNoSession
+	}
+	now := time.Now()
+	if now.Sub(s.LastSeen) > sa.idleTimeout() || now.Sub(s.CreatedAt) > sa.absoluteTimeout() {
+		_ = sa.Store.Delete(ctx.R.Context(), s.ID)
+		return nil, ErrNoSession
+	}
+	return s, nil
+}
+
+// ttl 会话在存储中的有效期，取空闲超时和剩余的绝对超时中较小的
+func (sa *SessionAuth) ttl(s *Session, now time.Time) time.Duration {
+	ttl := sa.idleTimeout()
+	if remain := s.CreatedAt.Add(sa.absoluteTimeout()).Sub(now); remain < ttl {
+		ttl = remain
+	}
+	return ttl
+}
+
+func (sa *SessionAuth) setCookie(ctx *web.Context, value string, maxAge int) {
+	sameSite := sa.SameSite
+	if sameSite == 0 {
+		sameSite = http.SameSiteLaxMode
+	}
+	http.SetCookie(ctx.W, &http.Cookie{
+		Name:     sa.cookieName(),
+		Value:    value,
+		Path:     "/",
+		Domain:   sa.CookieDomain,
+		MaxAge:   maxAge,
+		Secure:   sa.SecureCookie,
+		HttpOnly: true,
+		SameSite: sameSite,
+	})
+}
+
+func (sa *SessionAuth) fail(ctx *web.Context, err error) {
+	if sa.ErrorHandler != nil {
+		sa.ErrorHandler(ctx, err)
+		return
+	}
+	if errors.Is(err, ErrNoSession) {
+		ctx.W.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	ctx.W.WriteHeader(http.StatusInternalServerError) // 读取会话存储失败
+}
+
+func (sa *SessionAuth) cookieName() string {
+	if sa.CookieName == "" {
+		return "web_session"
+	}
+	return sa.CookieName
+}
+
+func (sa *SessionAuth) idleTimeout() time.Duration {
+	if sa.IdleTimeout <= 0 {
+		return 30 * time.Minute
+	}
+	return sa.IdleTimeout
+}
+
+func (sa *SessionAuth) absoluteTimeout() time.Duration {
+	if sa.AbsoluteTimeout <= 0 {
+		return 24 * time.Hour
+	}
+	return sa.AbsoluteTimeout
+}
+
+// SessionLogin OIDC 登录成功后创建本地会话并跳转到 next（默认 /），会话中保存 email 和 name
+func SessionLogin(sa *SessionAuth) func(ctx *web.Context, id *Identity) error {
+	return func(ctx *web.Context, id *Identity) error {
+		if _, err := sa.Login(ctx, id.Subject, map[string]any{"email": id.Email, "name": id.Name}); err != nil {
+			return err
+		}
+		next := id.Next
+		if next == "" {
+			next = "/"
+		}
+		return ctx.Redirect(http.StatusFound, next)
+	}
+}
+
+// MemorySessionStore 进程内的 SessionStore，只适合单副本部署或测试，多副本使用 RedisSessionStore
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]memorySession
+	users    map[string]map[string]struct{}
+}
+
+type memorySession struct {
+	data   []byte // 保存序列化后的会话，调用方修改 Session 不影响存储
+	expiry time.Time
+}
+
+// NewMemorySessionStore 创建 MemorySessionStore
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]memorySession), users: make(map[string]map[string]struct{})}
+}
+
+func (m *MemorySessionStore) Get(_ context.Context, id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ms, ok := m.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	if !ms.expiry.After(time.Now()) {
+		m.remove(id)
+		return nil, nil
+	}
+	var s Session
+	if err := json.Unmarshal(ms.data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (m *MemorySessionStore) Save(_ context.Context, s *Session, ttl time.Duration) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[s.ID] = memorySession{data: data, expiry: time.Now().Add(ttl)}
+	ids, ok := m.users[s.UserID]
+	if !ok {
+		ids = make(map[string]struct{})
+		m.users[s.UserID] = ids
+	}
+	ids[s.ID] = struct{}{}
+	return nil
+}
+
+func (m *MemorySessionStore) Delete(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(id)
+	return nil
+}
+
+func (m *MemorySessionStore) DeleteUser(_ context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id := range m.users[userID] {
+		delete(m.sessions, id)
+	}
+	delete(m.users, userID)
+	return nil
+}
+
+// remove 删除会话，需要持有锁
+func (m *MemorySessionStore) remove(id string) {
+	ms, ok := m.sessions[id]
+	if !ok {
+		return
+	}
+	delete(m.sessions, id)
+	var s Session
+	if json.Unmarshal(ms.data, &s) == nil {
+		if ids := m.users[s.UserID]; ids != nil {
+			delete(ids, id)
+			if len(ids) == 0 {
+				delete(m.users, s.UserID)
+			}
+		}
+	}
+}
+
+// RedisClient 执行 Redis 命令，key 不存在时返回 (nil, nil)，用法同 breaker.RedisClient
+type RedisClient = redis.Client
+
+// RedisFunc 函数形式的 RedisClient
+type RedisFunc = redis.Func
+
+// RedisSessionStore 使用 Redis 保存会话，会话为 json 字符串，另外按用户保存会话 ID 的集合用于在所有设备上退出登录
+type RedisSessionStore struct {
+	Client RedisClient
+	Prefix string // key 的前缀，默认 session:
+}
+
+// NewRedisSessionStore 创建 RedisSessionStore
+func NewRedisSessionStore(client RedisClient) *RedisSessionStore {
+	return &RedisSessionStore{Client: client}
+}
+
+func (r *RedisSessionStore) prefix() string {
+	if r.Prefix == "" {
+		return "session:"
+	}
+	return r.Prefix
+}
+
+func (r *RedisSessionStore) key(id string) string {
+	return r.prefix() + id
+}
+
+func (r *RedisSessionStore) userKey(userID string) string {
+	return r.prefix() + "user:" + userID
+}
+
+func (r *RedisSessionStore) Get(ctx context.Context, id string) (*Session, error) {
+	v, err := r.Client.Do(ctx, "GET", r.key(id))
+	if err != nil || v == nil {
+		return nil, err
+	}
+	var data []byte
+	switch v := v.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return nil, fmt.Errorf("auth: unexpected redis reply %T", v)
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *RedisSessionStore) Save(ctx context.Context, s *Session, ttl time.Duration) error {
+	if ttl <= 0 {
+		return r.Delete(ctx, s.ID)
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if _, err := r.Client.Do(ctx, "SET", r.key(s.ID), string(data), "PX", ttl.Milliseconds()); err != nil {
+		return err
+	}
+	// 用户的会话集合使用较长的过期时间，集合中已经过期的会话 ID 在 DeleteUser 时一并删除
+	if _, err := r.Client.Do(ctx, "SADD", r.userKey(s.UserID), s.ID); err != nil {
+		return err
+	}
+	_, err = r.Client.Do(ctx, "PEXPIRE", r.userKey(s.UserID), (ttl + 24*time.Hour).Milliseconds())
+	return err
+}
+
+func (r *RedisSessionStore) Delete(ctx context.Context, id string) error {
+	s, err := r.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := r.Client.Do(ctx, "DEL", r.key(id)); err != nil {
+		return err
+	}
+	if s != nil {
+		_, err = r.Client.Do(ctx, "SREM", r.userKey(s.UserID), id)
+	}
+	return err
+}
+
+func (r *RedisSessionStore) DeleteUser(ctx context.Context, userID string) error {
+	v, err := r.Client.Do(ctx, "SMEMBERS", r.userKey(userID))
+	if err != nil {
+		return err
+	}
+	members, _ := v.([]any)
+	args := []any{"DEL", r.userKey(userID)}
+	for _, m := range members {
+		switch m := m.(type) {
+		case string:
+			args = append(args, r.key(m))
+		case []byte:
+			args = append(args, r.key(string(m)))
+		}
+	}
+	_, err = r.Client.Do(ctx, args...)
+	return err
+}
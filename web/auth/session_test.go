@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"context"
+	"github.com/ygb616/web"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ttlStore 记录最近一次 Save 的 ttl
+type ttlStore struct {
+	*MemorySessionStore
+	ttl time.Duration
+}
+
+func (s *ttlStore) Save(ctx context.Context, sess *Session, ttl time.Duration) error {
+	s.ttl = ttl
+	return s.MemorySessionStore.Save(ctx, sess, ttl)
+}
+
+// serve 带上会话 Cookie 请求经过 Interceptor 的处理函数，返回状态码和处理函数看到的会话
+func serve(sa *SessionAuth, id string) (int, *Session) {
+	var seen *Session
+	h := sa.Interceptor(func(ctx *web.Context) {
+		seen, _ = SessionFromCtx(ctx)
+	})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if id != "" {
+		r.AddCookie(&http.Cookie{Name: sa.cookieName(), Value: id})
+	}
+	w := httptest.NewRecorder()
+	h(&web.Context{W: w, R: r})
+	return w.Code, seen
+}
+
+// saveSession 直接写入一个登录时间和最近访问时间为指定值的会话
+func saveSession(t *testing.T, store SessionStore, created, seen time.Time) *Session {
+	t.Helper()
+	s := &Session{ID: randomString(), UserID: "u1", CreatedAt: created, LastSeen: seen}
+	if err := store.Save(context.Background(), s, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSessionInterceptorExpiry(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		created time.Time
+		seen    time.Time
+		want    int
+	}{
+		{"valid", now.Add(-time.Hour), now.Add(-time.Minute), http.StatusOK},
+		{"idle timeout", now.Add(-time.Hour), now.Add(-31 * time.Minute), http.StatusUnauthorized},
+		{"absolute timeout", now.Add(-25 * time.Hour), now.Add(-time.Minute), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemorySessionStore()
+			sa := &SessionAuth{Store: store}
+			s := saveSession(t, store, tt.created, tt.seen)
+			code, seen := serve(sa, s.ID)
+			if code != tt.want {
+				t.Fatalf("status = %d, want %d", code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				if seen != nil {
+					t.Fatal("handler ran for an expired session")
+				}
+				if got, _ := store.Get(context.Background(), s.ID); got != nil {
+					t.Fatal("expired session not deleted")
+				}
+			}
+		})
+	}
+}
+
+// TestSessionLoginIssuesNewID 登录时删除登录前的会话并使用新的会话 ID
+func TestSessionLoginIssuesNewID(t *testing.T) {
+	store := NewMemorySessionStore()
+	sa := &SessionAuth{Store: store}
+	old := saveSession(t, store, time.Now(), time.Now())
+	r := httptest.NewRequest(http.MethodPost, "/login", nil)
+	r.AddCookie(&http.Cookie{Name: sa.cookieName(), Value: old.ID})
+	w := httptest.NewRecorder()
+	s, err := sa.Login(&web.Context{W: w, R: r}, "u1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ID == old.ID {
+		t.Fatal("login reused the pre-login session id")
+	}
+	if got, _ := store.Get(context.Background(), old.ID); got != nil {
+		t.Fatal("pre-login session not deleted")
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != s.ID {
+		t.Fatalf("cookies = %v, want the new session id", cookies)
+	}
+	if code, _ := serve(sa, s.ID); code != http.StatusOK {
+		t.Fatalf("new session status = %d", code)
+	}
+}
+
+func TestSessionLogoutEverywhere(t *testing.T) {
+	store := NewMemorySessionStore()
+	sa := &SessionAuth{Store: store}
+	a := saveSession(t, store, time.Now(), time.Now())
+	b := saveSession(t, store, time.Now(), time.Now())
+	other := &Session{ID: randomString(), UserID: "u2", CreatedAt: time.Now(), LastSeen: time.Now()}
+	_ = store.Save(context.Background(), other, time.Hour)
+
+	r := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	r.AddCookie(&http.Cookie{Name: sa.cookieName(), Value: a.ID})
+	if err := sa.LogoutEverywhere(&web.Context{W: httptest.NewRecorder(), R: r}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{a.ID, b.ID} {
+		if code, _ := serve(sa, id); code != http.StatusUnauthorized {
+			t.Fatalf("session of the logged out user: status = %d", code)
+		}
+	}
+	if code, _ := serve(sa, other.ID); code != http.StatusOK {
+		t.Fatalf("session of another user: status = %d", code)
+	}
+}
+
+// TestSessionTTLClampedToAbsolute 存储中的有效期不超过剩余的绝对超时
+func TestSessionTTLClampedToAbsolute(t *testing.T) {
+	store := &ttlStore{MemorySessionStore: NewMemorySessionStore()}
+	sa := &SessionAuth{Store: store, IdleTimeout: 30 * time.Minute, AbsoluteTimeout: time.Hour}
+	now := time.Now()
+	s := saveSession(t, store, now.Add(-55*time.Minute), now.Add(-10*time.Minute))
+	if code, _ := serve(sa, s.ID); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if store.ttl <= 0 || store.ttl > 5*time.Minute {
+		t.Fatalf("ttl = %v, want at most the remaining 5m of the absolute timeout", store.ttl)
+	}
+}
@@ -0,0 +1,82 @@
+package web
+
+import (
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// argon2idHash 生成 PHC 格式的 argon2id 哈希，参数较小，只用于测试
+func argon2idHash(password string) string {
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte(password), salt, 1, 64, 1, 32)
+	return fmt.Sprintf("$argon2id$v=%d$m=64,t=1,p=1$%s$%s", argon2.Version,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+// basicAuthStatus 以 user、pass 请求 BasicAuth 保护的处理函数，返回状态码
+func basicAuthStatus(a *Accounts, user, pass string) int {
+	h := a.BasicAuth(func(ctx *Context) {
+		ctx.W.WriteHeader(http.StatusOK)
+	})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.SetBasicAuth(user, pass)
+	w := httptest.NewRecorder()
+	h(&Context{W: w, R: r})
+	return w.Code
+}
+
+func TestBasicAuthPasswordHashes(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		stored string
+	}{
+		{"plaintext", "secret"},
+		{"bcrypt", string(bcryptHash)},
+		{"argon2id", argon2idHash("secret")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Accounts{Users: map[string]string{"alice": tt.stored}}
+			if code := basicAuthStatus(a, "alice", "secret"); code != http.StatusOK {
+				t.Errorf("correct password: status = %d, want %d", code, http.StatusOK)
+			}
+			if code := basicAuthStatus(a, "alice", "wrong"); code != http.StatusUnauthorized {
+				t.Errorf("wrong password: status = %d, want %d", code, http.StatusUnauthorized)
+			}
+			if code := basicAuthStatus(a, "bob", "secret"); code != http.StatusUnauthorized {
+				t.Errorf("unknown user: status = %d, want %d", code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+// TestBasicAuthUnknownUserComparesPassword 用户不存在时也做一次哈希比较，耗时与密码错误时相近
+func TestBasicAuthUnknownUserComparesPassword(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &Accounts{Users: map[string]string{"alice": hash}}
+	elapsed := func(user string) time.Duration {
+		start := time.Now()
+		if code := basicAuthStatus(a, user, "wrong"); code != http.StatusUnauthorized {
+			t.Fatalf("%s: status = %d, want %d", user, code, http.StatusUnauthorized)
+		}
+		return time.Since(start)
+	}
+	known, unknown := elapsed("alice"), elapsed("bob")
+	// 没有比较时只需要几微秒，bcrypt 默认 cost 需要几十毫秒
+	if unknown < known/4 {
+		t.Fatalf("unknown user took %v, wrong password took %v: no dummy comparison", unknown, known)
+	}
+}
@@ -0,0 +1,49 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"golang.org/x/crypto/acme/autocert"
+	"net/http"
+)
+
+// DefaultAutoTLSCacheDir RunAutoTLS 默认保存证书的目录
+const DefaultAutoTLSCacheDir = "certs"
+
+// RunAutoTLS 使用 Let's Encrypt 自动申请和续期 domains 的证书，在 :443 上启动 HTTPS，
+// 同时在 :80 上响应 HTTP-01 验证，其他 HTTP 请求重定向到 HTTPS。
+// 证书保存在 AutoTLSCacheDir 中（默认 DefaultAutoTLSCacheDir），重启后复用，避免触发申请频率限制；
+// 需要自定义 ACME 服务、邮箱等时使用 RunAutoTLSManager。Shutdown 时两个端口都会关闭
+func (e *Engine) RunAutoTLS(domains ...string) error {
+	if len(domains) == 0 {
+		return errors.New("autotls: no domains")
+	}
+	dir := e.AutoTLSCacheDir
+	if dir == "" {
+		dir = DefaultAutoTLSCacheDir
+	}
+	return e.RunAutoTLSManager(&autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Cache:      autocert.DirCache(dir),
+	})
+}
+
+// RunAutoTLSManager 与 RunAutoTLS 相同，使用 m 管理证书
+func (e *Engine) RunAutoTLSManager(m *autocert.Manager) error {
+	challenge := &http.Server{Addr: ":http", Handler: m.HTTPHandler(nil)}
+	go func() {
+		if err := challenge.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.Logger.Error("autotls: " + err.Error())
+		}
+	}()
+	srv := &http.Server{Addr: ":https", Handler: e, TLSConfig: m.TLSConfig()}
+	srv.RegisterOnShutdown(func() {
+		_ = challenge.Shutdown(context.Background())
+	})
+	err := e.RunServer(srv)
+	if err != nil {
+		_ = challenge.Close() // HTTPS 启动失败时不再保留 :80
+	}
+	return err
+}
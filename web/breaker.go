@@ -0,0 +1,51 @@
+package web
+
+import (
+	"github.com/ygb616/web/breaker"
+	"net/http"
+)
+
+// Breaker 返回熔断中间件，每个路由一个熔断器，一个路由依赖的下游故障时不影响同一组的其他路由；
+// 处理函数 panic 或响应 5xx 时计为失败，熔断打开时不再执行处理函数，调用 degrade 返回降级响应，
+// degrade 为 nil 时返回 503。熔断器注册在 breaker.DefaultRegistry，名称为路由，settings.Name 不为空时作为前缀，
+// 同一个路由使用不同设置的多个 Breaker 时需要设置不同的 settings.Name；
+// 网关路由按网关配置名称区分。settings.Fallback 不使用，降级由 degrade 处理
+func Breaker(settings breaker.Settings, degrade HandlerFunc) MiddlewareFunc {
+	if degrade == nil {
+		degrade = func(ctx *Context) {
+			_ = ctx.JSON(http.StatusServiceUnavailable, map[string]any{
+				"code": http.StatusServiceUnavailable,
+				"msg":  "service unavailable",
+			})
+		}
+	}
+	st := settings
+	st.Fallback = nil
+	get := func(route string) *breaker.CircuitBreaker {
+		name := route
+		if settings.Name != "" {
+			name = settings.Name + " " + route
+		}
+		return breaker.Get(name, st)
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) {
+			route := ctx.FullPath()
+			if name, ok := ctx.Get(GatewayRouteKey); ok && route == "" {
+				route = name.(string)
+			}
+			done, err := get(route).Allow()
+			if err != nil {
+				degrade(ctx) // 熔断打开
+				return
+			}
+			success := false
+			defer func() {
+				done(success) // panic 时计为失败，继续向上抛出
+			}()
+			ctx.StatusCode = 0
+			next(ctx)
+			success = ctx.StatusCode < http.StatusInternalServerError
+		}
+	}
+}
@@ -1,11 +1,17 @@
 package breaker
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"time"
 )
 
+var (
+	ErrOpenState       = errors.New("断路器是打开状态") // 熔断打开，请求被拒绝
+	ErrTooManyRequests = errors.New("请求数量过多")   // 半开状态下请求数量超过 MaxRequests
+)
+
 // State 状态
 type State int
 
@@ -15,6 +21,18 @@ const (
 	StateOpen                  // 打开状态
 )
 
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	}
+	return "unknown"
+}
+
 // Counts 计数器结构体
 type Counts struct {
 	Requests             uint32 // 请求数量
@@ -22,6 +40,16 @@ type Counts struct {
 	TotalFailures        uint32 // 总失败数
 	ConsecutiveSuccesses uint32 // 连续成功数量
 	ConsecutiveFailures  uint32 // 连续失败数量
+	WindowRequests       uint32 // 滑动窗口内的请求数，设置了 Window 或 WindowSize 时统计
+	WindowFailures       uint32 // 滑动窗口内的失败数
+}
+
+// FailureRate 返回滑动窗口内的失败率，窗口内没有请求时返回 0
+func (c Counts) FailureRate() float64 {
+	if c.WindowRequests == 0 {
+		return 0
+	}
+	return float64(c.WindowFailures) / float64(c.WindowRequests)
 }
 
 // OnRequest 增加请求数量
@@ -50,6 +78,8 @@ func (c *Counts) Clear() {
 	c.ConsecutiveSuccesses = 0 // 连续成功数重置为零
 	c.TotalFailures = 0        // 总失败数重置为零
 	c.ConsecutiveFailures = 0  // 连续失败数重置为零
+	c.WindowRequests = 0       // 窗口请求数重置为零
+	c.WindowFailures = 0       // 窗口失败数重置为零
 }
 
 // Settings 熔断器设置
@@ -61,7 +91,28 @@ type Settings struct {
 	ReadyToTrip   func(counts Counts) bool                // 执行熔断
 	OnStateChange func(name string, from State, to State) // 状态变更回调
 	IsSuccessful  func(err error) bool                    // 判断是否成功
-	Fallback      func(err error) (any, error)            // 回退函数
+	Fallback      func(err error) (any, error)            // 回退函数，多级降级可以用 Chain(...).Untyped() 组合
+
+	// 滑动窗口，设置 Window 或 WindowSize 时，关闭状态下按窗口内的失败率熔断：
+	// 窗口内请求数达到 MinRequests 并且失败率达到 FailureRate 时打开，不再按 Interval 清空计数；
+	// 同时设置了 ReadyToTrip 时使用 ReadyToTrip，可以通过 Counts.WindowRequests、Counts.FailureRate 自定义
+	Window        time.Duration // 按时间滑动的窗口时长，如 10 秒
+	WindowBuckets int           // 时间窗口分成多少个桶，默认 10，桶越多滑动越平滑
+	WindowSize    uint32        // 按请求数滑动的窗口，统计最近 WindowSize 个请求，设置了 Window 时不使用
+	MinRequests   uint32        // 窗口内最少的请求数，请求太少时失败率没有意义，默认 20
+	FailureRate   float64       // 失败率阈值，0 到 1，默认 0.5
+
+	// 半开状态的探测，设置后半开状态下同时最多 HalfOpenMaxProbes 个请求，两个请求之间至少间隔 ProbeInterval，
+	// 少量请求逐个试探恢复中的依赖，不会一下子全部涌过去；连续成功 MaxRequests 次后关闭。
+	// 都不设置时半开状态下最多允许 MaxRequests 个请求，不限制间隔
+	HalfOpenMaxProbes uint32        // 同时进行的探测请求数，默认 1
+	ProbeInterval     time.Duration // 两次探测之间的最小间隔
+
+	CallTimeout time.Duration // ExecuteCtx 每次调用的超时时间，超时计为失败，为 0 时只使用 ctx 的 deadline
+
+	// 多个副本共享熔断状态，为 nil 时只在本进程内熔断；同一个依赖在所有副本中的熔断器名称需要相同
+	Store        Store
+	SyncInterval time.Duration // 从 Store 同步状态的间隔，默认 1 秒
 }
 
 // CircuitBreaker 断路器
@@ -80,26 +131,118 @@ type CircuitBreaker struct {
 	counts     Counts                       // 计数器，记录请求数量和成功失败情况
 	expiry     time.Time                    // 到期时间，用于检查是否从开到半开
 	fallback   func(err error) (any, error) // 回退函数，当请求失败时调用
+	window     *rollingWindow               // 滑动窗口，为 nil 时不统计
+	since      time.Time                    // 进入当前状态的时间
+	totals     totals                       // 累计的统计，不随代数清空
+
+	maxProbes     uint32           // 半开状态下同时进行的探测请求数，为 0 时按 maxRequests 限制请求总数
+	probeInterval time.Duration    // 两次探测之间的最小间隔
+	probing       uint32           // 正在进行的探测请求数
+	lastProbe     time.Time        // 最近一次探测的时间
+	callTimeout   time.Duration    // ExecuteCtx 每次调用的超时时间
+	forced        bool             // 手动打开或关闭，不再自动变更状态
+	now           func() time.Time // 当前时间，测试时替换
+
+	store        Store         // 共享熔断状态的存储
+	syncInterval time.Duration // 从 store 同步状态的间隔
+	sharedUntil  time.Time     // 最近一次从 store 同步到的打开到的时间
+	lastSync     time.Time     // 最近一次同步的时间
+	syncing      bool          // 是否正在同步
+}
+
+// totals 熔断器创建以来累计的请求统计
+type totals struct {
+	requests  uint64
+	successes uint64
+	failures  uint64
+	rejected  uint64
+}
+
+// Snapshot 熔断器当前的状态和统计
+type Snapshot struct {
+	Name      string
+	State     State
+	Since     time.Time // 进入当前状态的时间
+	Counts    Counts    // 当前代的计数
+	Requests  uint64    // 累计允许的请求数
+	Successes uint64    // 累计成功数
+	Failures  uint64    // 累计失败数
+	Rejected  uint64    // 累计被拒绝的请求数，熔断打开或半开状态下请求过多
+	Forced    bool      // 是否手动打开或关闭
+}
+
+// Snapshot 返回熔断器当前的状态和统计
+func (cb *CircuitBreaker) Snapshot() Snapshot {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	state, _ := cb.currentState(cb.now())
+	return Snapshot{
+		Name:      cb.name,
+		State:     state,
+		Since:     cb.since,
+		Counts:    cb.counts,
+		Requests:  cb.totals.requests,
+		Successes: cb.totals.successes,
+		Failures:  cb.totals.failures,
+		Rejected:  cb.totals.rejected,
+		Forced:    cb.forced,
+	}
+}
+
+// ForceOpen 手动打开熔断器，一直保持打开，直到 ForceClose 或 Reset，用于故障时主动切断对依赖的请求
+func (cb *CircuitBreaker) ForceOpen() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.forced = true
+	cb.setState(StateOpen)
+}
+
+// ForceClose 手动关闭熔断器，失败不再触发熔断，直到 Reset
+func (cb *CircuitBreaker) ForceClose() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.forced = true
+	cb.setState(StateClosed)
+}
+
+// Reset 取消手动设置，恢复为关闭状态并清空计数
+func (cb *CircuitBreaker) Reset() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.forced = false
+	cb.setState(StateClosed)
+	cb.newGeneration()
+	cb.resetShared()
 }
 
 // NewGeneration 创建新的代数并清除计数器
 func (cb *CircuitBreaker) NewGeneration() {
 	cb.mutex.Lock()         // 加锁，防止并发访问
 	defer cb.mutex.Unlock() // 函数退出时解锁
-	cb.generation++         // 增加当前代数
-	cb.counts.Clear()       // 清空计数器
+	cb.newGeneration()
+}
+
+// newGeneration 创建新的代数并清除计数器，需要持有锁
+func (cb *CircuitBreaker) newGeneration() {
+	cb.generation++   // 增加当前代数
+	cb.counts.Clear() // 清空计数器
+	if cb.window != nil {
+		cb.window.reset() // 状态变更后重新统计，半开恢复后不会因为之前的失败立即打开
+	}
+	cb.probing = 0
+	cb.lastProbe = time.Time{}
 	var zero time.Time
 	switch cb.state {
 	case StateClosed:
-		// 如果状态为关闭，根据 interval 设置到期时间
-		if cb.interval == 0 {
+		// 如果状态为关闭，根据 interval 设置到期时间，使用滑动窗口时不需要定期清空
+		if cb.interval == 0 || cb.window != nil {
 			cb.expiry = zero
 		} else {
-			cb.expiry = time.Now().Add(cb.interval)
+			cb.expiry = cb.now().Add(cb.interval)
 		}
 	case StateOpen:
 		// 如果状态为打开，根据 timeout 设置到期时间
-		cb.expiry = time.Now().Add(cb.timeout)
+		cb.expiry = cb.now().Add(cb.timeout)
 	case StateHalfOpen:
 		// 如果状态为半开，设置到期时间为零
 		cb.expiry = zero
@@ -112,6 +255,7 @@ func NewCircuitBreaker(st Settings) *CircuitBreaker {
 	cb.name = st.Name                   // 设置断路器的名称
 	cb.onStateChange = st.OnStateChange // 设置状态变更回调函数
 	cb.fallback = st.Fallback           // 设置回退函数
+	cb.now = time.Now
 
 	// 设置最大请求数，默认为 1
 	if st.MaxRequests == 0 {
@@ -134,8 +278,44 @@ func NewCircuitBreaker(st Settings) *CircuitBreaker {
 		cb.timeout = st.Timeout
 	}
 
-	// 设置熔断条件，默认为连续失败次数大于 5
-	if st.ReadyToTrip == nil {
+	cb.callTimeout = st.CallTimeout
+	cb.store = st.Store
+	cb.syncInterval = st.SyncInterval
+	if cb.syncInterval <= 0 {
+		cb.syncInterval = time.Second
+	}
+
+	// 设置半开状态的探测
+	cb.probeInterval = st.ProbeInterval
+	cb.maxProbes = st.HalfOpenMaxProbes
+	if cb.maxProbes == 0 && cb.probeInterval > 0 {
+		cb.maxProbes = 1
+	}
+
+	// 设置滑动窗口
+	if st.Window > 0 {
+		buckets := st.WindowBuckets
+		if buckets <= 0 {
+			buckets = 10
+		}
+		cb.window = newTimeWindow(st.Window, buckets)
+	} else if st.WindowSize > 0 {
+		cb.window = newCountWindow(st.WindowSize)
+	}
+
+	// 设置熔断条件，默认为连续失败次数大于 5，设置了滑动窗口时默认按失败率
+	if st.ReadyToTrip == nil && cb.window != nil {
+		minRequests, failureRate := st.MinRequests, st.FailureRate
+		if minRequests == 0 {
+			minRequests = 20
+		}
+		if failureRate <= 0 {
+			failureRate = 0.5
+		}
+		cb.readyToTrip = func(counts Counts) bool {
+			return counts.WindowRequests >= minRequests && counts.FailureRate() >= failureRate
+		}
+	} else if st.ReadyToTrip == nil {
 		cb.readyToTrip = func(counts Counts) bool {
 			return counts.ConsecutiveFailures > 5
 		}
@@ -152,7 +332,8 @@ func NewCircuitBreaker(st Settings) *CircuitBreaker {
 		cb.isSuccessful = st.IsSuccessful
 	}
 
-	cb.NewGeneration() // 初始化新的代数
+	cb.since = cb.now()
+	cb.newGeneration() // 初始化新的代数
 	return cb          // 返回断路器实例
 }
 
@@ -168,44 +349,180 @@ func (cb *CircuitBreaker) Execute(req func() (any, error)) (any, error) {
 		return nil, err
 	}
 
+	// 请求函数 panic 时计为失败，继续向上抛出
+	defer func() {
+		if e := recover(); e != nil {
+			cb.afterRequest(generation, false)
+			panic(e)
+		}
+	}()
+
 	// 执行请求函数
 	result, err := req()
-	cb.counts.OnRequest() // 增加请求计数
 
 	// 请求之后，判断是否需要变更断路器状态
 	cb.afterRequest(generation, cb.isSuccessful(err))
 	return result, err
 }
 
+// ExecuteCtx 与 Execute 相同，请求函数接收 ctx，并且限制执行时间：设置了 CallTimeout 时每次调用最多执行 CallTimeout，
+// ctx 的 deadline 更早时使用 ctx 的；超时时不再等待请求函数，立即返回 context.DeadlineExceeded 并计为失败，
+// 响应慢的依赖和返回错误的依赖一样会触发熔断。请求函数应该在 ctx 结束时尽快返回，否则会在后台继续执行；
+// 调用方取消 ctx（context.Canceled）时不计为成功也不计为失败
+func (cb *CircuitBreaker) ExecuteCtx(ctx context.Context, req func(ctx context.Context) (any, error)) (any, error) {
+	err, generation := cb.beforeRequest()
+	if err != nil {
+		// 如果断路器打开或请求过多，执行回退函数
+		if cb.fallback != nil {
+			return cb.fallback(err)
+		}
+		return nil, err
+	}
+	if cb.callTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cb.callTimeout)
+		defer cancel()
+	}
+
+	type outcome struct {
+		result any
+		err    error
+		panic  any
+	}
+	var o outcome
+	if ctx.Done() == nil {
+		// 没有 deadline 也不会被取消，直接执行
+		func() {
+			defer func() {
+				o.panic = recover()
+			}()
+			o.result, o.err = req(ctx)
+		}()
+	} else {
+		ch := make(chan outcome, 1)
+		go func() {
+			var o outcome
+			defer func() {
+				o.panic = recover()
+				ch <- o
+			}()
+			o.result, o.err = req(ctx)
+		}()
+		select {
+		case o = <-ch:
+		case <-ctx.Done():
+			o.err = ctx.Err() // 不再等待请求函数
+		}
+	}
+
+	switch {
+	case o.panic != nil:
+		cb.afterRequest(generation, false)
+		panic(o.panic) // 请求函数 panic 时计为失败，继续向上抛出
+	case errors.Is(o.err, context.DeadlineExceeded):
+		cb.afterRequest(generation, false)
+	case errors.Is(o.err, context.Canceled) && ctx.Err() == context.Canceled:
+		cb.release(generation)
+	default:
+		cb.afterRequest(generation, cb.isSuccessful(o.err))
+	}
+	return o.result, o.err
+}
+
+// release 结束一个不计结果的请求，释放半开状态下占用的探测名额
+func (cb *CircuitBreaker) release(before uint64) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	state, generation := cb.currentState(cb.now())
+	if generation == before && state == StateHalfOpen && cb.probing > 0 {
+		cb.probing--
+	}
+}
+
+// Allow 两步调用，先判断是否允许请求，请求结束后调用 done 报告结果，不需要把请求包装成函数，
+// 适合流式处理、代理、拦截器等在别处才知道结果的场景：
+//
+//	done, err := cb.Allow()
+//	if err != nil {
+//		return degrade() // 熔断打开
+//	}
+//	resp, err := call()
+//	done(err == nil)
+//
+// 允许请求时 done 必须调用并且只能调用一次，否则半开状态下的请求数一直不会释放；
+// 成功与否由调用方判断，不使用 Settings.IsSuccessful，也不调用 Fallback
+func (cb *CircuitBreaker) Allow() (done func(success bool), err error) {
+	err, generation := cb.beforeRequest()
+	if err != nil {
+		return nil, err
+	}
+	return func(success bool) {
+		cb.afterRequest(generation, success)
+	}, nil
+}
+
 // beforeRequest 在请求执行前判断断路器的当前状态并进行处理
 func (cb *CircuitBreaker) beforeRequest() (error, uint64) {
-	now := time.Now()
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	now := cb.now()
 	state, generation := cb.currentState(now) // 获取当前断路器状态及代数
+	if state == StateClosed && cb.store != nil {
+		// 其他副本已经打开时同时打开
+		cb.syncShared(now)
+		state, generation = cb.state, cb.generation
+	}
 
 	// 如果断路器是打开状态，返回错误
 	if state == StateOpen {
-		return errors.New("断路器是打开状态"), generation
+		cb.totals.rejected++
+		return ErrOpenState, generation
 	}
 
-	// 如果断路器是半开状态且请求数量超过最大请求数，返回错误
+	// 如果断路器是半开状态且请求数量达到最大请求数，返回错误
 	if state == StateHalfOpen {
-		if cb.counts.Requests > cb.maxRequests {
-			return errors.New("请求数量过多"), generation
+		if cb.maxProbes > 0 {
+			// 探测请求太多或距离上一次探测太近
+			if cb.probing >= cb.maxProbes || now.Sub(cb.lastProbe) < cb.probeInterval {
+				cb.totals.rejected++
+				return ErrTooManyRequests, generation
+			}
+			cb.probing++
+			cb.lastProbe = now
+		} else if cb.counts.Requests >= cb.maxRequests {
+			cb.totals.rejected++
+			return ErrTooManyRequests, generation
 		}
 	}
 
+	cb.counts.OnRequest() // 增加请求计数
+	cb.totals.requests++
 	// 返回 nil 表示可以继续请求
 	return nil, generation
 }
 
 // afterRequest 在请求执行后，根据请求结果（成功或失败）更新断路器的状态
 func (cb *CircuitBreaker) afterRequest(before uint64, success bool) {
-	now := time.Now()
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	now := cb.now()
 	state, generation := cb.currentState(now) // 获取当前断路器状态及代数
+	if success {
+		cb.totals.successes++
+	} else {
+		cb.totals.failures++
+	}
 	if generation != before {
 		// 如果当前代数与请求之前的代数不同，直接返回
 		return
 	}
+	if state == StateHalfOpen && cb.probing > 0 {
+		cb.probing--
+	}
+	if cb.window != nil && state == StateClosed {
+		cb.window.add(now, !success)
+		cb.counts.WindowRequests, cb.counts.WindowFailures = cb.window.sum(now)
+	}
 	if success {
 		// 请求成功，调用 OnSuccess 更新断路器状态
 		cb.OnSuccess(state)
@@ -215,19 +532,34 @@ func (cb *CircuitBreaker) afterRequest(before uint64, success bool) {
 	}
 }
 
-// currentState 获取断路器的当前状态及代数
+// State 返回断路器的当前状态
+func (cb *CircuitBreaker) State() State {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	state, _ := cb.currentState(cb.now())
+	return state
+}
+
+// Name 返回断路器的名字
+func (cb *CircuitBreaker) Name() string {
+	return cb.name
+}
+
+// currentState 获取断路器的当前状态及代数，需要持有锁
 func (cb *CircuitBreaker) currentState(now time.Time) (State, uint64) {
 	switch cb.state {
 	case StateClosed:
 		// 如果断路器是关闭状态，检查是否需要开启新的一代
 		if !cb.expiry.IsZero() && cb.expiry.Before(now) {
-			cb.NewGeneration() // 开启新的一代
+			cb.newGeneration() // 开启新的一代
 		}
 	case StateOpen:
-		// 如果断路器是打开状态，检查是否需要变为半开状态
-		if cb.expiry.Before(now) {
-			cb.SetState(StateHalfOpen) // 设置为半开状态
+		// 如果断路器是打开状态，检查是否需要变为半开状态，手动打开时保持打开
+		if !cb.forced && cb.expiry.Before(now) {
+			cb.setState(StateHalfOpen) // 设置为半开状态
 		}
+	case StateHalfOpen:
+		// 半开状态由请求结果决定变为关闭或打开
 	default:
 		// 如果遇到未处理的状态，抛出异常
 		panic("unhandled default case")
@@ -235,15 +567,24 @@ func (cb *CircuitBreaker) currentState(now time.Time) (State, uint64) {
 	return cb.state, cb.generation
 }
 
-// SetState 设置断路器的状态
+// SetState 设置断路器的状态，可以用于手动打开或关闭断路器
 func (cb *CircuitBreaker) SetState(target State) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.setState(target)
+}
+
+// setState 设置断路器的状态，需要持有锁
+func (cb *CircuitBreaker) setState(target State) {
 	if cb.state == target {
 		return // 如果目标状态与当前状态相同，直接返回
 	}
 	before := cb.state // 记录状态变更前的状态
 	cb.state = target  // 设置新的目标状态
+	cb.since = cb.now()
 	// 状态变更之后，重新计数
-	cb.NewGeneration()
+	cb.newGeneration()
+	publish(StateChange{Name: cb.name, From: before, To: target, At: cb.since})
 
 	if cb.onStateChange != nil {
 		// 如果设置了状态变更回调函数，调用该函数
@@ -251,33 +592,35 @@ func (cb *CircuitBreaker) SetState(target State) {
 	}
 }
 
-// OnSuccess 处理成功的请求，根据状态进行处理
+// OnSuccess 处理成功的请求，根据状态进行处理，需要持有锁
 func (cb *CircuitBreaker) OnSuccess(state State) {
 	switch state {
 	case StateClosed:
 		cb.counts.OnSuccess() // 记录成功请求
 	case StateHalfOpen:
 		cb.counts.OnSuccess() // 记录成功请求
-		// 如果连续成功请求数大于最大请求数，关闭断路器
-		if cb.counts.ConsecutiveSuccesses > cb.maxRequests {
-			cb.SetState(StateClosed) // 设置断路器为关闭状态
+		// 如果连续成功请求数达到最大请求数，关闭断路器
+		if cb.counts.ConsecutiveSuccesses >= cb.maxRequests {
+			cb.setState(StateClosed) // 设置断路器为关闭状态
 		}
 	default:
 		panic("unhandled default case") // 未处理的状态抛出异常
 	}
 }
 
-// OnFail 处理失败的请求，根据状态进行处理
+// OnFail 处理失败的请求，根据状态进行处理，需要持有锁
 func (cb *CircuitBreaker) OnFail(state State) {
 	switch state {
 	case StateClosed:
 		cb.counts.OnFail() // 记录失败请求
-		// 如果满足触发熔断的条件，打开断路器
-		if cb.readyToTrip(cb.counts) {
-			cb.SetState(StateOpen) // 设置断路器为打开状态
+		// 如果满足触发熔断的条件，打开断路器，手动关闭时不打开
+		if !cb.forced && cb.readyToTrip(cb.counts) {
+			cb.setState(StateOpen) // 设置断路器为打开状态
+			cb.tripShared()
 		}
 	case StateHalfOpen:
-		cb.SetState(StateOpen) // 半开状态下，失败则打开断路器
+		cb.setState(StateOpen) // 半开状态下，失败则打开断路器
+		cb.tripShared()
 	default:
 		panic("unhandled default case") // 未处理的状态抛出异常
 	}
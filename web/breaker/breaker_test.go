@@ -0,0 +1,148 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeClock 手动推进的时钟
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.t }
+
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// newTestBreaker 创建使用 fakeClock 的熔断器
+func newTestBreaker(st Settings) (*CircuitBreaker, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1_000_000, 0)}
+	cb := NewCircuitBreaker(st)
+	cb.mutex.Lock()
+	cb.now = clock.Now
+	cb.since = clock.Now()
+	cb.newGeneration()
+	cb.mutex.Unlock()
+	return cb, clock
+}
+
+// call 发起一个请求并报告结果，熔断器拒绝时返回错误
+func call(cb *CircuitBreaker, success bool) error {
+	done, err := cb.Allow()
+	if err != nil {
+		return err
+	}
+	done(success)
+	return nil
+}
+
+func expectState(t *testing.T, cb *CircuitBreaker, want State) {
+	t.Helper()
+	if got := cb.State(); got != want {
+		t.Fatalf("state = %v, want %v", got, want)
+	}
+}
+
+// TestSlidingWindowTrip 窗口内请求数达到 MinRequests 且失败率达到 FailureRate 时打开，过期的桶不计入
+func TestSlidingWindowTrip(t *testing.T) {
+	cb, clock := newTestBreaker(Settings{
+		Window:        10 * time.Second,
+		WindowBuckets: 10,
+		MinRequests:   4,
+		FailureRate:   0.5,
+		Timeout:       5 * time.Second,
+	})
+
+	// 请求数不够时不打开
+	for i := 0; i < 3; i++ {
+		_ = call(cb, false)
+	}
+	expectState(t, cb, StateClosed)
+
+	// 之前的失败滑出窗口后，失败率低于阈值不打开
+	clock.Advance(11 * time.Second)
+	_ = call(cb, true)
+	_ = call(cb, true)
+	_ = call(cb, true)
+	_ = call(cb, false)
+	expectState(t, cb, StateClosed)
+
+	// 窗口内 6 个请求 3 个失败，达到 50%
+	_ = call(cb, false)
+	expectState(t, cb, StateClosed)
+	_ = call(cb, false)
+	expectState(t, cb, StateOpen)
+	if err := call(cb, true); !errors.Is(err, ErrOpenState) {
+		t.Fatalf("open breaker allowed a request: %v", err)
+	}
+
+	// Timeout 之后半开，探测成功后关闭，窗口重新统计
+	clock.Advance(5*time.Second + time.Millisecond)
+	expectState(t, cb, StateHalfOpen)
+	if err := call(cb, true); err != nil {
+		t.Fatal(err)
+	}
+	expectState(t, cb, StateClosed)
+	_ = call(cb, false)
+	expectState(t, cb, StateClosed)
+
+	// 再次打开后，半开状态下探测失败重新打开
+	for i := 0; i < 3; i++ {
+		_ = call(cb, false)
+	}
+	expectState(t, cb, StateOpen)
+	clock.Advance(5*time.Second + time.Millisecond)
+	expectState(t, cb, StateHalfOpen)
+	_ = call(cb, false)
+	expectState(t, cb, StateOpen)
+}
+
+// TestHalfOpenPacedProbes 半开状态下同时最多 HalfOpenMaxProbes 个探测，两次探测之间至少间隔 ProbeInterval，
+// 连续成功 MaxRequests 次后关闭
+func TestHalfOpenPacedProbes(t *testing.T) {
+	cb, clock := newTestBreaker(Settings{
+		MaxRequests:       2,
+		Timeout:           time.Second,
+		HalfOpenMaxProbes: 1,
+		ProbeInterval:     100 * time.Millisecond,
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.ConsecutiveFailures >= 1
+		},
+	})
+	_ = call(cb, false)
+	expectState(t, cb, StateOpen)
+	clock.Advance(time.Second + time.Millisecond)
+	expectState(t, cb, StateHalfOpen)
+
+	done, err := cb.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 已经有一个探测在进行
+	clock.Advance(50 * time.Millisecond)
+	if _, err := cb.Allow(); !errors.Is(err, ErrTooManyRequests) {
+		t.Fatalf("second concurrent probe: err = %v, want %v", err, ErrTooManyRequests)
+	}
+	done(true)
+	expectState(t, cb, StateHalfOpen)
+
+	// 探测已经结束，但距离上一次探测不到 ProbeInterval
+	if err := call(cb, true); !errors.Is(err, ErrTooManyRequests) {
+		t.Fatalf("probe within interval: err = %v, want %v", err, ErrTooManyRequests)
+	}
+	clock.Advance(50 * time.Millisecond)
+	if err := call(cb, true); err != nil {
+		t.Fatal(err)
+	}
+	expectState(t, cb, StateClosed)
+
+	// 探测失败时重新打开
+	_ = call(cb, false)
+	clock.Advance(time.Second + time.Millisecond)
+	expectState(t, cb, StateHalfOpen)
+	if err := call(cb, false); err != nil {
+		t.Fatal(err)
+	}
+	expectState(t, cb, StateOpen)
+}
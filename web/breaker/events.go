@@ -0,0 +1,49 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+// StateChange 熔断器的状态变更事件
+type StateChange struct {
+	Name string
+	From State
+	To   State
+	At   time.Time
+}
+
+var subscribers = struct {
+	mu    sync.RWMutex
+	chans map[chan StateChange]struct{}
+}{chans: make(map[chan StateChange]struct{})}
+
+// Subscribe 订阅所有熔断器的状态变更，用于告警、记录日志等；buffer 为通道的缓冲大小，
+// 消费不及时、通道满时丢弃事件，不会阻塞请求。不再需要时调用 cancel，cancel 后通道关闭
+func Subscribe(buffer int) (events <-chan StateChange, cancel func()) {
+	ch := make(chan StateChange, buffer)
+	subscribers.mu.Lock()
+	subscribers.chans[ch] = struct{}{}
+	subscribers.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			subscribers.mu.Lock()
+			delete(subscribers.chans, ch)
+			subscribers.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// publish 发送状态变更事件给所有订阅者
+func publish(e StateChange) {
+	subscribers.mu.RLock()
+	defer subscribers.mu.RUnlock()
+	for ch := range subscribers.chans {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
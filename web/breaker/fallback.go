@@ -0,0 +1,133 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrNoFallback 降级函数没有可用的结果，如缓存中没有数据，交给下一级降级
+var ErrNoFallback = errors.New("breaker: no fallback value")
+
+// Fallback 类型化的降级函数，err 为熔断器拒绝请求的错误；返回错误时由 Chain 交给下一级
+type Fallback[T any] func(err error) (T, error)
+
+// Chain 把多个降级函数按顺序组合，前一级返回错误时使用下一级，全部失败时返回最后一级的错误，
+// 如 缓存 → 静态默认值 → 错误：
+//
+//	last := &breaker.LastGood[[]Item]{}
+//	items, err := breaker.Execute(cb, last.Wrap(listItems), last.Fallback(), breaker.Static(defaultItems))
+func Chain[T any](fallbacks ...Fallback[T]) Fallback[T] {
+	return func(err error) (T, error) {
+		var zero T
+		lastErr := err
+		for _, f := range fallbacks {
+			v, ferr := f(err)
+			if ferr == nil {
+				return v, nil
+			}
+			lastErr = ferr
+		}
+		return zero, lastErr
+	}
+}
+
+// Static 返回固定的默认值
+func Static[T any](v T) Fallback[T] {
+	return func(error) (T, error) {
+		return v, nil
+	}
+}
+
+// Fail 返回错误，err 为 nil 时返回熔断器拒绝请求的错误，一般放在降级链的最后
+func Fail[T any](err error) Fallback[T] {
+	return func(cause error) (T, error) {
+		var zero T
+		if err == nil {
+			return zero, cause
+		}
+		return zero, err
+	}
+}
+
+// FromCache 从缓存中取值，get 返回 false 时交给下一级
+func FromCache[T any](get func() (T, bool)) Fallback[T] {
+	return func(error) (T, error) {
+		if v, ok := get(); ok {
+			return v, nil
+		}
+		var zero T
+		return zero, ErrNoFallback
+	}
+}
+
+// Untyped 转为 Settings.Fallback 使用的 func(err error) (any, error)
+func (f Fallback[T]) Untyped() func(err error) (any, error) {
+	return func(err error) (any, error) {
+		return f(err)
+	}
+}
+
+// Execute 类型化的 cb.Execute，熔断器拒绝请求时按顺序使用 fallbacks 降级，
+// 没有传入 fallbacks 时使用 Settings.Fallback，结果不是 T 类型时返回零值
+func Execute[T any](cb *CircuitBreaker, req func() (T, error), fallbacks ...Fallback[T]) (T, error) {
+	err, generation := cb.beforeRequest()
+	if err != nil {
+		if len(fallbacks) > 0 {
+			return Chain(fallbacks...)(err)
+		}
+		var zero T
+		if cb.fallback != nil {
+			v, ferr := cb.fallback(err)
+			t, ok := v.(T)
+			if !ok {
+				return zero, ferr
+			}
+			return t, ferr
+		}
+		return zero, err
+	}
+
+	// 请求函数 panic 时计为失败，继续向上抛出
+	defer func() {
+		if e := recover(); e != nil {
+			cb.afterRequest(generation, false)
+			panic(e)
+		}
+	}()
+
+	result, err := req()
+	cb.afterRequest(generation, cb.isSuccessful(err))
+	return result, err
+}
+
+// LastGood 保存最近一次成功的结果，作为降级时的缓存
+type LastGood[T any] struct {
+	mu  sync.RWMutex
+	v   T
+	set bool
+}
+
+// Wrap 包装请求函数，请求成功时保存结果
+func (l *LastGood[T]) Wrap(req func() (T, error)) func() (T, error) {
+	return func() (T, error) {
+		v, err := req()
+		if err == nil {
+			l.mu.Lock()
+			l.v, l.set = v, true
+			l.mu.Unlock()
+		}
+		return v, err
+	}
+}
+
+// Get 返回最近一次成功的结果，还没有成功过时返回 false
+func (l *LastGood[T]) Get() (T, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.v, l.set
+}
+
+// Fallback 返回最近一次成功的结果作为降级，还没有成功过时交给下一级
+func (l *LastGood[T]) Fallback() Fallback[T] {
+	return FromCache(l.Get)
+}
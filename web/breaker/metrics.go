@@ -0,0 +1,58 @@
+package breaker
+
+import (
+	"fmt"
+	"github.com/ygb616/web/metrics"
+	"io"
+	"sync"
+	"time"
+)
+
+var defaultMetricsOnce sync.Once
+
+// Collector 返回输出 r 中所有熔断器指标的 metrics.Collector，name 为注册时使用的名称，
+// 按 Prometheus 文本格式输出，breaker 标签为熔断器名称；DefaultRegistry 第一次 Get 时自动注册到 metrics.Default
+func (r *Registry) Collector(name string) metrics.Collector {
+	return &registryCollector{name: name, registry: r}
+}
+
+// registryCollector 输出 Registry 中所有熔断器的指标，同一个指标的多个熔断器放在一起输出
+type registryCollector struct {
+	name     string
+	registry *Registry
+}
+
+func (c *registryCollector) Name() string {
+	return c.name
+}
+
+func (c *registryCollector) Write(w io.Writer) {
+	breakers := c.registry.All()
+	snapshots := make([]Snapshot, len(breakers))
+	for i, cb := range breakers {
+		snapshots[i] = cb.Snapshot()
+	}
+	now := time.Now()
+	families := []struct {
+		name, typ, help string
+		value           func(s Snapshot) float64
+	}{
+		{"breaker_state", "gauge", "Breaker state: 0 closed, 1 half-open, 2 open.", func(s Snapshot) float64 { return float64(s.State) }},
+		{"breaker_open_seconds", "gauge", "Seconds since the breaker opened, 0 when not open.", func(s Snapshot) float64 {
+			if s.State != StateOpen {
+				return 0
+			}
+			return now.Sub(s.Since).Seconds()
+		}},
+		{"breaker_requests_total", "counter", "Requests allowed by the breaker.", func(s Snapshot) float64 { return float64(s.Requests) }},
+		{"breaker_successes_total", "counter", "Requests reported as successful.", func(s Snapshot) float64 { return float64(s.Successes) }},
+		{"breaker_failures_total", "counter", "Requests reported as failed.", func(s Snapshot) float64 { return float64(s.Failures) }},
+		{"breaker_rejected_total", "counter", "Requests rejected while open or half-open.", func(s Snapshot) float64 { return float64(s.Rejected) }},
+	}
+	for _, f := range families {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.typ)
+		for _, s := range snapshots {
+			fmt.Fprintf(w, "%s{breaker=%q} %v\n", f.name, s.Name, f.value(s))
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package breaker
+
+import (
+	"github.com/ygb616/web/metrics"
+	"sort"
+	"sync"
+)
+
+// Registry 按名称共享熔断器，同一个依赖（路由、上游服务、rpc 方法）在所有调用的地方使用同一个熔断器，
+// 失败计数合在一起，也便于统一查看和管理
+type Registry struct {
+	mu       sync.Mutex
+	breakers map[string]*CircuitBreaker
+}
+
+// NewRegistry 创建 Registry
+func NewRegistry() *Registry {
+	return &Registry{breakers: make(map[string]*CircuitBreaker)}
+}
+
+// DefaultRegistry 默认的 Registry，web.Breaker、网关和 gRPC 客户端的熔断器都注册在这里
+var DefaultRegistry = NewRegistry()
+
+// Get 从 DefaultRegistry 获取名称为 name 的熔断器，不存在时按 st 创建
+func Get(name string, st Settings) *CircuitBreaker {
+	return DefaultRegistry.Get(name, st)
+}
+
+// Get 获取名称为 name 的熔断器，不存在时按 st 创建，st.Name 使用 name；
+// 已经存在时返回已有的熔断器，st 不生效，需要修改设置时先 Remove
+func (r *Registry) Get(name string, st Settings) *CircuitBreaker {
+	if r == DefaultRegistry {
+		defaultMetricsOnce.Do(func() {
+			metrics.Default.Register(r.Collector("breaker"))
+		})
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cb, ok := r.breakers[name]; ok {
+		return cb
+	}
+	st.Name = name
+	cb := NewCircuitBreaker(st)
+	r.breakers[name] = cb
+	return cb
+}
+
+// Lookup 获取名称为 name 的熔断器，不存在时返回 false
+func (r *Registry) Lookup(name string) (*CircuitBreaker, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cb, ok := r.breakers[name]
+	return cb, ok
+}
+
+// Remove 删除名称为 name 的熔断器，已经获取到的熔断器仍然可以使用，之后 Get 时重新创建
+func (r *Registry) Remove(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.breakers, name)
+}
+
+// Names 返回所有熔断器的名称
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.breakers))
+	for name := range r.breakers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// All 返回所有的熔断器，按名称排序
+func (r *Registry) All() []*CircuitBreaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	all := make([]*CircuitBreaker, 0, len(r.breakers))
+	for _, cb := range r.breakers {
+		all = append(all, cb)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].name < all[j].name
+	})
+	return all
+}
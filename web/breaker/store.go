@@ -0,0 +1,186 @@
+package breaker
+
+import (
+	"context"
+	"fmt"
+	"github.com/ygb616/web/internal/redis"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Store 多个副本共享熔断状态的存储：任意一个副本的熔断器打开时写入 Store，其他副本同步到后也打开，
+// 不需要每个副本都各自失败到阈值才熔断；失败计数仍然在每个副本本地统计
+type Store interface {
+	// OpenUntil 返回名称为 name 的熔断器打开到什么时间，没有打开时返回零值
+	OpenUntil(ctx context.Context, name string) (time.Time, error)
+	// Trip 记录名称为 name 的熔断器打开到 until
+	Trip(ctx context.Context, name string, until time.Time) error
+	// Reset 清除名称为 name 的熔断器的打开状态
+	Reset(ctx context.Context, name string) error
+}
+
+// storeTimeout 访问 Store 的超时时间
+const storeTimeout = time.Second
+
+// syncShared 关闭状态下检查其他副本是否已经打开，需要持有锁；
+// 按 syncInterval 在后台从 Store 刷新，请求不会等待 Store
+func (cb *CircuitBreaker) syncShared(now time.Time) {
+	if cb.forced {
+		return
+	}
+	if cb.sharedUntil.After(now) {
+		cb.setState(StateOpen)
+		cb.expiry = cb.sharedUntil // 与打开的副本同时变为半开
+		return
+	}
+	if cb.syncing || now.Sub(cb.lastSync) < cb.syncInterval {
+		return
+	}
+	cb.syncing = true
+	cb.lastSync = now
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+		defer cancel()
+		until, err := cb.store.OpenUntil(ctx, cb.name)
+		cb.mutex.Lock()
+		defer cb.mutex.Unlock()
+		cb.syncing = false
+		if err == nil {
+			cb.sharedUntil = until // 出错时保持本地的状态
+		}
+	}()
+}
+
+// tripShared 本地打开时写入 Store，需要持有锁
+func (cb *CircuitBreaker) tripShared() {
+	if cb.store == nil || cb.forced {
+		return
+	}
+	until := cb.expiry
+	cb.sharedUntil = until
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+		defer cancel()
+		_ = cb.store.Trip(ctx, cb.name, until)
+	}()
+}
+
+// resetShared 手动重置时清除 Store 中的打开状态，需要持有锁
+func (cb *CircuitBreaker) resetShared() {
+	if cb.store == nil {
+		return
+	}
+	cb.sharedUntil = time.Time{}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+		defer cancel()
+		_ = cb.store.Reset(ctx, cb.name)
+	}()
+}
+
+// MemoryStore 进程内的 Store，同一个进程中的多个 Registry 共享熔断状态，也可以用于测试
+type MemoryStore struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+// NewMemoryStore 创建 MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{until: make(map[string]time.Time)}
+}
+
+func (s *MemoryStore) OpenUntil(_ context.Context, name string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	until := s.until[name]
+	if !until.After(time.Now()) {
+		delete(s.until, name)
+		return time.Time{}, nil
+	}
+	return until, nil
+}
+
+func (s *MemoryStore) Trip(_ context.Context, name string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if until.After(s.until[name]) {
+		s.until[name] = until
+	}
+	return nil
+}
+
+func (s *MemoryStore) Reset(_ context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.until, name)
+	return nil
+}
+
+// RedisClient 执行 Redis 命令，key 不存在时返回 (nil, nil)。不依赖具体的 Redis 客户端，如 go-redis：
+//
+//	client := breaker.RedisFunc(func(ctx context.Context, args ...any) (any, error) {
+//		v, err := rdb.Do(ctx, args...).Result()
+//		if err == redis.Nil {
+//			return nil, nil
+//		}
+//		return v, err
+//	})
+type RedisClient = redis.Client
+
+// RedisFunc 函数形式的 RedisClient
+type RedisFunc = redis.Func
+
+// RedisStore 使用 Redis 共享熔断状态，每个熔断器一个 key，值为打开到的时间（毫秒时间戳），到期自动删除
+type RedisStore struct {
+	Client RedisClient
+	Prefix string // key 的前缀，默认 breaker:
+}
+
+// NewRedisStore 创建 RedisStore
+func NewRedisStore(client RedisClient) *RedisStore {
+	return &RedisStore{Client: client}
+}
+
+func (s *RedisStore) key(name string) string {
+	prefix := s.Prefix
+	if prefix == "" {
+		prefix = "breaker:"
+	}
+	return prefix + name
+}
+
+func (s *RedisStore) OpenUntil(ctx context.Context, name string) (time.Time, error) {
+	v, err := s.Client.Do(ctx, "GET", s.key(name))
+	if err != nil || v == nil {
+		return time.Time{}, err
+	}
+	var text string
+	switch v := v.(type) {
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		return time.Time{}, fmt.Errorf("breaker: unexpected redis reply %T", v)
+	}
+	ms, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms), nil
+}
+
+func (s *RedisStore) Trip(ctx context.Context, name string, until time.Time) error {
+	ttl := time.Until(until).Milliseconds()
+	if ttl <= 0 {
+		return nil
+	}
+	_, err := s.Client.Do(ctx, "SET", s.key(name), strconv.FormatInt(until.UnixMilli(), 10), "PX", ttl)
+	return err
+}
+
+func (s *RedisStore) Reset(ctx context.Context, name string) error {
+	_, err := s.Client.Do(ctx, "DEL", s.key(name))
+	return err
+}
@@ -0,0 +1,75 @@
+package breaker
+
+import "time"
+
+// rollingWindow 滑动窗口，统计最近一段时间（按时间分桶）或最近若干个请求（每个桶一个请求）的结果，
+// 过期的桶在下次使用时清零，不需要定时器
+type rollingWindow struct {
+	buckets []bucket
+	width   time.Duration // 每个桶的时长，为 0 时按请求数滑动
+	seq     int64         // 按请求数滑动时最近一个请求的序号
+}
+
+type bucket struct {
+	epoch    int64 // 桶对应的时间段或请求序号，与当前的相差超过桶的数量时已过期
+	requests uint32
+	failures uint32
+}
+
+// newTimeWindow 最近 size 时长的窗口，分成 n 个桶
+func newTimeWindow(size time.Duration, n int) *rollingWindow {
+	width := size / time.Duration(n)
+	if width <= 0 {
+		width = 1
+	}
+	return &rollingWindow{buckets: make([]bucket, n), width: width}
+}
+
+// newCountWindow 最近 n 个请求的窗口
+func newCountWindow(n uint32) *rollingWindow {
+	return &rollingWindow{buckets: make([]bucket, n)}
+}
+
+// epoch 返回当前的时间段或请求序号
+func (w *rollingWindow) epoch(now time.Time) int64 {
+	if w.width == 0 {
+		return w.seq
+	}
+	return now.UnixNano() / int64(w.width)
+}
+
+// add 记录一个请求的结果
+func (w *rollingWindow) add(now time.Time, failed bool) {
+	if w.width == 0 {
+		w.seq++
+	}
+	epoch := w.epoch(now)
+	b := &w.buckets[epoch%int64(len(w.buckets))]
+	if b.epoch != epoch {
+		*b = bucket{epoch: epoch}
+	}
+	b.requests++
+	if failed {
+		b.failures++
+	}
+}
+
+// sum 返回窗口内的请求数和失败数
+func (w *rollingWindow) sum(now time.Time) (requests, failures uint32) {
+	epoch := w.epoch(now)
+	n := int64(len(w.buckets))
+	for _, b := range w.buckets {
+		if b.requests > 0 && b.epoch > epoch-n && b.epoch <= epoch {
+			requests += b.requests
+			failures += b.failures
+		}
+	}
+	return requests, failures
+}
+
+// reset 清空窗口
+func (w *rollingWindow) reset() {
+	for i := range w.buckets {
+		w.buckets[i] = bucket{}
+	}
+}
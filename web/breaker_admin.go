@@ -0,0 +1,62 @@
+package web
+
+import (
+	"github.com/ygb616/web/breaker"
+	"net/http"
+	"time"
+)
+
+// BreakerAdmin 熔断器的管理接口，列出 breaker.DefaultRegistry 中所有的熔断器，故障时可以手动干预：
+//
+//	e.Group("debug").Any("/breakers", web.BreakerAdmin)
+//
+// GET 返回所有熔断器的状态和计数；POST 修改 name 参数指定的熔断器，action 参数为
+// open（手动打开）、close（手动关闭，失败不再熔断）、reset（取消手动设置并清空计数）。
+// 挂载时的注意事项见包文档的管理接口一节
+func BreakerAdmin(ctx *Context) {
+	switch ctx.R.Method {
+	case http.MethodGet:
+		now := time.Now()
+		list := make([]map[string]any, 0)
+		for _, cb := range breaker.DefaultRegistry.All() {
+			s := cb.Snapshot()
+			list = append(list, map[string]any{
+				"name":                s.Name,
+				"state":               s.State.String(),
+				"forced":              s.Forced,
+				"since":               s.Since,
+				"stateSeconds":        now.Sub(s.Since).Seconds(),
+				"requests":            s.Counts.Requests,
+				"consecutiveFailures": s.Counts.ConsecutiveFailures,
+				"windowRequests":      s.Counts.WindowRequests,
+				"failureRate":         s.Counts.FailureRate(),
+				"totalRequests":       s.Requests,
+				"totalSuccesses":      s.Successes,
+				"totalFailures":       s.Failures,
+				"totalRejected":       s.Rejected,
+			})
+		}
+		_ = ctx.JSON(http.StatusOK, list)
+	case http.MethodPost:
+		name := ctx.GetQuery("name")
+		cb, ok := breaker.DefaultRegistry.Lookup(name)
+		if !ok {
+			_ = ctx.JSON(http.StatusNotFound, map[string]any{"code": http.StatusNotFound, "msg": "breaker " + name + " not found"})
+			return
+		}
+		switch action := ctx.GetQuery("action"); action {
+		case "open":
+			cb.ForceOpen()
+		case "close":
+			cb.ForceClose()
+		case "reset":
+			cb.Reset()
+		default:
+			_ = ctx.JSON(http.StatusBadRequest, map[string]any{"code": http.StatusBadRequest, "msg": "action must be open, close or reset"})
+			return
+		}
+		_ = ctx.JSON(http.StatusOK, map[string]any{"code": http.StatusOK, "msg": "ok", "state": cb.State().String()})
+	default:
+		ctx.W.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
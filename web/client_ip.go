@@ -0,0 +1,73 @@
+package web
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// SetTrustedProxies 设置信任的代理，proxies 为 IP 或 CIDR，如 10.0.0.0/8、127.0.0.1。
+// 只有直接连接的地址是信任的代理时，ClientIP 才读取 X-Forwarded-For、X-Real-Ip，
+// 否则客户端可以伪造这两个请求头；默认不信任任何代理
+func (e *Engine) SetTrustedProxies(proxies ...string) error {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return fmt.Errorf("web: invalid trusted proxy %q", p)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			p = fmt.Sprintf("%s/%d", p, bits)
+		}
+		_, ipNet, err := net.ParseCIDR(p)
+		if err != nil {
+			return fmt.Errorf("web: invalid trusted proxy %q: %w", p, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	e.trustedProxies = nets
+	return nil
+}
+
+// isTrustedProxy 判断 ip 是否是信任的代理
+func (e *Engine) isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range e.trustedProxies {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP 返回客户端 IP，默认为连接的地址；连接的地址是信任的代理（见 SetTrustedProxies）时，
+// 从右向左跳过 X-Forwarded-For 中信任的代理，返回第一个不信任的地址，没有 X-Forwarded-For 时使用 X-Real-Ip
+func (c *Context) ClientIP() string {
+	remote, _, err := net.SplitHostPort(c.R.RemoteAddr)
+	if err != nil {
+		remote = c.R.RemoteAddr
+	}
+	if c.E == nil || !c.E.isTrustedProxy(remote) {
+		return remote
+	}
+	if forwarded := c.R.Header.Get("X-Forwarded-For"); forwarded != "" {
+		ips := strings.Split(forwarded, ",")
+		for i := len(ips) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(ips[i])
+			if i == 0 || !c.E.isTrustedProxy(ip) {
+				return ip
+			}
+		}
+	}
+	if ip := strings.TrimSpace(c.R.Header.Get("X-Real-Ip")); ip != "" {
+		return ip
+	}
+	return remote
+}
@@ -0,0 +1,21 @@
+// Package autoload 在包初始化时加载配置文件，保持旧版本 config 包的行为，需要时在 main 包中引入：
+//
+//	import _ "github.com/ygb616/web/config/autoload"
+//
+// 配置文件依次按命令行参数 -conf、环境变量 WEB_CONF、conf/app.toml 等默认文件查找，见 config.LoadDefault
+package autoload
+
+import (
+	"flag"
+	"github.com/ygb616/web/config"
+	myLog "github.com/ygb616/web/log"
+)
+
+func init() {
+	// 注册到 flag 中，应用调用 flag.Parse 时不会因为 -conf 未定义而退出
+	flag.String("conf", "conf/app.toml", "app config file")
+	if err := config.LoadDefault(); err != nil {
+		// 如果加载失败，记录日志，环境变量的配置仍然生效
+		myLog.Default().Info(err.Error())
+	}
+}
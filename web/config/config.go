@@ -1,53 +1,190 @@
 package config
 
 import (
-	"flag"                            // 引入 flag 包，用于解析命令行参数
-	"github.com/BurntSushi/toml"      // 引入 toml 包，用于解析 TOML 格式的配置文件
+	"fmt"                             // 引入 fmt 包，用于生成错误信息
 	myLog "github.com/ygb616/web/log" // 引入自定义的日志包
 	"os"                              // 引入 os 包，用于文件系统操作
+	"reflect"                         // 引入 reflect 包，用于按名称设置配置的各节
+	"strings"                         // 引入 strings 包，用于解析命令行参数
+	"sync/atomic"                     // 引入 atomic 包，用于整体替换配置
 )
 
-// Conf 是全局的配置实例，初始化为默认配置
-var conf = &WebConfig{
-	logger: myLog.Default(), // 使用默认的日志记录器
-}
+// logger 加载配置使用的日志记录器
+var logger = myLog.Default()
+
+// current 当前的配置，重新加载时整体替换，已经读取到的 *WebConfig 不会再被修改
+var current atomic.Pointer[WebConfig]
 
 // WebConfig 结构体用于存储应用的各种配置
 type WebConfig struct {
 	logger   *myLog.Logger  // 日志记录器
+	file     string         // 加载的配置文件，重新加载时使用
+	opts     loadOptions    // 加载时的选项，重新加载时使用
 	Log      map[string]any // 日志相关配置
 	Pool     map[string]any // 连接池相关配置
 	Template map[string]any // 模板相关配置
 	Mysql    map[string]any //数据库相关配置
+	Grpc     map[string]any // gRPC 客户端相关配置，按目标服务分组
+	Register map[string]any // 注册中心相关配置
+	Gateway  map[string]any // 网关相关配置，路由在 [[gateway.routes]] 中
+	Limit    map[string]any // 限流相关配置，见 web.IdentityLimitConf 的 ConfKey
 }
 
-// init 函数在包初始化时自动调用，用于加载配置文件
+// File 返回加载的配置文件
+func (c *WebConfig) File() string {
+	return c.file
+}
+
+// init 函数在包初始化时自动调用，当前的配置初始化为空配置，不读取配置文件；
+// 需要在初始化时加载配置文件的应用引入 config/autoload 包，见 LoadDefault
 func init() {
-	loadToml() // 加载 TOML 配置文件
+	current.Store(&WebConfig{logger: logger, opts: defaultLoadOptions()})
+}
+
+// defaultConfigFiles 没有指定配置文件时按顺序查找
+var defaultConfigFiles = []string{"conf/app.toml", "conf/app.yaml", "conf/app.yml", "conf/app.json"}
+
+// LoadDefault 按旧版本的方式查找配置文件并设置为当前的配置：
+// 依次为命令行参数 -conf、环境变量 WEB_CONF、defaultConfigFiles 中第一个存在的文件。
+// 不调用 flag.Parse，只从 os.Args 中读取 -conf，避免遇到应用或 go test 的参数而退出；
+// 配置文件不存在或格式错误时返回错误，环境变量的配置仍然生效
+func LoadDefault() error {
+	file := confArg(os.Args[1:], "")
+	if file == "" {
+		file = os.Getenv(EnvPrefix + "CONF") // 容器中可以用环境变量指定配置文件
+	}
+	if file == "" {
+		file = defaultConfigFiles[0]
+		for _, name := range defaultConfigFiles {
+			if _, err := os.Stat(name); err == nil {
+				file = name
+				break
+			}
+		}
+	}
+	return reloadFrom(file, defaultLoadOptions(), false)
+}
+
+// Option Load 的选项
+type Option func(*loadOptions)
+
+type loadOptions struct {
+	environ func() []string // 叠加的环境变量，KEY=VALUE 形式，为 nil 时不叠加
+}
+
+func defaultLoadOptions() loadOptions {
+	return loadOptions{environ: os.Environ}
+}
+
+// WithoutEnv 不叠加环境变量
+func WithoutEnv() Option {
+	return func(o *loadOptions) {
+		o.environ = nil
+	}
+}
+
+// WithEnviron 使用 environ（KEY=VALUE 形式）代替进程的环境变量，便于测试
+func WithEnviron(environ []string) Option {
+	return func(o *loadOptions) {
+		o.environ = func() []string { return environ }
+	}
 }
 
-// loadToml 函数加载 TOML 配置文件
-func loadToml() {
-	// 定义命令行参数，用于指定配置文件路径，默认值为 "conf/app.toml"
-	configFile := flag.String("conf", "conf/app.toml", "app config file")
-	flag.Parse() // 解析命令行参数
+// Load 加载配置文件并叠加环境变量，返回新的配置，不修改当前的配置，需要时调用 SetCurrent，优先级从低到高为：
+//
+//  1. 配置文件，path 为空时跳过
+//  2. 环境变量，见 EnvPrefix
+//
+// 文件格式按扩展名区分：.toml、.yaml/.yml、.json，其他扩展名按 TOML 解析。
+// 文件不存在或格式错误时返回错误
+func Load(path string, opts ...Option) (*WebConfig, error) {
+	o := defaultLoadOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	c, err := build(path, o, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetCurrent 把 c 设置为当前的配置，GetToml、Get 等读取 c，之后 Watch 检查 c 的配置文件，
+// 配置文件修改或配置中心推送时按 c 的文件和选项重新加载。配置变化时调用 OnChange 注册的回调
+func SetCurrent(c *WebConfig) {
+	reloadMu.Lock()
+	swap(c)
+}
 
-	// 检查配置文件是否存在
-	if _, err := os.Stat(*configFile); err != nil {
-		// 如果文件不存在，记录日志并返回
-		conf.logger.Info("conf/app.toml file not load，because not exist")
-		return
+// build 读取配置文件，按顺序叠加配置中心和环境变量
+func build(file string, o loadOptions, srcs []*sourceState) (*WebConfig, error) {
+	sections, err := readFile(file)
+	for _, s := range srcs {
+		mergeMaps(sections, cloneValue(s.data).(map[string]any))
+	}
+	if o.environ != nil {
+		overlayEnv(sections, o.environ())
 	}
+	c := &WebConfig{logger: logger, file: file, opts: o}
+	c.setSections(sections)
+	return c, err
+}
 
-	// 解析配置文件并将结果存储到 Conf 变量中
-	_, err := toml.DecodeFile(*configFile, conf)
+// readFile 读取配置文件，file 为空时返回空的配置
+func readFile(file string) (map[string]any, error) {
+	if file == "" {
+		return make(map[string]any), nil
+	}
+	if _, err := os.Stat(file); err != nil {
+		return make(map[string]any), fmt.Errorf("%s file not load，because not exist", file)
+	}
+	m, err := decodeFile(file)
 	if err != nil {
-		// 如果解析失败，记录日志并返回
-		conf.logger.Info("conf/app.toml decode fail check format")
-		return
+		return make(map[string]any), fmt.Errorf("%s decode fail check format: %w", file, err)
+	}
+	return m, nil
+}
+
+// setSections 按名称（不区分大小写）把各节的配置设置到 WebConfig 的字段中
+func (c *WebConfig) setSections(sections map[string]any) {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Type != reflect.TypeOf(map[string]any(nil)) {
+			continue
+		}
+		var section map[string]any
+		for name, value := range sections {
+			if strings.EqualFold(name, field.Name) {
+				section, _ = value.(map[string]any)
+			}
+		}
+		v.Field(i).Set(reflect.ValueOf(section))
+	}
+}
+
+// confArg 从命令行参数中读取 -conf 的值，支持 -conf file、-conf=file 和两个横线的形式
+func confArg(args []string, def string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		if name == arg {
+			continue // 不是参数名
+		}
+		if value, ok := strings.CutPrefix(name, "conf="); ok {
+			return value
+		}
+		if name == "conf" && i+1 < len(args) {
+			return args[i+1]
+		}
 	}
+	return def
 }
 
+// GetToml 返回当前的配置，配置重新加载后需要重新调用；没有调用 SetCurrent、LoadDefault 时为空配置
 func GetToml() *WebConfig {
-	return conf
+	return current.Load()
 }
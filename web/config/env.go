@@ -0,0 +1,107 @@
+package config
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix 覆盖配置的环境变量前缀。环境变量 WEB_<节>_<键> 覆盖配置文件中的值，
+// 节为 WebConfig 的字段名，如 LOG、MYSQL；键中的双下划线表示下一层的表：
+//
+//	WEB_MYSQL_DSN=...                 # [mysql] dsn
+//	WEB_LOG_LEVEL=debug               # [log] level
+//	WEB_LOG_ACCESS__FORMAT=json       # [log.access] format
+//
+// 键统一转为小写。配置文件中已有的值按原来的类型转换，没有的值按整数、小数、布尔、字符串的顺序推断；
+// 另外 WEB_CONF 指定配置文件，优先级低于 -conf 参数
+var EnvPrefix = "WEB_"
+
+// overlayEnv 把 environ（KEY=VALUE 形式）中的配置叠加到 sections 上
+func overlayEnv(sections map[string]any, environ []string) {
+	names := sectionNames()
+	for _, kv := range environ {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(key, EnvPrefix) {
+			continue
+		}
+		section, rest, ok := strings.Cut(strings.TrimPrefix(key, EnvPrefix), "_")
+		if !ok || rest == "" {
+			continue
+		}
+		name, ok := names[strings.ToLower(section)]
+		if !ok {
+			continue // 不是配置的节，如 WEB_CONF
+		}
+		path := strings.Split(strings.ToLower(rest), "__")
+		setPath(sections, append([]string{name}, path...), value)
+	}
+}
+
+// sectionNames 返回 WebConfig 中各节的名称，小写 -> 小写（配置文件中的名称按不区分大小写匹配）
+func sectionNames() map[string]string {
+	names := make(map[string]string)
+	t := reflect.TypeOf(WebConfig{})
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.IsExported() {
+			names[strings.ToLower(f.Name)] = strings.ToLower(f.Name)
+		}
+	}
+	return names
+}
+
+// setPath 按路径设置值，中间的表不存在时创建，路径上的名称不区分大小写
+func setPath(m map[string]any, path []string, value string) {
+	for i, name := range path {
+		key := name
+		for k := range m {
+			if strings.EqualFold(k, name) {
+				key = k
+				break
+			}
+		}
+		if i == len(path)-1 {
+			m[key] = convertEnv(m[key], value)
+			return
+		}
+		next, ok := m[key].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			m[key] = next
+		}
+		m = next
+	}
+}
+
+// convertEnv 把环境变量的值转换为 old 的类型，old 为空时推断类型
+func convertEnv(old any, value string) any {
+	switch old.(type) {
+	case string:
+		return value
+	case int64:
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+		return value
+	case float64:
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+		return value
+	case bool:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+		return value
+	}
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return f
+	}
+	if value == "true" || value == "false" {
+		return value == "true"
+	}
+	return value
+}
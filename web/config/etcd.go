@@ -0,0 +1,52 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"path/filepath"
+)
+
+// EtcdSource 从 etcd 的一个键读取配置，如：
+//
+//	cli, _ := clientv3.New(clientv3.Config{Endpoints: []string{"127.0.0.1:2379"}})
+//	err := config.AddSource(ctx, &config.EtcdSource{Client: cli, Key: "/config/app.yaml"})
+type EtcdSource struct {
+	Client *clientv3.Client
+	Key    string
+	Format string // 配置格式，为空时按 Key 的扩展名
+}
+
+func (s *EtcdSource) format() string {
+	if s.Format != "" {
+		return s.Format
+	}
+	return filepath.Ext(s.Key)
+}
+
+func (s *EtcdSource) Load(ctx context.Context) ([]byte, string, error) {
+	resp, err := s.Client.Get(ctx, s.Key)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, "", fmt.Errorf("etcd key %s not exist", s.Key)
+	}
+	return resp.Kvs[0].Value, s.format(), nil
+}
+
+func (s *EtcdSource) Watch(ctx context.Context, onChange func(data []byte)) error {
+	for resp := range s.Client.Watch(ctx, s.Key) {
+		if err := resp.Err(); err != nil {
+			return err
+		}
+		for _, ev := range resp.Events {
+			if ev.Type == clientv3.EventTypeDelete {
+				onChange(nil) // 删除后不再叠加配置中心的配置
+				continue
+			}
+			onChange(ev.Kv.Value)
+		}
+	}
+	return ctx.Err()
+}
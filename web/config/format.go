@@ -0,0 +1,87 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// decodeFile 按扩展名解析配置文件，返回各节的配置
+func decodeFile(file string) (map[string]any, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return decodeBytes(data, filepath.Ext(file))
+}
+
+// decodeBytes 按格式解析配置，format 为 toml、yaml、yml、json，可以带点，如 .yaml，其他格式按 TOML 解析
+func decodeBytes(data []byte, format string) (map[string]any, error) {
+	var err error
+	m := make(map[string]any)
+	switch strings.ToLower(strings.TrimPrefix(format, ".")) {
+	case "yaml", "yml":
+		err = yaml.Unmarshal(data, &m)
+	case "json":
+		d := json.NewDecoder(bytes.NewReader(data))
+		d.UseNumber() // 整数解析为 int64，与 TOML 一致
+		err = d.Decode(&m)
+	default:
+		err = toml.Unmarshal(data, &m)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return normalize(m).(map[string]any), nil
+}
+
+// normalize 把 YAML、JSON 解析的值统一为 TOML 解析的类型，各模块读取配置时只需要处理一种类型：
+// 整数为 int64，小数为 float64，表为 map[string]any，表数组为 []map[string]any
+func normalize(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = normalize(e)
+		}
+		return v
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = normalize(e)
+		}
+		return m
+	case []any:
+		tables := make([]map[string]any, 0, len(v))
+		for i, e := range v {
+			v[i] = normalize(e)
+			if t, ok := v[i].(map[string]any); ok {
+				tables = append(tables, t)
+			}
+		}
+		if len(v) > 0 && len(tables) == len(v) {
+			return tables
+		}
+		return v
+	case int:
+		return int64(v)
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v)
+		}
+		return float64(v)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	default:
+		return v
+	}
+}
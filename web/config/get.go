@@ -0,0 +1,204 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Get 按点分隔的路径读取配置，如 mysql.dsn、log.access.format、gateway.routes.0.name，
+// 第一段为节的名称，名称不区分大小写，数字表示数组的下标
+func Get(key string) (any, bool) {
+	return getFrom(GetToml(), key)
+}
+
+// getFrom 从 c 中读取配置
+func getFrom(c *WebConfig, key string) (any, bool) {
+	if key == "" {
+		return c.sections(), true
+	}
+	path := strings.Split(key, ".")
+	var cur any = c.sections()
+	for _, name := range path {
+		switch m := cur.(type) {
+		case map[string]any:
+			v, ok := lookup(m, name)
+			if !ok {
+				return nil, false
+			}
+			cur = v
+		case []map[string]any:
+			i, err := strconv.Atoi(name)
+			if err != nil || i < 0 || i >= len(m) {
+				return nil, false
+			}
+			cur = m[i]
+		case []any:
+			i, err := strconv.Atoi(name)
+			if err != nil || i < 0 || i >= len(m) {
+				return nil, false
+			}
+			cur = m[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, cur != nil
+}
+
+// lookup 先按名称查找，没有时不区分大小写查找
+func lookup(m map[string]any, name string) (any, bool) {
+	if v, ok := m[name]; ok {
+		return v, true
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// sections 返回各节的配置，节名为小写
+func (c *WebConfig) sections() map[string]any {
+	return map[string]any{
+		"log":      c.Log,
+		"pool":     c.Pool,
+		"template": c.Template,
+		"mysql":    c.Mysql,
+		"grpc":     c.Grpc,
+		"register": c.Register,
+		"gateway":  c.Gateway,
+		"limit":    c.Limit,
+	}
+}
+
+// GetString 读取字符串配置，不是字符串时格式化为字符串，没有配置时返回 def
+func GetString(key string, def string) string {
+	v, ok := Get(key)
+	if !ok {
+		return def
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// GetInt 读取整数配置，字符串按十进制解析，没有配置或不是整数时返回 def
+func GetInt(key string, def int) int {
+	v, ok := Get(key)
+	if !ok {
+		return def
+	}
+	if n, ok := toInt64(v); ok {
+		return int(n)
+	}
+	return def
+}
+
+// GetFloat 读取小数配置，没有配置或不是数字时返回 def
+func GetFloat(key string, def float64) float64 {
+	v, ok := Get(key)
+	if !ok {
+		return def
+	}
+	switch n := v.(type) {
+	case float64:
+		return n
+	case int64:
+		return float64(n)
+	case string:
+		if f, err := strconv.ParseFloat(n, 64); err == nil {
+			return f
+		}
+	}
+	return def
+}
+
+// GetBool 读取布尔配置，字符串按 strconv.ParseBool 解析，没有配置或不是布尔值时返回 def
+func GetBool(key string, def bool) bool {
+	v, ok := Get(key)
+	if !ok {
+		return def
+	}
+	switch b := v.(type) {
+	case bool:
+		return b
+	case string:
+		if parsed, err := strconv.ParseBool(b); err == nil {
+			return parsed
+		}
+	}
+	return def
+}
+
+// GetDuration 读取时长配置，字符串如 "10s"，整数为毫秒，与其他模块的配置一致，没有配置或格式不对时返回 def
+func GetDuration(key string, def time.Duration) time.Duration {
+	v, ok := Get(key)
+	if !ok {
+		return def
+	}
+	if d, ok := toDuration(v); ok {
+		return d
+	}
+	return def
+}
+
+// GetStrings 读取字符串数组配置，元素不是字符串时格式化为字符串，单个字符串按逗号分隔
+func GetStrings(key string) []string {
+	v, ok := Get(key)
+	if !ok {
+		return nil
+	}
+	switch list := v.(type) {
+	case []any:
+		result := make([]string, 0, len(list))
+		for _, e := range list {
+			result = append(result, fmt.Sprint(e))
+		}
+		return result
+	case string:
+		var result []string
+		for _, s := range strings.Split(list, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+func toInt64(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case float64:
+		if n == math.Trunc(n) && n >= math.MinInt64 && n <= math.MaxInt64 {
+			return int64(n), true
+		}
+	case string:
+		if parsed, err := strconv.ParseInt(n, 10, 64); err == nil {
+			return parsed, true
+		}
+	}
+	return 0, false
+}
+
+func toDuration(v any) (time.Duration, bool) {
+	switch d := v.(type) {
+	case string:
+		if duration, err := time.ParseDuration(d); err == nil {
+			return duration, true
+		}
+		if ms, err := strconv.ParseInt(d, 10, 64); err == nil {
+			return time.Duration(ms) * time.Millisecond, true // 环境变量覆盖字符串配置时可能是数字
+		}
+	case int64:
+		return time.Duration(d) * time.Millisecond, true
+	}
+	return 0, false
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"context"
+	"github.com/nacos-group/nacos-sdk-go/clients/config_client"
+	"github.com/nacos-group/nacos-sdk-go/vo"
+	"path/filepath"
+)
+
+// NacosSource 从 nacos 配置中心读取配置，如：
+//
+//	client, _ := clients.NewConfigClient(vo.NacosClientParam{...})
+//	err := config.AddSource(ctx, &config.NacosSource{Client: client, DataId: "app.toml", Group: "DEFAULT_GROUP"})
+type NacosSource struct {
+	Client config_client.IConfigClient
+	DataId string
+	Group  string
+	Format string // 配置格式，为空时按 DataId 的扩展名
+}
+
+func (s *NacosSource) param() vo.ConfigParam {
+	return vo.ConfigParam{DataId: s.DataId, Group: s.Group}
+}
+
+func (s *NacosSource) format() string {
+	if s.Format != "" {
+		return s.Format
+	}
+	return filepath.Ext(s.DataId)
+}
+
+func (s *NacosSource) Load(ctx context.Context) ([]byte, string, error) {
+	content, err := s.Client.GetConfig(s.param())
+	if err != nil {
+		return nil, "", err
+	}
+	return []byte(content), s.format(), nil
+}
+
+func (s *NacosSource) Watch(ctx context.Context, onChange func(data []byte)) error {
+	param := s.param()
+	param.OnChange = func(namespace, group, dataId, data string) {
+		onChange([]byte(data))
+	}
+	if err := s.Client.ListenConfig(param); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	return s.Client.CancelListenConfig(s.param())
+}
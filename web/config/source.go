@@ -0,0 +1,61 @@
+package config
+
+import (
+	"context"
+	"fmt"
+)
+
+// Source 配置中心，见 NacosSource、EtcdSource
+type Source interface {
+	// Load 读取配置的内容，format 为 toml、yaml、json，见 Load 中的文件格式
+	Load(ctx context.Context) (data []byte, format string, err error)
+	// Watch 订阅配置的变化，配置变化时以新的内容调用 onChange，阻塞到 ctx 结束
+	Watch(ctx context.Context, onChange func(data []byte)) error
+}
+
+type sourceState struct {
+	src    Source
+	format string
+	data   map[string]any
+}
+
+// AddSource 从配置中心读取配置，叠加到配置文件之上、环境变量之下，多个配置中心按添加的顺序叠加；
+// 之后订阅配置的变化，推送的配置格式错误时记录日志并保留之前的配置，ctx 结束时停止订阅，已经叠加的配置保留。
+// 第一次读取失败时返回错误，不会添加
+func AddSource(ctx context.Context, src Source) error {
+	data, format, err := src.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("config: load source: %w", err)
+	}
+	m, err := decodeBytes(data, format)
+	if err != nil {
+		return fmt.Errorf("config: decode source: %w", err)
+	}
+	state := &sourceState{src: src, format: format, data: m}
+	reloadMu.Lock()
+	sources = append(sources, state)
+	reloadMu.Unlock()
+	if err := reload(false); err != nil {
+		logger.Info(err.Error()) // 配置文件不存在等，配置中心的配置仍然生效
+	}
+
+	go func() {
+		err := src.Watch(ctx, func(data []byte) {
+			m, err := decodeBytes(data, state.format)
+			if err != nil {
+				logger.Error("config: decode source: " + err.Error())
+				return
+			}
+			reloadMu.Lock()
+			state.data = m
+			reloadMu.Unlock()
+			if err := reload(false); err != nil {
+				logger.Info(err.Error())
+			}
+		})
+		if err != nil && ctx.Err() == nil {
+			logger.Error("config: watch source: " + err.Error())
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,177 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Unmarshal 把 key 处的配置解析到 out 中，out 为结构体、map 等的指针，如：
+//
+//	type RpcOptions struct {
+//		Address string
+//		Timeout time.Duration         // "3s" 或毫秒数
+//		Retries int    `config:"maxRetries"`
+//	}
+//	var opts RpcOptions
+//	err := config.Unmarshal("grpc.order", &opts)
+//
+// 结构体字段按 config 标签匹配，没有时按 json 标签，再没有时按字段名，都不区分大小写；
+// 配置中没有的字段保持原值，可以先设置默认值。没有 key 的配置时返回错误
+func Unmarshal(key string, out any) error {
+	v, ok := Get(key)
+	if !ok {
+		return fmt.Errorf("config: %s not exist", key)
+	}
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("config: Unmarshal out must be a non-nil pointer")
+	}
+	return decode(key, v, rv.Elem())
+}
+
+// decode 把配置值 v 解析到 out，path 用于错误信息
+func decode(path string, v any, out reflect.Value) error {
+	if v == nil {
+		return nil
+	}
+	if out.Type() == durationType {
+		d, ok := toDuration(v)
+		if !ok {
+			return typeError(path, v, out)
+		}
+		out.SetInt(int64(d))
+		return nil
+	}
+	switch out.Kind() {
+	case reflect.Pointer:
+		if out.IsNil() {
+			out.Set(reflect.New(out.Type().Elem()))
+		}
+		return decode(path, v, out.Elem())
+	case reflect.Interface:
+		if out.NumMethod() != 0 {
+			return typeError(path, v, out)
+		}
+		out.Set(reflect.ValueOf(v))
+	case reflect.String:
+		switch s := v.(type) {
+		case string:
+			out.SetString(s)
+		case int64, float64, bool:
+			out.SetString(fmt.Sprint(s))
+		default:
+			return typeError(path, v, out)
+		}
+	case reflect.Bool:
+		b, ok := v.(bool)
+		if !ok {
+			return typeError(path, v, out)
+		}
+		out.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := toInt64(v)
+		if !ok || out.OverflowInt(n) {
+			return typeError(path, v, out)
+		}
+		out.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := toInt64(v)
+		if !ok || n < 0 || out.OverflowUint(uint64(n)) {
+			return typeError(path, v, out)
+		}
+		out.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		switch n := v.(type) {
+		case float64:
+			out.SetFloat(n)
+		case int64:
+			out.SetFloat(float64(n))
+		default:
+			return typeError(path, v, out)
+		}
+	case reflect.Slice:
+		items := reflect.ValueOf(v)
+		if items.Kind() != reflect.Slice {
+			return typeError(path, v, out)
+		}
+		slice := reflect.MakeSlice(out.Type(), items.Len(), items.Len())
+		for i := 0; i < items.Len(); i++ {
+			if err := decode(fmt.Sprintf("%s.%d", path, i), items.Index(i).Interface(), slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		out.Set(slice)
+	case reflect.Map:
+		m, ok := v.(map[string]any)
+		if !ok || out.Type().Key().Kind() != reflect.String {
+			return typeError(path, v, out)
+		}
+		if out.IsNil() {
+			out.Set(reflect.MakeMapWithSize(out.Type(), len(m)))
+		}
+		for k, e := range m {
+			elem := reflect.New(out.Type().Elem()).Elem()
+			if err := decode(path+"."+k, e, elem); err != nil {
+				return err
+			}
+			out.SetMapIndex(reflect.ValueOf(k).Convert(out.Type().Key()), elem)
+		}
+	case reflect.Struct:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return typeError(path, v, out)
+		}
+		return decodeStruct(path, m, out)
+	default:
+		return typeError(path, v, out)
+	}
+	return nil
+}
+
+// decodeStruct 按字段名解析结构体，匿名的结构体字段展开
+func decodeStruct(path string, m map[string]any, out reflect.Value) error {
+	t := out.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("config") == "" {
+			if err := decodeStruct(path, m, out.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+		name := fieldName(field)
+		if name == "-" {
+			continue
+		}
+		v, ok := lookup(m, name)
+		if !ok {
+			continue
+		}
+		if err := decode(path+"."+name, v, out.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldName 字段对应的配置名称：config 标签、json 标签、字段名
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{"config", "json"} {
+		if name, _, _ := strings.Cut(field.Tag.Get(tag), ","); name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+func typeError(path string, v any, out reflect.Value) error {
+	return fmt.Errorf("config: cannot unmarshal %T into %s of type %s", v, path, out.Type())
+}
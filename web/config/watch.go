@@ -0,0 +1,188 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	reloadMu sync.Mutex     // 保护 sources，保证重新加载按顺序进行
+	notifyMu sync.Mutex     // 保证回调按配置变化的顺序调用
+	sources  []*sourceState // 配置中心，按添加的顺序叠加
+
+	watchMu   sync.Mutex
+	watchers  []*changeWatcher
+	watcherID int
+)
+
+type changeWatcher struct {
+	id  int
+	key string
+	fn  func(old, new any)
+}
+
+// OnChange 注册配置变化的回调，key 为点分隔的路径，见 Get，为空时任意配置变化都会调用。
+// 配置文件修改（见 Watch）、配置中心推送（见 AddSource）或调用 SetCurrent 后，
+// key 处的值与之前不同时调用 fn，old、new 为变化前后的值，没有配置时为 nil。
+// 回调按注册的顺序同步调用，回调中不要再调用 SetCurrent。返回的函数用于取消注册
+func OnChange(key string, fn func(old, new any)) (cancel func()) {
+	watchMu.Lock()
+	watcherID++
+	id := watcherID
+	watchers = append(watchers, &changeWatcher{id: id, key: key, fn: fn})
+	watchMu.Unlock()
+	return func() {
+		watchMu.Lock()
+		defer watchMu.Unlock()
+		for i, w := range watchers {
+			if w.id == id {
+				watchers = append(watchers[:i:i], watchers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// reload 按当前配置的文件和选项重新加载，见 reloadFrom
+func reload(keepOld bool) error {
+	c := GetToml()
+	return reloadFrom(c.file, c.opts, keepOld)
+}
+
+// reloadFrom 读取配置文件，叠加配置中心和环境变量后替换当前的配置。
+// keepOld 为 true 时配置文件读取失败则保留当前的配置，用于修改文件过程中读到不完整内容的情况
+func reloadFrom(file string, o loadOptions, keepOld bool) error {
+	reloadMu.Lock()
+	next, err := build(file, o, sources)
+	if err != nil && keepOld {
+		reloadMu.Unlock()
+		return err
+	}
+	swap(next)
+	return err
+}
+
+// swap 替换当前的配置并调用回调，调用前持有 reloadMu，返回前释放
+func swap(next *WebConfig) {
+	old := current.Swap(next)
+	notifyMu.Lock()
+	reloadMu.Unlock()
+	defer notifyMu.Unlock()
+	notify(old, next)
+}
+
+// notify 对比新旧配置，调用值发生变化的回调
+func notify(old, next *WebConfig) {
+	watchMu.Lock()
+	list := append([]*changeWatcher(nil), watchers...)
+	watchMu.Unlock()
+	for _, w := range list {
+		o, _ := getFrom(old, w.key)
+		n, _ := getFrom(next, w.key)
+		if reflect.DeepEqual(o, n) {
+			continue
+		}
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					logger.Error(fmt.Sprintf("config: OnChange %q panic: %v", w.key, r))
+				}
+			}()
+			w.fn(o, n)
+		}()
+	}
+}
+
+// Watch 定时检查配置文件的修改时间和大小，变化后稳定一个间隔时重新加载，interval 小于等于 0 时为 2 秒。
+// 文件修改后读取失败（如格式错误）时记录日志并保留当前的配置。返回的函数用于停止检查
+func Watch(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var lastFile string
+		var lastMod time.Time
+		var lastSize int64 = -1
+		pending := false // 文件变化后等一个间隔不再变化时才重新加载，避免读到写了一半的文件
+		for {
+			if file := GetToml().file; file != "" {
+				if info, err := os.Stat(file); err == nil {
+					changed := file == lastFile && (!info.ModTime().Equal(lastMod) || info.Size() != lastSize)
+					lastFile, lastMod, lastSize = file, info.ModTime(), info.Size()
+					if changed {
+						pending = true
+					} else if pending {
+						pending = false
+						if err := reload(true); err != nil {
+							logger.Error("config: reload " + err.Error())
+						} else {
+							logger.Info("config: reload " + file)
+						}
+					}
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return cancel
+}
+
+// mergeMaps 把 src 叠加到 dst 上，两边都是表时逐个键合并，否则 src 的值覆盖 dst
+func mergeMaps(dst, src map[string]any) {
+	for k, v := range src {
+		key := k
+		if _, ok := dst[k]; !ok {
+			for name := range dst {
+				if strings.EqualFold(name, k) {
+					key = name
+					break
+				}
+			}
+		}
+		if sm, ok := v.(map[string]any); ok {
+			if dm, ok := dst[key].(map[string]any); ok {
+				mergeMaps(dm, sm)
+				continue
+			}
+		}
+		dst[key] = v
+	}
+}
+
+// cloneValue 深拷贝配置值，叠加环境变量时会修改表，不能影响配置中心保存的内容
+func cloneValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k] = cloneValue(e)
+		}
+		return m
+	case []map[string]any:
+		list := make([]map[string]any, len(v))
+		for i, e := range v {
+			list[i] = cloneValue(e).(map[string]any)
+		}
+		return list
+	case []any:
+		list := make([]any, len(v))
+		for i, e := range v {
+			list[i] = cloneValue(e)
+		}
+		return list
+	default:
+		return v
+	}
+}
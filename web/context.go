@@ -3,6 +3,7 @@ package web
 import (
 	"errors"
 	"github.com/ygb616/web/binding"
+	"github.com/ygb616/web/internal/tree"
 	myLog "github.com/ygb616/web/log"
 	"github.com/ygb616/web/render"
 	"github.com/ygb616/web/util"
@@ -32,6 +33,43 @@ type Context struct {
 	Keys                  map[string]any
 	mu                    sync.RWMutex
 	sameSize              http.SameSite
+	fullPath              string
+	Params                Params // 路由中 :name 参数匹配到的值，按路径中的顺序
+	requestID             string
+	log                   *myLog.Logger // Log() 返回的带请求信息的 Logger
+}
+
+// FullPath 返回匹配到的路由，如 /user/:id，网关转发和没有匹配到路由时为空
+func (c *Context) FullPath() string {
+	return c.fullPath
+}
+
+// Param 路径参数，见 Context.Params
+type Param = tree.Param
+
+// Params 路径参数的列表
+type Params []Param
+
+// Get 返回名称为 name 的参数，没有时 ok 为 false
+func (ps Params) Get(name string) (value string, ok bool) {
+	for _, p := range ps {
+		if p.Key == name {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+// ByName 返回名称为 name 的参数，没有时返回空字符串
+func (ps Params) ByName(name string) string {
+	value, _ := ps.Get(name)
+	return value
+}
+
+// Param 返回路由中 :name 参数匹配到的值，如路由 /user/get/:id 匹配 /user/get/1 时 Param("id") 为 "1"，
+// 没有这个参数时返回空字符串
+func (c *Context) Param(name string) string {
+	return c.Params.ByName(name)
 }
 
 func (c *Context) SetSameSize(site http.SameSite) {
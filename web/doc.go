@@ -0,0 +1,7 @@
+// Package web 轻量的 Web 框架，包含路由、中间件、网关、熔断、限流和认证等组件。
+//
+// # 管理接口
+//
+// BreakerAdmin、LogLevelAdmin 等管理接口可以修改线上的运行状态（熔断、日志级别），
+// 框架不对它们做认证，只应挂在内网端口（见 ServerGroup）或加上认证中间件的分组下。
+package web
@@ -0,0 +1,391 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ygb616/web/gateway"
+	myLog "github.com/ygb616/web/log"
+	"github.com/ygb616/web/metrics"
+	"github.com/ygb616/web/register"
+	"golang.org/x/net/http2"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// gatewayHandle 网关处理逻辑，根据请求路径匹配网关配置，经过中间件后转发
+func (e *Engine) gatewayHandle(ctx *Context) {
+	// 请求过来，具体转发到哪？
+	path := ctx.R.URL.Path                            // 获取请求的URL路径
+	gwConfig, ok := e.gatewayTable.Load().Match(path) // 根据路径在路由表中获取对应的网关配置
+	if !ok {
+		ctx.W.WriteHeader(http.StatusNotFound)             // 如果没有找到对应节点，返回404状态码
+		fmt.Fprintln(ctx.W, ctx.R.RequestURI+" not found") // 返回未找到的请求URI
+		return
+	}
+	ctx.Set(GatewayRouteKey, gwConfig.Name) // 供中间件按路由区分，如限流
+	// 与普通路由一致：先应用引擎级中间件，再应用路由级中间件
+	h := func(ctx *Context) {
+		e.gatewayProxy(ctx, gwConfig)
+	}
+	for _, middlewareFunc := range e.Middles {
+		h = middlewareFunc(h)
+	}
+	for _, middlewareFunc := range e.gatewayMiddles[gwConfig.Name] {
+		h = middlewareFunc(h)
+	}
+	h(ctx)
+}
+
+// 网关指标，通过 metrics.Handler() 输出
+var (
+	gatewayRequests        = metrics.NewCounterVec("gateway_requests_total", "Gateway requests by route, upstream and status code.", "route", "service", "upstream", "code")
+	gatewayRetries         = metrics.NewCounterVec("gateway_retries_total", "Gateway upstream retries by route.", "route")
+	gatewayLatency         = metrics.NewHistogramVec("gateway_request_duration_seconds", "Gateway total request latency by route.", nil, "route")
+	gatewayUpstreamLatency = metrics.NewHistogramVec("gateway_upstream_duration_seconds", "Upstream response header latency by route and upstream.", nil, "route", "upstream")
+)
+
+// gatewayProxy 从注册中心选择服务实例后反向代理
+func (e *Engine) gatewayProxy(ctx *Context, gwConfig gateway.GWConfig) {
+	start := time.Now()
+	trace := &gateway.Trace{}
+	defer e.gatewayAccess(ctx, &gwConfig, trace, start)
+	path := ctx.R.URL.Path
+	if gwConfig.Header != nil {
+		gwConfig.Header(ctx.R) // 设置请求头信息
+	}
+	upgrade := gateway.IsUpgrade(ctx.R)
+	if _, ok := ctx.W.(http.Hijacker); upgrade && !ok {
+		trace.Status = http.StatusInternalServerError
+		ctx.W.WriteHeader(http.StatusInternalServerError) // WebSocket 需要接管连接
+		fmt.Fprintln(ctx.W, "gateway: response writer does not support hijacking")
+		return
+	}
+	gwConfig.ServiceName = gwConfig.Split.ServiceName(ctx.R, gwConfig.ServiceName) // 灰度规则命中时转发到其他服务版本
+	var instances []register.Instance
+	var err error
+	switch {
+	case gwConfig.IsStatic():
+		instances, err = gwConfig.StaticInstances() // 固定的后端地址
+	case e.RegisterCli != nil:
+		instances, err = e.RegisterCli.GetInstances(gwConfig.ServiceName) // 从注册中心获取服务的实例列表
+	default:
+		err = gateway.ErrNoUpstream
+	}
+	if err == nil {
+		for _, filter := range gwConfig.Filters {
+			instances = filter(instances) // 过滤实例，如同可用区、同版本
+		}
+		if gwConfig.Health != nil {
+			instances = gwConfig.Health.Available(instances, gwConfig.UpstreamScheme) // 去掉健康检查摘除的实例
+		}
+	}
+	var instance register.Instance
+	if err == nil {
+		instance, err = gwConfig.Balancer.Select(gwConfig.ServiceName, instances) // 负载均衡选择一个实例
+	}
+	if err != nil {
+		trace.Status = http.StatusInternalServerError // 如果获取服务地址出错，返回500状态码
+		if errors.Is(err, register.ErrNoInstance) || errors.Is(err, gateway.ErrNoUpstream) {
+			trace.Status = http.StatusServiceUnavailable // 没有可用的实例，返回503状态码
+		}
+		if gwConfig.GRPC {
+			gateway.WriteGRPCError(ctx.W, gateway.GRPCUnavailable, err.Error())
+			return
+		}
+		ctx.W.WriteHeader(trace.Status)
+		fmt.Fprintln(ctx.W, err.Error()) // 返回错误信息
+		return
+	}
+	addr := instance.Addr()
+	// 去掉前缀并重写路径，得到后端服务的路径
+	scheme := gwConfig.UpstreamScheme(instance.Metadata)
+	target, err := url.Parse(fmt.Sprintf("%s://%s%s", scheme, addr, gwConfig.TargetPath(path))) // 解析目标地址
+	if err != nil {
+		trace.Status = http.StatusInternalServerError
+		ctx.W.WriteHeader(http.StatusInternalServerError) // 如果解析目标地址出错，返回500状态码
+		fmt.Fprintln(ctx.W, err.Error())                  // 返回错误信息
+		return
+	}
+	// 网关的处理逻辑
+	host := ctx.R.Host
+	director := func(req *http.Request) {
+		gateway.SetForwarded(req, host, gwConfig.StripPrefix) // 转发前的 Host、协议和去掉的前缀
+		gwConfig.Headers.ApplyRequest(req.Header)
+		// 后端服务的日志使用同一个请求 ID
+		req.Header.Set(RequestIDHeader, ctx.RequestID())
+		req.Host = target.Host         // 设置请求的Host
+		req.URL.Host = target.Host     // 设置请求URL的Host
+		req.URL.Path = target.Path     // 设置请求URL的Path
+		req.URL.RawPath = ""           // 路径已经重写，不再使用原始的编码路径
+		req.URL.Scheme = target.Scheme // 设置请求URL的Scheme
+		if _, ok := req.Header["User-Agent"]; !ok {
+			req.Header.Set("User-Agent", "") // 如果请求头中没有User-Agent，设置为空字符串
+		}
+	}
+	// 转发失败时返回 502，超时返回 504，不能让客户端一直等待
+	handler := func(writer http.ResponseWriter, request *http.Request, err error) {
+		e.ModuleLogger("gateway").Error(fmt.Sprintf("gateway %s proxy %s error: %v", gwConfig.Name, request.URL.String(), err))
+		status := http.StatusBadGateway
+		if gateway.IsTimeout(err) {
+			status = http.StatusGatewayTimeout
+		}
+		trace.Status = status
+		if gwConfig.GRPC {
+			code := gateway.GRPCUnavailable
+			if status == http.StatusGatewayTimeout {
+				code = gateway.GRPCDeadlineExceeded
+			}
+			gateway.WriteGRPCError(writer, code, err.Error())
+			return
+		}
+		_ = ctx.JSON(status, map[string]any{
+			"code": status,
+			"msg":  http.StatusText(status),
+		})
+	}
+	var base http.RoundTripper = e.gatewayTransport
+	switch {
+	case gwConfig.GRPC && gwConfig.TLS != nil:
+		base, err = gwConfig.TLS.GRPCTransport() // gRPC over TLS
+	case gwConfig.GRPC:
+		base = e.gatewayGRPCTransport() // gRPC over h2c
+	case gwConfig.TLS != nil:
+		base, err = gwConfig.TLS.Transport(e.gatewayTransport) // 路由单独的 TLS 配置，如自定义 CA、客户端证书
+	}
+	if err != nil {
+		handler(ctx.W, ctx.R, err)
+		return
+	}
+	// 每次转发（包括重试）单独计算连接和响应头超时，并记录转发的实例和耗时
+	transport := gateway.TraceTransport(gwConfig.Timeout.Transport(base))
+	if gwConfig.Health != nil {
+		transport = gwConfig.Health.Transport(transport) // 每次转发的结果都计入被动健康检查
+	}
+	if gwConfig.Retry != nil && !upgrade && !gwConfig.GRPC {
+		// 重试时优先选择没有尝试过的实例
+		pick := func(tried map[string]bool) (register.Instance, error) {
+			rest := make([]register.Instance, 0, len(instances))
+			for _, ins := range instances {
+				if !tried[ins.Addr()] {
+					rest = append(rest, ins)
+				}
+			}
+			if len(rest) == 0 {
+				rest = instances // 所有实例都尝试过，再从全部实例中选择
+			}
+			return gwConfig.Balancer.Select(gwConfig.ServiceName, rest)
+		}
+		transport = gwConfig.Retry.Transport(transport, pick)
+	}
+	if gwConfig.Breaker != nil {
+		// 熔断在重试之外，一次请求的所有重试只计一次
+		transport = gwConfig.Breaker.Transport(gwConfig.ServiceName, transport)
+	}
+	flushInterval := gwConfig.FlushInterval
+	stream := upgrade || gateway.IsEventStream(ctx.R) || gwConfig.GRPC
+	if stream {
+		flushInterval = -1 // 长连接不缓冲，立即刷新给客户端
+	}
+	proxy := httputil.ReverseProxy{
+		Director:      director,      // 设置请求重定向逻辑
+		ErrorHandler:  handler,       // 设置错误处理逻辑
+		Transport:     transport,     // 共用连接池，同一实例的连接可以复用
+		FlushInterval: flushInterval, // 刷新间隔
+		ModifyResponse: func(resp *http.Response) error {
+			trace.Status = resp.StatusCode
+			gwConfig.Headers.ApplyResponse(resp.Header)       // 修改响应头
+			return gwConfig.Transform.TransformResponse(resp) // 转换响应体，出错时返回 502
+		},
+	}
+	req := ctx.R.WithContext(gateway.WithTrace(ctx.R.Context(), trace))
+	if gwConfig.Timeout.Total > 0 && !stream {
+		// 整个请求的超时时间，长连接不限制
+		timeoutCtx, cancel := context.WithTimeout(req.Context(), gwConfig.Timeout.Total)
+		defer cancel()
+		req = req.WithContext(timeoutCtx)
+	}
+	if err := gwConfig.Transform.TransformRequest(req); err != nil {
+		trace.Status = http.StatusBadRequest
+		_ = ctx.JSON(http.StatusBadRequest, map[string]any{"code": http.StatusBadRequest, "msg": err.Error()}) // 转换请求体出错
+		return
+	}
+	proxy.ServeHTTP(ctx.W, req) // 反向代理处理请求
+}
+
+// gatewayGRPCTransport 懒加载转发 gRPC 使用的 h2c Transport
+func (e *Engine) gatewayGRPCTransport() *http2.Transport {
+	e.gatewayGRPCOnce.Do(func() {
+		e.gatewayGRPC = gateway.NewGRPCTransport(nil)
+	})
+	return e.gatewayGRPC
+}
+
+// gatewayAccess 记录网关访问日志和指标
+func (e *Engine) gatewayAccess(ctx *Context, gwConfig *gateway.GWConfig, trace *gateway.Trace, start time.Time) {
+	latency := time.Since(start)
+	status := trace.Status
+	if status == 0 {
+		status = http.StatusBadGateway // 没有收到后端响应，如 ModifyResponse 出错
+	}
+	gatewayRequests.Inc(gwConfig.Name, gwConfig.ServiceName, trace.Upstream, strconv.Itoa(status))
+	gatewayLatency.Observe(latency.Seconds(), gwConfig.Name)
+	if trace.Attempts > 0 {
+		gatewayUpstreamLatency.Observe(trace.UpstreamLatency.Seconds(), gwConfig.Name, trace.Upstream)
+	}
+	retries := 0
+	if trace.Attempts > 1 {
+		retries = trace.Attempts - 1
+		gatewayRetries.Add(float64(retries), gwConfig.Name)
+	}
+	if e.DisableGatewayAccessLog {
+		return
+	}
+	fields := myLog.Fields{
+		"service":         gwConfig.ServiceName,
+		"upstream":        trace.Upstream,
+		"path":            ctx.R.URL.Path,
+		"status":          status,
+		"latency":         latency.String(),
+		"upstreamLatency": trace.UpstreamLatency.String(),
+		"retries":         retries,
+	}
+	// 带上 ctx.Log() 的 route、method、client_ip 和 request_id，级别按 gateway 模块
+	for k, v := range ctx.Log().LoggerFields {
+		fields[k] = v
+	}
+	e.ModuleLogger("gateway").WithFields(fields).Info("gateway access")
+}
+
+// GatewayConfigs 返回当前所有的网关路由
+func (e *Engine) GatewayConfigs() []gateway.GWConfig {
+	return e.gatewayTable.Load().Configs()
+}
+
+// PutGatewayConfig 运行时添加或更新一个网关路由，按名称匹配，路由表整体替换，路径冲突时返回错误
+func (e *Engine) PutGatewayConfig(config gateway.GWConfig) error {
+	return e.updateGateway(func(configs []gateway.GWConfig) []gateway.GWConfig {
+		for i, c := range configs {
+			if c.Name == config.Name {
+				configs[i] = config
+				return configs
+			}
+		}
+		return append(configs, config)
+	})
+}
+
+// ErrGatewayRouteNotFound 删除的网关路由不存在
+var ErrGatewayRouteNotFound = errors.New("web: gateway route not found")
+
+// RemoveGatewayConfig 运行时删除名称为 name 的网关路由，路由不存在时返回 ErrGatewayRouteNotFound
+func (e *Engine) RemoveGatewayConfig(name string) error {
+	found := false
+	err := e.updateGateway(func(configs []gateway.GWConfig) []gateway.GWConfig {
+		result := configs[:0]
+		for _, c := range configs {
+			if c.Name == name {
+				found = true
+				continue
+			}
+			result = append(result, c)
+		}
+		return result
+	})
+	if err == nil && !found {
+		return ErrGatewayRouteNotFound
+	}
+	return err
+}
+
+// updateGateway 基于当前的路由构建新的路由表
+func (e *Engine) updateGateway(update func(configs []gateway.GWConfig) []gateway.GWConfig) error {
+	e.gatewayMu.Lock()
+	defer e.gatewayMu.Unlock()
+	if e.gatewayTransport == nil {
+		e.gatewayTransport = gateway.NewTransport()
+	}
+	old := e.gatewayTable.Load()
+	table, err := gateway.NewTable(update(old.Configs()), old)
+	if err != nil {
+		return err
+	}
+	e.gatewayTable.Store(table)
+	return nil
+}
+
+// WatchGatewayConfig 从 source 中加载网关路由，路由变化时重新构建路由表，ctx 结束时停止
+func (e *Engine) WatchGatewayConfig(ctx context.Context, source gateway.Source) error {
+	ch, err := source.Watch(ctx)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for configs := range ch {
+			if err := e.SetGatewayConfig(configs); err != nil {
+				e.ModuleLogger("gateway").Error(fmt.Sprintf("gateway routes reload failed: %v", err)) // 保持原来的路由
+				continue
+			}
+			e.ModuleLogger("gateway").Info(fmt.Sprintf("gateway routes reloaded, %d routes", len(configs)))
+		}
+	}()
+	return nil
+}
+
+// GatewayAdmin 网关路由的管理接口，需要挂在另外一个 Engine 上（网关模式下不会经过普通路由）：
+// GET 返回所有路由；POST、PUT 添加或更新路由，请求体为 json，字段与 [[gateway.routes]] 相同，
+// 需要 serviceName 或固定的后端地址（targets、host）；DELETE 删除 name 参数指定的路由，路由不存在时返回 404
+func (e *Engine) GatewayAdmin(ctx *Context) {
+	switch ctx.R.Method {
+	case http.MethodGet:
+		routes := make([]map[string]any, 0)
+		for _, c := range e.GatewayConfigs() {
+			routes = append(routes, map[string]any{
+				"name":        c.Name,
+				"path":        c.Path,
+				"serviceName": c.ServiceName,
+				"stripPrefix": c.StripPrefix,
+				"splits":      c.Split.Splits(),
+				"ejected":     c.Health.Ejected(),
+			})
+		}
+		_ = ctx.JSON(http.StatusOK, routes)
+	case http.MethodPost, http.MethodPut:
+		var m map[string]any
+		if err := json.NewDecoder(ctx.R.Body).Decode(&m); err != nil {
+			_ = ctx.JSON(http.StatusBadRequest, map[string]any{"code": http.StatusBadRequest, "msg": err.Error()})
+			return
+		}
+		config := gateway.ConfigByMap(m)
+		if config.Name == "" || config.Path == "" || (config.ServiceName == "" && !config.IsStatic()) {
+			_ = ctx.JSON(http.StatusBadRequest, map[string]any{"code": http.StatusBadRequest, "msg": "name, path and serviceName or targets are required"})
+			return
+		}
+		if err := e.PutGatewayConfig(config); err != nil {
+			_ = ctx.JSON(http.StatusBadRequest, map[string]any{"code": http.StatusBadRequest, "msg": err.Error()})
+			return
+		}
+		_ = ctx.JSON(http.StatusOK, map[string]any{"code": http.StatusOK, "msg": "ok"})
+	case http.MethodDelete:
+		name := ctx.GetQuery("name")
+		if name == "" {
+			_ = ctx.JSON(http.StatusBadRequest, map[string]any{"code": http.StatusBadRequest, "msg": "name is required"})
+			return
+		}
+		if err := e.RemoveGatewayConfig(name); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, ErrGatewayRouteNotFound) {
+				status = http.StatusNotFound
+			}
+			_ = ctx.JSON(status, map[string]any{"code": status, "msg": err.Error()})
+			return
+		}
+		_ = ctx.JSON(http.StatusOK, map[string]any{"code": http.StatusOK, "msg": "ok"})
+	default:
+		ctx.W.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
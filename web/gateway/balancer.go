@@ -0,0 +1,123 @@
+package gateway
+
+import (
+	"github.com/ygb616/web/register"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Balancer 负载均衡器，从服务的实例列表中选择一个实例转发请求
+type Balancer interface {
+	Select(serviceName string, instances []register.Instance) (register.Instance, error)
+}
+
+// available 返回健康且权重大于 0 的实例
+func available(instances []register.Instance) []register.Instance {
+	result := make([]register.Instance, 0, len(instances))
+	for _, ins := range instances {
+		if ins.Healthy && ins.Weight > 0 {
+			result = append(result, ins)
+		}
+	}
+	return result
+}
+
+// RoundRobin 轮询，忽略权重
+type RoundRobin struct {
+	counters sync.Map // 服务名称 -> *uint64
+}
+
+func (b *RoundRobin) Select(serviceName string, instances []register.Instance) (register.Instance, error) {
+	instances = available(instances)
+	if len(instances) == 0 {
+		return register.Instance{}, register.ErrNoInstance
+	}
+	v, _ := b.counters.LoadOrStore(serviceName, new(uint64))
+	n := atomic.AddUint64(v.(*uint64), 1)
+	return instances[(n-1)%uint64(len(instances))], nil
+}
+
+// Random 按权重随机
+type Random struct{}
+
+func (Random) Select(serviceName string, instances []register.Instance) (register.Instance, error) {
+	return register.SelectInstance(instances)
+}
+
+// WeightedRoundRobin 平滑加权轮询（与 nginx 相同的算法），权重高的实例被选中的次数多且分布均匀。
+// 每个实例的当前权重按地址保存，重试、健康检查剔除时传入部分实例只在这些实例中选择，不影响其他实例的状态
+type WeightedRoundRobin struct {
+	mu      sync.Mutex
+	current map[string]map[string]*wrrWeight // 服务名称 -> 实例地址 -> 当前权重
+	pruned  time.Time                        // 上次清理的时间
+}
+
+type wrrWeight struct {
+	current  float64
+	lastSeen time.Time // 最近一次传入该实例的时间
+}
+
+// wrrStaleAfter 实例超过这个时间没有传入时删除它的状态，如实例已经下线
+const wrrStaleAfter = time.Minute
+
+func (b *WeightedRoundRobin) Select(serviceName string, instances []register.Instance) (register.Instance, error) {
+	instances = available(instances)
+	if len(instances) == 0 {
+		return register.Instance{}, register.ErrNoInstance
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if b.current == nil {
+		b.current = make(map[string]map[string]*wrrWeight)
+	}
+	if now.Sub(b.pruned) > wrrStaleAfter {
+		b.pruned = now
+		for name, weights := range b.current {
+			for addr, w := range weights {
+				if now.Sub(w.lastSeen) > wrrStaleAfter {
+					delete(weights, addr)
+				}
+			}
+			if len(weights) == 0 {
+				delete(b.current, name)
+			}
+		}
+	}
+	weights, ok := b.current[serviceName]
+	if !ok {
+		weights = make(map[string]*wrrWeight, len(instances))
+		b.current[serviceName] = weights
+	}
+	var total float64
+	var best *wrrWeight
+	bestIndex := 0
+	for i, ins := range instances {
+		w, ok := weights[ins.Addr()]
+		if !ok {
+			w = &wrrWeight{} // 新的实例
+			weights[ins.Addr()] = w
+		}
+		w.lastSeen = now
+		w.current += ins.Weight
+		total += ins.Weight
+		if best == nil || w.current > best.current {
+			best, bestIndex = w, i
+		}
+	}
+	best.current -= total
+	return instances[bestIndex], nil
+}
+
+// NewBalancer 根据名称创建负载均衡器：round_robin、random、weighted_round_robin（默认）
+func NewBalancer(name string) Balancer {
+	switch name {
+	case "round_robin":
+		return &RoundRobin{}
+	case "random":
+		return Random{}
+	default:
+		return &WeightedRoundRobin{}
+	}
+}
@@ -0,0 +1,268 @@
+package gateway
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"github.com/ygb616/web/breaker"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Degrade 熔断打开时返回给客户端的降级响应
+type Degrade struct {
+	StatusCode  int               // 静态响应的状态码，默认 503
+	ContentType string            // 静态响应的内容类型，默认 application/json
+	Header      map[string]string // 额外的响应头，返回缓存时也会设置，可以用来标记降级
+	Body        []byte            // 静态响应体，默认 {"code":503,"msg":"service unavailable"}
+	// UseCache 优先返回该路径最近一次成功的 GET 响应，Cache-Control 为 private、no-store 的响应不缓存。
+	// 返回缓存时与原来的响应一致，状态码为 200，Content-Type、Content-Encoding 使用缓存的值
+	UseCache    bool
+	MaxCacheLen int64         // 缓存的响应体大小上限，默认 64KB
+	MaxEntries  int           // 缓存的响应个数上限，超过时淘汰最久没有使用的，默认 256
+	CacheTTL    time.Duration // 缓存的有效期，默认 10 分钟
+	CacheQuery  []string      // 默认的缓存键中包含的参数，其他参数不区分缓存
+	// CacheKey 缓存的键，返回空字符串时不缓存。默认为请求的路径和 CacheQuery 中的参数，带 Authorization、Cookie 的请求不缓存，
+	// 避免把一个用户的响应返回给其他用户；需要缓存登录用户的响应时返回带用户标识的键
+	CacheKey func(req *http.Request) string
+}
+
+// BreakerPolicy 网关路由的熔断策略，后端持续失败时直接返回降级响应，不再转发
+type BreakerPolicy struct {
+	Settings breaker.Settings // 熔断器设置，Name 为空时使用服务名称；转发错误和 5xx 计为失败，不使用 IsSuccessful
+	Degrade  Degrade          // 降级响应
+
+	mu    sync.Mutex
+	cache map[string]*list.Element // 熔断器名称 + 缓存的键 -> lru 中的 *cacheEntry
+	lru   *list.List               // 最近使用的在前面
+}
+
+// cacheEntry 降级缓存的一个响应
+type cacheEntry struct {
+	key             string
+	body            []byte
+	contentType     string
+	contentEncoding string
+	expires         time.Time
+}
+
+// breaker 从 breaker.DefaultRegistry 获取名称为 name 的熔断器，转发到同一个服务的路由共用一个熔断器，
+// 灰度转发到其他服务版本时使用各自的熔断器；重新加载网关配置后熔断状态保留
+func (p *BreakerPolicy) breaker(name string) *breaker.CircuitBreaker {
+	st := p.Settings
+	if st.Name != "" {
+		name = st.Name
+	}
+	st.Fallback = nil // 降级由网关处理
+	return breaker.Get(name, st)
+}
+
+// Transport 返回带熔断的 RoundTripper，name 为熔断器名称，一般为转发的服务名称
+func (p *BreakerPolicy) Transport(name string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &breakerTransport{base: base, policy: p, cb: p.breaker(name)}
+}
+
+// cacheKey 返回降级缓存的键，为空时不缓存
+func (p *BreakerPolicy) cacheKey(cb *breaker.CircuitBreaker, req *http.Request) string {
+	var key string
+	switch {
+	case p.Degrade.CacheKey != nil:
+		key = p.Degrade.CacheKey(req)
+	case req.Header.Get("Authorization") != "" || req.Header.Get("Cookie") != "":
+		return "" // 响应可能与用户相关
+	default:
+		key = req.URL.Path
+		if len(p.Degrade.CacheQuery) > 0 {
+			query := req.URL.Query()
+			values := make(url.Values, len(p.Degrade.CacheQuery))
+			for _, name := range p.Degrade.CacheQuery {
+				if v, ok := query[name]; ok {
+					values[name] = v
+				}
+			}
+			if len(values) > 0 {
+				key += "?" + values.Encode()
+			}
+		}
+	}
+	if key == "" {
+		return ""
+	}
+	return cb.Name() + " " + key
+}
+
+// cacheable 判断响应是否可以缓存，Cache-Control 为 private、no-store 或设置了 Cookie 的响应不缓存
+func cacheable(resp *http.Response) bool {
+	if resp.Header.Get("Set-Cookie") != "" {
+		return false
+	}
+	for _, directive := range strings.Split(resp.Header.Get("Cache-Control"), ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "private", "no-store":
+			return false
+		}
+	}
+	return true
+}
+
+type breakerTransport struct {
+	base   http.RoundTripper
+	policy *BreakerPolicy
+	cb     *breaker.CircuitBreaker
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	done, err := t.cb.Allow()
+	if err != nil {
+		return t.policy.degrade(t.cb, req), nil // 熔断打开，返回降级响应
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		done(false)
+		return nil, err
+	}
+	// 5xx 计为失败，但响应照常返回给客户端；流式响应在收到响应头时就报告结果
+	done(resp.StatusCode < http.StatusInternalServerError)
+	if t.policy.Degrade.UseCache && req.Method == http.MethodGet && resp.StatusCode == http.StatusOK && !isStreamResponse(resp) && cacheable(resp) {
+		if key := t.policy.cacheKey(t.cb, req); key != "" {
+			resp.Body = &cacheBody{ReadCloser: resp.Body, policy: t.policy, entry: cacheEntry{
+				key:             key,
+				contentType:     resp.Header.Get("Content-Type"),
+				contentEncoding: resp.Header.Get("Content-Encoding"),
+			}}
+		}
+	}
+	return resp, nil
+}
+
+// degrade 构造降级响应
+func (p *BreakerPolicy) degrade(cb *breaker.CircuitBreaker, req *http.Request) *http.Response {
+	d := p.Degrade
+	header := make(http.Header)
+	body := d.Body
+	statusCode := d.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusServiceUnavailable
+	}
+	contentType := d.ContentType
+	if contentType == "" {
+		contentType = "application/json; charset=utf-8"
+	}
+	if key := p.cacheKey(cb, req); d.UseCache && key != "" {
+		if cached, ok := p.loadCache(key); ok {
+			// 按原来的响应返回，客户端才能正确解析
+			body, statusCode, contentType = cached.body, http.StatusOK, cached.contentType
+			if cached.contentEncoding != "" {
+				header.Set("Content-Encoding", cached.contentEncoding)
+			}
+		}
+	}
+	if body == nil {
+		body = []byte(`{"code":503,"msg":"service unavailable"}`)
+	}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	for k, v := range d.Header {
+		header.Set(k, v)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// loadCache 返回缓存的响应，过期的删除
+func (p *BreakerPolicy) loadCache(key string) (cacheEntry, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	elem, ok := p.cache[key]
+	if !ok {
+		return cacheEntry{}, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		p.lru.Remove(elem)
+		delete(p.cache, key)
+		return cacheEntry{}, false
+	}
+	p.lru.MoveToFront(elem)
+	return *entry, true
+}
+
+// storeCache 保存响应，超过 MaxEntries 时淘汰最久没有使用的
+func (p *BreakerPolicy) storeCache(entry cacheEntry) {
+	ttl := p.Degrade.CacheTTL
+	if ttl <= 0 {
+		ttl = 10 * time.Minute
+	}
+	maxEntries := p.Degrade.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = 256
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cache == nil {
+		p.cache = make(map[string]*list.Element)
+		p.lru = list.New()
+	}
+	entry.expires = time.Now().Add(ttl)
+	if elem, ok := p.cache[entry.key]; ok {
+		*elem.Value.(*cacheEntry) = entry
+		p.lru.MoveToFront(elem)
+		return
+	}
+	p.cache[entry.key] = p.lru.PushFront(&entry)
+	for p.lru.Len() > maxEntries {
+		oldest := p.lru.Back()
+		p.lru.Remove(oldest)
+		delete(p.cache, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// cacheBody 读取响应体的同时缓存，读完后保存为该路径的降级响应
+type cacheBody struct {
+	io.ReadCloser
+	policy *BreakerPolicy
+	entry  cacheEntry // 缓存的键和响应头，读完后补上响应体
+	buf    bytes.Buffer
+	over   bool
+}
+
+func (b *cacheBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if !b.over {
+		maxLen := b.policy.Degrade.MaxCacheLen
+		if maxLen <= 0 {
+			maxLen = 64 << 10
+		}
+		if int64(b.buf.Len()+n) > maxLen {
+			b.over = true // 超过上限不再缓存
+			b.buf.Reset()
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF && !b.over {
+		entry := b.entry
+		entry.body = append([]byte(nil), b.buf.Bytes()...)
+		b.policy.storeCache(entry)
+	}
+	return n, err
+}
@@ -0,0 +1,56 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// roundTripFunc 把函数作为 RoundTripper
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// TestDegradeReplaysCachedResponse 熔断打开时按原来的状态码和 Content-Type 返回缓存，没有缓存时返回静态的降级响应
+func TestDegradeReplaysCachedResponse(t *testing.T) {
+	upstream := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+			Body:       io.NopCloser(strings.NewReader("<p>hello</p>")),
+			Request:    req,
+		}, nil
+	})
+	p := &BreakerPolicy{Degrade: Degrade{UseCache: true, CacheQuery: []string{"lang"}}}
+	transport := p.Transport("TestDegradeReplaysCachedResponse", upstream)
+	get := func(target string) *http.Response {
+		t.Helper()
+		resp, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, target, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	resp := get("/page?lang=en&r=1")
+	_, _ = io.ReadAll(resp.Body) // 读完才会缓存
+	resp.Body.Close()
+
+	cb := transport.(*breakerTransport).cb
+	cb.ForceOpen()
+	defer cb.Reset()
+
+	resp = get("/page?lang=en&r=2") // 不在 CacheQuery 中的参数不影响缓存
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/html; charset=utf-8" || string(body) != "<p>hello</p>" {
+		t.Fatalf("cached degrade = %d %q %q", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+
+	resp = get("/page?lang=fr")
+	if resp.StatusCode != http.StatusServiceUnavailable || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		t.Fatalf("static degrade = %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
@@ -0,0 +1,199 @@
+package gateway
+
+import (
+	"fmt"
+	"github.com/ygb616/web/config"
+	"time"
+)
+
+// ConfigsByConf 从配置文件的 [[gateway.routes]] 中读取网关路由，例如：
+//
+//	[[gateway.routes]]
+//	name = "order"
+//	path = "/order/**"
+//	serviceName = "ordercenter"
+//	stripPrefix = "/order"
+//	# 不使用注册中心时配置固定的后端地址
+//	# targets = ["127.0.0.1:9002", "http://127.0.0.1:9003"]
+//	# 后端使用 https 时配置 CA 和客户端证书
+//	# [gateway.routes.tls]
+//	# caFile = "conf/ca.pem"
+//	# certFile = "conf/client.pem"
+//	# keyFile = "conf/client.key"
+//	loadBalance = "round_robin"
+//	[gateway.routes.timeout]
+//	dial = "1s"
+//	responseHeader = "3s"
+//	[gateway.routes.healthCheck]
+//	path = "/health"
+//	interval = "10s"
+//	maxFails = 3
+//	cooldown = "30s"
+//	[gateway.routes.requestHeaders]
+//	set = { X-Gateway = "web" }
+//	remove = ["Cookie"]
+//	[gateway.routes.responseHeaders]
+//	add = { X-Served-By = "gateway" }
+//	[[gateway.routes.splits]]
+//	serviceName = "ordercenter-v2"
+//	headers = { X-Canary = "true" }
+//	[[gateway.routes.splits]]
+//	serviceName = "ordercenter-v2"
+//	weight = 10
+func ConfigsByConf() []GWConfig {
+	return configsByMap(config.GetToml().Gateway)
+}
+
+// configsByMap 读取 [gateway] 中的 routes
+func configsByMap(gateway map[string]any) []GWConfig {
+	routes := mapsOf(gateway["routes"])
+	configs := make([]GWConfig, 0, len(routes))
+	for _, m := range routes {
+		configs = append(configs, ConfigByMap(m))
+	}
+	return configs
+}
+
+// ConfigByMap 将一个路由的配置转为 GWConfig，配置可以来自 toml 或 json
+func ConfigByMap(m map[string]any) GWConfig {
+	c := GWConfig{}
+	c.Name, _ = m["name"].(string)
+	c.Path, _ = m["path"].(string)
+	c.ServiceName, _ = m["serviceName"].(string)
+	c.StripPrefix, _ = m["stripPrefix"].(string)
+	c.Host, _ = m["host"].(string)
+	switch port := m["port"].(type) {
+	case int64:
+		c.Port = int(port)
+	case float64:
+		c.Port = int(port)
+	}
+	c.Targets = stringsOf(m["targets"])
+	c.Scheme, _ = m["scheme"].(string)
+	c.GRPC, _ = m["grpc"].(bool)
+	if v, ok := m["tls"].(map[string]any); ok {
+		c.TLS = &UpstreamTLS{}
+		c.TLS.CAFile, _ = v["caFile"].(string)
+		c.TLS.CertFile, _ = v["certFile"].(string)
+		c.TLS.KeyFile, _ = v["keyFile"].(string)
+		c.TLS.ServerName, _ = v["serverName"].(string)
+		c.TLS.InsecureSkipVerify, _ = v["insecureSkipVerify"].(bool)
+	}
+	if v, ok := m["rewrite"].(map[string]any); ok {
+		pattern, _ := v["pattern"].(string)
+		target, _ := v["target"].(string)
+		c.Rewrite = &Rewrite{Pattern: pattern, Target: target}
+	}
+	if v, ok := m["loadBalance"].(string); ok {
+		c.Balancer = NewBalancer(v)
+	}
+	if v, ok := m["timeout"].(map[string]any); ok {
+		c.Timeout = Timeout{
+			Dial:           durationOf(v["dial"]),
+			ResponseHeader: durationOf(v["responseHeader"]),
+			Total:          durationOf(v["total"]),
+		}
+	}
+	if v, ok := m["healthCheck"].(map[string]any); ok {
+		c.Health = &HealthCheck{
+			Interval: durationOf(v["interval"]),
+			Timeout:  durationOf(v["timeout"]),
+			Cooldown: durationOf(v["cooldown"]),
+		}
+		c.Health.Path, _ = v["path"].(string)
+		switch maxFails := v["maxFails"].(type) {
+		case int64:
+			c.Health.MaxFails = int(maxFails)
+		case float64:
+			c.Health.MaxFails = int(maxFails)
+		}
+	}
+	if v, ok := m["flushInterval"]; ok {
+		c.FlushInterval = durationOf(v)
+	}
+	if v, ok := m["splits"]; ok {
+		var splits []Split
+		for _, split := range mapsOf(v) {
+			s := Split{
+				Headers: stringMapOf(split["headers"]),
+				Cookies: stringMapOf(split["cookies"]),
+			}
+			s.ServiceName, _ = split["serviceName"].(string)
+			switch weight := split["weight"].(type) {
+			case int64:
+				s.Weight = int(weight)
+			case float64:
+				s.Weight = int(weight)
+			}
+			splits = append(splits, s)
+		}
+		c.Split = NewTrafficSplit(splits...)
+		c.Split.HashHeader, _ = m["splitHashHeader"].(string)
+	}
+	if v, ok := m["requestHeaders"].(map[string]any); ok {
+		c.Headers.AddRequest = stringMapOf(v["add"])
+		c.Headers.SetRequest = stringMapOf(v["set"])
+		c.Headers.RemoveRequest = stringsOf(v["remove"])
+	}
+	if v, ok := m["responseHeaders"].(map[string]any); ok {
+		c.Headers.AddResponse = stringMapOf(v["add"])
+		c.Headers.SetResponse = stringMapOf(v["set"])
+		c.Headers.RemoveResponse = stringsOf(v["remove"])
+	}
+	return c
+}
+
+// durationOf 时间配置支持 "3s" 这样的字符串，或者毫秒数
+func durationOf(v any) time.Duration {
+	switch d := v.(type) {
+	case string:
+		duration, _ := time.ParseDuration(d)
+		return duration
+	case int64:
+		return time.Duration(d) * time.Millisecond
+	case float64:
+		return time.Duration(d) * time.Millisecond
+	}
+	return 0
+}
+
+// mapsOf 读取表数组，toml 解析为 []map[string]any，json 解析为 []any
+func mapsOf(v any) []map[string]any {
+	switch values := v.(type) {
+	case []map[string]any:
+		return values
+	case []any:
+		result := make([]map[string]any, 0, len(values))
+		for _, value := range values {
+			if m, ok := value.(map[string]any); ok {
+				result = append(result, m)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+func stringMapOf(v any) map[string]string {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil
+	}
+	result := make(map[string]string, len(m))
+	for key, value := range m {
+		result[key] = fmt.Sprint(value)
+	}
+	return result
+}
+
+func stringsOf(v any) []string {
+	values, ok := v.([]any)
+	if !ok {
+		return nil
+	}
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		result = append(result, fmt.Sprint(value))
+	}
+	return result
+}
@@ -1,13 +1,35 @@
 package gateway
 
-import "net/http"
+import (
+	"github.com/ygb616/web/register"
+	"net/http"
+	"time"
+)
 
 // GWConfig 定义了网关配置结构体
 type GWConfig struct {
 	Name        string                  // 服务名称
 	Path        string                  // 路径
-	Host        string                  // 主机地址
-	Port        int                     // 端口号
+	Host        string                  // 固定的后端主机地址，配置后不使用注册中心
+	Port        int                     // 固定的后端端口号，默认 80
+	Targets     []string                // 固定的后端地址列表，host:port 或 URL，配置后不使用注册中心，按负载均衡器选择
+	Scheme      string                  // 后端协议 http 或 https，默认 http，配置了 TLS 时默认 https
+	TLS         *UpstreamTLS            // 转发到 https 后端的 TLS 配置，如自定义 CA、客户端证书
+	GRPC        bool                    // 后端是 gRPC 服务，使用 HTTP/2 转发并保留 trailer；客户端到网关也需要是 HTTP/2
 	Header      func(req *http.Request) // 处理请求头的函数
 	ServiceName string                  // 服务名称
+	StripPrefix string                  // 转发前去掉的路径前缀，如 /api
+	Rewrite     *Rewrite                // 路径重写规则，在去掉前缀之后应用
+	Balancer    Balancer                // 负载均衡器，默认为平滑加权轮询
+	Filters     []register.Filter       // 选择实例前使用的过滤器，如同可用区优先
+	Retry       *RetryPolicy            // 重试策略，失败时换一个实例重试，为 nil 时不重试
+	Breaker     *BreakerPolicy          // 熔断策略，后端持续失败时返回降级响应，为 nil 时不熔断
+	Timeout     Timeout                 // 转发超时时间，超时返回 504
+	Health      *HealthCheck            // 健康检查，摘除不健康的实例，为 nil 时不检查
+	Headers     HeaderRules             // 声明式的请求头、响应头修改规则，在 Header 函数之后应用
+	Split       *TrafficSplit           // 灰度规则，按请求头、Cookie 或权重转发到其他服务版本
+	Transform   *Transform              // 请求体、响应体的转换钩子
+	// FlushInterval 转发响应时刷新缓冲的间隔，0 表示响应结束时刷新，负数表示每次写入后立即刷新；
+	// WebSocket 和 SSE 请求总是立即刷新
+	FlushInterval time.Duration
 }
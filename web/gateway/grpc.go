@@ -0,0 +1,59 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"golang.org/x/net/http2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// gRPC 状态码，网关自身出错时返回给 gRPC 客户端
+const (
+	GRPCDeadlineExceeded = 4  // 后端超时
+	GRPCUnavailable      = 14 // 没有可用的后端或转发失败
+)
+
+// IsGRPC 判断是否是 gRPC 请求
+func IsGRPC(req *http.Request) bool {
+	return req.ProtoMajor == 2 && strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc")
+}
+
+// NewGRPCTransport 创建转发 gRPC 使用的 HTTP/2 Transport，tlsConfig 为 nil 时使用 h2c（明文 HTTP/2）
+func NewGRPCTransport(tlsConfig *tls.Config) *http2.Transport {
+	if tlsConfig != nil {
+		return &http2.Transport{TLSClientConfig: tlsConfig}
+	}
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr) // h2c 不需要 TLS 握手
+		},
+	}
+}
+
+// GRPCTransport 基于该 TLS 配置创建转发 gRPC 使用的 HTTP/2 Transport，只创建一次
+func (t *UpstreamTLS) GRPCTransport() (*http2.Transport, error) {
+	t.grpcOnce.Do(func() {
+		config, err := t.ClientConfig()
+		if err != nil {
+			t.grpcErr = err
+			return
+		}
+		config.NextProtos = []string{http2.NextProtoTLS}
+		t.grpcTransport = NewGRPCTransport(config)
+	})
+	return t.grpcTransport, t.grpcErr
+}
+
+// WriteGRPCError 以 Trailers-Only 的形式返回 gRPC 错误，gRPC 客户端才能正确解析
+func WriteGRPCError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", url.PathEscape(msg))
+	w.WriteHeader(http.StatusOK)
+}
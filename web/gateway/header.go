@@ -0,0 +1,55 @@
+package gateway
+
+import (
+	"net/http"
+)
+
+// HeaderRules 声明式的请求头、响应头修改规则，按删除、设置、追加的顺序应用
+type HeaderRules struct {
+	AddRequest     map[string]string // 追加请求头，保留已有的值
+	SetRequest     map[string]string // 设置请求头，覆盖已有的值
+	RemoveRequest  []string          // 删除请求头
+	AddResponse    map[string]string // 追加响应头
+	SetResponse    map[string]string // 设置响应头
+	RemoveResponse []string          // 删除响应头
+}
+
+// ApplyRequest 修改转发给后端的请求头
+func (h HeaderRules) ApplyRequest(header http.Header) {
+	apply(header, h.RemoveRequest, h.SetRequest, h.AddRequest)
+}
+
+// ApplyResponse 修改返回给客户端的响应头
+func (h HeaderRules) ApplyResponse(header http.Header) {
+	apply(header, h.RemoveResponse, h.SetResponse, h.AddResponse)
+}
+
+func apply(header http.Header, remove []string, set, add map[string]string) {
+	for _, k := range remove {
+		header.Del(k)
+	}
+	for k, v := range set {
+		header.Set(k, v)
+	}
+	for k, v := range add {
+		header.Add(k, v)
+	}
+}
+
+// SetForwarded 设置 X-Forwarded-Host、X-Forwarded-Proto、X-Forwarded-Prefix，
+// X-Forwarded-For 由 ReverseProxy 追加；前面还有代理时保留已有的值
+func SetForwarded(req *http.Request, host, prefix string) {
+	if req.Header.Get("X-Forwarded-Host") == "" {
+		req.Header.Set("X-Forwarded-Host", host)
+	}
+	if req.Header.Get("X-Forwarded-Proto") == "" {
+		proto := "http"
+		if req.TLS != nil {
+			proto = "https"
+		}
+		req.Header.Set("X-Forwarded-Proto", proto)
+	}
+	if prefix != "" && req.Header.Get("X-Forwarded-Prefix") == "" {
+		req.Header.Set("X-Forwarded-Prefix", prefix)
+	}
+}
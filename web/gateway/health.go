@@ -0,0 +1,255 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"github.com/ygb616/web/register"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HealthCheck 后端实例的健康检查，不健康的实例暂时从负载均衡中摘除，冷却时间过后重新加入。
+// 主动检查：定期请求每个实例的 Path，请求失败或返回非 2xx 时摘除；
+// 被动检查：转发时同一实例连续失败（5xx、超时、连接失败）MaxFails 次时摘除。
+// 所有实例都被摘除时不再摘除，仍然按原来的实例列表转发，避免整个服务不可用
+type HealthCheck struct {
+	Path           string            // 主动检查的路径，如 /health，为空时不主动检查
+	Interval       time.Duration     // 主动检查的间隔，默认 10 秒
+	Timeout        time.Duration     // 主动检查的超时时间，默认 2 秒
+	ProbeTransport http.RoundTripper // 主动检查使用的 Transport，为空时与路由的转发相同（TLS、gRPC 的 h2c），否则使用 http.DefaultTransport
+	MaxFails       int               // 被动检查连续失败多少次时摘除，默认 3，小于 0 时不被动检查
+	Cooldown       time.Duration     // 摘除的时长，默认 30 秒
+
+	mu      sync.Mutex
+	fails   map[string]int         // 地址 -> 连续失败次数
+	ejected map[string]time.Time   // 地址 -> 重新加入的时间
+	targets map[string]probeTarget // 主动检查的实例，地址 -> 检查地址
+	running bool                   // 主动检查是否在运行
+}
+
+// probeTarget 主动检查的实例
+type probeTarget struct {
+	url      string
+	lastSeen time.Time // 最近一次转发时看到该实例的时间，长时间没有看到时不再检查
+}
+
+func (h *HealthCheck) interval() time.Duration {
+	if h.Interval <= 0 {
+		return 10 * time.Second
+	}
+	return h.Interval
+}
+
+func (h *HealthCheck) cooldown() time.Duration {
+	if h.Cooldown <= 0 {
+		return 30 * time.Second
+	}
+	return h.Cooldown
+}
+
+func (h *HealthCheck) maxFails() int {
+	if h.MaxFails == 0 {
+		return 3
+	}
+	return h.MaxFails
+}
+
+// Available 去掉被摘除的实例，scheme 返回实例使用的协议，用于拼接主动检查的地址。
+// 第一次调用时启动主动检查，一段时间没有请求时主动检查自动停止，下次请求时再启动
+func (h *HealthCheck) Available(instances []register.Instance, scheme func(meta map[string]string) string) []register.Instance {
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.Path != "" {
+		if h.targets == nil {
+			h.targets = make(map[string]probeTarget)
+		}
+		for _, ins := range instances {
+			addr := ins.Addr()
+			h.targets[addr] = probeTarget{url: scheme(ins.Metadata) + "://" + addr + h.Path, lastSeen: now}
+		}
+		if !h.running && len(h.targets) > 0 {
+			h.running = true
+			go h.probeLoop()
+		}
+	}
+	result := make([]register.Instance, 0, len(instances))
+	for _, ins := range instances {
+		if !h.isEjected(ins.Addr(), now) {
+			result = append(result, ins)
+		}
+	}
+	if len(result) == 0 {
+		return instances // 全部摘除时不摘除
+	}
+	return result
+}
+
+// Ejected 返回当前被摘除的实例地址，h 为 nil 时返回 nil
+func (h *HealthCheck) Ejected() []string {
+	if h == nil {
+		return nil
+	}
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	addrs := make([]string, 0, len(h.ejected))
+	for addr := range h.ejected {
+		if h.isEjected(addr, now) {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// isEjected 判断实例是否被摘除，冷却时间过后重新加入，需要持有锁
+func (h *HealthCheck) isEjected(addr string, now time.Time) bool {
+	until, ok := h.ejected[addr]
+	if !ok {
+		return false
+	}
+	if now.After(until) {
+		delete(h.ejected, addr)
+		return false
+	}
+	return true
+}
+
+// eject 摘除实例，需要持有锁
+func (h *HealthCheck) eject(addr string) {
+	if h.ejected == nil {
+		h.ejected = make(map[string]time.Time)
+	}
+	h.ejected[addr] = time.Now().Add(h.cooldown())
+	delete(h.fails, addr)
+}
+
+// onResult 记录一次转发的结果，连续失败达到 MaxFails 次时摘除
+func (h *HealthCheck) onResult(addr string, failed bool) {
+	maxFails := h.maxFails()
+	if maxFails < 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !failed {
+		delete(h.fails, addr)
+		return
+	}
+	if h.fails == nil {
+		h.fails = make(map[string]int)
+	}
+	h.fails[addr]++
+	if h.fails[addr] >= maxFails {
+		h.eject(addr)
+	}
+}
+
+// Transport 返回被动检查的 RoundTripper，需要在重试之内，每次转发都单独记录结果
+func (h *HealthCheck) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &healthTransport{base: base, health: h}
+}
+
+type healthTransport struct {
+	base   http.RoundTripper
+	health *HealthCheck
+}
+
+func (t *healthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil && errors.Is(req.Context().Err(), context.Canceled) {
+		return resp, err // 客户端断开，不是实例的问题
+	}
+	t.health.onResult(req.URL.Host, err != nil || resp.StatusCode >= http.StatusInternalServerError)
+	return resp, err
+}
+
+// probeTransport 返回路由转发使用的 Transport，作为主动检查默认的 Transport，
+// 后端使用自定义 CA、客户端证书或 h2c 时主动检查才能连上；普通路由返回 nil
+func (c GWConfig) probeTransport() (http.RoundTripper, error) {
+	switch {
+	case c.GRPC && c.TLS != nil:
+		transport, err := c.TLS.GRPCTransport()
+		if err != nil {
+			return nil, err
+		}
+		return transport, nil
+	case c.GRPC:
+		return NewGRPCTransport(nil), nil
+	case c.TLS != nil:
+		transport, err := c.TLS.Transport(nil)
+		if err != nil {
+			return nil, err
+		}
+		return transport, nil
+	}
+	return nil, nil
+}
+
+// probeLoop 定期检查最近转发过的实例，没有需要检查的实例时退出
+func (h *HealthCheck) probeLoop() {
+	interval := h.interval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		now := time.Now()
+		h.mu.Lock()
+		targets := make(map[string]string, len(h.targets))
+		for addr, target := range h.targets {
+			if now.Sub(target.lastSeen) > 3*interval && now.Sub(target.lastSeen) > time.Minute {
+				delete(h.targets, addr) // 实例已经下线或没有请求
+				continue
+			}
+			targets[addr] = target.url
+		}
+		if len(targets) == 0 {
+			h.running = false
+			h.mu.Unlock()
+			return
+		}
+		h.mu.Unlock()
+		var wg sync.WaitGroup
+		for addr, url := range targets {
+			wg.Add(1)
+			go func(addr, url string) {
+				defer wg.Done()
+				if !h.probe(url) {
+					h.mu.Lock()
+					h.eject(addr)
+					h.mu.Unlock()
+				}
+			}(addr, url)
+		}
+		wg.Wait()
+	}
+}
+
+// probe 请求检查地址，返回 2xx 时为健康
+func (h *HealthCheck) probe(url string) bool {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false
+	}
+	transport := h.ProbeTransport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
@@ -0,0 +1,62 @@
+package gateway
+
+import (
+	"encoding/pem"
+	"github.com/ygb616/web/register"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestProbeUsesRouteTLS 后端使用私有 CA 时，主动检查使用路由的 TLS 配置，健康的实例不会被摘除
+func TestProbeUsesRouteTLS(t *testing.T) {
+	var probes atomic.Int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			probes.Add(1)
+		}
+	}))
+	defer srv.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	health := &HealthCheck{Path: "/health", Interval: 10 * time.Millisecond}
+	table, err := NewTable([]GWConfig{{
+		Name:   "secure",
+		Path:   "/secure/**",
+		Host:   "127.0.0.1",
+		TLS:    &UpstreamTLS{CAFile: caFile},
+		Health: health,
+	}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := table.Config("secure")
+	if c.Health.ProbeTransport == nil {
+		t.Fatal("probe transport not defaulted from the route tls")
+	}
+
+	host, portStr, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	instances := []register.Instance{{Host: host, Port: port, Weight: 1, Healthy: true}}
+	deadline := time.Now().Add(2 * time.Second)
+	for probes.Load() < 3 && time.Now().Before(deadline) {
+		c.Health.Available(instances, c.UpstreamScheme)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if probes.Load() < 3 {
+		t.Fatalf("upstream saw %d probes, want at least 3", probes.Load())
+	}
+	if ejected := c.Health.Ejected(); len(ejected) != 0 {
+		t.Fatalf("healthy tls instance ejected: %v", ejected)
+	}
+}
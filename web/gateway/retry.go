@@ -0,0 +1,199 @@
+package gateway
+
+import (
+	"bytes"
+	"errors"
+	"github.com/ygb616/web/register"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 重试条件
+const (
+	RetryOn502            = "502"             // 后端返回 502
+	RetryOn503            = "503"             // 后端返回 503
+	RetryOn504            = "504"             // 后端返回 504
+	RetryOnTimeout        = "timeout"         // 连接或读取响应超时
+	RetryOnConnectFailure = "connect-failure" // 连接失败，如实例已下线
+)
+
+// 默认的重试条件
+var defaultRetryOn = []string{RetryOn502, RetryOn503, RetryOnTimeout, RetryOnConnectFailure}
+
+// RetryPolicy 网关路由的重试策略，重试时会换一个后端实例
+type RetryPolicy struct {
+	Attempts    int           // 最大尝试次数（包含第一次请求），小于等于 1 时不重试
+	RetryOn     []string      // 触发重试的条件，为空时使用 502、503、timeout、connect-failure
+	Budget      float64       // 重试预算，统计窗口内重试次数占请求次数的最大比例，如 0.2；为 0 时不限制
+	MinRetries  int           // 统计窗口内不受预算限制的重试次数，默认 10，避免请求量小时无法重试
+	Window      time.Duration // 重试预算的统计窗口，默认 10 秒
+	MaxBodySize int64         // 为了重试而缓存的请求体大小上限，默认 1MB，超过时不重试
+	// RetryNonIdempotent 非幂等的方法（POST、PATCH 等）也按 RetryOn 重试。默认只在连接没有建立时重试，
+	// 超时、5xx 时请求可能已经到达后端，换一个实例重发会重复执行
+	RetryNonIdempotent bool
+
+	mu       sync.Mutex
+	start    time.Time // 当前统计窗口的开始时间
+	requests int       // 当前窗口的请求数
+	retries  int       // 当前窗口的重试数
+}
+
+// Picker 选择一个后端实例，tried 为已经尝试过的实例地址
+type Picker func(tried map[string]bool) (register.Instance, error)
+
+// idempotentMethods 可以安全重试的方法
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// retryable 判断请求是否可以重试，非幂等的方法默认只在连接失败时重试
+func (p *RetryPolicy) retryable(req *http.Request, resp *http.Response, err error) bool {
+	cond := condition(resp, err)
+	if !p.retryOn(cond) {
+		return false
+	}
+	if idempotentMethods[req.Method] || p.RetryNonIdempotent {
+		return true
+	}
+	var opErr *net.OpError
+	return cond == RetryOnConnectFailure && errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// retryOn 判断是否满足重试条件
+func (p *RetryPolicy) retryOn(cond string) bool {
+	conds := p.RetryOn
+	if len(conds) == 0 {
+		conds = defaultRetryOn
+	}
+	for _, c := range conds {
+		if c == cond {
+			return true
+		}
+	}
+	return false
+}
+
+// condition 根据响应或错误得到对应的重试条件
+func condition(resp *http.Response, err error) string {
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return RetryOnTimeout
+		}
+		return RetryOnConnectFailure
+	}
+	return strconv.Itoa(resp.StatusCode)
+}
+
+// window 进入统计窗口，窗口过期时重新计数
+func (p *RetryPolicy) window(now time.Time) {
+	window := p.Window
+	if window <= 0 {
+		window = 10 * time.Second
+	}
+	if now.Sub(p.start) > window {
+		p.start = now
+		p.requests = 0
+		p.retries = 0
+	}
+}
+
+// onRequest 记录一次请求
+func (p *RetryPolicy) onRequest() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.window(time.Now())
+	p.requests++
+}
+
+// allowRetry 判断重试预算是否允许再重试一次，允许时记录重试次数
+func (p *RetryPolicy) allowRetry() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.window(time.Now())
+	minRetries := p.MinRetries
+	if minRetries <= 0 {
+		minRetries = 10
+	}
+	if p.Budget > 0 && p.retries >= minRetries && float64(p.retries+1) > p.Budget*float64(p.requests) {
+		return false
+	}
+	p.retries++
+	return true
+}
+
+// Transport 返回带重试的 RoundTripper，第一次请求发往 Director 设置的实例，重试时通过 pick 选择其他实例
+func (p *RetryPolicy) Transport(base http.RoundTripper, pick Picker) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &retryTransport{base: base, policy: p, pick: pick}
+}
+
+type retryTransport struct {
+	base   http.RoundTripper
+	policy *RetryPolicy
+	pick   Picker
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.policy.onRequest()
+	if t.policy.Attempts <= 1 {
+		return t.base.RoundTrip(req)
+	}
+	// 缓存请求体，每次重试都需要重新发送
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		maxBodySize := t.policy.MaxBodySize
+		if maxBodySize <= 0 {
+			maxBodySize = 1 << 20
+		}
+		if req.ContentLength < 0 || req.ContentLength > maxBodySize {
+			return t.base.RoundTrip(req) // 请求体过大或长度未知，不重试
+		}
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	tried := map[string]bool{req.URL.Host: true}
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		// 客户端已经断开、次数用完或不满足重试条件时直接返回
+		if attempt >= t.policy.Attempts || req.Context().Err() != nil || !t.policy.retryable(req, resp, err) {
+			return resp, err
+		}
+		instance, pickErr := t.pick(tried)
+		if pickErr != nil || !t.policy.allowRetry() {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close() // 丢弃本次响应，释放连接
+		}
+		next := req.Clone(req.Context())
+		next.URL.Host = instance.Addr()
+		next.Host = next.URL.Host
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			next.Body = body
+		}
+		tried[next.URL.Host] = true
+		req = next
+	}
+}
@@ -0,0 +1,127 @@
+package gateway
+
+import (
+	"github.com/ygb616/web/register"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// upstream 记录收到的请求体的测试后端
+type upstream struct {
+	srv    *httptest.Server
+	mu     sync.Mutex
+	bodies []string
+}
+
+func newUpstream(t *testing.T, status int) *upstream {
+	t.Helper()
+	u := &upstream{}
+	u.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		u.mu.Lock()
+		u.bodies = append(u.bodies, string(body))
+		u.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(u.srv.Close)
+	return u
+}
+
+func (u *upstream) received() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]string(nil), u.bodies...)
+}
+
+func instanceOf(t *testing.T, addr string) register.Instance {
+	t.Helper()
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ := strconv.Atoi(portStr)
+	return register.Instance{Host: host, Port: port, Weight: 1, Healthy: true}
+}
+
+// pickUntried 按顺序选择第一个没有尝试过的实例
+func pickUntried(instances ...register.Instance) Picker {
+	return func(tried map[string]bool) (register.Instance, error) {
+		for _, ins := range instances {
+			if !tried[ins.Addr()] {
+				return ins, nil
+			}
+		}
+		return instances[0], nil
+	}
+}
+
+func TestRetryFailover(t *testing.T) {
+	// 已经关闭的地址，连接会被拒绝
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := ln.Addr().String()
+	ln.Close()
+
+	tests := []struct {
+		name        string
+		method      string
+		first       string // 第一次请求的地址，为空时使用返回 503 的后端
+		nonIdem     bool
+		wantStatus  int
+		wantRetried bool
+	}{
+		{name: "GET 503 fails over", method: http.MethodGet, wantStatus: http.StatusOK, wantRetried: true},
+		{name: "PUT 503 replays body", method: http.MethodPut, wantStatus: http.StatusOK, wantRetried: true},
+		{name: "POST 503 not retried", method: http.MethodPost, wantStatus: http.StatusServiceUnavailable},
+		{name: "POST 503 retried when opted in", method: http.MethodPost, nonIdem: true, wantStatus: http.StatusOK, wantRetried: true},
+		{name: "POST dial failure retried", method: http.MethodPost, first: refused, wantStatus: http.StatusOK, wantRetried: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failing := newUpstream(t, http.StatusServiceUnavailable)
+			healthy := newUpstream(t, http.StatusOK)
+			first := tt.first
+			if first == "" {
+				first = failing.srv.Listener.Addr().String()
+			}
+			p := &RetryPolicy{Attempts: 3, RetryNonIdempotent: tt.nonIdem}
+			transport := p.Transport(&http.Transport{}, pickUntried(
+				instanceOf(t, first), instanceOf(t, healthy.srv.Listener.Addr().String())))
+
+			const body = "payload"
+			req := httptest.NewRequest(tt.method, "http://"+first+"/orders", strings.NewReader(body))
+			req.RequestURI = ""
+			resp, err := transport.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			got := healthy.received()
+			if !tt.wantRetried {
+				if len(got) != 0 {
+					t.Fatalf("healthy upstream got %d requests, want 0", len(got))
+				}
+				return
+			}
+			if len(got) != 1 || got[0] != body {
+				t.Fatalf("healthy upstream received %q, want one request with body %q", got, body)
+			}
+			if tt.first == "" {
+				if bodies := failing.received(); len(bodies) != 1 || bodies[0] != body {
+					t.Fatalf("failing upstream received %q, want one request with body %q", bodies, body)
+				}
+			}
+		})
+	}
+}
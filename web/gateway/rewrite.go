@@ -0,0 +1,79 @@
+package gateway
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Rewrite 路径重写规则，Pattern 使用与网关路由相同的通配符：
+// * 匹配一段路径，** 匹配剩余的所有路径，:name 匹配一段路径并可以在 Target 中通过 $name 引用，
+// 通配符按出现顺序依次对应 Target 中的 $1、$2 ...
+// 例如 Pattern: /api/order/**，Target: /order/$1，/api/order/get/1 会被重写为 /order/get/1；
+// Pattern 以 ^ 开头时作为正则表达式使用
+type Rewrite struct {
+	Pattern string // 匹配规则
+	Target  string // 重写后的路径
+
+	once sync.Once
+	re   *regexp.Regexp
+	err  error
+}
+
+// compile 将匹配规则编译为正则表达式，只编译一次
+func (r *Rewrite) compile() (*regexp.Regexp, error) {
+	r.once.Do(func() {
+		if strings.HasPrefix(r.Pattern, "^") {
+			r.re, r.err = regexp.Compile(r.Pattern)
+			return
+		}
+		var b strings.Builder
+		b.WriteString("^")
+		for i, seg := range strings.Split(strings.TrimPrefix(r.Pattern, "/"), "/") {
+			if i > 0 || strings.HasPrefix(r.Pattern, "/") {
+				b.WriteString("/")
+			}
+			switch {
+			case seg == "**":
+				b.WriteString("(.*)")
+			case seg == "*":
+				b.WriteString("([^/]+)")
+			case strings.HasPrefix(seg, ":"):
+				b.WriteString("(?P<" + seg[1:] + ">[^/]+)")
+			default:
+				b.WriteString(regexp.QuoteMeta(seg))
+			}
+		}
+		b.WriteString("$")
+		r.re, r.err = regexp.Compile(b.String())
+	})
+	return r.re, r.err
+}
+
+// Apply 重写路径，不匹配时返回原路径和 false
+func (r *Rewrite) Apply(path string) (string, bool) {
+	re, err := r.compile()
+	if err != nil {
+		return path, false
+	}
+	match := re.FindStringSubmatchIndex(path)
+	if match == nil {
+		return path, false
+	}
+	result := re.ExpandString(nil, r.Target, path, match)
+	return string(result), true
+}
+
+// TargetPath 返回转发到后端服务的路径，先去掉 StripPrefix，再应用 Rewrite
+func (c GWConfig) TargetPath(path string) string {
+	if c.StripPrefix != "" && strings.HasPrefix(path, c.StripPrefix) {
+		path = strings.TrimPrefix(path, c.StripPrefix)
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+	}
+	if c.Rewrite != nil {
+		path, _ = c.Rewrite.Apply(path)
+	}
+	return path
+}
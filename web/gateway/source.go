@@ -0,0 +1,110 @@
+package gateway
+
+import (
+	"context"
+	"github.com/BurntSushi/toml"
+	"github.com/ygb616/web/config"
+	"os"
+	"sync"
+	"time"
+)
+
+// Source 网关路由的来源，路由变化时把全部路由发送到通道中，如配置文件、配置中心
+type Source interface {
+	Watch(ctx context.Context) (<-chan []GWConfig, error)
+}
+
+// FileSource 从 toml 文件的 [[gateway.routes]] 中读取路由，文件修改后重新加载
+type FileSource struct {
+	Path     string        // 文件路径
+	Interval time.Duration // 检查文件是否修改的间隔，默认 5 秒
+}
+
+// ConfigsByFile 从 toml 文件中读取网关路由，格式见 ConfigsByConf
+func ConfigsByFile(path string) ([]GWConfig, error) {
+	var file struct {
+		Gateway map[string]any
+	}
+	if _, err := toml.DecodeFile(path, &file); err != nil {
+		return nil, err
+	}
+	return configsByMap(file.Gateway), nil
+}
+
+func (s *FileSource) Watch(ctx context.Context) (<-chan []GWConfig, error) {
+	info, err := os.Stat(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	configs, err := ConfigsByFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	interval := s.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ch := make(chan []GWConfig, 1)
+	ch <- configs
+	go func() {
+		defer close(ch)
+		modTime := info.ModTime()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			info, err := os.Stat(s.Path)
+			if err != nil || !info.ModTime().After(modTime) {
+				continue
+			}
+			configs, err := ConfigsByFile(s.Path)
+			if err != nil {
+				continue // 文件正在写入或格式错误，等下次修改
+			}
+			modTime = info.ModTime()
+			select {
+			case ch <- configs:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// ConfigSource 从 config 包当前配置的 [[gateway.routes]] 中读取路由，
+// 配置文件修改（config.Watch）或配置中心推送（config.AddSource）后重新加载
+type ConfigSource struct{}
+
+func (ConfigSource) Watch(ctx context.Context) (<-chan []GWConfig, error) {
+	ch := make(chan []GWConfig, 1)
+	ch <- ConfigsByConf()
+	var mu sync.Mutex
+	closed := false
+	cancel := config.OnChange("gateway.routes", func(_, _ any) {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+		// 只保留最新的路由，没有取走的旧路由直接丢弃，不阻塞配置的重新加载
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- ConfigsByConf()
+	})
+	go func() {
+		<-ctx.Done()
+		cancel()
+		mu.Lock()
+		closed = true
+		close(ch)
+		mu.Unlock()
+	}()
+	return ch, nil
+}
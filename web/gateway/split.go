@@ -0,0 +1,105 @@
+package gateway
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"sync"
+)
+
+// Split 流量拆分规则，把路由的部分流量转发到其他服务版本
+type Split struct {
+	ServiceName string            // 目标服务，如 goodscenter-v2
+	Headers     map[string]string // 请求头全部匹配时命中，如 X-Canary: true
+	Cookies     map[string]string // Cookie 全部匹配时命中
+	Weight      int               // 没有配置匹配条件时按权重拆分，取值 0-100，表示百分比
+}
+
+// match 判断请求是否命中匹配条件
+func (s Split) match(req *http.Request) bool {
+	for k, v := range s.Headers {
+		if req.Header.Get(k) != v {
+			return false
+		}
+	}
+	for k, v := range s.Cookies {
+		cookie, err := req.Cookie(k)
+		if err != nil || cookie.Value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// TrafficSplit 路由的灰度规则，可以在运行时调整：
+// 先按顺序匹配配置了请求头或 Cookie 的规则，都不匹配时再按权重拆分，剩余的流量转发到路由原来的服务
+type TrafficSplit struct {
+	HashHeader string // 按权重拆分时根据该请求头的值（如 X-User-Id）计算，同一用户总是转发到同一版本；为空时随机
+
+	mu     sync.RWMutex
+	splits []Split
+}
+
+// NewTrafficSplit 创建灰度规则
+func NewTrafficSplit(splits ...Split) *TrafficSplit {
+	t := &TrafficSplit{}
+	t.Set(splits...)
+	return t
+}
+
+// Set 替换所有规则，运行时调整权重时调用
+func (t *TrafficSplit) Set(splits ...Split) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.splits = append([]Split(nil), splits...)
+}
+
+// Splits 返回当前的规则
+func (t *TrafficSplit) Splits() []Split {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]Split(nil), t.splits...)
+}
+
+// ServiceName 返回请求应该转发到的服务，serviceName 为路由原来的服务
+func (t *TrafficSplit) ServiceName(req *http.Request, serviceName string) string {
+	if t == nil {
+		return serviceName
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if len(t.splits) == 0 {
+		return serviceName
+	}
+	for _, s := range t.splits {
+		if (len(s.Headers) > 0 || len(s.Cookies) > 0) && s.match(req) {
+			return s.ServiceName
+		}
+	}
+	n := -1
+	for _, s := range t.splits {
+		if len(s.Headers) > 0 || len(s.Cookies) > 0 || s.Weight <= 0 {
+			continue
+		}
+		if n < 0 {
+			n = t.bucket(req)
+		}
+		if n < s.Weight {
+			return s.ServiceName
+		}
+		n -= s.Weight
+	}
+	return serviceName
+}
+
+// bucket 返回 0-99 的桶号
+func (t *TrafficSplit) bucket(req *http.Request) int {
+	if t.HashHeader != "" {
+		if v := req.Header.Get(t.HashHeader); v != "" {
+			h := fnv.New32a()
+			h.Write([]byte(v))
+			return int(h.Sum32() % 100)
+		}
+	}
+	return rand.Intn(100)
+}
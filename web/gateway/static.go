@@ -0,0 +1,73 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ygb616/web/register"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrNoUpstream 路由既没有配置固定的后端地址，也没有配置注册中心
+var ErrNoUpstream = errors.New("gateway: no static upstream and no register configured")
+
+// MetaScheme 固定地址以 URL 形式配置时，实例元数据中记录的协议
+const MetaScheme = "scheme"
+
+// IsStatic 判断路由是否配置了固定的后端地址（Targets 或 Host/Port），配置了时不使用注册中心
+func (c GWConfig) IsStatic() bool {
+	return len(c.Targets) > 0 || c.Host != ""
+}
+
+// StaticInstances 将固定的后端地址转为实例列表，权重都为 1
+func (c GWConfig) StaticInstances() ([]register.Instance, error) {
+	if len(c.Targets) == 0 {
+		if c.Host == "" {
+			return nil, ErrNoUpstream
+		}
+		port := c.Port
+		if port == 0 {
+			port = 80
+		}
+		return []register.Instance{{Host: c.Host, Port: port, Weight: 1, Healthy: true}}, nil
+	}
+	instances := make([]register.Instance, 0, len(c.Targets))
+	for _, target := range c.Targets {
+		instance, err := parseTarget(target)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, instance)
+	}
+	return instances, nil
+}
+
+// parseTarget 解析 host:port 或 http(s)://host:port 形式的地址
+func parseTarget(target string) (register.Instance, error) {
+	instance := register.Instance{Weight: 1, Healthy: true}
+	hostPort := target
+	defaultPort := "80"
+	if strings.Contains(target, "://") {
+		u, err := url.Parse(target)
+		if err != nil {
+			return instance, err
+		}
+		hostPort = u.Host
+		instance.Metadata = map[string]string{MetaScheme: u.Scheme}
+		if u.Scheme == "https" {
+			defaultPort = "443"
+		}
+	}
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		host, port = hostPort, defaultPort // 没有端口
+	}
+	instance.Host = host
+	instance.Port, err = strconv.Atoi(port)
+	if err != nil || host == "" {
+		return instance, fmt.Errorf("gateway: invalid upstream target %q", target)
+	}
+	return instance, nil
+}
@@ -0,0 +1,32 @@
+package gateway
+
+import (
+	"net/http"
+	"strings"
+)
+
+// IsUpgrade 判断是否是协议升级请求，如 WebSocket
+func IsUpgrade(req *http.Request) bool {
+	if req.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, value := range req.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsEventStream 判断是否是 SSE 请求
+func IsEventStream(req *http.Request) bool {
+	return strings.Contains(req.Header.Get("Accept"), "text/event-stream")
+}
+
+// isStreamResponse 判断响应是否是长连接，长连接的响应不能缓存
+func isStreamResponse(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusSwitchingProtocols ||
+		strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+}
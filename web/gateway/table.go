@@ -0,0 +1,89 @@
+package gateway
+
+import (
+	"fmt"
+	"github.com/ygb616/web/internal/tree"
+)
+
+// Table 网关路由表，构建之后只读；动态更新路由时构建新的路由表整体替换，正在处理的请求不受影响
+type Table struct {
+	tree    *tree.Node
+	paths   map[string]string // 路径 -> 路由名称
+	configs map[string]GWConfig
+	list    []GWConfig
+}
+
+// NewTable 根据网关配置构建路由表，old 为替换前的路由表，同名路由沿用原来的负载均衡状态。
+// 路径的匹配规则与普通路由相同；路由名称重复、路径重复或无法区分（如 /user/:id 和 /user/*）时返回错误
+func NewTable(configs []GWConfig, old *Table) (*Table, error) {
+	t := &Table{
+		tree:    tree.New(),
+		paths:   make(map[string]string, len(configs)),
+		configs: make(map[string]GWConfig, len(configs)),
+		list:    make([]GWConfig, 0, len(configs)),
+	}
+	//把这个路径 存储起来 访问的时候 去匹配这里面的路由 如果匹配，就拿出来相应的匹配结果
+	for _, v := range configs {
+		if _, ok := t.configs[v.Name]; ok {
+			return nil, fmt.Errorf("gateway: duplicate route name %s", v.Name)
+		}
+		_, exist, err := t.tree.Put(v.Path)
+		if err != nil {
+			return nil, fmt.Errorf("gateway: route %s: %w", v.Name, err)
+		}
+		if exist {
+			return nil, fmt.Errorf("gateway: route %s: path %s already used by route %s", v.Name, v.Path, t.paths[v.Path])
+		}
+		t.paths[v.Path] = v.Name
+		if v.Split == nil {
+			v.Split = &TrafficSplit{} // 便于运行时调整灰度规则
+		}
+		if v.Balancer == nil {
+			if prev, ok := old.Config(v.Name); ok {
+				v.Balancer = prev.Balancer
+			} else {
+				v.Balancer = &WeightedRoundRobin{} // 每个路由独立的负载均衡状态
+			}
+		}
+		if v.Health != nil && v.Health.ProbeTransport == nil {
+			transport, err := v.probeTransport()
+			if err != nil {
+				return nil, fmt.Errorf("gateway: route %s: %w", v.Name, err)
+			}
+			v.Health.ProbeTransport = transport
+		}
+		t.configs[v.Name] = v
+		t.list = append(t.list, v)
+	}
+	return t, nil
+}
+
+// Match 根据请求路径匹配路由
+func (t *Table) Match(path string) (GWConfig, bool) {
+	if t == nil {
+		return GWConfig{}, false
+	}
+	node := t.tree.Get(path)
+	if node == nil {
+		return GWConfig{}, false
+	}
+	c, ok := t.configs[t.paths[node.RouterName()]]
+	return c, ok
+}
+
+// Config 根据名称获取路由
+func (t *Table) Config(name string) (GWConfig, bool) {
+	if t == nil {
+		return GWConfig{}, false
+	}
+	c, ok := t.configs[name]
+	return c, ok
+}
+
+// Configs 返回所有路由，顺序与配置顺序一致
+func (t *Table) Configs() []GWConfig {
+	if t == nil {
+		return nil
+	}
+	return append([]GWConfig(nil), t.list...)
+}
@@ -0,0 +1,90 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"golang.org/x/net/http2"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// UpstreamTLS 转发到 https 后端时的 TLS 配置，支持自定义 CA 和客户端证书（mTLS）
+type UpstreamTLS struct {
+	CAFile             string      // 校验后端证书的 CA，为空时使用系统 CA
+	CertFile           string      // 客户端证书，与 KeyFile 同时配置时启用 mTLS
+	KeyFile            string      // 客户端私钥
+	ServerName         string      // 校验后端证书使用的域名，后端通过 IP 访问时需要配置
+	InsecureSkipVerify bool        // 不校验后端证书，仅用于测试
+	Config             *tls.Config // 直接指定 TLS 配置，优先于上面的文件配置
+
+	once      sync.Once
+	transport *http.Transport
+	err       error
+
+	grpcOnce      sync.Once
+	grpcTransport *http2.Transport
+	grpcErr       error
+}
+
+// ClientConfig 根据配置生成 tls.Config
+func (t *UpstreamTLS) ClientConfig() (*tls.Config, error) {
+	if t.Config != nil {
+		return t.Config.Clone(), nil
+	}
+	config := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("gateway: no certificates found in " + t.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if t.CertFile != "" && t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// Transport 基于 base 创建使用该 TLS 配置的 Transport，只创建一次，路由的所有请求共用
+func (t *UpstreamTLS) Transport(base *http.Transport) (*http.Transport, error) {
+	t.once.Do(func() {
+		config, err := t.ClientConfig()
+		if err != nil {
+			t.err = err
+			return
+		}
+		if base == nil {
+			base = NewTransport()
+		}
+		t.transport = base.Clone()
+		t.transport.TLSClientConfig = config
+	})
+	return t.transport, t.err
+}
+
+// UpstreamScheme 返回转发到实例时使用的协议：实例元数据中的 scheme 优先，其次是路由配置的 Scheme，默认 http
+func (c GWConfig) UpstreamScheme(instanceMetadata map[string]string) string {
+	if scheme := instanceMetadata[MetaScheme]; scheme != "" {
+		return scheme
+	}
+	if c.Scheme != "" {
+		return c.Scheme
+	}
+	if c.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
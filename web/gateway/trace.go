@@ -0,0 +1,53 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Trace 一次网关转发的记录，用于访问日志和指标
+type Trace struct {
+	Upstream        string        // 最后一次转发的后端实例地址
+	Attempts        int           // 转发次数，大于 1 表示发生了重试
+	UpstreamLatency time.Duration // 所有转发等待后端响应头的耗时之和
+	Status          int           // 返回给客户端的状态码
+}
+
+type traceKey struct{}
+
+// WithTrace 将 Trace 放到上下文中，TraceTransport 会记录转发的情况
+func WithTrace(ctx context.Context, trace *Trace) context.Context {
+	return context.WithValue(ctx, traceKey{}, trace)
+}
+
+// TraceFrom 从上下文中获取 Trace，不存在时返回 nil
+func TraceFrom(ctx context.Context) *Trace {
+	trace, _ := ctx.Value(traceKey{}).(*Trace)
+	return trace
+}
+
+// TraceTransport 返回记录每次转发的 RoundTripper，应当在重试之内，每次重试都会记录
+func TraceTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return traceTransport{base: base}
+}
+
+type traceTransport struct {
+	base http.RoundTripper
+}
+
+func (t traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	trace := TraceFrom(req.Context())
+	if trace == nil {
+		return t.base.RoundTrip(req)
+	}
+	start := time.Now()
+	trace.Upstream = req.URL.Host
+	trace.Attempts++
+	resp, err := t.base.RoundTrip(req)
+	trace.UpstreamLatency += time.Since(start)
+	return resp, err
+}
@@ -0,0 +1,117 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Transform 请求体、响应体的转换钩子，可以读取并修改转发的请求和响应；
+// 请求体或响应体超过 MaxBodySize、长连接以及压缩过的响应不会转换，原样转发
+type Transform struct {
+	Request     func(req *http.Request, body []byte) ([]byte, error)   // 转发给后端前修改请求体
+	Response    func(resp *http.Response, body []byte) ([]byte, error) // 返回给客户端前修改响应体
+	MaxBodySize int64                                                  // 读取的请求体、响应体大小上限，默认 1MB
+}
+
+func (t *Transform) maxBodySize() int64 {
+	if t.MaxBodySize <= 0 {
+		return 1 << 20
+	}
+	return t.MaxBodySize
+}
+
+// readBody 最多读取 max 字节，超过时返回 false，并把已经读取的内容还原到 body 中
+func readBody(body *io.ReadCloser, max int64) ([]byte, bool, error) {
+	data, err := io.ReadAll(io.LimitReader(*body, max+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(data)) > max {
+		*body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), *body), *body}
+		return nil, false, nil
+	}
+	(*body).Close()
+	return data, true, nil
+}
+
+// TransformRequest 转换请求体，在 Director 中调用
+func (t *Transform) TransformRequest(req *http.Request) error {
+	if t == nil || t.Request == nil || IsUpgrade(req) {
+		return nil
+	}
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		data, ok, err := readBody(&req.Body, t.maxBodySize())
+		if err != nil || !ok {
+			return err
+		}
+		body = data
+	}
+	body, err := t.Request(req, body)
+	if err != nil {
+		return err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	if len(body) > 0 {
+		req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	} else {
+		req.Header.Del("Content-Length")
+	}
+	return nil
+}
+
+// TransformResponse 转换响应体，在 ModifyResponse 中调用
+func (t *Transform) TransformResponse(resp *http.Response) error {
+	if t == nil || t.Response == nil || isStreamResponse(resp) {
+		return nil
+	}
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return nil // 压缩过的响应不转换
+	}
+	data, ok, err := readBody(&resp.Body, t.maxBodySize())
+	if err != nil || !ok {
+		return err
+	}
+	body, err := t.Response(resp, data)
+	if err != nil {
+		return err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+// WrapResult 响应体转换钩子：把后端返回的 json 包装为统一的返回格式 {"Code":..., "Msg":..., "Data":...}，
+// 已经是统一格式（包含 Code 字段）或者不是 json 的响应原样返回
+func WrapResult(resp *http.Response, body []byte) ([]byte, error) {
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") || !json.Valid(body) {
+		return body, nil
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) == nil {
+		if _, ok := fields["Code"]; ok {
+			return body, nil
+		}
+	}
+	msg := "success"
+	if resp.StatusCode >= http.StatusBadRequest {
+		msg = http.StatusText(resp.StatusCode)
+	}
+	return json.Marshal(map[string]any{
+		"Code": resp.StatusCode,
+		"Msg":  msg,
+		"Data": json.RawMessage(body),
+	})
+}
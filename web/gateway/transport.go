@@ -0,0 +1,142 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Timeout 网关路由转发的超时时间，0 表示使用 Transport 的设置
+type Timeout struct {
+	Dial           time.Duration // 连接后端实例的超时时间
+	ResponseHeader time.Duration // 发送请求后等待响应头的超时时间
+	Total          time.Duration // 整个请求（包含重试和读取响应体）的超时时间，对 WebSocket、SSE 不生效
+}
+
+// timeoutError 后端超时，实现 net.Error，重试策略按 timeout 条件处理
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "gateway: upstream response header timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// ErrResponseHeaderTimeout 等待后端响应头超时
+var ErrResponseHeaderTimeout error = timeoutError{}
+
+// dialTimeoutKey 请求上下文中单个路由的连接超时时间
+type dialTimeoutKey struct{}
+
+// NewTransport 创建网关转发使用的 Transport，所有路由共用，按后端实例保持空闲连接；
+// 请求上下文中带有路由的连接超时时间时使用路由的设置
+func NewTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if timeout, ok := ctx.Value(dialTimeoutKey{}).(time.Duration); ok {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			return dialer.DialContext(ctx, network, addr)
+		},
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          1000,             // 所有实例的最大空闲连接数
+		MaxIdleConnsPerHost:   100,              // 每个实例的最大空闲连接数，默认值 2 在网关场景下过小
+		IdleConnTimeout:       90 * time.Second, // 空闲连接的超时时间
+		TLSHandshakeTimeout:   10 * time.Second, // TLS 握手的超时时间
+		ExpectContinueTimeout: 1 * time.Second,  // 100-continue 状态码的超时时间
+	}
+}
+
+// Transport 返回按路由设置连接和响应头超时的 RoundTripper，每次重试单独计时
+func (t Timeout) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if t.Dial <= 0 && t.ResponseHeader <= 0 {
+		return base
+	}
+	return &timeoutTransport{base: base, timeout: t}
+}
+
+type timeoutTransport struct {
+	base    http.RoundTripper
+	timeout Timeout
+}
+
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if t.timeout.Dial > 0 {
+		ctx = context.WithValue(ctx, dialTimeoutKey{}, t.timeout.Dial)
+	}
+	if t.timeout.ResponseHeader <= 0 {
+		return t.base.RoundTrip(req.WithContext(ctx))
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	var timedOut atomic.Bool
+	timer := time.AfterFunc(t.timeout.ResponseHeader, func() {
+		timedOut.Store(true)
+		cancel()
+	})
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	timer.Stop()
+	if timedOut.Load() {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, ErrResponseHeaderTimeout
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// 响应头已经收到，读取完响应体后再释放上下文
+	if rwc, ok := resp.Body.(io.ReadWriteCloser); ok {
+		resp.Body = &cancelReadWriteCloser{ReadWriteCloser: rwc, cancel: cancel} // 协议升级的连接需要可写
+	} else {
+		resp.Body = &cancelReadCloser{ReadCloser: resp.Body, cancel: cancel}
+	}
+	return resp, nil
+}
+
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelReadCloser) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+type cancelReadWriteCloser struct {
+	io.ReadWriteCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelReadWriteCloser) Close() error {
+	err := b.ReadWriteCloser.Close()
+	b.cancel()
+	return err
+}
+
+// IsTimeout 判断转发错误是否是超时
+func IsTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
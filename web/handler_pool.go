@@ -0,0 +1,51 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"github.com/ygb616/web/pool"
+	"net/http"
+)
+
+// WithHandlerPool 所有的请求在 p 中处理，同时处理的请求数不超过 p 的容量，
+// 不再每个连接一个不受限制的 goroutine；p 过载时返回 503 并设置 Retry-After。
+// p 为阻塞模式时请求等待空闲的 worker，直到请求的 ctx 结束，需要快速失败时使用
+// pool.WithNonblocking 或 pool.WithQueue(n, pool.RejectAbort)；传入 nil 时取消
+func (e *Engine) WithHandlerPool(p *pool.Pool) {
+	e.handlerPool = p
+}
+
+// HandlerPool 返回在 p 中执行后续处理的中间件，只限制耗资源的路由或路由组，过载时返回 503：
+//
+//	heavy := pool.Get("report")
+//	g.Get("/export", export, web.HandlerPool(heavy))
+func HandlerPool(p *pool.Pool) MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) {
+			runInPool(p, ctx, next)
+		}
+	}
+}
+
+// runInPool 在 p 中执行 h 并等待执行完，执行完之前 ResponseWriter 不能失效
+func runInPool(p *pool.Pool, ctx *Context, h HandlerFunc) {
+	future := pool.SubmitFuncCtx(ctx.R.Context(), p, func() (struct{}, error) {
+		h(ctx)
+		return struct{}{}, nil
+	})
+	_, err := future.Get(context.Background())
+	switch {
+	case err == nil:
+	case errors.Is(err, context.Canceled):
+		// 客户端断开，不需要响应
+	case errors.Is(err, pool.ErrPoolOverload), errors.Is(err, pool.ErrorHasClosed), errors.Is(err, context.DeadlineExceeded):
+		ctx.W.Header().Set("Retry-After", "1")
+		_ = ctx.JSON(http.StatusServiceUnavailable, map[string]any{
+			"code": http.StatusServiceUnavailable,
+			"msg":  "server busy",
+		})
+	default:
+		// 处理函数 panic，由 pool 的 PanicHandler 记录
+		ctx.Fail(http.StatusInternalServerError, "Internal Server Error")
+	}
+}
@@ -0,0 +1,99 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"github.com/ygb616/web/register"
+	"net/http"
+	"time"
+)
+
+// HealthChecker 健康检查函数，返回错误表示实例不健康
+type HealthChecker func() error
+
+// AddHealthChecker 添加健康检查，name 用于日志和健康检查接口的输出
+func (e *Engine) AddHealthChecker(name string, checker HealthChecker) {
+	e.healthMu.Lock()
+	defer e.healthMu.Unlock()
+	if e.healthCheckers == nil {
+		e.healthCheckers = make(map[string]HealthChecker)
+	}
+	e.healthCheckers[name] = checker
+}
+
+// CheckHealth 执行所有健康检查，返回每个失败检查的错误
+func (e *Engine) CheckHealth() map[string]error {
+	e.healthMu.Lock()
+	checkers := make(map[string]HealthChecker, len(e.healthCheckers))
+	for name, checker := range e.healthCheckers {
+		checkers[name] = checker
+	}
+	e.healthMu.Unlock()
+	failed := make(map[string]error)
+	for name, checker := range checkers {
+		if err := checker(); err != nil {
+			failed[name] = err
+		}
+	}
+	return failed
+}
+
+// SetHealthy 设置所有已注册实例在注册中心的健康状态，不健康的实例会退出轮询但进程不退出
+func (e *Engine) SetHealthy(healthy bool) error {
+	if e.RegisterCli == nil {
+		return nil
+	}
+	var lastErr error
+	for _, ins := range e.registeredInstances() {
+		instance := register.Instance{Host: ins.host, Port: ins.port, Healthy: healthy}
+		err := e.RegisterCli.SetHealthy(ins.serviceName, instance, healthy)
+		if err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// ReportHealth 按 interval 定期执行健康检查，状态变化时上报注册中心，ctx 取消后停止
+func (e *Engine) ReportHealth(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		healthy := true // 注册时实例是健康的
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			failed := e.CheckHealth()
+			current := len(failed) == 0
+			if current == healthy {
+				continue
+			}
+			for name, err := range failed {
+				e.Logger.Error(fmt.Sprintf("health check %s failed: %v", name, err))
+			}
+			if err := e.SetHealthy(current); err != nil {
+				e.Logger.Error(err)
+				continue // 上报失败，下次继续上报
+			}
+			healthy = current
+			e.Logger.Info(fmt.Sprintf("instance health reported: %v", healthy))
+		}
+	}()
+}
+
+// HealthHandler 健康检查接口，全部检查通过返回 200，否则返回 503 和失败的检查，可用作 kubernetes 的 readiness 探针
+func (e *Engine) HealthHandler(ctx *Context) {
+	failed := e.CheckHealth()
+	if len(failed) == 0 {
+		_ = ctx.JSON(http.StatusOK, map[string]any{"status": "UP"})
+		return
+	}
+	checks := make(map[string]string, len(failed))
+	for name, err := range failed {
+		checks[name] = err.Error()
+	}
+	_ = ctx.JSON(http.StatusServiceUnavailable, map[string]any{"status": "DOWN", "checks": checks})
+}
@@ -0,0 +1,16 @@
+package redis
+
+import "context"
+
+// Client 执行 Redis 命令，key 不存在时返回 (nil, nil)，不依赖具体的 Redis 客户端。
+// breaker、token、auth 和 web 包的 RedisClient 都是它的别名，同一个客户端可以传给所有的 Redis 存储
+type Client interface {
+	Do(ctx context.Context, args ...any) (any, error)
+}
+
+// Func 函数形式的 Client
+type Func func(ctx context.Context, args ...any) (any, error)
+
+func (f Func) Do(ctx context.Context, args ...any) (any, error) {
+	return f(ctx, args...)
+}
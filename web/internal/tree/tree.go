@@ -0,0 +1,308 @@
+// Package tree 路由树，普通路由和网关路由共用同一套匹配规则
+package tree
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Node 路由树的节点，路径按 / 分段，每段一个节点。
+// 构建完成之后只读，匹配时不修改节点，可以并发匹配。
+// 每段支持：静态名称、:name 参数（匹配一段）、*（匹配一段）、**（匹配剩余的所有段，至少一段），
+// 参数可以带约束，只有满足约束的段才匹配：:id(\d+) 为正则表达式（不能包含 /），:id|int 为类型，见 paramTypes。
+// 匹配的优先级为 静态名称 > 带约束的参数（按注册顺序） > 不带约束的参数或 * > **，
+// 高优先级的分支匹配不到时回退到低优先级的分支，所以 /user/:id|int、/user/:name、/user/new 可以同时注册。
+// 静态名称的子节点按名称索引，匹配时逐段扫描路径、不切分字符串，
+// 耗时只与路径的长度有关，与注册的路由数量无关
+type Node struct {
+	name       string            // 节点的名称，即路径中的一段
+	static     map[string]*Node  // 静态名称的子节点，名称 -> 子节点
+	params     []*Node           // :name 或 * 子节点，带约束的在前，不带约束的最多一个、在最后
+	key        string            // 参数的名称，不含 : 和约束
+	constraint string            // 参数的约束，如 (\d+)、|int，不带约束时为空
+	check      func(string) bool // 检查段是否满足约束，不带约束时为 nil
+	catchAll   *Node             // ** 子节点
+	routerName string            // 注册时的完整路径，只有尾节点才有
+	isEnd      bool              // 是否是尾节点
+	// Value 注册路径时保存的数据，如路由的处理函数，由调用方设置
+	Value any
+}
+
+// Param 匹配到的路径参数，如 /user/get/:id 匹配 /user/get/1 时为 {Key: "id", Value: "1"}
+type Param struct {
+	Key   string
+	Value string
+}
+
+// New 创建根节点
+func New() *Node {
+	return &Node{name: "/"}
+}
+
+// RouterName 返回注册时的完整路径
+func (n *Node) RouterName() string {
+	return n.routerName
+}
+
+// IsEnd 是否是注册过的路径的尾节点
+func (n *Node) IsEnd() bool {
+	return n.isEnd
+}
+
+// isParam 判断是否是匹配一段的通配符
+func isParam(name string) bool {
+	return strings.HasPrefix(name, ":") || name == "*"
+}
+
+// paramTypes :name|type 支持的类型
+var paramTypes = map[string]func(string) bool{
+	"int": func(s string) bool {
+		return isDigits(strings.TrimPrefix(s, "-"))
+	},
+	"uint":  isDigits,
+	"alpha": allBytes(func(b byte) bool { return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' }),
+	"alnum": allBytes(func(b byte) bool { return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' }),
+	"hex":   allBytes(isHex),
+	"uuid": func(s string) bool {
+		if len(s) != 36 {
+			return false
+		}
+		for i := 0; i < len(s); i++ {
+			if i == 8 || i == 13 || i == 18 || i == 23 {
+				if s[i] != '-' {
+					return false
+				}
+			} else if !isHex(s[i]) {
+				return false
+			}
+		}
+		return true
+	},
+}
+
+var isDigits = allBytes(func(b byte) bool { return '0' <= b && b <= '9' })
+
+func isHex(b byte) bool {
+	return '0' <= b && b <= '9' || 'a' <= b && b <= 'f' || 'A' <= b && b <= 'F'
+}
+
+// allBytes 返回检查非空字符串的每个字节都满足 f 的函数
+func allBytes(f func(b byte) bool) func(string) bool {
+	return func(s string) bool {
+		if s == "" {
+			return false
+		}
+		for i := 0; i < len(s); i++ {
+			if !f(s[i]) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// newParam 解析参数段，如 :id、:id(\d+)、:id|int、*
+func newParam(name string) (*Node, error) {
+	n := &Node{name: name}
+	if name == "*" {
+		return n, nil
+	}
+	key := name[1:]
+	if i := strings.IndexAny(key, "(|"); i >= 0 {
+		key, n.constraint = key[:i], key[i:]
+	}
+	if key == "" {
+		return nil, fmt.Errorf("param %s has no name", name)
+	}
+	n.key = key
+	switch {
+	case n.constraint == "":
+	case n.constraint[0] == '|':
+		check, ok := paramTypes[n.constraint[1:]]
+		if !ok {
+			return nil, fmt.Errorf("param %s has unknown type %s", name, n.constraint[1:])
+		}
+		n.check = check
+	case strings.HasSuffix(n.constraint, ")"):
+		re, err := regexp.Compile("^(?:" + n.constraint[1:len(n.constraint)-1] + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("param %s: %w", name, err)
+		}
+		n.check = re.MatchString
+	default:
+		return nil, fmt.Errorf("param %s has unclosed constraint", name)
+	}
+	return n, nil
+}
+
+// Put 插入路径，示例路径: /user/get/:id。
+// 返回路径对应的尾节点，路径已经注册过时 exist 为 true；
+// 同一位置已经有约束相同、名称不同的参数（如 /user/:id 和 /user/:name）时返回错误，这两个路径无法区分；
+// 参数的约束格式错误时返回错误；** 匹配剩余的所有段，后面还有段（如 /a/**/b）时返回错误
+func (n *Node) Put(path string) (node *Node, exist bool, err error) {
+	t := n
+	names := strings.Split(path, "/")[1:]
+	for i, name := range names {
+		var child *Node
+		switch {
+		case isParam(name):
+			param, err := newParam(name)
+			if err != nil {
+				return nil, false, fmt.Errorf("path %s: %w", path, err)
+			}
+			for _, c := range t.params {
+				if c.constraint != param.constraint {
+					continue
+				}
+				// 约束相同时无法区分，名称也必须相同
+				if c.name != name {
+					return nil, false, fmt.Errorf("path %s conflicts with existing wildcard %s", path, c.name)
+				}
+				child = c
+			}
+			if child == nil {
+				child = param
+				if param.check == nil || len(t.params) == 0 || t.params[len(t.params)-1].check != nil {
+					t.params = append(t.params, param)
+				} else {
+					// 插入到不带约束的参数之前
+					last := t.params[len(t.params)-1]
+					t.params = append(t.params[:len(t.params)-1], param, last)
+				}
+			}
+		case name == "**":
+			if i != len(names)-1 {
+				return nil, false, fmt.Errorf("path %s: ** must be the last segment", path)
+			}
+			if t.catchAll == nil {
+				t.catchAll = &Node{name: name}
+			}
+			child = t.catchAll
+		default:
+			if t.static == nil {
+				t.static = make(map[string]*Node)
+			}
+			child = t.static[name]
+			if child == nil {
+				child = &Node{name: name}
+				t.static[name] = child
+			}
+		}
+		t = child
+	}
+	if t.isEnd {
+		return t, true, nil
+	}
+	t.isEnd = true
+	t.routerName = path
+	return t, false, nil
+}
+
+// Get 返回与路径匹配的尾节点，没有匹配时返回 nil，示例路径: /user/get/1
+func (n *Node) Get(path string) *Node {
+	rest, done := trimRoot(path)
+	return n.match(rest, done, nil)
+}
+
+// Match 与 Get 相同，同时把 :name 参数匹配到的值按路径中的顺序追加到 params 中，
+// 传入复用的切片可以避免每次匹配都分配内存
+func (n *Node) Match(path string, params []Param) (*Node, []Param) {
+	rest, done := trimRoot(path)
+	node := n.match(rest, done, &params)
+	return node, params
+}
+
+// trimRoot 去掉路径开头的 /，与 strings.Split(path, "/")[1:] 的分段一致：空路径没有任何段
+func trimRoot(path string) (rest string, done bool) {
+	if path == "" {
+		return "", true
+	}
+	_, rest, _ = strings.Cut(path, "/")
+	return rest, false
+}
+
+// match 匹配剩余的路径 rest，done 为 true 时已经没有剩余的段；
+// params 不为 nil 时记录参数，分支匹配失败时撤销这个分支记录的参数
+func (n *Node) match(rest string, done bool, params *[]Param) *Node {
+	if done {
+		if n.isEnd {
+			return n
+		}
+		return nil
+	}
+	name, next, found := strings.Cut(rest, "/")
+	// 静态名称优先
+	if c := n.static[name]; c != nil {
+		if node := c.match(next, !found, params); node != nil {
+			return node
+		}
+	}
+	// 参数和 * 匹配一段，带约束的参数只匹配满足约束的段
+	for _, c := range n.params {
+		if c.check != nil && !c.check(name) {
+			continue
+		}
+		size := 0
+		if params != nil {
+			size = len(*params)
+			if c.key != "" {
+				*params = append(*params, Param{Key: c.key, Value: name})
+			}
+		}
+		if node := c.match(next, !found, params); node != nil {
+			return node
+		}
+		if params != nil {
+			*params = (*params)[:size]
+		}
+	}
+	// ** 匹配剩余的所有段
+	if c := n.catchAll; c != nil && c.isEnd {
+		return c
+	}
+	return nil
+}
+
+// FixedPath 不区分大小写匹配路径，返回按注册的静态名称修正大小写后的路径，
+// 参数和 ** 匹配的段保持原样，如注册了 /User/:id 时 /user/Bob 返回 /User/Bob；没有匹配时 ok 为 false
+func (n *Node) FixedPath(path string) (fixed string, ok bool) {
+	rest, done := trimRoot(path)
+	return n.fixPath(rest, done, make([]byte, 0, len(path)+1))
+}
+
+// fixPath 与 match 的优先级相同，buf 中是已经修正的前缀
+func (n *Node) fixPath(rest string, done bool, buf []byte) (string, bool) {
+	if done {
+		if n.isEnd {
+			return string(buf), true
+		}
+		return "", false
+	}
+	name, next, found := strings.Cut(rest, "/")
+	buf = append(buf, '/')
+	if c := n.static[name]; c != nil {
+		if p, ok := c.fixPath(next, !found, append(buf, name...)); ok {
+			return p, true
+		}
+	}
+	for k, c := range n.static {
+		if k != name && strings.EqualFold(k, name) {
+			if p, ok := c.fixPath(next, !found, append(buf, k...)); ok {
+				return p, true
+			}
+		}
+	}
+	for _, c := range n.params {
+		if c.check != nil && !c.check(name) {
+			continue
+		}
+		if p, ok := c.fixPath(next, !found, append(buf, name...)); ok {
+			return p, true
+		}
+	}
+	if c := n.catchAll; c != nil && c.isEnd {
+		return string(append(buf, rest...)), true
+	}
+	return "", false
+}
@@ -0,0 +1,133 @@
+package tree
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTree 按顺序注册 routes
+func newTree(t *testing.T, routes ...string) *Node {
+	t.Helper()
+	root := New()
+	for _, r := range routes {
+		if _, _, err := root.Put(r); err != nil {
+			t.Fatalf("Put(%q): %v", r, err)
+		}
+	}
+	return root
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes []string
+		path   string
+		want   string // 匹配到的路由，空为没有匹配
+		params []Param
+	}{
+		// 优先级：静态名称 > 参数 > **
+		{"static before param", []string{"/user/:name", "/user/new"}, "/user/new", "/user/new", nil},
+		{"param when static differs", []string{"/user/:name", "/user/new"}, "/user/bob", "/user/:name", []Param{{"name", "bob"}}},
+		{"param before catch all", []string{"/files/**", "/files/:name"}, "/files/a", "/files/:name", []Param{{"name", "a"}}},
+		{"catch all takes the rest", []string{"/files/**", "/files/:name"}, "/files/a/b/c", "/files/**", nil},
+		{"catch all needs one segment", []string{"/files/**"}, "/files", "", nil},
+		{"star matches one segment", []string{"/img/*/thumb"}, "/img/1/thumb", "/img/*/thumb", nil},
+		// 带约束的参数不满足约束时回退到不带约束的参数
+		{"constraint matches", []string{"/user/:name", "/user/:id|int"}, "/user/42", "/user/:id|int", []Param{{"id", "42"}}},
+		{"constraint falls back", []string{"/user/:name", "/user/:id|int"}, "/user/bob", "/user/:name", []Param{{"name", "bob"}}},
+		{"regexp constraint", []string{`/post/:slug([a-z-]+)`, "/post/:any"}, "/post/hello-world", `/post/:slug([a-z-]+)`, []Param{{"slug", "hello-world"}}},
+		{"regexp falls back", []string{`/post/:slug([a-z-]+)`, "/post/:any"}, "/post/Hello", "/post/:any", []Param{{"any", "Hello"}}},
+		{"constraint in registration order", []string{"/v/:id|uint", "/v/:n|int"}, "/v/7", "/v/:id|uint", []Param{{"id", "7"}}},
+		{"unmatched constraint", []string{"/user/:id|int"}, "/user/bob", "", nil},
+		// 高优先级的分支在更深处失败时回退，并撤销这个分支记录的参数
+		{"static branch fails deeper", []string{"/a/b/c", "/a/:x/d"}, "/a/b/d", "/a/:x/d", []Param{{"x", "b"}}},
+		{"param rolled back", []string{"/a/:x|int/c", "/a/:y/d"}, "/a/1/d", "/a/:y/d", []Param{{"y", "1"}}},
+		{"params rolled back to catch all", []string{"/a/:x/:y/z", "/a/**"}, "/a/1/2/3", "/a/**", nil},
+		{"no match", []string{"/a/b"}, "/a/c", "", nil},
+		{"not an end node", []string{"/a/b/c"}, "/a/b", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := newTree(t, tt.routes...)
+			node, params := root.Match(tt.path, nil)
+			got := ""
+			if node != nil {
+				got = node.RouterName()
+			}
+			if got != tt.want {
+				t.Fatalf("Match(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+			if tt.want != "" && (len(params) != 0 || len(tt.params) != 0) && !reflect.DeepEqual(params, tt.params) {
+				t.Fatalf("Match(%q) params = %v, want %v", tt.path, params, tt.params)
+			}
+			if node != root.Get(tt.path) {
+				t.Fatalf("Get(%q) differs from Match", tt.path)
+			}
+		})
+	}
+}
+
+func TestPut(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes []string // 最后一个是被测试的路由，前面的先注册
+		exist  bool
+		err    string // 错误信息包含的内容，空为没有错误
+	}{
+		{"new route", []string{"/user/:id"}, false, ""},
+		{"same route", []string{"/user/:id", "/user/:id"}, true, ""},
+		{"different constraints", []string{"/user/:id|int", "/user/:name"}, false, ""},
+		{"same constraint different name", []string{"/user/:id", "/user/:name"}, false, "conflicts with existing wildcard :id"},
+		{"same type different name", []string{"/user/:id|int", "/user/:n|int"}, false, "conflicts with existing wildcard :id|int"},
+		{"star and param conflict", []string{"/user/*", "/user/:name"}, false, "conflicts with existing wildcard *"},
+		{"param without name", []string{"/user/:"}, false, "has no name"},
+		{"unknown type", []string{"/user/:id|float"}, false, "unknown type float"},
+		{"unclosed constraint", []string{`/user/:id(\d+`}, false, "unclosed constraint"},
+		{"bad regexp", []string{`/user/:id([)`}, false, "/user/:id([)"},
+		{"catch all at the end", []string{"/a/**"}, false, ""},
+		{"segments after catch all", []string{"/a/**/b"}, false, "** must be the last segment"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := newTree(t, tt.routes[:len(tt.routes)-1]...)
+			path := tt.routes[len(tt.routes)-1]
+			node, exist, err := root.Put(path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Put(%q) error = %v, want containing %q", path, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Put(%q): %v", path, err)
+			}
+			if exist != tt.exist {
+				t.Fatalf("Put(%q) exist = %v, want %v", path, exist, tt.exist)
+			}
+			if node.RouterName() != path || !node.IsEnd() {
+				t.Fatalf("Put(%q) node = %q", path, node.RouterName())
+			}
+		})
+	}
+}
+
+func TestFixedPath(t *testing.T) {
+	root := newTree(t, "/User/:id", "/Files/**", "/about")
+	tests := []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		{"/user/Bob", "/User/Bob", true},
+		{"/ABOUT", "/about", true},
+		{"/files/A/b", "/Files/A/b", true},
+		{"/group/1", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := root.FixedPath(tt.path)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("FixedPath(%q) = %q, %v, want %q, %v", tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -2,8 +2,12 @@ package web
 
 import (
 	"context"
+	"github.com/ygb616/web/config"
 	"golang.org/x/time/rate"
+	"math"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 )
 
@@ -24,3 +28,143 @@ func Limiter(limit, cap int) MiddlewareFunc {
 		}
 	}
 }
+
+// GatewayRouteKey 网关路由名称在 Context 中的键，网关转发前设置
+const GatewayRouteKey = "gateway_route"
+
+// LimitKeyFunc 限流的客户端标识，如 IP、API Key、用户 id，返回空字符串时不限流
+type LimitKeyFunc func(ctx *Context) string
+
+// LimitByIP 按客户端 IP 限流，见 Context.ClientIP，只有设置了信任的代理时才使用 X-Forwarded-For、X-Real-Ip
+func LimitByIP(ctx *Context) string {
+	return ctx.ClientIP()
+}
+
+// LimitByHeader 按请求头限流，如 X-Api-Key，或网关 jwt 中间件转发的 X-User-Id
+func LimitByHeader(header string) LimitKeyFunc {
+	return func(ctx *Context) string {
+		return ctx.R.Header.Get(header)
+	}
+}
+
+// limiterEntry 某个客户端的限流器
+type limiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// KeyLimiter 返回按路由 + 客户端标识限流的中间件，每个客户端每秒 limit 个请求，允许突发 burst 个，
+// 超出时直接返回 429 并设置 Retry-After，不会排队等待；limit 小于等于 0 时不限流；
+// 网关路由按网关配置名称区分，普通路由按注册的路径区分（/user/:id 的所有请求共用一个限流器），keyFunc 为 nil 时按客户端 IP 限流
+func KeyLimiter(limit float64, burst int, keyFunc LimitKeyFunc) MiddlewareFunc {
+	return newKeyLimiter(limit, burst).middleware(keyFunc)
+}
+
+// KeyLimiterByConf 与 KeyLimiter 相同，速率从配置 key 处的 limit、burst 读取，如 key 为 limit.api 时：
+//
+//	[limit.api]
+//	limit = 100 # 每秒请求数
+//	burst = 200 # 默认与 limit 相同
+//
+// 没有配置或 limit 小于等于 0 时不限流，配置拼写错误不会拒绝所有请求；
+// 配置变化时（见 config.OnChange）更新所有客户端的速率，不需要重启
+func KeyLimiterByConf(key string, keyFunc LimitKeyFunc) MiddlewareFunc {
+	readConf := func() (float64, int) {
+		limit := config.GetFloat(key+".limit", 0)
+		return limit, config.GetInt(key+".burst", int(math.Ceil(limit)))
+	}
+	l := newKeyLimiter(readConf())
+	config.OnChange(key, func(_, _ any) {
+		l.setRate(readConf())
+	})
+	return l.middleware(keyFunc)
+}
+
+// keyLimiter 按客户端保存的限流器
+type keyLimiter struct {
+	mu        sync.Mutex
+	limit     rate.Limit
+	burst     int
+	limiters  map[string]*limiterEntry
+	lastClean time.Time
+}
+
+func newKeyLimiter(limit float64, burst int) *keyLimiter {
+	return &keyLimiter{
+		limit:     rate.Limit(limit),
+		burst:     burst,
+		limiters:  make(map[string]*limiterEntry),
+		lastClean: time.Now(),
+	}
+}
+
+// setRate 修改速率，已有的客户端也使用新的速率
+func (l *keyLimiter) setRate(limit float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit, l.burst = rate.Limit(limit), burst
+	for _, entry := range l.limiters {
+		entry.limiter.SetLimit(l.limit)
+		entry.limiter.SetBurst(l.burst)
+	}
+}
+
+func (l *keyLimiter) middleware(keyFunc LimitKeyFunc) MiddlewareFunc {
+	if keyFunc == nil {
+		keyFunc = LimitByIP
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) {
+			client := keyFunc(ctx)
+			if client == "" {
+				next(ctx)
+				return
+			}
+			route := ctx.FullPath() // 注册的路径，改变路径参数不能绕过限流
+			if name, ok := ctx.Get(GatewayRouteKey); ok {
+				route = name.(string)
+			}
+			key := route + "|" + client
+
+			now := time.Now()
+			l.mu.Lock()
+			if l.limit <= 0 {
+				l.mu.Unlock()
+				next(ctx)
+				return
+			}
+			// 定期清理长时间没有请求的客户端，避免内存一直增长
+			if now.Sub(l.lastClean) > time.Minute {
+				for k, entry := range l.limiters {
+					if now.Sub(entry.lastSeen) > 3*time.Minute {
+						delete(l.limiters, k)
+					}
+				}
+				l.lastClean = now
+			}
+			entry, ok := l.limiters[key]
+			if !ok {
+				entry = &limiterEntry{limiter: rate.NewLimiter(l.limit, l.burst)}
+				l.limiters[key] = entry
+			}
+			entry.lastSeen = now
+			l.mu.Unlock()
+
+			reservation := entry.limiter.ReserveN(now, 1)
+			if !reservation.OK() || reservation.DelayFrom(now) > 0 {
+				retryAfter := time.Second
+				if reservation.OK() {
+					retryAfter = reservation.DelayFrom(now)
+					reservation.CancelAt(now) // 不使用这次预约，归还令牌
+				}
+				ctx.W.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				_ = ctx.JSON(http.StatusTooManyRequests, map[string]any{
+					"code": http.StatusTooManyRequests,
+					"msg":  "too many requests",
+				})
+				return
+			}
+			next(ctx)
+		}
+	}
+}
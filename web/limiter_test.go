@@ -0,0 +1,85 @@
+package web
+
+import (
+	"github.com/ygb616/web/config"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestKeyLimiterSharesBucketAcrossParams 同一个路由不同的路径参数共用一个限流器，改变参数不能绕过限流
+func TestKeyLimiterSharesBucketAcrossParams(t *testing.T) {
+	e := New()
+	g := e.Group("")
+	g.Use(KeyLimiter(1, 1, LimitByIP))
+	g.Get("/user/:id", func(ctx *Context) {
+		_ = ctx.String(http.StatusOK, "ok")
+	})
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("first request status = %d, want %d", w.Code, http.StatusOK)
+	}
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/2", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+}
+
+// setLimitConf 把 content 作为当前的配置，测试结束后恢复原来的配置
+func setLimitConf(t *testing.T, content string) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "app.toml")
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := config.Load(file, config.WithoutEnv())
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := config.GetToml()
+	t.Cleanup(func() { config.SetCurrent(prev) })
+	config.SetCurrent(c)
+}
+
+// TestKeyLimiterByConf 没有配置时不限流，配置变化后按新的速率限流，配置删除后恢复不限流
+func TestKeyLimiterByConf(t *testing.T) {
+	setLimitConf(t, "")
+	e := New()
+	g := e.Group("")
+	g.Use(KeyLimiterByConf("limit.test", LimitByIP))
+	g.Get("/ping", func(ctx *Context) {
+		_ = ctx.String(http.StatusOK, "ok")
+	})
+	statuses := func(n int) []int {
+		codes := make([]int, n)
+		for i := range codes {
+			w := httptest.NewRecorder()
+			e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+			codes[i] = w.Code
+		}
+		return codes
+	}
+
+	for i, code := range statuses(3) {
+		if code != http.StatusOK {
+			t.Fatalf("absent config: request %d status = %d, want %d", i, code, http.StatusOK)
+		}
+	}
+
+	setLimitConf(t, "[limit.test]\nlimit = 1\nburst = 1\n")
+	if codes := statuses(2); codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Fatalf("after reload: statuses = %v, want [200 429]", codes)
+	}
+
+	setLimitConf(t, "")
+	for i, code := range statuses(3) {
+		if code != http.StatusOK {
+			t.Fatalf("section removed: request %d status = %d, want %d", i, code, http.StatusOK)
+		}
+	}
+}
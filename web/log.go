@@ -30,10 +30,11 @@ const (
 
 var DefaultWriter io.Writer = os.Stdout
 
+// LoggingConfig 访问日志的配置，也可以用 LoggingConfigFromMap 从 app.toml 的 [log.access] 读取
 type LoggingConfig struct {
 	Formatter LoggerFormatter
-	out       io.Writer
-	IsColor   bool
+	Out       io.Writer // 输出，为空时输出到 DefaultWriter 并且带颜色
+	IsColor   bool      // 设置了 Out 时是否带颜色
 }
 
 type LoggerFormatter = func(params *LogFormatterParams) string
@@ -46,6 +47,7 @@ type LogFormatterParams struct {
 	ClientIP       net.IP
 	Method         string
 	Path           string
+	RequestID      string // 请求 ID，见 Context.RequestID
 	IsDisplayColor bool
 }
 
@@ -70,19 +72,20 @@ var defaultFormatter = func(params *LogFormatterParams) string {
 		params.Latency = params.Latency.Truncate(time.Second)
 	}
 	if params.IsDisplayColor {
-		return fmt.Sprintf("%s [web] %s |%s %v %s| %s %3d %s |%s %13v %s| %15s  |%s %-7s %s %s %#v %s \n",
+		return fmt.Sprintf("%s [web] %s |%s %v %s| %s %3d %s |%s %13v %s| %15s  |%s %-7s %s %s %#v %s | %s\n",
 			yellow, resetColor, blue, params.TimeStamp.Format("2006/01/02 - 15:04:05"), resetColor,
 			statusCodeColor, params.StatusCode, resetColor,
 			red, params.Latency, resetColor,
 			params.ClientIP,
 			magenta, params.Method, resetColor,
 			cyan, params.Path, resetColor,
+			params.RequestID,
 		)
 	}
-	return fmt.Sprintf("[web] %v | %3d | %13v | %15s |%-7s %#v",
+	return fmt.Sprintf("[web] %v | %3d | %13v | %15s |%-7s %#v | %s",
 		params.TimeStamp.Format("2006/01/02 - 15:04:05"),
 		params.StatusCode,
-		params.Latency, params.ClientIP, params.Method, params.Path,
+		params.Latency, params.ClientIP, params.Method, params.Path, params.RequestID,
 	)
 
 }
@@ -92,8 +95,8 @@ func LoggingWithConfig(conf LoggingConfig, next HandlerFunc) HandlerFunc {
 	if formatter == nil {
 		formatter = defaultFormatter
 	}
-	out := conf.out
-	displayColor := false
+	out := conf.Out
+	displayColor := conf.IsColor
 	if out == nil {
 		out = DefaultWriter
 		displayColor = true
@@ -103,6 +106,7 @@ func LoggingWithConfig(conf LoggingConfig, next HandlerFunc) HandlerFunc {
 		param := &LogFormatterParams{
 			Request:        r,
 			IsDisplayColor: displayColor,
+			RequestID:      ctx.RequestID(), // 处理请求前生成，响应头中带上请求 ID
 		}
 		// Start timer
 		start := time.Now()
@@ -127,9 +131,20 @@ func LoggingWithConfig(conf LoggingConfig, next HandlerFunc) HandlerFunc {
 		param.ClientIP = clientIP
 		param.Method = method
 
-		fmt.Fprint(out, formatter(param))
+		line := formatter(param)
+		if !strings.HasSuffix(line, "\n") {
+			line += "\n" // 输出到文件时每条日志一行
+		}
+		fmt.Fprint(out, line)
 	}
 }
 func Logging(next HandlerFunc) HandlerFunc {
 	return LoggingWithConfig(LoggingConfig{}, next)
 }
+
+// LoggingMiddleware 返回按 conf 输出访问日志的中间件
+func LoggingMiddleware(conf LoggingConfig) MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return LoggingWithConfig(conf, next)
+	}
+}
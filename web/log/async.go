@@ -0,0 +1,180 @@
+package log
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AsyncConf 异步写日志的配置
+type AsyncConf struct {
+	BufferSize    int           // 等待写入的日志条数，默认 1024
+	FlushInterval time.Duration // 定时把缓冲写入文件的间隔，默认 1 秒
+	DropOnFull    bool          // 缓冲满时丢弃日志，默认等待，不丢日志
+}
+
+// AsyncWriter 异步写入：Write 只把日志放入有界的 channel，由后台 goroutine 写入 out，
+// 请求处理中不会等待磁盘 I/O；进程退出前需要调用 Close 把剩下的日志写完
+type AsyncWriter struct {
+	out      io.Writer
+	ch       chan []byte
+	flushCh  chan chan struct{}
+	done     chan struct{}
+	interval time.Duration
+	drop     bool
+	dropped  int64
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAsyncWriter 创建 AsyncWriter 并启动后台写入
+func NewAsyncWriter(out io.Writer, conf AsyncConf) *AsyncWriter {
+	if conf.BufferSize <= 0 {
+		conf.BufferSize = 1024
+	}
+	if conf.FlushInterval <= 0 {
+		conf.FlushInterval = time.Second
+	}
+	w := &AsyncWriter{
+		out:      out,
+		ch:       make(chan []byte, conf.BufferSize),
+		flushCh:  make(chan chan struct{}),
+		done:     make(chan struct{}),
+		interval: conf.FlushInterval,
+		drop:     conf.DropOnFull,
+	}
+	go w.run()
+	return w
+}
+
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return w.out.Write(p) // 关闭后直接写入
+	}
+	b := make([]byte, len(p)) // 调用方可能复用 p
+	copy(b, p)
+	if w.drop {
+		select {
+		case w.ch <- b:
+		default:
+			atomic.AddInt64(&w.dropped, 1)
+		}
+		return len(p), nil
+	}
+	w.ch <- b
+	return len(p), nil
+}
+
+// Dropped 返回缓冲满时丢弃的日志条数
+func (w *AsyncWriter) Dropped() int64 {
+	return atomic.LoadInt64(&w.dropped)
+}
+
+// Flush 把已经写入的日志全部写到 out
+func (w *AsyncWriter) Flush() error {
+	w.mu.RLock()
+	if w.closed {
+		w.mu.RUnlock()
+		return nil
+	}
+	done := make(chan struct{})
+	w.flushCh <- done
+	w.mu.RUnlock()
+	<-done
+	return nil
+}
+
+// Close 写完剩下的日志后停止后台写入，out 实现了 io.Closer 时一并关闭（标准输出除外）
+func (w *AsyncWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.ch)
+	w.mu.Unlock()
+	<-w.done
+	if c, ok := w.out.(io.Closer); ok && w.out != os.Stdout && w.out != os.Stderr {
+		return c.Close()
+	}
+	return nil
+}
+
+func (w *AsyncWriter) run() {
+	defer close(w.done)
+	buf := bufio.NewWriterSize(w.out, 64<<10)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case b, ok := <-w.ch:
+			if !ok {
+				_ = buf.Flush()
+				return
+			}
+			_, _ = buf.Write(b)
+		case <-ticker.C:
+			_ = buf.Flush()
+		case done := <-w.flushCh:
+			// 先写完 channel 中已有的日志
+			for n := len(w.ch); n > 0; n-- {
+				_, _ = buf.Write(<-w.ch)
+			}
+			_ = buf.Flush()
+			close(done)
+		}
+	}
+}
+
+// SetAsync 所有的输出改为异步写入，之后 SetLogPath 添加的文件也异步写入
+func (l *Logger) SetAsync(conf AsyncConf) {
+	l.async = &conf
+	for _, out := range l.Outs {
+		if _, ok := out.Out.(*AsyncWriter); !ok {
+			out.Out = NewAsyncWriter(out.Out, conf)
+		}
+	}
+}
+
+// Flush 把异步写入的日志全部写到输出
+func (l *Logger) Flush() error {
+	for _, out := range l.Outs {
+		if f, ok := out.Out.(interface{ Flush() error }); ok {
+			if err := f.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close 写完剩下的日志并关闭日志文件，进程退出前调用
+func (l *Logger) Close() error {
+	var first error
+	for _, out := range l.Outs {
+		if out.Out == os.Stdout || out.Out == os.Stderr {
+			continue
+		}
+		if c, ok := out.Out.(io.Closer); ok {
+			if err := c.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// isStdout 判断输出是否为标准输出，标准输出带颜色
+func isStdout(w io.Writer) bool {
+	if a, ok := w.(*AsyncWriter); ok {
+		w = a.out
+	}
+	return w == os.Stdout
+}
@@ -0,0 +1,125 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer 并发安全的输出，gate 不为空时 Write 等待 gate 关闭，进入 Write 时通知 entered
+type syncBuffer struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	closed  bool
+	gate    chan struct{}
+	entered chan struct{}
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	if b.gate != nil {
+		b.entered <- struct{}{}
+		<-b.gate
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	return nil
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func writeLines(t *testing.T, w *AsyncWriter, n int) string {
+	t.Helper()
+	var want strings.Builder
+	for i := 0; i < n; i++ {
+		line := fmt.Sprintf("line %d\n", i)
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		want.WriteString(line)
+	}
+	return want.String()
+}
+
+// TestAsyncFlush Flush 返回时已经写入的日志全部写到 out
+func TestAsyncFlush(t *testing.T) {
+	out := &syncBuffer{}
+	w := NewAsyncWriter(out, AsyncConf{FlushInterval: time.Hour})
+	defer w.Close()
+	want := writeLines(t, w, 100)
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != want {
+		t.Fatalf("after Flush out has %d bytes, want %d", len(got), len(want))
+	}
+}
+
+// TestAsyncClose Close 写完缓冲中的日志并关闭 out，之后的写入直接写到 out
+func TestAsyncClose(t *testing.T) {
+	out := &syncBuffer{}
+	w := NewAsyncWriter(out, AsyncConf{FlushInterval: time.Hour})
+	want := writeLines(t, w, 100)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != want {
+		t.Fatalf("after Close out has %d bytes, want %d", len(got), len(want))
+	}
+	if !out.closed {
+		t.Fatal("out not closed")
+	}
+	if _, err := w.Write([]byte("late\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != want+"late\n" {
+		t.Fatalf("write after Close: out = %q", got[len(want):])
+	}
+}
+
+// TestAsyncDropOnFull 后台写入阻塞、缓冲满时丢弃日志并计数
+func TestAsyncDropOnFull(t *testing.T) {
+	out := &syncBuffer{gate: make(chan struct{}), entered: make(chan struct{}, 1)}
+	w := NewAsyncWriter(out, AsyncConf{BufferSize: 2, FlushInterval: time.Hour, DropOnFull: true})
+	if _, err := w.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+	// 让后台写入阻塞在 out.Write 上，此时 channel 为空
+	flushed := make(chan struct{})
+	go func() {
+		_ = w.Flush()
+		close(flushed)
+	}()
+	<-out.entered
+
+	for _, line := range []string{"a\n", "b\n", "c\n", "d\n", "e\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := w.Dropped(); got != 3 {
+		t.Fatalf("Dropped() = %d, want 3", got)
+	}
+
+	close(out.gate)
+	<-flushed
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "first\na\nb\n" {
+		t.Fatalf("out = %q, want the first line and the two buffered lines", got)
+	}
+}
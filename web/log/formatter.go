@@ -0,0 +1,100 @@
+package log
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// FormatterFactory 按配置创建 LoggerFormatter，options 为 app.toml 中 [log.formatter] 的内容，没有时为空
+type FormatterFactory func(options map[string]any) (LoggerFormatter, error)
+
+var (
+	formattersMu sync.RWMutex
+	formatters   = map[string]FormatterFactory{
+		"text": newTextFormatter,
+		"json": newJsonFormatter,
+	}
+)
+
+// defaultTextFormatter Logger 没有设置 Formatter 时使用
+var defaultTextFormatter = &TextFormatter{}
+
+// RegisterFormatter 注册名称为 name 的日志格式，已经注册时替换，之后可以在配置中按名称选择：
+//
+//	log.RegisterFormatter("logfmt", func(options map[string]any) (log.LoggerFormatter, error) {
+//		return &LogfmtFormatter{}, nil
+//	})
+func RegisterFormatter(name string, factory FormatterFactory) {
+	formattersMu.Lock()
+	defer formattersMu.Unlock()
+	formatters[name] = factory
+}
+
+// NewFormatter 按名称创建日志格式，内置 text 和 json
+func NewFormatter(name string, options map[string]any) (LoggerFormatter, error) {
+	formattersMu.RLock()
+	factory, ok := formatters[name]
+	formattersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("log: unknown formatter %q", name)
+	}
+	return factory(options)
+}
+
+// Formatters 返回已注册的日志格式名称，按名称排序
+func Formatters() []string {
+	formattersMu.RLock()
+	defer formattersMu.RUnlock()
+	names := make([]string, 0, len(formatters))
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newTextFormatter 选项：color（默认 true，输出到标准输出时带颜色）、time_format
+func newTextFormatter(options map[string]any) (LoggerFormatter, error) {
+	f := &TextFormatter{}
+	if color, ok := options["color"].(bool); ok {
+		f.DisableColor = !color
+	}
+	if format, ok := options["time_format"].(string); ok {
+		f.TimeFormat = format
+	}
+	return f, nil
+}
+
+// newJsonFormatter 选项：time（默认 true，输出 log_time）
+func newJsonFormatter(options map[string]any) (LoggerFormatter, error) {
+	f := &JsonFormatter{TimeDisplay: true}
+	if display, ok := options["time"].(bool); ok {
+		f.TimeDisplay = display
+	}
+	return f, nil
+}
+
+// formatterFromConf 解析 [log] 的 formatter，可以是名称，或带 name 的表：
+//
+//	formatter = "json"
+//	# 或者
+//	[log.formatter]
+//	name = "text"
+//	color = false
+func formatterFromConf(v any) (LoggerFormatter, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return NewFormatter(v, nil)
+	case map[string]any:
+		name, _ := v["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("log: formatter without name")
+		}
+		return NewFormatter(name, v)
+	default:
+		return nil, fmt.Errorf("log: formatter should be a name or a table, got %T", v)
+	}
+}
@@ -0,0 +1,70 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Entry 一条日志，传给 Hook
+type Entry struct {
+	Time   time.Time
+	Level  LoggerLevel
+	Msg    any
+	Fields Fields  // Logger 的字段，是复制的，Hook 可以修改
+	Caller *Caller // ReportCaller 时为调用日志方法的位置，否则为 nil
+}
+
+// Hook 每条日志输出时调用，用于把日志发送到 Sentry、Kafka 或在 Fatal 时告警等，
+// 不需要替换 Logger。Fire 在记录日志的 goroutine 中同步调用，耗时的操作需要自己异步处理；
+// Fire 中不能再用同一个 Logger 记录日志，否则会递归调用
+type Hook interface {
+	Fire(level LoggerLevel, entry *Entry) error
+}
+
+// HookFunc 函数形式的 Hook
+type HookFunc func(level LoggerLevel, entry *Entry) error
+
+func (f HookFunc) Fire(level LoggerLevel, entry *Entry) error {
+	return f(level, entry)
+}
+
+// LevelHook 只在 levels 级别的日志调用 hook，如 LevelHook(alert, LevelError, LevelFatal)
+func LevelHook(hook Hook, levels ...LoggerLevel) Hook {
+	return HookFunc(func(level LoggerLevel, entry *Entry) error {
+		for _, l := range levels {
+			if l == level {
+				return hook.Fire(level, entry)
+			}
+		}
+		return nil
+	})
+}
+
+// AddHook 添加 Hook，之后 WithFields、With 创建的子 Logger 也会调用
+func (l *Logger) AddHook(hook Hook) {
+	l.Hooks = append(l.Hooks, hook)
+}
+
+// fireHooks 调用所有的 Hook，Hook 返回的错误写到标准错误
+func (l *Logger) fireHooks(param *LoggingFormatParam) {
+	if len(l.Hooks) == 0 {
+		return
+	}
+	fields := make(Fields, len(param.LoggerFields))
+	for k, v := range param.LoggerFields {
+		fields[k] = v
+	}
+	entry := &Entry{
+		Time:   time.Now(),
+		Level:  param.Level,
+		Msg:    param.Msg,
+		Fields: fields,
+		Caller: param.Caller,
+	}
+	for _, hook := range l.Hooks {
+		if err := hook.Fire(param.Level, entry); err != nil {
+			fmt.Fprintf(os.Stderr, "log: hook error: %v\n", err)
+		}
+	}
+}
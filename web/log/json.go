@@ -11,17 +11,29 @@ type JsonFormatter struct {
 }
 
 func (f *JsonFormatter) Format(param *LoggingFormatParam) string {
-	if param.LoggerFields == nil {
-		param.LoggerFields = make(Fields)
+	// 复制一份字段，不修改 Logger 共享的 LoggerFields
+	fields := make(Fields, len(param.LoggerFields)+3)
+	for k, v := range param.LoggerFields {
+		if err, ok := v.(error); ok {
+			v = err.Error() // error 序列化为 json 时是 {}
+		}
+		fields[k] = v
 	}
 
 	now := time.Now()
 	if f.TimeDisplay {
-		param.LoggerFields["log_time"] = now.Format("2006/01/02 - 15:04:05")
+		fields["log_time"] = now.Format("2006/01/02 - 15:04:05")
 	}
-	param.LoggerFields["msg"] = param.Msg
-	param.LoggerFields["log_level"] = param.Level.Level()
-	marshal, err := json.Marshal(param.LoggerFields)
+	fields["msg"] = param.Msg
+	if err, ok := param.Msg.(error); ok {
+		fields["msg"] = err.Error()
+	}
+	fields["log_level"] = param.Level.Level()
+	if param.Caller != nil {
+		fields["caller"] = param.Caller.String()
+		fields["func"] = param.Caller.Function
+	}
+	marshal, err := json.Marshal(fields)
 	if err != nil {
 		panic(err)
 	}
@@ -8,6 +8,8 @@ import (
 	"log"
 	"os"
 	"path"
+	"runtime"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -39,8 +41,14 @@ func (l LoggerLevel) Level() string {
 		return "DEBUG"
 	case LevelInfo:
 		return "INFO"
+	case LevelWarn:
+		return "WARN"
 	case LevelError:
 		return "ERROR"
+	case LevelFatal:
+		return "FATAL"
+	case LevelPanic:
+		return "PANIC"
 	default:
 		return ""
 	}
@@ -49,52 +57,114 @@ func (l LoggerLevel) Level() string {
 const (
 	LevelDebug LoggerLevel = iota
 	LevelInfo
+	LevelWarn
 	LevelError
+	LevelFatal // 输出日志后调用 os.Exit(1)
+	LevelPanic // 输出日志后 panic
 )
 
 type Fields map[string]any
 
 // Logger 日志
 type Logger struct {
-	Formatter    LoggingFormatter
+	Formatter    LoggerFormatter // 为空时使用 TextFormatter
 	Level        LoggerLevel
 	Outs         []*LoggerWriter
 	LoggerFields Fields
 	logPath      string
-	LogFileSize  int64
+	LogFileSize  int64      // 单个日志文件的最大字节数，Rotate.MaxSize 为 0 时使用
+	Rotate       RotateConf // SetLogPath 创建的日志文件的切割配置，需要在 SetLogPath 之前设置
+	ReportCaller bool       // 是否输出调用日志方法的文件、行号和函数名
+	CallerSkip   int        // 跳过的调用层数，在自己封装的日志函数中调用时设置为封装的层数
+	Hooks        []Hook     // 每条日志输出时调用，见 AddHook
+	async        *AsyncConf // SetAsync 后为异步写入的配置
+	sampler      *sampler   // SetSampling 后按内容采样
+	dynLevel     *levelVar  // SetLevel 设置的级别
 }
 
+// LoggerWriter 日志输出，Level 为 -1 时接收所有级别，其他值只接收该级别；设置了 Levels 时只接收 Levels 中的级别
 type LoggerWriter struct {
-	Level LoggerLevel
-	Out   io.Writer
+	Level  LoggerLevel
+	Levels []LoggerLevel
+	Out    io.Writer
 }
 
-type LoggingFormatter interface {
+// LoggerFormatter 日志格式，把一条日志格式化为一行文本（不带换行），自定义的格式用 RegisterFormatter 注册后可以在配置中按名称选择
+type LoggerFormatter interface {
 	Format(param *LoggingFormatParam) string
 }
 
+// LoggingFormatter 同 LoggerFormatter
+//
+// Deprecated: 使用 LoggerFormatter
+type LoggingFormatter = LoggerFormatter
+
 type LoggingFormatParam struct {
 	Level        LoggerLevel
 	IsColor      bool
 	LoggerFields Fields
 	Msg          any
+	Caller       *Caller // ReportCaller 时为调用日志方法的位置，否则为 nil
 }
 
-type LoggerFormatter struct {
-	Level        LoggerLevel
-	IsColor      bool
-	LoggerFields Fields
+// Caller 调用日志方法的位置
+type Caller struct {
+	File     string // 文件，只保留最后一级目录，如 orm/orm.go
+	Line     int
+	Function string // 函数名，如 orm.(*MsSession).Insert
+}
+
+func (c *Caller) String() string {
+	return c.File + ":" + strconv.Itoa(c.Line)
+}
+
+// logPackage 日志包的函数名前缀，获取调用位置时跳过日志包内部的调用
+const logPackage = "github.com/ygb616/web/log."
+
+// caller 返回日志包之外第 skip+1 层调用的位置
+func caller(skip int) *Caller {
+	pcs := make([]uintptr, 16+skip)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, logPackage) {
+			if skip == 0 {
+				return &Caller{File: shortFile(frame.File), Line: frame.Line, Function: shortFunction(frame.Function)}
+			}
+			skip--
+		}
+		if !more {
+			return nil
+		}
+	}
+}
+
+func shortFile(file string) string {
+	if i := strings.LastIndex(file, "/"); i > 0 {
+		if j := strings.LastIndex(file[:i], "/"); j >= 0 {
+			return file[j+1:]
+		}
+	}
+	return file
+}
+
+func shortFunction(fn string) string {
+	if i := strings.LastIndex(fn, "/"); i >= 0 {
+		return fn[i+1:]
+	}
+	return fn
 }
 
 func New() *Logger {
-	return &Logger{}
+	return &Logger{dynLevel: &levelVar{}}
 }
 
 func Default() *Logger {
 	logger := New()
 	logger.Level = LevelDebug
 	w := &LoggerWriter{
-		Level: LevelDebug,
+		Level: -1,
 		Out:   os.Stdout,
 	}
 	logger.Outs = append(logger.Outs, w)
@@ -110,67 +180,217 @@ func (l *Logger) Debug(msg any) {
 	l.Print(LevelDebug, msg)
 }
 
+func (l *Logger) Warn(msg any) {
+	l.Print(LevelWarn, msg)
+}
+
 func (l *Logger) Error(msg any) {
 	l.Print(LevelError, msg)
 }
 
+// Fatal 输出日志后退出进程，退出前写完异步写入的日志
+func (l *Logger) Fatal(msg any) {
+	l.Print(LevelFatal, msg)
+	_ = l.Flush()
+	os.Exit(1)
+}
+
+// Panic 输出日志后以 msg panic
+func (l *Logger) Panic(msg any) {
+	l.Print(LevelPanic, msg)
+	panic(msg)
+}
+
+// Debugf 按 format 格式化后输出，低于 Logger 级别时不格式化
+func (l *Logger) Debugf(format string, args ...any) {
+	if l.GetLevel() <= LevelDebug {
+		l.Print(LevelDebug, fmt.Sprintf(format, args...))
+	}
+}
+
+func (l *Logger) Infof(format string, args ...any) {
+	if l.GetLevel() <= LevelInfo {
+		l.Print(LevelInfo, fmt.Sprintf(format, args...))
+	}
+}
+
+func (l *Logger) Warnf(format string, args ...any) {
+	if l.GetLevel() <= LevelWarn {
+		l.Print(LevelWarn, fmt.Sprintf(format, args...))
+	}
+}
+
+func (l *Logger) Errorf(format string, args ...any) {
+	if l.GetLevel() <= LevelError {
+		l.Print(LevelError, fmt.Sprintf(format, args...))
+	}
+}
+
+func (l *Logger) Fatalf(format string, args ...any) {
+	l.Fatal(fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Panicf(format string, args ...any) {
+	l.Panic(fmt.Sprintf(format, args...))
+}
+
 func (l *Logger) Print(level LoggerLevel, msg any) {
-	if l.Level > level {
+	l.print(level, msg, nil)
+}
+
+// print 输出日志，c 为空且 ReportCaller 时获取调用日志方法的位置
+func (l *Logger) print(level LoggerLevel, msg any, c *Caller) {
+	if l.GetLevel() > level {
 		//当前的级别大于输入级别 不打印对应的级别日志
 		return
 	}
+	if l.sampler != nil && !l.sampler.allow(level, msg) {
+		return
+	}
 	param := &LoggingFormatParam{
 		Level:        level,
 		LoggerFields: l.LoggerFields,
 		Msg:          msg,
 	}
-	str := l.Formatter.Format(param)
+	if l.ReportCaller {
+		if c == nil {
+			c = caller(l.CallerSkip)
+		}
+		param.Caller = c
+	}
+	formatter := l.Formatter
+	if formatter == nil {
+		formatter = defaultTextFormatter
+	}
+	// 标准输出带颜色，其他输出不带颜色，各格式化一次
+	var plain, colored string
 	for _, out := range l.Outs {
-		if out.Out == os.Stdout {
-			param.IsColor = true
-			str = l.Formatter.Format(param)
-			fmt.Fprintln(out.Out, str)
+		if !out.accepts(level) {
+			continue
+		}
+		if isStdout(out.Out) {
+			if colored == "" {
+				param.IsColor = true
+				colored = formatter.Format(param)
+			}
+			fmt.Fprintln(out.Out, colored)
+			continue
 		}
-		if out.Level == -1 || level == out.Level {
-			fmt.Fprintln(out.Out, str)
-			l.CheckFileSize(out)
+		if plain == "" {
+			param.IsColor = false
+			plain = formatter.Format(param)
 		}
+		fmt.Fprintln(out.Out, plain)
 	}
+	l.fireHooks(param)
 }
 
+// WithFields 返回带有 fields 的子 Logger，子 Logger 的日志都带上父 Logger 和 fields 中的字段，
+// 同名的字段使用 fields 中的值，不修改父 Logger
 func (l *Logger) WithFields(fields Fields) *Logger {
+	merged := make(Fields, len(l.LoggerFields)+len(fields))
+	for k, v := range l.LoggerFields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
 	return &Logger{
 		Formatter:    l.Formatter,
 		Outs:         l.Outs,
 		Level:        l.Level,
-		LoggerFields: fields,
+		LoggerFields: merged,
+		logPath:      l.logPath,
+		LogFileSize:  l.LogFileSize,
+		Rotate:       l.Rotate,
+		ReportCaller: l.ReportCaller,
+		CallerSkip:   l.CallerSkip,
+		Hooks:        l.Hooks,
+		async:        l.async,
+		sampler:      l.sampler,
+		dynLevel:     l.dynLevel,
 	}
 }
 
+// With 按 key、value 交替传入字段，返回带有这些字段的子 Logger，如：
+//
+//	logger.With("request_id", id, "user_id", uid).Info("login")
+func (l *Logger) With(keyValues ...any) *Logger {
+	fields := make(Fields, (len(keyValues)+1)/2)
+	for i := 0; i < len(keyValues); i += 2 {
+		key, ok := keyValues[i].(string)
+		if !ok {
+			key = fmt.Sprint(keyValues[i])
+		}
+		if i+1 < len(keyValues) {
+			fields[key] = keyValues[i+1]
+		} else {
+			fields[key] = "!MISSING" // 缺少值
+		}
+	}
+	return l.WithFields(fields)
+}
+
+// SetLogPath 在 logPath 目录下按级别写入日志文件，文件按 Rotate 的配置自动切割
 func (l *Logger) SetLogPath(logPath string) {
 	l.logPath = logPath
+	conf := l.Rotate
+	if conf.MaxSize <= 0 {
+		conf.MaxSize = l.LogFileSize
+	}
 	l.Outs = append(l.Outs, &LoggerWriter{
 		Level: -1,
-		Out:   FileWriter(path.Join(logPath, "all.log")),
+		Out:   l.fileWriter(path.Join(logPath, "all.log"), conf),
 	})
 	l.Outs = append(l.Outs, &LoggerWriter{
 		Level: LevelDebug,
-		Out:   FileWriter(path.Join(logPath, "debug.log")),
+		Out:   l.fileWriter(path.Join(logPath, "debug.log"), conf),
 	})
 	l.Outs = append(l.Outs, &LoggerWriter{
 		Level: LevelInfo,
-		Out:   FileWriter(path.Join(logPath, "info.log")),
+		Out:   l.fileWriter(path.Join(logPath, "info.log"), conf),
 	})
 	l.Outs = append(l.Outs, &LoggerWriter{
 		Level: LevelError,
-		Out:   FileWriter(path.Join(logPath, "error.log")),
+		Out:   l.fileWriter(path.Join(logPath, "error.log"), conf),
 	})
 }
 
+// fileWriter 创建自动切割的日志文件，SetAsync 后异步写入
+func (l *Logger) fileWriter(name string, conf RotateConf) io.Writer {
+	var w io.Writer = NewRotateWriter(name, conf)
+	if l.async != nil {
+		w = NewAsyncWriter(w, *l.async)
+	}
+	return w
+}
+
+// RotateConfFromMap 从 app.toml 的 [log] 中读取切割配置：
+// max_size（MB）、max_backups、max_age（天）、compress
+func RotateConfFromMap(m map[string]any) RotateConf {
+	var conf RotateConf
+	if v, ok := m["max_size"].(int64); ok {
+		conf.MaxSize = v << 20
+	}
+	if v, ok := m["max_backups"].(int64); ok {
+		conf.MaxBackups = int(v)
+	}
+	if v, ok := m["max_age"].(int64); ok {
+		conf.MaxAge = time.Duration(v) * 24 * time.Hour
+	}
+	if v, ok := m["compress"].(bool); ok {
+		conf.Compress = v
+	}
+	return conf
+}
+
+// CheckFileSize 文件超过 LogFileSize 时切换到新的文件
+//
+// Deprecated: SetLogPath 创建的 RotateWriter 写入时自动切割，不需要再调用
 func (l *Logger) CheckFileSize(w *LoggerWriter) {
 	//判断对应的文件大小
-	logFile := w.Out.(*os.File)
-	if logFile != nil {
+	logFile, ok := w.Out.(*os.File)
+	if ok && logFile != nil && logFile != os.Stdout && logFile != os.Stderr {
 		stat, err := logFile.Stat()
 		if err != nil {
 			log.Println(err)
@@ -189,44 +409,6 @@ func (l *Logger) CheckFileSize(w *LoggerWriter) {
 	}
 
 }
-func (f *LoggerFormatter) format(msg any) string {
-	now := time.Now()
-	if f.IsColor {
-		//要带颜色  error的颜色 为红色 info为绿色 debug为蓝色
-		levelColor := f.LevelColor()
-		msgColor := f.MsgColor()
-		return fmt.Sprintf("%s [web] %s %s%v%s | level= %s %s %s | msg=%s %#v %s | fields=%v ",
-			yellow, reset, blue, now.Format("2006/01/02 - 15:04:05"), reset,
-			levelColor, f.Level.Level(), reset, msgColor, msg, reset, f.LoggerFields,
-		)
-	}
-	return fmt.Sprintf("[web] %v | level=%s | msg=%#v | fields=%#v",
-		now.Format("2006/01/02 - 15:04:05"),
-		f.Level.Level(), msg, f.LoggerFields)
-}
-
-func (f *LoggerFormatter) LevelColor() string {
-	switch f.Level {
-	case LevelDebug:
-		return blue
-	case LevelInfo:
-		return green
-	case LevelError:
-		return red
-	default:
-		return cyan
-	}
-}
-
-func (f *LoggerFormatter) MsgColor() string {
-	switch f.Level {
-	case LevelError:
-		return red
-	default:
-		return ""
-	}
-}
-
 func FileWriter(name string) io.Writer {
 	w, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
 	if err != nil {
@@ -0,0 +1,109 @@
+package log
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// levelVar 运行时修改的级别，WithFields、With 创建的子 Logger 共用
+type levelVar struct {
+	set atomic.Bool
+	v   atomic.Int32
+}
+
+// GetLevel 返回当前的级别，SetLevel 设置过时为 SetLevel 的级别，否则为 Level
+func (l *Logger) GetLevel() LoggerLevel {
+	if l.dynLevel != nil && l.dynLevel.set.Load() {
+		return LoggerLevel(l.dynLevel.v.Load())
+	}
+	return l.Level
+}
+
+// SetLevel 运行时修改级别，可以和记录日志并发调用，WithFields、With 创建的子 Logger 一起修改；
+// 不是用 New、Default 创建的 Logger 直接修改 Level，不能并发调用
+func (l *Logger) SetLevel(level LoggerLevel) {
+	if l.dynLevel == nil {
+		l.Level = level
+		return
+	}
+	l.dynLevel.v.Store(int32(level))
+	l.dynLevel.set.Store(true)
+}
+
+// Named 返回模块的子 Logger，日志带上 module 字段，级别可以单独修改，初始为当前的级别
+func (l *Logger) Named(module string) *Logger {
+	child := l.WithFields(Fields{"module": module})
+	child.dynLevel = &levelVar{}
+	child.Level = l.GetLevel()
+	return child
+}
+
+var (
+	modulesMu sync.Mutex
+	modules   = make(map[string]*Logger)
+)
+
+// Module 返回名称为 name 的模块 Logger，如 orm、rpc、gateway，没有注册时注册一个输出到标准输出的 Logger；
+// 模块的级别可以用 SetModuleLevel 单独修改
+func Module(name string) *Logger {
+	return RegisterModule(name, func() *Logger {
+		return Default().Named(name)
+	})
+}
+
+// RegisterModule 注册模块 Logger，已经注册时返回已经注册的，否则用 newLogger 创建后注册并返回，如：
+//
+//	log.RegisterModule("gateway", func() *log.Logger { return engine.Logger.Named("gateway") })
+func RegisterModule(name string, newLogger func() *Logger) *Logger {
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+	if l, ok := modules[name]; ok {
+		return l
+	}
+	l := newLogger()
+	modules[name] = l
+	return l
+}
+
+// LookupModule 返回已注册的模块 Logger
+func LookupModule(name string) (*Logger, bool) {
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+	l, ok := modules[name]
+	return l, ok
+}
+
+// SetModuleLevel 修改模块的级别，模块没有注册时返回错误
+func SetModuleLevel(name string, level LoggerLevel) error {
+	l, ok := LookupModule(name)
+	if !ok {
+		return fmt.Errorf("log: unknown module %q", name)
+	}
+	l.SetLevel(level)
+	return nil
+}
+
+// ModuleLevels 返回所有已注册模块的级别
+func ModuleLevels() map[string]LoggerLevel {
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+	levels := make(map[string]LoggerLevel, len(modules))
+	for name, l := range modules {
+		levels[name] = l.GetLevel()
+	}
+	return levels
+}
+
+// ModuleNames 返回所有已注册模块的名称，按名称排序
+func ModuleNames() []string {
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+	names := make([]string, 0, len(modules))
+	for name := range modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
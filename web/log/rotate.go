@@ -0,0 +1,217 @@
+package log
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat 切割后的文件名中的时间，如 all-2024-01-02T15-04-05.000.log
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotateConf 日志文件切割的配置
+type RotateConf struct {
+	MaxSize    int64         // 单个文件的最大字节数，超过后切割，默认 100M
+	MaxBackups int           // 保留的切割文件数，0 表示不限制
+	MaxAge     time.Duration // 切割文件的保留时间，0 表示不限制
+	Compress   bool          // 是否用 gzip 压缩切割后的文件
+}
+
+// RotateWriter 按大小自动切割的日志文件：写入后超过 MaxSize 时把当前文件重命名为 name-时间.log，
+// 再创建新的文件继续写，之后在后台压缩切割的文件并删除超出 MaxBackups、MaxAge 的文件
+type RotateWriter struct {
+	Filename string
+	RotateConf
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+
+	millMu sync.Mutex
+}
+
+// NewRotateWriter 创建 RotateWriter，文件在第一次写入时打开
+func NewRotateWriter(filename string, conf RotateConf) *RotateWriter {
+	return &RotateWriter{Filename: filename, RotateConf: conf}
+}
+
+func (w *RotateWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	if w.size > 0 && w.size+int64(len(p)) > w.maxSize() {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate 立即切割当前文件，如配合 logrotate 等外部工具按天切割
+func (w *RotateWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rotate()
+}
+
+// Close 关闭当前文件
+func (w *RotateWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *RotateWriter) maxSize() int64 {
+	if w.MaxSize <= 0 {
+		return 100 << 20
+	}
+	return w.MaxSize
+}
+
+// open 打开日志文件，需要持有锁
+func (w *RotateWriter) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.Filename), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.Filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	w.file = f
+	w.size = info.Size()
+	return nil
+}
+
+// rotate 切割当前文件，需要持有锁
+func (w *RotateWriter) rotate() error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+		w.file = nil
+	}
+	if _, err := os.Stat(w.Filename); err == nil {
+		if err := os.Rename(w.Filename, w.backupName(time.Now())); err != nil {
+			return err
+		}
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	go w.mill()
+	return nil
+}
+
+// backupName 切割后的文件名
+func (w *RotateWriter) backupName(t time.Time) string {
+	dir, base := filepath.Split(w.Filename)
+	ext := filepath.Ext(base)
+	return filepath.Join(dir, strings.TrimSuffix(base, ext)+"-"+t.Format(backupTimeFormat)+ext)
+}
+
+// backup 切割后的文件
+type backup struct {
+	path string
+	time time.Time
+}
+
+// backups 返回切割后的文件，从新到旧排序
+func (w *RotateWriter) backups() ([]backup, error) {
+	dir, base := filepath.Split(w.Filename)
+	if dir == "" {
+		dir = "."
+	}
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext) + "-"
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var list []backup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		ts := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)
+		t, err := time.ParseInLocation(backupTimeFormat, strings.TrimPrefix(ts, prefix), time.Local)
+		if err != nil {
+			continue
+		}
+		list = append(list, backup{path: filepath.Join(dir, name), time: t})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].time.After(list[j].time)
+	})
+	return list, nil
+}
+
+// mill 删除超出 MaxBackups、MaxAge 的文件并压缩剩下的文件
+func (w *RotateWriter) mill() {
+	w.millMu.Lock()
+	defer w.millMu.Unlock()
+	list, err := w.backups()
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-w.MaxAge)
+	for i, b := range list {
+		if (w.MaxBackups > 0 && i >= w.MaxBackups) || (w.MaxAge > 0 && b.time.Before(cutoff)) {
+			_ = os.Remove(b.path)
+			continue
+		}
+		if w.Compress && !strings.HasSuffix(b.path, ".gz") {
+			_ = compressFile(b.path)
+		}
+	}
+}
+
+// compressFile 把文件压缩为 .gz 并删除原文件
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(name+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(name + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(name + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	_ = src.Close()
+	return os.Remove(name)
+}
@@ -0,0 +1,120 @@
+package log
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitFiles 等待后台的 mill 完成，dir 中以 prefix 开头的切割文件满足 cond 时返回这些文件
+func waitFiles(t *testing.T, dir, prefix string, cond func(names []string) bool) []string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name(), prefix) {
+				names = append(names, e.Name())
+			}
+		}
+		if cond(names) {
+			return names
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("backups in %s: %v", dir, names)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// TestRotateBySize 写入后超过 MaxSize 时切割，新的内容写入新的文件
+func TestRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	w := NewRotateWriter(name, RotateConf{MaxSize: 10})
+	defer w.Close()
+	for _, line := range []string{"first\n", "second\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := readFile(t, name); got != "second\n" {
+		t.Fatalf("current file = %q, want %q", got, "second\n")
+	}
+	backups := waitFiles(t, dir, "app-", func(names []string) bool { return len(names) == 1 })
+	if got := readFile(t, filepath.Join(dir, backups[0])); got != "first\n" {
+		t.Fatalf("backup = %q, want %q", got, "first\n")
+	}
+}
+
+// TestRotateMaxBackups 只保留最新的 MaxBackups 个切割文件
+func TestRotateMaxBackups(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	w := NewRotateWriter(name, RotateConf{MaxBackups: 2})
+	defer w.Close()
+	for i := 0; i < 4; i++ {
+		if _, err := w.Write([]byte{'0' + byte(i), '\n'}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond) // 切割文件名精确到毫秒
+	}
+	backups := waitFiles(t, dir, "app-", func(names []string) bool { return len(names) == 2 })
+	// 文件名中的时间可以按字符串排序，保留的是最后两次切割的文件
+	if got := readFile(t, filepath.Join(dir, backups[0])) + readFile(t, filepath.Join(dir, backups[1])); got != "2\n3\n" {
+		t.Fatalf("kept backups contain %q, want %q", got, "2\n3\n")
+	}
+}
+
+// TestRotateCompress 切割后的文件压缩为 .gz 并删除原文件
+func TestRotateCompress(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	w := NewRotateWriter(name, RotateConf{Compress: true})
+	defer w.Close()
+	if _, err := w.Write([]byte("compressed line\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	backups := waitFiles(t, dir, "app-", func(names []string) bool {
+		return len(names) == 1 && strings.HasSuffix(names[0], ".log.gz")
+	})
+	f, err := os.Open(filepath.Join(dir, backups[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "compressed line\n" {
+		t.Fatalf("decompressed = %q", b)
+	}
+}
@@ -0,0 +1,199 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// ParseLevel 解析级别名称，不区分大小写：debug、info、warn、error、fatal、panic
+func ParseLevel(s string) (LoggerLevel, error) {
+	for level := LevelDebug; level <= LevelPanic; level++ {
+		if strings.EqualFold(s, level.Level()) {
+			return level, nil
+		}
+	}
+	if strings.EqualFold(s, "warning") {
+		return LevelWarn, nil
+	}
+	return 0, fmt.Errorf("log: unknown level %q", s)
+}
+
+// ParseLevels 解析输出接收的级别，逗号分隔；级别后加 + 表示该级别及以上，all 或 * 表示所有级别，
+// 如 "error+"、"info,warn"
+func ParseLevels(s string) ([]LoggerLevel, error) {
+	var levels []LoggerLevel
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		switch {
+		case item == "":
+			continue
+		case item == "all" || item == "*":
+			return nil, nil // 所有级别
+		case strings.HasSuffix(item, "+"):
+			min, err := ParseLevel(strings.TrimSuffix(item, "+"))
+			if err != nil {
+				return nil, err
+			}
+			for level := min; level <= LevelPanic; level++ {
+				levels = append(levels, level)
+			}
+		default:
+			level, err := ParseLevel(item)
+			if err != nil {
+				return nil, err
+			}
+			levels = append(levels, level)
+		}
+	}
+	return levels, nil
+}
+
+// accepts 判断输出是否接收 level 级别的日志：设置了 Levels 时按 Levels，否则 Level 为 -1 时接收所有级别，
+// 其他值只接收该级别
+func (w *LoggerWriter) accepts(level LoggerLevel) bool {
+	if len(w.Levels) > 0 {
+		for _, l := range w.Levels {
+			if l == level {
+				return true
+			}
+		}
+		return false
+	}
+	return w.Level == -1 || w.Level == level
+}
+
+// OutputConf 一个日志输出的配置
+type OutputConf struct {
+	File   string        // 文件名，相对路径时在日志目录下；stdout、stderr 表示标准输出、标准错误
+	Levels []LoggerLevel // 接收的级别，为空时接收所有级别
+}
+
+// SetOutputs 替换所有的输出，按级别把日志写到不同的输出，如错误日志写到 error.log 和标准错误：
+//
+//	logger.SetOutputs("./log", []log.OutputConf{
+//		{File: "app.log", Levels: []log.LoggerLevel{log.LevelInfo, log.LevelWarn}},
+//		{File: "error.log", Levels: levels},
+//		{File: "stderr", Levels: levels},
+//	})
+func (l *Logger) SetOutputs(dir string, outputs []OutputConf) {
+	l.logPath = dir
+	conf := l.Rotate
+	if conf.MaxSize <= 0 {
+		conf.MaxSize = l.LogFileSize
+	}
+	outs := make([]*LoggerWriter, 0, len(outputs))
+	for _, o := range outputs {
+		var w io.Writer
+		switch o.File {
+		case "stdout":
+			w = os.Stdout
+		case "stderr":
+			w = os.Stderr
+		default:
+			name := o.File
+			if !path.IsAbs(name) {
+				name = path.Join(dir, name)
+			}
+			w = l.fileWriter(name, conf)
+		}
+		if l.async != nil && (o.File == "stdout" || o.File == "stderr") {
+			w = NewAsyncWriter(w, *l.async)
+		}
+		outs = append(outs, &LoggerWriter{Level: -1, Levels: o.Levels, Out: w})
+	}
+	l.Outs = outs
+}
+
+// LoadConf 按 app.toml 的 [log] 配置 Logger：
+//
+//	[log]
+//	level = "info"      # 低于该级别的日志不输出，开发环境设为 debug
+//	formatter = "text"  # 日志格式，内置 text、json，可以用 RegisterFormatter 注册
+//	path = "./log"      # 日志目录，没有 outputs 时按级别写入 all.log、debug.log 等文件
+//	max_size = 100      # 单个文件的最大 MB，以及 max_backups、max_age（天）、compress
+//	[[log.outputs]]
+//	file = "error.log"
+//	levels = "error+"
+//	[[log.outputs]]
+//	file = "stderr"
+//	levels = "error+"
+//	[[log.outputs]]
+//	file = "app.log"
+//	levels = "info,warn"
+//	[log.sampling]      # 每秒相同的日志先输出 5 条，之后每 100 条输出一条
+//	first = 5
+//	thereafter = 100
+//	tick = "1s"
+func (l *Logger) LoadConf(m map[string]any) error {
+	if s, ok := m["level"].(string); ok {
+		level, err := ParseLevel(s)
+		if err != nil {
+			return err
+		}
+		l.SetLevel(level)
+	}
+	formatter, err := formatterFromConf(m["formatter"])
+	if err != nil {
+		return err
+	}
+	if formatter != nil {
+		l.Formatter = formatter
+	}
+	l.Rotate = RotateConfFromMap(m)
+	sampling, err := samplingFromConf(m["sampling"])
+	if err != nil {
+		return err
+	}
+	if sampling != nil {
+		l.SetSampling(*sampling)
+	}
+	dir, _ := m["path"].(string)
+	outputs, err := outputsFromConf(m["outputs"])
+	if err != nil {
+		return err
+	}
+	if len(outputs) > 0 {
+		l.SetOutputs(dir, outputs)
+		return nil
+	}
+	if dir != "" {
+		l.SetLogPath(dir)
+	}
+	return nil
+}
+
+// outputsFromConf 解析 [[log.outputs]]
+func outputsFromConf(v any) ([]OutputConf, error) {
+	var items []map[string]any
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case []map[string]any:
+		items = v
+	case []any:
+		for _, item := range v {
+			if m, ok := item.(map[string]any); ok {
+				items = append(items, m)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("log: outputs should be an array of tables, got %T", v)
+	}
+	outputs := make([]OutputConf, 0, len(items))
+	for _, item := range items {
+		file, _ := item["file"].(string)
+		if file == "" {
+			return nil, fmt.Errorf("log: output without file")
+		}
+		levelsText, _ := item["levels"].(string)
+		levels, err := ParseLevels(levelsText)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, OutputConf{File: file, Levels: levels})
+	}
+	return outputs, nil
+}
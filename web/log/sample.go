@@ -0,0 +1,125 @@
+package log
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+)
+
+// SamplingConf 日志采样的配置：每个 Tick 内相同级别、相同内容的日志先输出 First 条，
+// 之后每 Thereafter 条输出一条，下游故障导致每个请求都报错时避免日志刷屏
+type SamplingConf struct {
+	Tick       time.Duration // 计数的周期，默认 1 秒
+	First      int           // 每个周期先输出的条数
+	Thereafter int           // 超过 First 后每多少条输出一条，0 表示超过后全部丢弃
+	Levels     []LoggerLevel // 采样的级别，默认 Debug 到 Error，Fatal、Panic 不采样
+}
+
+// samplerBuckets 计数的槽数，按内容的哈希取槽，内存占用固定，哈希冲突时共用计数
+const samplerBuckets = 4096
+
+type sampler struct {
+	conf     SamplingConf
+	levels   [LevelPanic + 1]bool
+	counters [LevelPanic + 1][samplerBuckets]sampleCounter
+	dropped  int64
+}
+
+type sampleCounter struct {
+	resetAt int64 // 当前周期结束的时间
+	n       int64
+}
+
+func newSampler(conf SamplingConf) *sampler {
+	if conf.Tick <= 0 {
+		conf.Tick = time.Second
+	}
+	s := &sampler{conf: conf}
+	levels := conf.Levels
+	if len(levels) == 0 {
+		levels = []LoggerLevel{LevelDebug, LevelInfo, LevelWarn, LevelError}
+	}
+	for _, level := range levels {
+		if level >= LevelDebug && level <= LevelPanic {
+			s.levels[level] = true
+		}
+	}
+	return s
+}
+
+// allow 判断这条日志是否输出
+func (s *sampler) allow(level LoggerLevel, msg any) bool {
+	if level < LevelDebug || level > LevelPanic || !s.levels[level] {
+		return true
+	}
+	h := fnv.New32a()
+	_, _ = fmt.Fprint(h, msg)
+	c := &s.counters[level][h.Sum32()%samplerBuckets]
+	n := c.inc(time.Now().UnixNano(), int64(s.conf.Tick))
+	if n <= int64(s.conf.First) || (s.conf.Thereafter > 0 && (n-int64(s.conf.First))%int64(s.conf.Thereafter) == 0) {
+		return true
+	}
+	atomic.AddInt64(&s.dropped, 1)
+	return false
+}
+
+// inc 计数加一并返回当前周期内的计数，周期结束后重新计数
+func (c *sampleCounter) inc(now, tick int64) int64 {
+	resetAt := atomic.LoadInt64(&c.resetAt)
+	if resetAt > now {
+		return atomic.AddInt64(&c.n, 1)
+	}
+	// 只有一个 goroutine 能开始新的周期，其他的在新周期中计数
+	if atomic.CompareAndSwapInt64(&c.resetAt, resetAt, now+tick) {
+		atomic.StoreInt64(&c.n, 1)
+		return 1
+	}
+	return atomic.AddInt64(&c.n, 1)
+}
+
+// SetSampling 开启日志采样，之后 WithFields、With 创建的子 Logger 共用采样的计数
+func (l *Logger) SetSampling(conf SamplingConf) {
+	l.sampler = newSampler(conf)
+}
+
+// SampledDropped 返回采样丢弃的日志条数
+func (l *Logger) SampledDropped() int64 {
+	if l.sampler == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&l.sampler.dropped)
+}
+
+// samplingFromConf 解析 [log.sampling]：first、thereafter、tick（如 "1s"）、levels（同 outputs 的 levels）
+func samplingFromConf(v any) (*SamplingConf, error) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		if v != nil {
+			return nil, fmt.Errorf("log: sampling should be a table, got %T", v)
+		}
+		return nil, nil
+	}
+	conf := &SamplingConf{}
+	if n, ok := m["first"].(int64); ok {
+		conf.First = int(n)
+	}
+	if n, ok := m["thereafter"].(int64); ok {
+		conf.Thereafter = int(n)
+	}
+	if s, ok := m["tick"].(string); ok {
+		tick, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("log: sampling tick: %w", err)
+		}
+		conf.Tick = tick
+	}
+	if s, ok := m["levels"].(string); ok {
+		levels, err := ParseLevels(s)
+		if err != nil {
+			return nil, err
+		}
+		conf.Levels = levels
+	}
+	return conf, nil
+}
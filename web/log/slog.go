@@ -0,0 +1,166 @@
+//go:build go1.21
+
+package log
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"sort"
+)
+
+// SlogHandler 把 Logger 包装为 slog.Handler，应用使用 slog 记录的日志和框架的日志走同一个 Logger，
+// 使用相同的级别、输出、字段和 Hook：
+//
+//	slog.SetDefault(slog.New(log.SlogHandler(engine.Logger)))
+func SlogHandler(l *Logger) slog.Handler {
+	return &slogHandler{logger: l}
+}
+
+type slogHandler struct {
+	logger *Logger
+	fields Fields // WithAttrs 添加的字段
+	group  string // WithGroup 的分组，字段名加上分组前缀，如 db.table
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.logger.GetLevel() <= fromSlogLevel(level)
+}
+
+func (h *slogHandler) Handle(_ context.Context, r slog.Record) error {
+	fields := make(Fields, len(h.fields)+r.NumAttrs())
+	for k, v := range h.fields {
+		fields[k] = v
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		addAttr(fields, h.group, a)
+		return true
+	})
+	l := h.logger
+	if len(fields) > 0 {
+		l = l.WithFields(fields)
+	}
+	var c *Caller
+	if l.ReportCaller && r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		c = &Caller{File: shortFile(frame.File), Line: frame.Line, Function: shortFunction(frame.Function)}
+	}
+	l.print(fromSlogLevel(r.Level), r.Message, c)
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make(Fields, len(h.fields)+len(attrs))
+	for k, v := range h.fields {
+		fields[k] = v
+	}
+	for _, a := range attrs {
+		addAttr(fields, h.group, a)
+	}
+	return &slogHandler{logger: h.logger, fields: fields, group: h.group}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &slogHandler{logger: h.logger, fields: h.fields, group: h.group + name + "."}
+}
+
+// addAttr 把 slog 的属性加入 fields，分组展开为 group.key
+func addAttr(fields Fields, group string, a slog.Attr) {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		prefix := group
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range v.Group() {
+			addAttr(fields, prefix, ga)
+		}
+		return
+	}
+	if a.Key == "" {
+		return
+	}
+	fields[group+a.Key] = v.Any()
+}
+
+// fromSlogLevel slog 的级别转换为 LoggerLevel，Fatal、Panic 只是级别，不会退出进程或 panic
+func fromSlogLevel(level slog.Level) LoggerLevel {
+	switch {
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelWarn:
+		return LevelInfo
+	case level < slog.LevelError:
+		return LevelWarn
+	case level < slog.LevelError+4:
+		return LevelError
+	case level < slog.LevelError+8:
+		return LevelFatal
+	default:
+		return LevelPanic
+	}
+}
+
+// toSlogLevel LoggerLevel 转换为 slog 的级别，Fatal、Panic 为 ERROR+4、ERROR+8
+func toSlogLevel(level LoggerLevel) slog.Level {
+	switch level {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelInfo:
+		return slog.LevelInfo
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelFatal:
+		return slog.LevelError + 4
+	case LevelPanic:
+		return slog.LevelError + 8
+	default:
+		return slog.LevelError
+	}
+}
+
+// SlogHook 把 Logger 的日志转发给 slog.Handler 的 Hook，字段转为 slog 的属性
+func SlogHook(h slog.Handler) Hook {
+	return HookFunc(func(level LoggerLevel, entry *Entry) error {
+		ctx := context.Background()
+		sl := toSlogLevel(level)
+		if !h.Enabled(ctx, sl) {
+			return nil
+		}
+		msg, ok := entry.Msg.(string)
+		if !ok {
+			if err, isErr := entry.Msg.(error); isErr {
+				msg = err.Error()
+			} else {
+				msg = slog.AnyValue(entry.Msg).String()
+			}
+		}
+		r := slog.NewRecord(entry.Time, sl, msg, 0)
+		keys := make([]string, 0, len(entry.Fields))
+		for k := range entry.Fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			r.AddAttrs(slog.Any(k, entry.Fields[k]))
+		}
+		if entry.Caller != nil {
+			r.AddAttrs(slog.String("caller", entry.Caller.String()), slog.String("func", entry.Caller.Function))
+		}
+		return h.Handle(ctx, r)
+	})
+}
+
+// FromSlog 返回只输出到 slog.Handler 的 Logger，框架内部的日志交给应用的 slog 处理，如：
+//
+//	engine.Logger = log.FromSlog(slog.Default().Handler())
+func FromSlog(h slog.Handler) *Logger {
+	logger := New()
+	logger.Level = LevelDebug
+	logger.Formatter = &TextFormatter{}
+	logger.AddHook(SlogHook(h))
+	return logger
+}
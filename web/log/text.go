@@ -2,46 +2,88 @@ package log
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// TextFormatter 文本格式，每条日志一行，各列对齐：
+//
+//	[web] 2006/01/02 - 15:04:05 | INFO  | orm/orm.go:359 | msg | module=orm table=user
+//
+// 输出到标准输出时带颜色，字段按名称排序，带空格等特殊字符的值加引号
 type TextFormatter struct {
+	DisableColor bool   // 不带颜色，即使输出到标准输出
+	TimeFormat   string // 时间格式，默认 2006/01/02 - 15:04:05
 }
 
 func (f *TextFormatter) Format(param *LoggingFormatParam) string {
-	now := time.Now()
-	fieldsString := ""
-	if param.LoggerFields != nil {
-		//name=xx,age=xxx
-		var sb strings.Builder
-		var count = 0
-		var lens = len(param.LoggerFields)
-		for k, v := range param.LoggerFields {
-			fmt.Fprintf(&sb, "%s=%v", k, v)
-			if count < lens-1 {
-				fmt.Fprintf(&sb, ",")
-				count++
+	color := param.IsColor && !f.DisableColor
+	timeFormat := f.TimeFormat
+	if timeFormat == "" {
+		timeFormat = "2006/01/02 - 15:04:05"
+	}
+	var sb strings.Builder
+	if color {
+		sb.WriteString(yellow + "[web]" + reset + " " + blue + time.Now().Format(timeFormat) + reset)
+		fmt.Fprintf(&sb, " | %s%-5s%s", f.LevelColor(param.Level), param.Level.Level(), reset)
+	} else {
+		sb.WriteString("[web] " + time.Now().Format(timeFormat))
+		fmt.Fprintf(&sb, " | %-5s", param.Level.Level())
+	}
+	if param.Caller != nil {
+		sb.WriteString(" | " + param.Caller.String() + " " + param.Caller.Function)
+	}
+	sb.WriteString(" | ")
+	msg := formatValue(param.Msg, false)
+	if c := f.MsgColor(param.Level); color && c != "" {
+		msg = c + msg + reset
+	}
+	sb.WriteString(msg)
+	if len(param.LoggerFields) > 0 {
+		sb.WriteString(" |")
+		// 按字段名排序，同样的字段每行顺序一致
+		keys := make([]string, 0, len(param.LoggerFields))
+		for k := range param.LoggerFields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			sb.WriteByte(' ')
+			if color {
+				sb.WriteString(cyan + k + reset)
+			} else {
+				sb.WriteString(k)
 			}
+			sb.WriteByte('=')
+			sb.WriteString(formatValue(param.LoggerFields[k], true))
 		}
-		fieldsString = sb.String()
 	}
-	var msgInfo = "\n msg: "
-	if param.Level == LevelError {
-		msgInfo = "\n Error Cause By: "
+	return sb.String()
+}
+
+// formatValue 格式化消息和字段值，quote 为 true 时带空格、引号、等号的值加引号，避免字段分不清
+func formatValue(v any, quote bool) string {
+	var s string
+	switch v := v.(type) {
+	case nil:
+		s = "<nil>"
+	case string:
+		s = v
+	case error:
+		s = v.Error()
+	case time.Time:
+		s = v.Format(time.RFC3339)
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		s = fmt.Sprint(v)
 	}
-	if param.IsColor {
-		//要带颜色  error的颜色 为红色 info为绿色 debug为蓝色
-		levelColor := f.LevelColor(param.Level)
-		msgColor := f.MsgColor(param.Level)
-		return fmt.Sprintf("%s [web] %s %s%v%s | level= %s %s %s%s%s %v %s %s ",
-			yellow, reset, blue, now.Format("2006/01/02 - 15:04:05"), reset,
-			levelColor, param.Level.Level(), reset, msgColor, msgInfo, param.Msg, reset, fieldsString,
-		)
+	if quote && (s == "" || strings.ContainsAny(s, " \t\r\n\"=|")) {
+		return strconv.Quote(s)
 	}
-	return fmt.Sprintf("[web] %v | level=%s%s%v %s",
-		now.Format("2006/01/02 - 15:04:05"),
-		param.Level.Level(), msgInfo, param.Msg, fieldsString)
+	return s
 }
 
 func (f *TextFormatter) LevelColor(level LoggerLevel) string {
@@ -50,8 +92,12 @@ func (f *TextFormatter) LevelColor(level LoggerLevel) string {
 		return blue
 	case LevelInfo:
 		return green
+	case LevelWarn:
+		return yellow
 	case LevelError:
 		return red
+	case LevelFatal, LevelPanic:
+		return magenta
 	default:
 		return cyan
 	}
@@ -59,7 +105,7 @@ func (f *TextFormatter) LevelColor(level LoggerLevel) string {
 
 func (f *TextFormatter) MsgColor(level LoggerLevel) string {
 	switch level {
-	case LevelError:
+	case LevelError, LevelFatal, LevelPanic:
 		return red
 	default:
 		return ""
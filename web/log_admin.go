@@ -0,0 +1,108 @@
+package web
+
+import (
+	"fmt"
+	myLog "github.com/ygb616/web/log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ModuleLogger 返回模块的 Logger，如 gateway，没有注册时注册为 e.Logger 的子 Logger，
+// 日志写到引擎的输出，级别可以用 LogLevelAdmin 或 myLog.SetModuleLevel 单独修改
+func (e *Engine) ModuleLogger(name string) *myLog.Logger {
+	return myLog.RegisterModule(name, func() *myLog.Logger {
+		return e.Logger.Named(name)
+	})
+}
+
+// logLevelRestore 按 module 记录 ttl 到期后恢复级别的定时器，"" 为引擎的 Logger
+var (
+	logLevelMu      sync.Mutex
+	logLevelRestore = make(map[string]*time.Timer)
+)
+
+// LogLevelAdmin 运行时查看和修改日志级别的管理接口，排查线上问题时不用重新部署就能打开 debug 日志：
+//
+//	e.Group("debug").Any("/log/level", web.LogLevelAdmin)
+//
+// GET 返回引擎 Logger 和各模块（orm、rpc、gateway 等）的级别；POST 修改级别，参数 level 为
+// debug、info、warn、error 等，module 为空时修改引擎的 Logger，否则修改该模块；
+// ttl 参数（如 10m）设置后到期自动恢复原来的级别，挂载时的注意事项见包文档的管理接口一节
+func LogLevelAdmin(ctx *Context) {
+	switch ctx.R.Method {
+	case http.MethodGet:
+		modules := make(map[string]string)
+		for name, level := range myLog.ModuleLevels() {
+			modules[name] = level.Level()
+		}
+		_ = ctx.JSON(http.StatusOK, map[string]any{
+			"level":   ctx.E.Logger.GetLevel().Level(),
+			"modules": modules,
+		})
+	case http.MethodPost:
+		level, err := myLog.ParseLevel(ctx.GetQuery("level"))
+		if err != nil {
+			_ = ctx.JSON(http.StatusBadRequest, map[string]any{"code": http.StatusBadRequest, "msg": err.Error()})
+			return
+		}
+		var ttl time.Duration
+		if s := ctx.GetQuery("ttl"); s != "" {
+			if ttl, err = time.ParseDuration(s); err != nil || ttl <= 0 {
+				_ = ctx.JSON(http.StatusBadRequest, map[string]any{"code": http.StatusBadRequest, "msg": "ttl must be a positive duration like 10m"})
+				return
+			}
+		}
+		module := ctx.GetQuery("module")
+		if err := ctx.E.SetLogLevel(module, level, ttl); err != nil {
+			_ = ctx.JSON(http.StatusNotFound, map[string]any{"code": http.StatusNotFound, "msg": err.Error()})
+			return
+		}
+		ctx.E.Logger.Warn("log level of " + moduleName(module) + " changed to " + level.Level())
+		_ = ctx.JSON(http.StatusOK, map[string]any{"code": http.StatusOK, "msg": "ok", "level": level.Level()})
+	default:
+		ctx.W.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// SetLogLevel 修改日志级别，module 为空时修改 e.Logger，否则修改已注册的模块；
+// ttl 大于 0 时到期后恢复为修改前的级别，期间再次修改会取消之前的恢复
+func (e *Engine) SetLogLevel(module string, level myLog.LoggerLevel, ttl time.Duration) error {
+	logger := e.Logger
+	if module != "" {
+		var ok bool
+		if logger, ok = myLog.LookupModule(module); !ok {
+			return fmt.Errorf("web: unknown log module %q", module)
+		}
+	}
+	logLevelMu.Lock()
+	defer logLevelMu.Unlock()
+	if t, ok := logLevelRestore[module]; ok {
+		t.Stop()
+		delete(logLevelRestore, module)
+	}
+	previous := logger.GetLevel()
+	logger.SetLevel(level)
+	if ttl > 0 {
+		var t *time.Timer
+		t = time.AfterFunc(ttl, func() {
+			logLevelMu.Lock()
+			defer logLevelMu.Unlock()
+			if logLevelRestore[module] != t {
+				return // 已经被再次修改
+			}
+			delete(logLevelRestore, module)
+			logger.SetLevel(previous)
+			logger.Warn("log level of " + moduleName(module) + " restored to " + previous.Level())
+		})
+		logLevelRestore[module] = t
+	}
+	return nil
+}
+
+func moduleName(module string) string {
+	if module == "" {
+		return "engine"
+	}
+	return module
+}
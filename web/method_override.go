@@ -0,0 +1,51 @@
+package web
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// MethodOverrideConf 方法覆盖的配置，见 Engine.MethodOverride
+type MethodOverrideConf struct {
+	Header    string   // 覆盖方法的请求头，默认 X-HTTP-Method-Override
+	FormField string   // 覆盖方法的表单字段，默认 _method，为 "-" 时不读取表单
+	Methods   []string // 允许覆盖为的方法，默认 PUT、PATCH、DELETE
+}
+
+// overrideMethod POST 请求按请求头或表单字段修改 r.Method，需要在匹配路由之前调用
+func (conf *MethodOverrideConf) overrideMethod(r *http.Request) {
+	if r.Method != http.MethodPost {
+		return
+	}
+	header := conf.Header
+	if header == "" {
+		header = "X-HTTP-Method-Override"
+	}
+	method := r.Header.Get(header)
+	if method == "" && conf.FormField != "-" {
+		field := conf.FormField
+		if field == "" {
+			field = "_method"
+		}
+		// 只读取表单请求的请求体，JSON 等请求体留给处理函数
+		contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if contentType == "application/x-www-form-urlencoded" || contentType == "multipart/form-data" {
+			method = r.PostFormValue(field)
+		}
+	}
+	if method == "" {
+		return
+	}
+	method = strings.ToUpper(method)
+	methods := conf.Methods
+	if len(methods) == 0 {
+		methods = []string{http.MethodPut, http.MethodPatch, http.MethodDelete}
+	}
+	for _, m := range methods {
+		if m == method {
+			r.Method = method
+			return
+		}
+	}
+}
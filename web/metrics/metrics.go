@@ -0,0 +1,347 @@
+// Package metrics 简单的指标统计，按 Prometheus 文本格式输出，不依赖 Prometheus 客户端
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Collector 指标，按 Prometheus 文本格式输出
+type Collector interface {
+	Name() string
+	Write(w io.Writer)
+}
+
+// Registry 指标注册表
+type Registry struct {
+	mu         sync.RWMutex
+	collectors map[string]Collector
+}
+
+// NewRegistry 创建指标注册表
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]Collector)}
+}
+
+// Default 默认的指标注册表，NewCounterVec 等函数创建的指标都注册在这里
+var Default = NewRegistry()
+
+// Register 注册指标，同名的指标已经存在时返回已有的指标
+func (r *Registry) Register(c Collector) Collector {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if exist, ok := r.collectors[c.Name()]; ok {
+		return exist
+	}
+	r.collectors[c.Name()] = c
+	return c
+}
+
+// Unregister 删除指标
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.collectors, name)
+}
+
+// WritePrometheus 按名称顺序输出所有指标
+func (r *Registry) WritePrometheus(w io.Writer) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	collectors := make([]Collector, 0, len(names))
+	for _, name := range names {
+		collectors = append(collectors, r.collectors[name])
+	}
+	r.mu.RUnlock()
+	for _, c := range collectors {
+		c.Write(w)
+	}
+}
+
+// Handler 返回输出 Default 中所有指标的 http.Handler，供 Prometheus 抓取
+func Handler() http.Handler {
+	return HandlerFor(Default)
+}
+
+// HandlerFor 返回输出 r 中所有指标的 http.Handler
+func HandlerFor(r *Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WritePrometheus(w)
+	})
+}
+
+// vec 按标签值分组的指标
+type vec[T any] struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.RWMutex
+	values map[string]*T
+	keys   map[string][]string // 分组键 -> 标签值
+	newT   func() *T
+}
+
+func (v *vec[T]) Name() string {
+	return v.name
+}
+
+// with 根据标签值获取指标，不存在时创建
+func (v *vec[T]) with(labelValues []string) *T {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	v.mu.RLock()
+	t, ok := v.values[key]
+	v.mu.RUnlock()
+	if ok {
+		return t
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if t, ok = v.values[key]; !ok {
+		t = v.newT()
+		v.values[key] = t
+		v.keys[key] = append([]string(nil), labelValues...)
+	}
+	return t
+}
+
+// each 按标签值的顺序遍历
+func (v *vec[T]) each(f func(labelValues []string, t *T)) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.values))
+	for key := range v.values {
+		keys = append(keys, key)
+	}
+	v.mu.RUnlock()
+	sort.Strings(keys)
+	for _, key := range keys {
+		v.mu.RLock()
+		t, labelValues := v.values[key], v.keys[key]
+		v.mu.RUnlock()
+		f(labelValues, t)
+	}
+}
+
+func (v *vec[T]) header(w io.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, typ)
+}
+
+// labelString 输出 {k1="v1",k2="v2"}，extra 为额外的标签，如 le
+func labelString(labels, values []string, extra ...string) string {
+	if len(labels) == 0 && len(extra) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, label := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(label)
+		b.WriteString("=")
+		b.WriteString(strconv.Quote(values[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		b.WriteString(extra[i])
+		b.WriteString("=")
+		b.WriteString(strconv.Quote(extra[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// value 并发安全的数值
+type value struct {
+	mu sync.Mutex
+	v  float64
+}
+
+func (v *value) add(delta float64) {
+	v.mu.Lock()
+	v.v += delta
+	v.mu.Unlock()
+}
+
+func (v *value) set(f float64) {
+	v.mu.Lock()
+	v.v = f
+	v.mu.Unlock()
+}
+
+func (v *value) get() float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.v
+}
+
+// CounterVec 只增不减的计数器，按标签分组
+type CounterVec struct {
+	vec[value]
+}
+
+// NewCounterVec 创建计数器并注册到 Default，同名的指标已经存在时返回已有的指标
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec[value]{name: name, help: help, labels: labels, values: make(map[string]*value), keys: make(map[string][]string), newT: func() *value { return &value{} }}}
+	return Default.Register(c).(*CounterVec)
+}
+
+// Inc 加一
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.with(labelValues).add(1)
+}
+
+// Add 增加 delta，delta 不能为负数
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	c.with(labelValues).add(delta)
+}
+
+// Value 返回当前值
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	return c.with(labelValues).get()
+}
+
+func (c *CounterVec) Write(w io.Writer) {
+	c.header(w, "counter")
+	c.each(func(labelValues []string, v *value) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, labelString(c.labels, labelValues), formatFloat(v.get()))
+	})
+}
+
+// GaugeVec 可增可减的指标，按标签分组
+type GaugeVec struct {
+	vec[value]
+}
+
+// NewGaugeVec 创建 Gauge 并注册到 Default，同名的指标已经存在时返回已有的指标
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{vec[value]{name: name, help: help, labels: labels, values: make(map[string]*value), keys: make(map[string][]string), newT: func() *value { return &value{} }}}
+	return Default.Register(g).(*GaugeVec)
+}
+
+// Set 设置当前值
+func (g *GaugeVec) Set(f float64, labelValues ...string) {
+	g.with(labelValues).set(f)
+}
+
+// Add 增加 delta，可以为负数
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	g.with(labelValues).add(delta)
+}
+
+// Value 返回当前值
+func (g *GaugeVec) Value(labelValues ...string) float64 {
+	return g.with(labelValues).get()
+}
+
+func (g *GaugeVec) Write(w io.Writer) {
+	g.header(w, "gauge")
+	g.each(func(labelValues []string, v *value) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, labelString(g.labels, labelValues), formatFloat(v.get()))
+	})
+}
+
+// DefBuckets 默认的耗时分桶，单位秒
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// histogram 分桶统计
+type histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+// HistogramVec 分桶统计，如请求耗时，按标签分组
+type HistogramVec struct {
+	vec[histogram]
+	buckets []float64
+}
+
+// NewHistogramVec 创建分桶统计并注册到 Default，buckets 为 nil 时使用 DefBuckets
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &HistogramVec{buckets: buckets}
+	h.vec = vec[histogram]{name: name, help: help, labels: labels, values: make(map[string]*histogram), keys: make(map[string][]string), newT: func() *histogram {
+		return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+	}}
+	return Default.Register(h).(*HistogramVec)
+}
+
+// Observe 记录一个值
+func (h *HistogramVec) Observe(f float64, labelValues ...string) {
+	t := h.with(labelValues)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, bound := range t.buckets {
+		if f <= bound {
+			t.counts[i]++
+		}
+	}
+	t.sum += f
+	t.count++
+}
+
+func (h *HistogramVec) Write(w io.Writer) {
+	h.header(w, "histogram")
+	h.each(func(labelValues []string, t *histogram) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		for i, bound := range t.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelString(h.labels, labelValues, "le", formatFloat(bound)), t.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelString(h.labels, labelValues, "le", "+Inf"), t.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelString(h.labels, labelValues), formatFloat(t.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelString(h.labels, labelValues), t.count)
+	})
+}
+
+// GaugeFunc 读取时通过函数计算的指标，如连接池当前的协程数
+type GaugeFunc struct {
+	name string
+	help string
+	f    func() float64
+}
+
+// NewGaugeFunc 创建 GaugeFunc 并注册到 Default，同名的指标已经存在时替换为新的函数
+func NewGaugeFunc(name, help string, f func() float64) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, f: f}
+	Default.Unregister(name)
+	Default.Register(g)
+	return g
+}
+
+func (g *GaugeFunc) Name() string {
+	return g.name
+}
+
+func (g *GaugeFunc) Write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, g.help, g.name, g.name, formatFloat(g.f()))
+}
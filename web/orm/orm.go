@@ -50,7 +50,7 @@ func Open(driverName string, source string) *WebDb {
 	// 创建 WebDb 实例
 	msDb := &WebDb{
 		db:     db,
-		logger: myLog.Default(),
+		logger: myLog.Module("orm"),
 	}
 	// 测试数据库连接是否可用
 	err = db.Ping()
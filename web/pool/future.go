@@ -0,0 +1,70 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// Future 异步任务的结果，通过 Get 等待任务完成
+type Future[T any] struct {
+	done   chan struct{}
+	result T
+	err    error
+}
+
+// SubmitFunc 提交一个有返回值的任务，返回任务的 Future，便于并发执行多个任务后汇总结果：
+//
+//	user := pool.SubmitFunc(p, func() (*User, error) { return getUser(id) })
+//	orders := pool.SubmitFunc(p, func() ([]Order, error) { return getOrders(id) })
+//	u, err := user.Get(ctx)
+//
+// 提交失败（如 pool 已释放、过载）时 Future 立即完成，Get 返回提交的错误；任务 panic 时 Get 返回错误
+func SubmitFunc[T any](p *Pool, f func() (T, error)) *Future[T] {
+	return SubmitFuncCtx(context.Background(), p, f)
+}
+
+// SubmitFuncCtx 与 SubmitFunc 相同，使用 SubmitCtx 提交，ctx 结束时放弃等待 worker 或取消排队的任务
+func SubmitFuncCtx[T any](ctx context.Context, p *Pool, f func() (T, error)) *Future[T] {
+	future := &Future[T]{done: make(chan struct{})}
+	err := p.submit(ctx, func() {
+		if err := ctx.Err(); err != nil {
+			future.err = err // 排队或等待执行期间 ctx 已经结束，取消任务
+			close(future.done)
+			return
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				future.err = fmt.Errorf("pool: task panic: %v", r)
+				close(future.done)
+				panic(&taskPanic{value: r, stack: debug.Stack()}) // 交给 pool 的 PanicHandler 处理
+			}
+			close(future.done)
+		}()
+		future.result, future.err = f()
+	}, func() {
+		future.err = ErrorHasClosed // 排队期间 pool 被释放，任务被丢弃
+		close(future.done)
+	}, !p.nonblocking, PriorityNormal)
+	if err != nil {
+		future.err = err
+		close(future.done)
+	}
+	return future
+}
+
+// Done 任务完成时关闭
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Get 等待任务完成并返回结果，ctx 结束时返回 ctx.Err()，不影响任务的执行
+func (f *Future[T]) Get(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
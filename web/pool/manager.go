@@ -0,0 +1,164 @@
+package pool
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ygb616/web/config"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Manager 按名称管理多个 pool，如 io 密集和 cpu 密集的任务分开，互不影响
+type Manager struct {
+	mu    sync.Mutex
+	pools map[string]*Pool
+	// conf 返回 pool 的配置，默认读取配置文件的 [pool]
+	conf func() map[string]any
+}
+
+// NewManager 创建 Manager，配置从配置文件的 [pool] 中读取：
+//
+//	[pool]
+//	io = 100
+//	cpu = 8
+//	[pool.batch]
+//	cap = 20
+//	expire = 10
+//	queue = 1000
+//	rejectPolicy = "abort"   # wait、abort、callerRuns
+//	nonblocking = false
+//	preAlloc = false
+func NewManager() *Manager {
+	return &Manager{
+		pools: make(map[string]*Pool),
+		conf: func() map[string]any {
+			return config.GetToml().Pool
+		},
+	}
+}
+
+// DefaultManager 默认的 Manager，Get、ReleaseAll 使用
+var DefaultManager = NewManager()
+
+// Get 从 DefaultManager 获取名称为 name 的 pool，不存在时按配置创建，没有配置时返回 nil
+func Get(name string) *Pool {
+	p, err := DefaultManager.Get(name)
+	if err != nil {
+		return nil
+	}
+	return p
+}
+
+// ReleaseAll 释放 DefaultManager 中所有的 pool，服务停止时调用，每个 pool 最多等待 timeout
+func ReleaseAll(timeout time.Duration) error {
+	return DefaultManager.ReleaseAll(timeout)
+}
+
+// Get 获取名称为 name 的 pool，不存在时按配置创建；没有配置或配置错误时返回错误
+func (m *Manager) Get(name string) (*Pool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if p, ok := m.pools[name]; ok {
+		return p, nil
+	}
+	v, ok := m.conf()[name]
+	if !ok {
+		return nil, fmt.Errorf("pool %s config not exist", name)
+	}
+	cap, expire, opts, err := optionsOf(v)
+	if err != nil {
+		return nil, fmt.Errorf("pool %s: %w", name, err)
+	}
+	p, err := NewTimePool(cap, expire, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("pool %s: %w", name, err)
+	}
+	p.RegisterMetrics(name)
+	m.pools[name] = p
+	return p, nil
+}
+
+// Set 把自己创建的 pool 交给 Manager 管理，同名的 pool 已经存在时返回错误
+func (m *Manager) Set(name string, p *Pool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.pools[name]; ok {
+		return fmt.Errorf("pool %s already exist", name)
+	}
+	p.RegisterMetrics(name)
+	m.pools[name] = p
+	return nil
+}
+
+// Names 返回所有已经创建的 pool 的名称
+func (m *Manager) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.pools))
+	for name := range m.pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReleaseAll 并发释放所有的 pool，每个 pool 等待正在执行的任务最多 timeout，有超时的 pool 时返回错误
+func (m *Manager) ReleaseAll(timeout time.Duration) error {
+	m.mu.Lock()
+	pools := m.pools
+	m.pools = make(map[string]*Pool)
+	m.mu.Unlock()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+	for name, p := range pools {
+		wg.Add(1)
+		go func(name string, p *Pool) {
+			defer wg.Done()
+			if err := p.ReleaseTimeout(timeout); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("pool %s: %w", name, err))
+				mu.Unlock()
+			}
+		}(name, p)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// optionsOf 解析一个 pool 的配置，可以是容量，也可以是表
+func optionsOf(v any) (cap int, expire int, opts []Option, err error) {
+	expire = DefaultExpire
+	switch c := v.(type) {
+	case int64:
+		return int(c), expire, nil, nil
+	case map[string]any:
+		n, ok := c["cap"].(int64)
+		if !ok {
+			return 0, 0, nil, errors.New("cap config not exist")
+		}
+		cap = int(n)
+		if e, ok := c["expire"].(int64); ok {
+			expire = int(e)
+		}
+		if q, ok := c["queue"].(int64); ok {
+			policy := RejectWait
+			switch c["rejectPolicy"] {
+			case "abort":
+				policy = RejectAbort
+			case "callerRuns":
+				policy = RejectCallerRuns
+			}
+			opts = append(opts, WithQueue(int(q), policy))
+		}
+		if b, ok := c["nonblocking"].(bool); ok {
+			opts = append(opts, WithNonblocking(b))
+		}
+		if b, ok := c["preAlloc"].(bool); ok {
+			opts = append(opts, WithPreAlloc(b))
+		}
+		return cap, expire, opts, nil
+	}
+	return 0, 0, nil, fmt.Errorf("invalid config %v", v)
+}
@@ -1,9 +1,12 @@
 package pool
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/ygb616/web/config"
+	myLog "github.com/ygb616/web/log"
+	"runtime/debug"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -17,19 +20,59 @@ var (
 	ErrorInValidCap    = errors.New("pool cap can not <= 0")
 	ErrorInValidExpire = errors.New("pool expire can not <= 0")
 	ErrorHasClosed     = errors.New("pool has bean released!!")
+	ErrPoolOverload    = errors.New("pool overload, no idle worker")
+	ErrReleaseTimeout  = errors.New("pool release timeout, tasks still running")
 )
 
+// Option 创建 pool 时的可选配置
+type Option func(p *Pool)
+
+// WithNonblocking 非阻塞模式，没有空闲的 worker 时 Submit 立即返回 ErrPoolOverload，由调用方决定如何降级
+func WithNonblocking(nonblocking bool) Option {
+	return func(p *Pool) {
+		p.nonblocking = nonblocking
+	}
+}
+
+// RejectPolicy 没有空闲的 worker 并且任务队列已满时的处理方式
+type RejectPolicy int
+
+const (
+	RejectWait       RejectPolicy = iota // 等待 worker 空闲或队列有空位，默认
+	RejectAbort                          // 立即返回 ErrPoolOverload
+	RejectCallerRuns                     // 由提交任务的 goroutine 直接执行，自然地降低提交速度
+)
+
+// WithQueue 在 Submit 和 worker 之间加一个有界的先进先出任务队列，worker 都在忙时任务先排队，
+// 平滑短时间的突发流量而不增加 goroutine；队列满时按 policy 处理
+func WithQueue(maxQueue int, policy RejectPolicy) Option {
+	return func(p *Pool) {
+		p.maxQueue = maxQueue
+		p.rejectPolicy = policy
+	}
+}
+
+// WithPreAlloc 创建 pool 时启动所有的 worker，并且空闲的 worker 不过期回收，
+// 适合对延迟敏感的服务，避免流量高峰时集中新建 worker；容量很大时不要使用
+func WithPreAlloc(preAlloc bool) Option {
+	return func(p *Pool) {
+		p.preAlloc = preAlloc
+	}
+}
+
 type Pool struct {
 	//cap 容量 pool max cap
 	cap int32
 	//running 正在运行的worker的数量
 	running int32
-	//空闲worker
-	workers []*Worker
+	//空闲worker，按 P 分片，没有排队和等待的提交者时获取、归还 worker 不需要全局锁
+	idle idleWorkers
 	//expire 过期时间 空闲的worker超过这个时间 回收掉
 	expire time.Duration
 	//release 释放资源  pool就不能使用了
 	release chan sig
+	//closed 与 release 同步设置，不加锁读取时使用原子操作
+	closed int32
 	//lock 去保护pool里面的相关资源的安全
 	lock sync.Mutex
 	//once 释放只能调用一次 不能多次调用
@@ -38,27 +81,46 @@ type Pool struct {
 	workerCache sync.Pool
 	//cond
 	cond *sync.Cond
-	//PanicHandler
-	PanicHandler func()
+	//PanicHandler 任务 panic 时调用，recovered 为 recover() 的返回值，stack 为 panic 时的调用栈；
+	//为空时记录错误日志；旧的 func() 形式可以用 PanicFunc 转换
+	PanicHandler func(recovered any, stack []byte)
+	//TimeoutHandler SubmitWithTimeout 提交的任务执行超时时调用，为空时记录错误日志
+	TimeoutHandler func(timeout time.Duration)
+	//nonblocking 没有空闲的worker时不等待，直接返回 ErrPoolOverload
+	nonblocking bool
+	//queue 等待执行的任务，按优先级分组，最多 maxQueue 个
+	queue    taskQueue
+	maxQueue int
+	//waiting 按优先级统计等待worker的提交者
+	waiting waiters
+	//rejectPolicy 队列已满时的处理方式
+	rejectPolicy RejectPolicy
+	//counters 运行统计
+	counters counters
+	//metricsName 注册指标时使用的名称
+	metricsName string
+	//preAlloc 预先启动所有的worker，空闲的worker不回收
+	preAlloc bool
 }
 
 // NewPoolConf 从配置文件中创建一个新的连接池
+//
+// Deprecated: 使用 Get 按名称获取配置文件中的 pool，如 pool.Get("c")，服务停止时用 ReleaseAll 统一释放
 func NewPoolConf() (*Pool, error) {
-	// 从全局配置 config.Conf 中获取连接池配置 "c"
-	c, ok := config.GetToml().Pool["c"]
-	if !ok {
+	// 从全局配置中获取连接池配置 pool.c
+	if _, ok := config.Get("pool.c"); !ok {
 		// 如果配置中没有找到 "c"，返回错误
 		return nil, errors.New("c config not exist")
 	}
 	// 调用 NewTimePool 函数创建一个新的连接池，使用从配置中获取的值作为参数
-	return NewTimePool(int(c.(int64)), DefaultExpire)
+	return NewTimePool(config.GetInt("pool.c", 0), DefaultExpire)
 }
 
-func NewPool(cap int) (*Pool, error) {
-	return NewTimePool(cap, DefaultExpire)
+func NewPool(cap int, opts ...Option) (*Pool, error) {
+	return NewTimePool(cap, DefaultExpire, opts...)
 }
 
-func NewTimePool(cap int, expire int) (*Pool, error) {
+func NewTimePool(cap int, expire int, opts ...Option) (*Pool, error) {
 	if cap <= 0 {
 		return nil, ErrorInValidCap
 	}
@@ -69,14 +131,25 @@ func NewTimePool(cap int, expire int) (*Pool, error) {
 		cap:     int32(cap),
 		expire:  time.Duration(expire) * time.Second,
 		release: make(chan sig, 1),
+		idle:    newIdleWorkers(),
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
 	p.workerCache.New = func() any {
 		return &Worker{
-			pool: p,
-			task: make(chan func(), 1),
+			pool:  p,
+			task:  make(chan func(), 1),
+			shard: p.idle.assign(),
 		}
 	}
 	p.cond = sync.NewCond(&p.lock)
+	if p.preAlloc {
+		p.lock.Lock()
+		p.spawnIdle()
+		p.lock.Unlock()
+		return p, nil // 预先启动的 worker 不过期回收
+	}
 	go p.expireWorker()
 	return p, nil
 }
@@ -89,150 +162,290 @@ func (p *Pool) expireWorker() {
 		if p.IsClosed() { // 如果线程池已关闭，则退出循环
 			break
 		}
-		p.lock.Lock()             // 加锁，开始操作共享资源
-		idleWorkers := p.workers  // 获取当前的空闲工作者列表
-		n := len(idleWorkers) - 1 // 获取列表中最后一个元素的索引
-		if n >= 0 {               // 如果列表不为空
-			var clearN = -1                 // 初始化一个标记，用来记录需要清理的worker的最大索引
-			for i, w := range idleWorkers { // 遍历空闲工作者列表
-				// 如果当前时间与worker的最后活动时间的差值大于过期时间，则该worker过期
-				if time.Now().Sub(w.lastTime) <= p.expire {
-					break // 如果遇到未过期的worker，停止检查
+		// 从各个分片取出空闲超过过期时间的worker，向worker的任务通道发送nil，触发worker停止
+		expired := p.idle.expire(time.Now().Add(-p.expire))
+		for _, w := range expired {
+			w.task <- nil
+		}
+		if len(expired) > 0 {
+			// 打印清理完成后的状态
+			fmt.Printf("清除完成,running:%d, idle:%d \n", p.Running(), p.idle.len())
+		}
+	}
+}
+
+// Submit 方法用于将一个任务提交到线程池，没有空闲的 worker 时阻塞等待，非阻塞模式下返回 ErrPoolOverload
+func (p *Pool) Submit(task func()) error {
+	return p.SubmitCtx(context.Background(), task)
+}
+
+// TrySubmit 提交任务，没有空闲的 worker 时立即返回 ErrPoolOverload，不受非阻塞模式影响
+func (p *Pool) TrySubmit(task func()) error {
+	return p.submit(context.Background(), task, nil, false, PriorityNormal)
+}
+
+// SubmitWithTimeout 提交任务，任务执行超过 timeout 时放弃等待，worker 立即释放去执行其他任务，
+// 卡住的任务不会一直占用 worker；超时的任务不能被强制停止，会在单独的 goroutine 中继续执行直到返回，
+// 超时时调用 TimeoutHandler，没有设置时记录错误日志
+func (p *Pool) SubmitWithTimeout(task func(), timeout time.Duration) error {
+	if timeout <= 0 {
+		return p.Submit(task)
+	}
+	return p.Submit(func() {
+		done := make(chan *taskPanic, 1)
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					done <- &taskPanic{value: r, stack: debug.Stack()}
+					return
 				}
-				clearN = i           // 更新需要清理的最大索引
-				w.task <- nil        // 向worker的任务通道发送nil，触发worker停止
-				idleWorkers[i] = nil // 将worker从列表中清除
+				done <- nil
+			}()
+			task()
+		}()
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case tp := <-done:
+			if tp != nil {
+				panic(tp) // 由 worker 按任务 panic 处理
 			}
-			// 如果有需要清理的worker
-			if clearN != -1 {
-				if clearN >= len(idleWorkers)-1 { // 如果清理的是列表中的所有worker
-					p.workers = idleWorkers[:0] // 清空worker列表
-				} else { // 如果不是清理所有worker
-					// 从清理点的下一个开始，保留后面的worker
-					p.workers = idleWorkers[clearN+1:]
+		case <-timer.C:
+			atomic.AddUint64(&p.counters.timedOut, 1)
+			p.handleTimeout(timeout)
+			go func() {
+				if tp := <-done; tp != nil {
+					p.handlePanic(tp.value, tp.stack) // 放弃之后的 panic 也需要处理，不能让进程退出
 				}
-				// 打印清理完成后的状态
-				fmt.Printf("清除完成,running:%d, workers:%v \n", p.running, p.workers)
-			}
+			}()
 		}
-		p.lock.Unlock() // 解锁
+	})
+}
+
+// handleTimeout 处理执行超时的任务
+func (p *Pool) handleTimeout(timeout time.Duration) {
+	if p.TimeoutHandler != nil {
+		p.TimeoutHandler(timeout)
+		return
 	}
+	myLog.Default().Error(fmt.Sprintf("pool task exceeded %s, abandoned", timeout))
 }
 
-// Submit 方法用于将一个任务提交到线程池
-func (p *Pool) Submit(task func()) error {
-	if len(p.release) > 0 {
+// SubmitCtx 提交任务，没有空闲的 worker 时等待，ctx 结束时放弃等待并返回 ctx.Err()；
+// 任务开始执行前 ctx 已经结束时不再执行，适合在 HTTP 处理函数中使用，不会超过请求的截止时间
+func (p *Pool) SubmitCtx(ctx context.Context, task func()) error {
+	return p.submit(ctx, cancelable(ctx, task), nil, !p.nonblocking, PriorityNormal)
+}
+
+// cancelable 任务开始执行前 ctx 已经结束时不再执行
+func cancelable(ctx context.Context, task func()) func() {
+	if ctx.Done() == nil {
+		return task
+	}
+	return func() {
+		if ctx.Err() != nil {
+			return // 排队或等待执行期间 ctx 已经结束，取消任务
+		}
+		task()
+	}
+}
+
+// submit 提交任务，wait 为 false 时不等待 worker 释放，ctx 只用于等待；
+// drop 在任务排队后被 Release 丢弃时调用，让等待结果的调用方返回，可以为 nil
+func (p *Pool) submit(ctx context.Context, task func(), drop func(), wait bool, priority Priority) error {
+	if p.IsClosed() {
 		return ErrorHasClosed // 如果池已释放，则返回错误
 	}
-	w := p.GetWorker()  // 从池中获取一个worker
-	w.task <- task      // 将任务发送给worker的任务队列
-	w.pool.incRunning() // 增加正在运行的worker计数
+	w, err := p.retrieveWorker(ctx, task, drop, wait && p.rejectPolicy == RejectWait, priority) // 从池中获取一个worker
+	if errors.Is(err, ErrPoolOverload) && wait && p.rejectPolicy == RejectCallerRuns {
+		atomic.AddUint64(&p.counters.submitted, 1)
+		task() // 队列已满，由提交任务的 goroutine 执行
+		atomic.AddUint64(&p.counters.completed, 1)
+		return nil
+	}
+	if err != nil {
+		atomic.AddUint64(&p.counters.rejected, 1)
+		return err
+	}
+	atomic.AddUint64(&p.counters.submitted, 1)
+	if w != nil {
+		w.task <- task // 将任务发送给worker的任务队列
+	}
 	return nil
 }
 
+// GetWorker 获取一个 worker，没有空闲的 worker 时阻塞等待
 func (p *Pool) GetWorker() *Worker {
-	//1. 目的获取pool里面的worker
-	//2. 如果 有空闲的worker 直接获取
-	p.lock.Lock()
-	idleWorkers := p.workers
-	n := len(idleWorkers) - 1
-	if n >= 0 {
-		w := idleWorkers[n]
-		idleWorkers[n] = nil
-		p.workers = idleWorkers[:n]
-		p.lock.Unlock()
-		return w
+	w, _ := p.retrieveWorker(context.Background(), nil, nil, true, PriorityNormal)
+	return w
+}
+
+// retrieveWorker 获取一个 worker：
+// 有空闲的 worker 直接获取；没有空闲的但还不够 pool 的容量，新建一个；
+// 配置了任务队列并且队列未满时，task 放入队列，返回 nil；
+// 否则等待 worker 释放，ctx 结束时返回 ctx.Err()；wait 为 false 时不等待，返回 ErrPoolOverload；
+// 有优先级更高的提交者在等待时，把 worker 让给它们
+func (p *Pool) retrieveWorker(ctx context.Context, task func(), drop func(), wait bool, priority Priority) (*Worker, error) {
+	// 快速路径：没有等待的提交者时直接从分片中取空闲的 worker，不需要全局锁
+	if atomic.LoadInt32(&p.counters.waiting) == 0 {
+		if w := p.idle.pop(); w != nil {
+			return w, nil
+		}
 	}
-	//3. 如果没有空闲的worker，要新建一个worker
-	if p.running < p.cap {
-		p.lock.Unlock()
-		c := p.workerCache.Get()
-		var w *Worker
-		//还不够pool的容量，直接新建一个
-		if c == nil {
-			w = &Worker{
-				pool: p,
-				task: make(chan func(), 1),
+	if done := ctx.Done(); done != nil && wait {
+		// cond 不能和 ctx 一起 select，ctx 结束时唤醒所有等待的 goroutine，由它们自己检查 ctx
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-done:
+				p.lock.Lock()
+				p.cond.Broadcast()
+				p.lock.Unlock()
+			case <-stop:
 			}
-		} else {
-			w = c.(*Worker)
+		}()
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for {
+		if p.IsClosed() {
+			return nil, ErrorHasClosed
 		}
-		w.run()
-		return w
+		yield := p.waiting.higher(priority)
+		if !yield {
+			if w := p.idle.pop(); w != nil {
+				return w, nil
+			}
+			if p.Running() < p.Cap() {
+				w := p.workerCache.Get().(*Worker)
+				w.run() // 在锁内增加 running，避免并发新建超过容量
+				return w, nil
+			}
+		}
+		if task != nil && p.queue.len() < p.maxQueue {
+			p.queue.push(task, drop, priority) // 放入队列，worker 空闲时按优先级执行，同一优先级先进先出
+			// 放入队列之前可能有 worker 不加锁放回了分片，交给它执行，避免任务一直排队
+			p.handoff()
+			return nil, nil
+		}
+		if !wait {
+			return nil, ErrPoolOverload
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		// 等待 worker 释放，被唤醒后重新检查，不使用递归，持续饱和时也不会栈溢出
+		atomic.AddInt32(&p.counters.waiting, 1)
+		p.waiting[priority.level()]++
+		// 先增加等待数再检查一次分片：在这之前放回的 worker 在这里取到，
+		// 在这之后放回的 worker 会看到等待数，加锁唤醒，不会错过
+		if w := p.idle.pop(); w != nil && !yield {
+			p.waiting[priority.level()]--
+			atomic.AddInt32(&p.counters.waiting, -1)
+			return w, nil
+		} else if w != nil {
+			p.idle.push(w) // 让给优先级高的提交者
+			p.notify()
+		}
+		p.cond.Wait()
+		p.waiting[priority.level()]--
+		atomic.AddInt32(&p.counters.waiting, -1)
 	}
-	p.lock.Unlock()
-	//4. 如果正在运行的workers 如果大于pool容量，阻塞等待，worker释放
-	//for {
-	//
-	//}
-	return p.waitIdleWorker()
 }
 
-// 等待空闲的 worker
-func (p *Pool) waitIdleWorker() *Worker {
-	// 加锁，确保线程安全
-	p.lock.Lock()
-	// 等待条件变量，直到有空闲 worker
-	p.cond.Wait()
-
-	// 获取当前池中的所有空闲 worker
-	idleWorkers := p.workers
-	// 获取最后一个空闲 worker 的索引
-	n := len(idleWorkers) - 1
-	// 如果没有空闲 worker
-	if n < 0 {
-		// 解锁
-		p.lock.Unlock()
-		// 如果当前运行的 worker 数量小于池的容量
-		if p.running < p.cap {
-			// 从缓存中获取一个 worker
-			c := p.workerCache.Get()
-			var w *Worker
-			// 如果缓存中没有 worker，则新建一个
-			if c == nil {
-				w = &Worker{
-					pool: p,
-					task: make(chan func(), 1),
-				}
-			} else {
-				// 如果缓存中有，则使用缓存中的 worker
-				w = c.(*Worker)
-			}
-			// 运行这个 worker
-			w.run()
-			// 返回这个新创建的 worker
-			return w
+// handoff 把队列中的任务交给空闲的 worker，池已关闭时让空闲的 worker 退出，需要持有锁
+func (p *Pool) handoff() {
+	for p.queue.len() > 0 {
+		w := p.idle.pop()
+		if w == nil {
+			break
 		}
-		// 如果池已经满了，递归等待空闲的 worker
-		return p.waitIdleWorker()
-	}
-	// 获取最后一个空闲的 worker
-	w := idleWorkers[n]
-	// 将这个 worker 从空闲列表中移除
-	idleWorkers[n] = nil
-	p.workers = idleWorkers[:n]
-	// 解锁
-	p.lock.Unlock()
-	// 返回这个空闲的 worker
-	return w
+		w.task <- p.queue.pop()
+	}
+	if p.IsClosed() {
+		for _, w := range p.idle.oldest(-1) {
+			w.task <- nil
+		}
+	}
+}
+
+// dispatchQueue 有排队的任务并且还有容量时新建一个 worker 执行，避免 worker 因 panic 退出后队列中的任务没人执行
+func (p *Pool) dispatchQueue() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.handoff()
+	if p.queue.len() == 0 || p.Running() >= p.Cap() {
+		return
+	}
+	w := p.workerCache.Get().(*Worker)
+	w.run()
+	w.task <- p.queue.pop()
+}
+
+// notify 唤醒等待 worker 的提交者，有不同优先级的提交者在等待时全部唤醒，由优先级高的先获取
+func (p *Pool) notify() {
+	if p.waiting.mixed() {
+		p.cond.Broadcast()
+		return
+	}
+	p.cond.Signal()
+}
+
+// QueueLen 返回队列中等待执行的任务数量
+func (p *Pool) QueueLen() int {
+	return p.queue.len()
 }
 
 func (p *Pool) incRunning() {
 	atomic.AddInt32(&p.running, 1)
 }
 
-// PutWorker 将 worker 放入池中
-func (p *Pool) PutWorker(w *Worker) {
+// PutWorker 将 worker 放入池中，缩容后 worker 数量超过容量时不放入，返回 false，worker 退出
+func (p *Pool) PutWorker(w *Worker) bool {
 	// 设置 worker 的最后活跃时间为当前时间
 	w.lastTime = time.Now()
+	if p.Running() > p.Cap() {
+		return false
+	}
+	// 快速路径：没有排队的任务和等待的提交者时直接放回自己的分片，不需要全局锁
+	if p.quiet() {
+		p.idle.push(w)
+		if p.quiet() {
+			return true
+		}
+		// 放回的同时有任务入队、提交者开始等待或池被关闭，加锁处理，避免任务一直排队或提交者一直等待
+		p.lock.Lock()
+		p.handoff()
+		p.notify()
+		p.lock.Unlock()
+		return true
+	}
 	// 加锁，确保线程安全
 	p.lock.Lock()
-	// 将 worker 添加到池的 workers 切片中
-	p.workers = append(p.workers, w)
+	defer p.lock.Unlock()
+	if p.Running() > p.Cap() {
+		return false
+	}
+	if p.queue.len() > 0 {
+		// 队列中有任务时直接执行，不放回空闲列表
+		w.task <- p.queue.pop()
+		p.notify() // 队列有了空位
+		return true
+	}
+	if p.IsClosed() {
+		return false // 池已关闭，队列中的任务都执行完了，worker 退出
+	}
+	// 将 worker 放回自己的分片
+	p.idle.push(w)
 	// 发送信号通知其他等待的 goroutine 有新的 worker 可用
-	p.cond.Signal()
-	// 解锁
-	p.lock.Unlock()
+	p.notify()
+	return true
+}
+
+// quiet 没有排队的任务和等待的提交者，并且池未关闭，worker 可以不加锁放回分片
+func (p *Pool) quiet() bool {
+	return p.queue.len() == 0 && atomic.LoadInt32(&p.counters.waiting) == 0 && !p.IsClosed()
 }
 
 // 减少运行中的 worker 数量
@@ -241,46 +454,90 @@ func (p *Pool) decRunning() {
 	atomic.AddInt32(&p.running, -1)
 }
 
-// Release 释放池中的所有资源
+// Release 立即释放池：不再接受新任务，丢弃队列中还没有执行的任务（SubmitFunc 的 Future 返回 ErrorHasClosed），
+// 空闲的 worker 退出；正在执行的任务不会中断，执行完后 worker 退出。需要等待任务执行完时使用 ReleaseTimeout
 func (p *Pool) Release() {
 	// 确保下面的代码只执行一次
 	p.once.Do(func() {
 		// 加锁，确保线程安全
 		p.lock.Lock()
-		// 获取当前池中的所有 workers
-		workers := p.workers
-		// 遍历每个 worker
-		for i, w := range workers {
-			// 将每个 worker 的任务置空
-			w.task = nil
-			// 将每个 worker 的池引用置空
-			w.pool = nil
-			// 将 worker 在切片中的引用置空
-			workers[i] = nil
-		}
-		// 将池中的 workers 切片置空
-		p.workers = nil
+		p.close()
+		// 丢弃队列中的任务
+		drops := p.queue.reset()
 		// 解锁
 		p.lock.Unlock()
-		// 向 release 通道发送信号，表示释放操作已完成
-		p.release <- sig{}
+		for _, drop := range drops {
+			drop()
+		}
+		// 删除注册的指标
+		p.unregisterMetrics()
 	})
 }
 
+// ReleaseTimeout 优雅地释放池：不再接受新任务，等待正在执行和队列中的任务执行完，最多等待 timeout，
+// 然后释放资源；超时时返回 ErrReleaseTimeout，这时还在执行的任务不会中断
+func (p *Pool) ReleaseTimeout(timeout time.Duration) error {
+	p.lock.Lock()
+	p.close()
+	p.lock.Unlock()
+	deadline := time.Now().Add(timeout)
+	for p.Running() > 0 {
+		if time.Now().After(deadline) {
+			p.Release()
+			return ErrReleaseTimeout
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	p.Release()
+	return nil
+}
+
+// close 标记池已关闭，让空闲的 worker 退出，唤醒等待的提交者，需要持有锁
+func (p *Pool) close() {
+	if !p.IsClosed() {
+		// 向 release 通道发送信号，表示池已关闭
+		p.release <- sig{}
+		atomic.StoreInt32(&p.closed, 1)
+	}
+	// 空闲的 worker 退出，不修改 worker 的字段，避免正在执行任务的 worker panic
+	for _, w := range p.idle.oldest(-1) {
+		w.task <- nil
+	}
+	// 等待的提交者返回 ErrorHasClosed
+	p.cond.Broadcast()
+}
+
+// spawnIdle 启动 worker 直到达到容量，放入空闲列表，需要持有锁
+func (p *Pool) spawnIdle() {
+	now := time.Now()
+	for p.Running() < p.Cap() {
+		w := p.workerCache.Get().(*Worker)
+		w.lastTime = now
+		w.run()
+		p.idle.push(w)
+	}
+}
+
 // IsClosed 判断池是否已关闭
 func (p *Pool) IsClosed() bool {
-	// 如果 release 通道中有信号，表示池已关闭
-	return len(p.release) > 0
+	return atomic.LoadInt32(&p.closed) == 1
 }
 
 // Restart 重启池
 func (p *Pool) Restart() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 	// 如果 release 通道中没有信号，表示池未关闭，直接返回 true
 	if len(p.release) <= 0 {
 		return true
 	}
 	// 从 release 通道接收一个信号，表示释放已完成，可以重启
 	_ = <-p.release
+	atomic.StoreInt32(&p.closed, 0)
+	p.once = sync.Once{} // 重启后可以再次释放
+	if p.preAlloc {
+		p.spawnIdle()
+	}
 	return true
 }
 
@@ -289,5 +546,36 @@ func (p *Pool) Running() int {
 }
 
 func (p *Pool) Free() int {
-	return int(p.cap - p.running)
+	return p.Cap() - p.Running()
+}
+
+// Cap 返回 pool 的容量
+func (p *Pool) Cap() int {
+	return int(atomic.LoadInt32(&p.cap))
+}
+
+// Tune 运行时调整 pool 的容量，扩容时唤醒等待的任务；
+// 缩容时先让空闲的 worker 退出，正在执行任务的 worker 执行完后退出，不会中断任务
+func (p *Pool) Tune(newCap int) error {
+	if newCap <= 0 {
+		return ErrorInValidCap
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	oldCap := p.Cap()
+	atomic.StoreInt32(&p.cap, int32(newCap))
+	if newCap > oldCap {
+		if p.preAlloc {
+			p.spawnIdle()
+		}
+		p.cond.Broadcast() // 有了新的容量，等待的任务可以新建 worker
+		return nil
+	}
+	// 多出来的 worker 数量，优先从最久没有使用的空闲 worker 开始退出
+	if excess := p.Running() - newCap; excess > 0 {
+		for _, w := range p.idle.oldest(excess) {
+			w.task <- nil
+		}
+	}
+	return nil
 }
@@ -1,9 +1,11 @@
 package pool
 
 import (
+	"errors"
 	"math"    // 导入数学包
 	"runtime" // 导入运行时包，用于获取内存统计等信息
 	"sync"    // 导入同步包，用于 WaitGroup 等同步原语
+	"sync/atomic"
 	"testing" // 导入测试包，用于编写测试代码
 	"time"    // 导入时间包，用于处理时间相关操作
 )
@@ -76,3 +78,202 @@ func TestHasPool(t *testing.T) {
 	t.Logf("running worker:%d", pool.Running()) // 打印正在运行的协程数
 	t.Logf("free worker:%d ", pool.Free())      // 打印空闲的协程数
 }
+
+// BenchmarkGoroutineSubmit 不使用 pool，每个任务新建一个 goroutine，作为对比
+func BenchmarkGoroutineSubmit(b *testing.B) {
+	var wg sync.WaitGroup
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			wg.Add(1)
+			go func() {
+				wg.Done()
+			}()
+		}
+	})
+	wg.Wait()
+}
+
+// BenchmarkPoolSubmit 单个提交者，worker 充足
+func BenchmarkPoolSubmit(b *testing.B) {
+	p, _ := NewPool(PoolSize)
+	defer p.Release()
+	var wg sync.WaitGroup
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wg.Add(1)
+		_ = p.Submit(func() {
+			wg.Done()
+		})
+	}
+	wg.Wait()
+}
+
+// BenchmarkPoolSubmitParallel 多个提交者并发提交，worker 充足，主要是获取和归还 worker 的锁竞争
+func BenchmarkPoolSubmitParallel(b *testing.B) {
+	p, _ := NewPool(PoolSize)
+	defer p.Release()
+	var wg sync.WaitGroup
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			wg.Add(1)
+			_ = p.Submit(func() {
+				wg.Done()
+			})
+		}
+	})
+	wg.Wait()
+}
+
+// BenchmarkPoolSaturated 多个提交者并发提交，worker 数量等于 CPU 数，提交者经常需要等待 worker
+func BenchmarkPoolSaturated(b *testing.B) {
+	p, _ := NewPool(runtime.GOMAXPROCS(0))
+	defer p.Release()
+	var wg sync.WaitGroup
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			wg.Add(1)
+			_ = p.Submit(func() {
+				for i := 0; i < Param; i++ {
+					_ = math.Sqrt(float64(i))
+				}
+				wg.Done()
+			})
+		}
+	})
+	wg.Wait()
+}
+
+// waitUntil 等待 cond 成立，超过 1 秒时测试失败
+func waitUntil(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestReleaseTimeout 任务在 timeout 内执行完时返回 nil，超时时返回 ErrReleaseTimeout，不中断还在执行的任务
+func TestReleaseTimeout(t *testing.T) {
+	p, _ := NewPool(2)
+	if err := p.Submit(func() { time.Sleep(20 * time.Millisecond) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ReleaseTimeout(time.Second); err != nil {
+		t.Fatalf("ReleaseTimeout with finishing task: %v", err)
+	}
+
+	p, _ = NewPool(2)
+	block := make(chan struct{})
+	var finished atomic.Bool
+	if err := p.Submit(func() {
+		<-block
+		finished.Store(true)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := p.ReleaseTimeout(50 * time.Millisecond); !errors.Is(err, ErrReleaseTimeout) {
+		t.Fatalf("err = %v, want %v", err, ErrReleaseTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("ReleaseTimeout returned after %v", elapsed)
+	}
+	if finished.Load() || p.Running() != 1 {
+		t.Fatalf("running task interrupted: finished = %v, running = %d", finished.Load(), p.Running())
+	}
+	close(block)
+	waitUntil(t, "the task to finish", func() bool { return p.Running() == 0 })
+	if !finished.Load() {
+		t.Fatal("task did not finish")
+	}
+}
+
+// TestTune 缩容后超过容量的 worker 执行完任务后退出，新的任务不能超过新的容量；扩容后可以同时执行更多任务
+func TestTune(t *testing.T) {
+	p, _ := NewPool(4)
+	defer p.Release()
+	var started atomic.Int32
+	block := make(chan struct{})
+	submit := func(n int, block chan struct{}) {
+		for i := 0; i < n; i++ {
+			if err := p.Submit(func() {
+				started.Add(1)
+				<-block
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	submit(4, block)
+	waitUntil(t, "4 running tasks", func() bool { return started.Load() == 4 })
+
+	if err := p.Tune(2); err != nil {
+		t.Fatal(err)
+	}
+	if p.Cap() != 2 || p.Running() != 4 {
+		t.Fatalf("after Tune(2): cap = %d, running = %d, want 2, 4", p.Cap(), p.Running())
+	}
+	close(block)
+	waitUntil(t, "excess workers to exit", func() bool { return p.Running() <= 2 })
+
+	block = make(chan struct{})
+	started.Store(0)
+	submit(2, block)
+	waitUntil(t, "2 running tasks", func() bool { return started.Load() == 2 })
+	if err := p.TrySubmit(func() {}); !errors.Is(err, ErrPoolOverload) {
+		t.Fatalf("TrySubmit over the reduced cap: err = %v, want %v", err, ErrPoolOverload)
+	}
+
+	if err := p.Tune(4); err != nil {
+		t.Fatal(err)
+	}
+	submit(2, block)
+	waitUntil(t, "4 running tasks after Tune(4)", func() bool { return started.Load() == 4 })
+	if p.Running() != 4 {
+		t.Fatalf("after Tune(4): running = %d, want 4", p.Running())
+	}
+	close(block)
+}
+
+// TestPriorityDequeue worker 都在忙时，队列中高优先级的任务先于低优先级的任务执行
+func TestPriorityDequeue(t *testing.T) {
+	p, _ := NewPool(1, WithQueue(10, RejectWait))
+	defer p.Release()
+	block := make(chan struct{})
+	if err := p.Submit(func() { <-block }); err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var order []Priority
+	var wg sync.WaitGroup
+	record := func(pr Priority) func() {
+		return func() {
+			defer wg.Done()
+			mu.Lock()
+			order = append(order, pr)
+			mu.Unlock()
+		}
+	}
+	for _, pr := range []Priority{PriorityLow, PriorityHigh, PriorityLow, PriorityNormal, PriorityHigh, PriorityLow} {
+		wg.Add(1)
+		if err := p.SubmitPriority(record(pr), pr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.QueueLen() != 6 {
+		t.Fatalf("queue len = %d, want 6", p.QueueLen())
+	}
+	close(block)
+	wg.Wait()
+	want := []Priority{PriorityHigh, PriorityHigh, PriorityNormal, PriorityLow, PriorityLow, PriorityLow}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("execution order = %v, want %v", order, want)
+		}
+	}
+}
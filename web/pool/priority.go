@@ -0,0 +1,114 @@
+package pool
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Priority 任务的优先级，worker 空闲时优先执行高优先级的任务
+type Priority int
+
+const (
+	PriorityLow    Priority = iota // 低优先级，如批处理任务
+	PriorityNormal                 // 普通优先级，Submit 提交的任务
+	PriorityHigh                   // 高优先级，如对延迟敏感的请求处理
+
+	priorityLevels = 3
+)
+
+// level 将优先级限制在有效范围内
+func (pr Priority) level() int {
+	if pr < PriorityLow {
+		return int(PriorityLow)
+	}
+	if pr > PriorityHigh {
+		return int(PriorityHigh)
+	}
+	return int(pr)
+}
+
+// SubmitPriority 按优先级提交任务，worker 空闲时，等待中和队列中优先级高的任务先执行，队列中同一优先级先进先出
+func (p *Pool) SubmitPriority(task func(), priority Priority) error {
+	return p.SubmitPriorityCtx(context.Background(), task, priority)
+}
+
+// SubmitPriorityCtx 与 SubmitPriority 相同，ctx 结束时放弃等待 worker 或取消排队的任务
+func (p *Pool) SubmitPriorityCtx(ctx context.Context, task func(), priority Priority) error {
+	return p.submit(ctx, cancelable(ctx, task), nil, !p.nonblocking, priority)
+}
+
+// taskQueue 按优先级分组的任务队列，每个优先级一个先进先出的队列；
+// 修改需要持有 pool 的锁，len 不加锁也可以读取
+type taskQueue struct {
+	levels [priorityLevels][]queuedTask
+	size   int32
+}
+
+// queuedTask 排队的任务，drop 在任务被 Release 丢弃时调用，可以为 nil
+type queuedTask struct {
+	run  func()
+	drop func()
+}
+
+func (q *taskQueue) len() int {
+	return int(atomic.LoadInt32(&q.size))
+}
+
+func (q *taskQueue) push(task func(), drop func(), priority Priority) {
+	l := priority.level()
+	q.levels[l] = append(q.levels[l], queuedTask{run: task, drop: drop})
+	atomic.AddInt32(&q.size, 1)
+}
+
+// pop 取出优先级最高的任务，队列为空时返回 nil
+func (q *taskQueue) pop() func() {
+	for l := priorityLevels - 1; l >= 0; l-- {
+		if tasks := q.levels[l]; len(tasks) > 0 {
+			task := tasks[0]
+			tasks[0] = queuedTask{}
+			q.levels[l] = tasks[1:]
+			atomic.AddInt32(&q.size, -1)
+			return task.run
+		}
+	}
+	return nil
+}
+
+// reset 丢弃队列中所有的任务，返回被丢弃的任务的 drop，在释放锁之后调用
+func (q *taskQueue) reset() []func() {
+	var drops []func()
+	for _, tasks := range q.levels {
+		for _, task := range tasks {
+			if task.drop != nil {
+				drops = append(drops, task.drop)
+			}
+		}
+	}
+	q.levels = [priorityLevels][]queuedTask{}
+	atomic.StoreInt32(&q.size, 0)
+	return drops
+}
+
+// waiters 按优先级统计等待 worker 的提交者
+type waiters [priorityLevels]int
+
+// higher 是否有优先级比 priority 高的提交者在等待
+func (w *waiters) higher(priority Priority) bool {
+	for l := priority.level() + 1; l < priorityLevels; l++ {
+		if w[l] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// mixed 是否有不同优先级的提交者在等待，这时需要唤醒所有等待者，由高优先级的先获取 worker
+func (w *waiters) mixed() bool {
+	n := 0
+	for _, c := range w {
+		if c > 0 {
+			n++
+		}
+	}
+	return n > 1
+}
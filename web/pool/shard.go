@@ -0,0 +1,133 @@
+package pool
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// workerStack 一个分片的空闲 worker，后进先出：最近用过的 worker 先取出，最久没用的留在底部，便于过期回收
+type workerStack struct {
+	mu      sync.Mutex
+	workers []*Worker
+	n       int32    // len(workers)，获取 worker 时不加锁跳过空的分片
+	_       [28]byte // 填充到一个缓存行，避免相邻分片的伪共享
+}
+
+// idleWorkers 按 P 的数量分片的空闲 worker，每个分片单独加锁，
+// 高并发时获取和放回 worker 分散到不同的锁上，不再都竞争 pool 的全局锁
+type idleWorkers struct {
+	shards []workerStack
+	next   uint32 // 获取 worker 时从哪个分片开始找，轮询分散竞争
+	home   uint32 // 新建的 worker 放回哪个分片，轮询分配
+	size   int32  // 空闲 worker 的总数
+}
+
+func newIdleWorkers() idleWorkers {
+	return idleWorkers{shards: make([]workerStack, runtime.GOMAXPROCS(0))}
+}
+
+func (iw *idleWorkers) len() int {
+	return int(atomic.LoadInt32(&iw.size))
+}
+
+// assign 给新建的 worker 分配一个分片，worker 总是放回自己的分片
+func (iw *idleWorkers) assign() int {
+	return int(atomic.AddUint32(&iw.home, 1) % uint32(len(iw.shards)))
+}
+
+func (iw *idleWorkers) push(w *Worker) {
+	s := &iw.shards[w.shard]
+	s.mu.Lock()
+	s.workers = append(s.workers, w)
+	atomic.StoreInt32(&s.n, int32(len(s.workers)))
+	atomic.AddInt32(&iw.size, 1)
+	s.mu.Unlock()
+}
+
+// pop 取出一个空闲的 worker，自己的分片为空时从其他分片取，没有空闲的 worker 时返回 nil
+func (iw *idleWorkers) pop() *Worker {
+	if iw.len() == 0 {
+		return nil
+	}
+	n := uint32(len(iw.shards))
+	start := atomic.AddUint32(&iw.next, 1)
+	for i := uint32(0); i < n; i++ {
+		s := &iw.shards[(start+i)%n]
+		if atomic.LoadInt32(&s.n) == 0 {
+			continue
+		}
+		s.mu.Lock()
+		if last := len(s.workers) - 1; last >= 0 {
+			w := s.workers[last]
+			s.workers[last] = nil
+			s.workers = s.workers[:last]
+			atomic.StoreInt32(&s.n, int32(last))
+			atomic.AddInt32(&iw.size, -1)
+			s.mu.Unlock()
+			return w
+		}
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// expire 取出所有在 deadline 之前就空闲的 worker
+func (iw *idleWorkers) expire(deadline time.Time) []*Worker {
+	var expired []*Worker
+	for i := range iw.shards {
+		s := &iw.shards[i]
+		s.mu.Lock()
+		n := 0
+		for n < len(s.workers) && s.workers[n].lastTime.Before(deadline) {
+			n++
+		}
+		expired = append(expired, s.takeOldest(n)...)
+		atomic.AddInt32(&iw.size, -int32(n))
+		s.mu.Unlock()
+	}
+	return expired
+}
+
+// oldest 从各个分片的底部轮流取出最多 n 个最久没用的 worker，n 小于 0 时全部取出
+func (iw *idleWorkers) oldest(n int) []*Worker {
+	var taken []*Worker
+	for n != 0 && iw.len() > 0 {
+		found := false
+		for i := range iw.shards {
+			if n == 0 {
+				break
+			}
+			s := &iw.shards[i]
+			s.mu.Lock()
+			if len(s.workers) > 0 {
+				taken = append(taken, s.takeOldest(1)...)
+				atomic.AddInt32(&iw.size, -1)
+				n--
+				found = true
+			}
+			s.mu.Unlock()
+		}
+		if !found {
+			break // 其他 goroutine 把剩下的 worker 取走了
+		}
+	}
+	return taken
+}
+
+// takeOldest 取出底部的 n 个 worker，需要持有分片的锁
+func (s *workerStack) takeOldest(n int) []*Worker {
+	if n == 0 {
+		return nil
+	}
+	taken := make([]*Worker, n)
+	copy(taken, s.workers[:n])
+	m := copy(s.workers, s.workers[n:])
+	for i := m; i < len(s.workers); i++ {
+		s.workers[i] = nil
+	}
+	s.workers = s.workers[:m]
+	atomic.StoreInt32(&s.n, int32(m))
+	return taken
+}
@@ -0,0 +1,132 @@
+package pool
+
+import (
+	"fmt"
+	"github.com/ygb616/web/metrics"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Stats pool 的运行统计
+type Stats struct {
+	Cap         int     // 容量
+	Running     int     // 正在运行的 worker 数量
+	Idle        int     // 空闲的 worker 数量
+	Busy        int     // 正在执行任务的 worker 数量
+	Waiting     int     // 等待 worker 的提交者数量
+	Queued      int     // 队列中等待执行的任务数量
+	Submitted   uint64  // 提交成功的任务数量
+	Completed   uint64  // 执行完成的任务数量
+	Panicked    uint64  // panic 的任务数量
+	Rejected    uint64  // 提交失败的任务数量，如过载、ctx 结束、pool 已释放
+	TimedOut    uint64  // 执行超时被放弃的任务数量
+	Utilization float64 // worker 使用率，Busy / Cap
+}
+
+// counters pool 的计数器
+type counters struct {
+	busy      int32
+	waiting   int32
+	submitted uint64
+	completed uint64
+	panicked  uint64
+	rejected  uint64
+	timedOut  uint64
+}
+
+// Stats 返回 pool 当前的运行统计
+func (p *Pool) Stats() Stats {
+	s := Stats{
+		Cap:       p.Cap(),
+		Running:   p.Running(),
+		Idle:      p.idle.len(),
+		Busy:      int(atomic.LoadInt32(&p.counters.busy)),
+		Waiting:   int(atomic.LoadInt32(&p.counters.waiting)),
+		Queued:    p.queue.len(),
+		Submitted: atomic.LoadUint64(&p.counters.submitted),
+		Completed: atomic.LoadUint64(&p.counters.completed),
+		Panicked:  atomic.LoadUint64(&p.counters.panicked),
+		Rejected:  atomic.LoadUint64(&p.counters.rejected),
+		TimedOut:  atomic.LoadUint64(&p.counters.timedOut),
+	}
+	if s.Cap > 0 {
+		s.Utilization = float64(s.Busy) / float64(s.Cap)
+	}
+	return s
+}
+
+// RegisterMetrics 将 pool 的运行统计注册到 metrics.Default，name 作为 pool 标签区分多个 pool，
+// 通过 metrics.Handler() 按 Prometheus 文本格式输出；pool 释放时自动删除
+func (p *Pool) RegisterMetrics(name string) {
+	collectorOnce.Do(func() {
+		metrics.Default.Register(collector)
+	})
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	p.metricsName = name
+	collector.pools[name] = p
+}
+
+// unregisterMetrics 删除 pool 的运行统计
+func (p *Pool) unregisterMetrics() {
+	if p.metricsName == "" {
+		return
+	}
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	if collector.pools[p.metricsName] == p {
+		delete(collector.pools, p.metricsName)
+	}
+}
+
+var (
+	collectorOnce sync.Once
+	collector     = &poolCollector{pools: make(map[string]*Pool)}
+)
+
+// poolCollector 输出所有注册的 pool 的指标，同一个指标的多个 pool 放在一起输出
+type poolCollector struct {
+	mu    sync.Mutex
+	pools map[string]*Pool
+}
+
+func (c *poolCollector) Name() string {
+	return "pool"
+}
+
+func (c *poolCollector) Write(w io.Writer) {
+	c.mu.Lock()
+	names := make([]string, 0, len(c.pools))
+	stats := make(map[string]Stats, len(c.pools))
+	for name, p := range c.pools {
+		names = append(names, name)
+		stats[name] = p.Stats()
+	}
+	c.mu.Unlock()
+	sort.Strings(names)
+	families := []struct {
+		name, typ, help string
+		value           func(s Stats) float64
+	}{
+		{"pool_capacity", "gauge", "Pool capacity.", func(s Stats) float64 { return float64(s.Cap) }},
+		{"pool_running_workers", "gauge", "Running workers.", func(s Stats) float64 { return float64(s.Running) }},
+		{"pool_idle_workers", "gauge", "Idle workers.", func(s Stats) float64 { return float64(s.Idle) }},
+		{"pool_busy_workers", "gauge", "Workers executing a task.", func(s Stats) float64 { return float64(s.Busy) }},
+		{"pool_waiting_submitters", "gauge", "Submitters waiting for a worker.", func(s Stats) float64 { return float64(s.Waiting) }},
+		{"pool_queued_tasks", "gauge", "Tasks waiting in the queue.", func(s Stats) float64 { return float64(s.Queued) }},
+		{"pool_utilization", "gauge", "Busy workers divided by capacity.", func(s Stats) float64 { return s.Utilization }},
+		{"pool_submitted_tasks_total", "counter", "Tasks accepted by the pool.", func(s Stats) float64 { return float64(s.Submitted) }},
+		{"pool_completed_tasks_total", "counter", "Tasks completed without panic.", func(s Stats) float64 { return float64(s.Completed) }},
+		{"pool_panicked_tasks_total", "counter", "Tasks that panicked.", func(s Stats) float64 { return float64(s.Panicked) }},
+		{"pool_rejected_tasks_total", "counter", "Tasks rejected by the pool.", func(s Stats) float64 { return float64(s.Rejected) }},
+		{"pool_timed_out_tasks_total", "counter", "Tasks abandoned after exceeding their timeout.", func(s Stats) float64 { return float64(s.TimedOut) }},
+	}
+	for _, f := range families {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.typ)
+		for _, name := range names {
+			fmt.Fprintf(w, "%s{pool=%q} %v\n", f.name, name, f.value(stats[name]))
+		}
+	}
+}
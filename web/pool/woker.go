@@ -1,7 +1,10 @@
 package pool
 
 import (
+	"fmt"
 	myLog "github.com/ygb616/web/log"
+	"runtime/debug"
+	"sync/atomic"
 	"time"
 )
 
@@ -11,6 +14,8 @@ type Worker struct {
 	task chan func()
 	//lastTime 执行任务的最后的时间
 	lastTime time.Time
+	//shard 空闲时放回的分片
+	shard int
 }
 
 func (w *Worker) run() {
@@ -27,30 +32,61 @@ func (w *Worker) running() {
 		w.pool.workerCache.Put(w)
 		// 捕获任务发生的 panic
 		if err := recover(); err != nil {
-			// 如果池中定义了 panic 处理函数，调用它
-			if w.pool.PanicHandler != nil {
-				w.pool.PanicHandler()
-			} else {
-				// 否则，记录错误日志
-				myLog.Default().Error(err)
+			atomic.AddInt32(&w.pool.counters.busy, -1)
+			stack := debug.Stack()
+			if p, ok := err.(*taskPanic); ok {
+				err, stack = p.value, p.stack // Future 中 recover 后重新抛出的 panic，使用原始的调用栈
 			}
+			w.pool.handlePanic(err, stack)
 		}
 		// 发送信号，通知其他等待的 goroutine
-		w.pool.cond.Signal()
+		w.pool.lock.Lock()
+		w.pool.notify()
+		w.pool.lock.Unlock()
+		// 队列中还有任务时补一个 worker
+		w.pool.dispatchQueue()
 	}()
 
 	// 无限循环监听任务通道，当通道被关闭时，循环会自动结束
 	for f := range w.task {
 		if f == nil {
-			// 如果从任务通道中接收到 nil，表示需要停止此 worker
-			w.pool.workerCache.Put(w) // 将此 worker 放入池的缓存中，可能用于快速重用
-			return                    // 结束此方法，停止当前 goroutine
+			// 如果从任务通道中接收到 nil，表示需要停止此 worker，退出时放入池的缓存中
+			return // 结束此方法，停止当前 goroutine
 		}
 		// 调用接收到的函数，执行实际的任务
+		atomic.AddInt32(&w.pool.counters.busy, 1)
 		f()
+		atomic.AddInt32(&w.pool.counters.busy, -1)
+		atomic.AddUint64(&w.pool.counters.completed, 1)
 
 		// 任务运行完成后，以下代码处理 worker 的状态
-		w.pool.PutWorker(w) // 将 worker 放回池中，标记为空闲
+		if !w.pool.PutWorker(w) { // 将 worker 放回池中，标记为空闲
+			return // 缩容后超过容量，退出
+		}
+	}
+}
 
+// handlePanic 处理任务的 panic，调用 PanicHandler，没有设置时记录错误日志
+func (p *Pool) handlePanic(recovered any, stack []byte) {
+	atomic.AddUint64(&p.counters.panicked, 1)
+	// 如果池中定义了 panic 处理函数，调用它
+	if p.PanicHandler != nil {
+		p.PanicHandler(recovered, stack)
+		return
+	}
+	// 否则，记录错误日志
+	myLog.Default().Error(fmt.Sprintf("pool task panic: %v\n%s", recovered, stack))
+}
+
+// taskPanic 重新抛出的 panic，保留原始的调用栈
+type taskPanic struct {
+	value any
+	stack []byte
+}
+
+// PanicFunc 将旧的 func() 形式的 panic 处理函数转为 PanicHandler
+func PanicFunc(f func()) func(recovered any, stack []byte) {
+	return func(any, []byte) {
+		f()
 	}
 }
@@ -0,0 +1,264 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/ygb616/web/config"
+	"github.com/ygb616/web/internal/redis"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RateTier 限流档位，每个 Window 内最多 Limit 个请求
+type RateTier struct {
+	Limit  int64
+	Window time.Duration
+}
+
+// 默认的身份档位，LimitByPrincipal 返回
+const (
+	TierUser      = "user"      // jwt 登录的用户，claims 中有 tier 时使用 tier
+	TierAPIKey    = "apikey"    // 使用 API Key 的调用方
+	TierAnonymous = "anonymous" // 未认证的请求，按 IP 限流
+)
+
+// PrincipalFunc 返回请求的身份标识和档位，key 为空时不限流
+type PrincipalFunc func(ctx *Context) (key, tier string)
+
+// CounterStore 限流计数的存储，多个副本共享时使用 RedisCounterStore
+type CounterStore interface {
+	// Incr 名称为 key 的计数加一并返回加一后的值，计数在 ttl 后过期
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+}
+
+// IdentityLimitConf 按身份限流的配置
+type IdentityLimitConf struct {
+	// Tiers 档位名称 -> 限流速率，如 {"anonymous": {60, time.Minute}, "user": {600, time.Minute}}
+	Tiers map[string]RateTier
+	// Default Tiers 中没有的档位使用的速率，Limit 为 0 时不限流
+	Default RateTier
+	// Principal 请求的身份，默认 LimitByPrincipal(APIKeyHeader, APIKeyValid)
+	Principal PrincipalFunc
+	// APIKeyHeader 默认的 Principal 使用的 API Key 请求头，默认 X-Api-Key
+	APIKeyHeader string
+	// APIKeyValid 默认的 Principal 校验 API Key，返回 true 时按 API Key 限流，为 nil 时不使用 API Key
+	APIKeyValid func(ctx *Context, key string) bool
+	// Store 计数存储，默认进程内存储
+	Store CounterStore
+	// PerRoute 是否按路由分别计数，默认同一个身份所有路由共用额度
+	PerRoute bool
+	// ConfKey 配置中的路径，如 limit.identity，设置时从配置的 tiers、default 读取档位，覆盖 Tiers、Default，
+	// 配置变化时自动更新，不需要重启：
+	//
+	//	[limit.identity.default]
+	//	limit = 60
+	//	window = "1m"
+	//	[limit.identity.tiers.user]
+	//	limit = 600
+	//	window = "1m"
+	ConfKey string
+}
+
+// rateTiers IdentityLimiter 使用的档位，配置变化时整体替换
+type rateTiers struct {
+	Tiers   map[string]RateTier `config:"tiers"`
+	Default RateTier            `config:"default"`
+}
+
+// tiersByConf 从配置读取档位，没有配置或格式错误时使用 def
+func tiersByConf(key string, def rateTiers) *rateTiers {
+	tiers := rateTiers{Tiers: make(map[string]RateTier, len(def.Tiers)), Default: def.Default}
+	for name, tier := range def.Tiers {
+		tiers.Tiers[name] = tier // 配置中的档位合并到副本中，不修改 def
+	}
+	if err := config.Unmarshal(key, &tiers); err != nil {
+		return &def
+	}
+	return &tiers
+}
+
+// LimitByPrincipal 按认证的身份限流：jwt 中间件保存的 claims 中的 sub（没有时使用 userId），
+// 其次是 apiKeyHeader 请求头中 validKey 确认有效的 API Key，都没有时按客户端 IP。
+// 没有校验的 API Key 不能作为身份，否则每个请求换一个随机的 Key 就可以绕过按 IP 的限流，validKey 为 nil 时不使用 API Key
+func LimitByPrincipal(apiKeyHeader string, validKey func(ctx *Context, key string) bool) PrincipalFunc {
+	if apiKeyHeader == "" {
+		apiKeyHeader = "X-Api-Key"
+	}
+	return func(ctx *Context) (string, string) {
+		// token.ClaimsKey，web 不能引用 token 包
+		if v, ok := ctx.Get("jwt_claims"); ok {
+			if claims, ok := v.(jwt.MapClaims); ok {
+				sub := claims["sub"]
+				if sub == nil {
+					sub = claims["userId"]
+				}
+				if sub != nil {
+					tier, _ := claims["tier"].(string)
+					if tier == "" {
+						tier = TierUser
+					}
+					return "user:" + fmt.Sprint(sub), tier
+				}
+			}
+		}
+		if key := ctx.R.Header.Get(apiKeyHeader); key != "" && validKey != nil && validKey(ctx, key) {
+			return "key:" + key, TierAPIKey
+		}
+		return "ip:" + LimitByIP(ctx), TierAnonymous
+	}
+}
+
+// IdentityLimiter 返回按身份和档位限流的中间件，按固定窗口计数，超出时返回 429 并设置 Retry-After；
+// 与 Limiter、KeyLimiter 不同，计数可以保存在 Redis 中由多个副本共享。
+// 需要放在 jwt 中间件之后才能按用户限流，计数存储出错时不限流
+func IdentityLimiter(conf IdentityLimitConf) MiddlewareFunc {
+	principal := conf.Principal
+	if principal == nil {
+		principal = LimitByPrincipal(conf.APIKeyHeader, conf.APIKeyValid)
+	}
+	store := conf.Store
+	if store == nil {
+		store = NewMemoryCounterStore()
+	}
+	var tiers atomic.Pointer[rateTiers]
+	def := rateTiers{Tiers: conf.Tiers, Default: conf.Default}
+	tiers.Store(&def)
+	if conf.ConfKey != "" {
+		tiers.Store(tiersByConf(conf.ConfKey, def))
+		config.OnChange(conf.ConfKey, func(_, _ any) {
+			tiers.Store(tiersByConf(conf.ConfKey, def))
+		})
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) {
+			key, tierName := principal(ctx)
+			current := tiers.Load()
+			tier, ok := current.Tiers[tierName]
+			if !ok {
+				tier = current.Default
+			}
+			if key == "" || tier.Limit <= 0 || tier.Window <= 0 {
+				next(ctx)
+				return
+			}
+			if conf.PerRoute {
+				route := ctx.FullPath() // 注册的路径，/user/:id 的所有请求共用额度
+				if name, ok := ctx.Get(GatewayRouteKey); ok {
+					route = name.(string)
+				}
+				key = route + "|" + key
+			}
+			// 固定窗口：key 中带上窗口编号，计数在窗口结束后过期
+			now := time.Now()
+			window := now.UnixNano() / int64(tier.Window)
+			reset := time.Unix(0, (window+1)*int64(tier.Window))
+			counterKey := tierName + "|" + key + "|" + strconv.FormatInt(window, 10)
+			count, err := store.Incr(ctx.R.Context(), counterKey, reset.Sub(now))
+			if err != nil {
+				next(ctx)
+				return
+			}
+			remaining := tier.Limit - count
+			if remaining < 0 {
+				remaining = 0
+			}
+			h := ctx.W.Header()
+			h.Set("X-RateLimit-Limit", strconv.FormatInt(tier.Limit, 10))
+			h.Set("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+			h.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+			if count > tier.Limit {
+				h.Set("Retry-After", strconv.Itoa(int(math.Ceil(reset.Sub(now).Seconds()))))
+				_ = ctx.JSON(http.StatusTooManyRequests, map[string]any{
+					"code": http.StatusTooManyRequests,
+					"msg":  "too many requests",
+				})
+				return
+			}
+			next(ctx)
+		}
+	}
+}
+
+// MemoryCounterStore 进程内的 CounterStore
+type MemoryCounterStore struct {
+	mu        sync.Mutex
+	counters  map[string]*memoryCounter
+	lastClean time.Time
+}
+
+type memoryCounter struct {
+	count  int64
+	expiry time.Time
+}
+
+// NewMemoryCounterStore 创建 MemoryCounterStore
+func NewMemoryCounterStore() *MemoryCounterStore {
+	return &MemoryCounterStore{counters: make(map[string]*memoryCounter), lastClean: time.Now()}
+}
+
+func (m *MemoryCounterStore) Incr(_ context.Context, key string, ttl time.Duration) (int64, error) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// 定期清理已经过期的计数，避免内存一直增长
+	if now.Sub(m.lastClean) > time.Minute {
+		for k, c := range m.counters {
+			if !c.expiry.After(now) {
+				delete(m.counters, k)
+			}
+		}
+		m.lastClean = now
+	}
+	c, ok := m.counters[key]
+	if !ok || !c.expiry.After(now) {
+		c = &memoryCounter{expiry: now.Add(ttl)}
+		m.counters[key] = c
+	}
+	c.count++
+	return c.count, nil
+}
+
+// RedisClient 执行 Redis 命令，用法同 breaker.RedisClient
+type RedisClient = redis.Client
+
+// RedisFunc 函数形式的 RedisClient
+type RedisFunc = redis.Func
+
+// RedisCounterStore 使用 Redis INCR 计数，多个副本共享限流额度
+type RedisCounterStore struct {
+	Client RedisClient
+	Prefix string // key 的前缀，默认 ratelimit:
+}
+
+// NewRedisCounterStore 创建 RedisCounterStore
+func NewRedisCounterStore(client RedisClient) *RedisCounterStore {
+	return &RedisCounterStore{Client: client}
+}
+
+func (r *RedisCounterStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	prefix := r.Prefix
+	if prefix == "" {
+		prefix = "ratelimit:"
+	}
+	key = prefix + key
+	v, err := r.Client.Do(ctx, "INCR", key)
+	if err != nil {
+		return 0, err
+	}
+	count, ok := v.(int64)
+	if !ok {
+		return 0, fmt.Errorf("web: unexpected redis reply %T", v)
+	}
+	if count == 1 {
+		// 多保留一秒，避免各副本时钟的差异导致窗口还没结束计数就过期了
+		if _, err := r.Client.Do(ctx, "PEXPIRE", key, (ttl + time.Second).Milliseconds()); err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
@@ -33,7 +33,7 @@ func Recovery(next HandlerFunc) HandlerFunc {
 						return
 					}
 				}
-				ctx.Logger.Error(detailMsg(err))
+				ctx.Log().Error(detailMsg(err))
 				ctx.Fail(http.StatusInternalServerError, "Internal Server Error")
 			}
 		}()
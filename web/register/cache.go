@@ -0,0 +1,96 @@
+package register
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+)
+
+var ErrNoInstance = errors.New("no available instance")
+
+// instanceCache 服务实例的本地缓存，由注册中心的 Watch 保持更新，
+// GetValue 优先读取缓存，避免每次请求都访问注册中心
+type instanceCache struct {
+	mu        sync.RWMutex
+	instances map[string][]Instance // 服务名称 -> 实例列表
+	watching  map[string]bool       // 已经在监听的服务
+}
+
+// get 获取缓存中的实例列表
+func (c *instanceCache) get(serviceName string) ([]Instance, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	instances, ok := c.instances[serviceName]
+	return instances, ok
+}
+
+// set 更新缓存中的实例列表
+func (c *instanceCache) set(serviceName string, instances []Instance) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.instances == nil {
+		c.instances = make(map[string][]Instance)
+	}
+	c.instances[serviceName] = instances
+}
+
+// startWatch 标记服务开始监听，第一次调用返回 true
+func (c *instanceCache) startWatch(serviceName string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.watching == nil {
+		c.watching = make(map[string]bool)
+	}
+	if c.watching[serviceName] {
+		return false
+	}
+	c.watching[serviceName] = true
+	return true
+}
+
+// stopWatch 取消服务的监听标记，下次 GetValue 时会重新监听
+func (c *instanceCache) stopWatch(serviceName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.watching, serviceName)
+	delete(c.instances, serviceName)
+}
+
+// selectInstance 按权重随机选择一个健康的实例
+func selectInstance(instances []Instance) (Instance, error) {
+	var total float64
+	healthy := make([]Instance, 0, len(instances))
+	for _, ins := range instances {
+		if !ins.Healthy || ins.Weight <= 0 {
+			continue
+		}
+		healthy = append(healthy, ins)
+		total += ins.Weight
+	}
+	if len(healthy) == 0 {
+		return Instance{}, ErrNoInstance
+	}
+	r := rand.Float64() * total
+	for _, ins := range healthy {
+		r -= ins.Weight
+		if r < 0 {
+			return ins, nil
+		}
+	}
+	return healthy[len(healthy)-1], nil
+}
+
+// publish 向监听通道发送最新的实例列表，通道已满时丢弃旧值，保证读取方拿到的总是最新列表
+func publish(ch chan []Instance, instances []Instance) {
+	for {
+		select {
+		case ch <- instances:
+			return
+		default:
+		}
+		select {
+		case <-ch:
+		default:
+		}
+	}
+}
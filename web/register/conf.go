@@ -0,0 +1,63 @@
+package register
+
+import (
+	"fmt"
+	"github.com/ygb616/web/config"
+	"time"
+)
+
+// OptionByConf 从配置文件的 [register] 中读取注册中心类型和选项，例如：
+//
+//	[register]
+//	type = "nacos"
+//	endpoints = ["127.0.0.1:8848"]
+//	namespace = "dev"
+//	group = "order"
+//	username = "nacos"
+//	password = "nacos"
+//	[register.metadata]
+//	zone = "sh-a"
+func OptionByConf() (string, Option) {
+	m := config.GetToml().Register
+	option := Option{}
+	registerType, _ := m["type"].(string)
+	if v, ok := m["endpoints"].([]any); ok {
+		for _, endpoint := range v {
+			option.Endpoints = append(option.Endpoints, fmt.Sprint(endpoint))
+		}
+	}
+	if v, ok := m["dialTimeout"].(string); ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			option.DialTimeout = d
+		}
+	}
+	if v, ok := m["dialTimeout"].(int64); ok {
+		option.DialTimeout = time.Duration(v) * time.Millisecond
+	}
+	if v, ok := m["ttl"].(int64); ok {
+		option.TTL = v
+	}
+	option.HealthCheckURL, _ = m["healthCheckURL"].(string)
+	option.Namespace, _ = m["namespace"].(string)
+	option.PortName, _ = m["portName"].(string)
+	option.Group, _ = m["group"].(string)
+	option.Cluster, _ = m["cluster"].(string)
+	switch v := m["weight"].(type) {
+	case float64:
+		option.Weight = v
+	case int64:
+		option.Weight = float64(v)
+	}
+	option.Username, _ = m["username"].(string)
+	option.Password, _ = m["password"].(string)
+	option.LogDir, _ = m["logDir"].(string)
+	option.CacheDir, _ = m["cacheDir"].(string)
+	option.LogLevel, _ = m["logLevel"].(string)
+	if v, ok := m["metadata"].(map[string]any); ok {
+		option.Metadata = make(map[string]string, len(v))
+		for key, value := range v {
+			option.Metadata[key] = fmt.Sprint(value)
+		}
+	}
+	return registerType, option
+}
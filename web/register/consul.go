@@ -0,0 +1,222 @@
+package register
+
+import (
+	"context"
+	"fmt"
+	consulapi "github.com/hashicorp/consul/api"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register("consul", func() MsRegister { return &MsConsulRegister{} })
+}
+
+// MsConsulRegister 代表一个consul注册器
+type MsConsulRegister struct {
+	cli         *consulapi.Client  // consul客户端
+	option      Option             // 注册选项
+	cache       instanceCache      // 服务实例本地缓存
+	filters     []Filter           // 选择实例前使用的过滤器
+	events      eventEmitter       // 注册中心事件
+	mu          sync.Mutex         // 保护 serviceIds
+	serviceIds  []string           // 已注册的服务ID，关闭时注销
+	watchCtx    context.Context    // 监听使用的上下文
+	watchCancel context.CancelFunc // 关闭时停止所有监听
+}
+
+// CreateCli 创建consul客户端，Endpoints 的第一个地址作为 consul agent 地址
+func (r *MsConsulRegister) CreateCli(option Option) error {
+	config := consulapi.DefaultConfig()
+	if len(option.Endpoints) > 0 {
+		config.Address = option.Endpoints[0] // consul agent 地址
+	}
+	cli, err := consulapi.NewClient(config)
+	if err != nil {
+		return err
+	}
+	r.cli = cli
+	r.option = option
+	r.filters = option.Filters
+	r.events = newEventEmitter("consul", option.OnEvent)
+	r.watchCtx, r.watchCancel = context.WithCancel(context.Background())
+	return nil
+}
+
+// consulServiceId 返回实例在consul中的服务ID
+func consulServiceId(serviceName string, host string, port int) string {
+	return fmt.Sprintf("%s-%s-%d", serviceName, host, port)
+}
+
+// RegisterService 在consul中注册服务并注册健康检查，
+// 设置了 HealthCheckURL 时使用 HTTP 检查，否则使用 TCP 检查
+func (r *MsConsulRegister) RegisterService(serviceName string, host string, port int) (err error) {
+	defer func() { r.events.emit(instanceEvent(EventRegister, serviceName, host, port, err)) }()
+	id := consulServiceId(serviceName, host, port)
+	check := &consulapi.AgentServiceCheck{
+		Interval:                       "10s", // 检查间隔
+		Timeout:                        "5s",  // 检查超时时间
+		DeregisterCriticalServiceAfter: "1m",  // 持续不健康后自动注销
+	}
+	if r.option.HealthCheckURL != "" {
+		check.HTTP = r.option.HealthCheckURL
+	} else {
+		check.TCP = fmt.Sprintf("%s:%d", host, port)
+	}
+	err = r.cli.Agent().ServiceRegister(&consulapi.AgentServiceRegistration{
+		ID:      id,                // 服务ID
+		Name:    serviceName,       // 服务名称
+		Address: host,              // 实例的 IP 地址
+		Port:    port,              // 实例的端口号
+		Meta:    r.option.Metadata, // 实例的元数据
+		Check:   check,             // 健康检查
+	})
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.serviceIds = append(r.serviceIds, id)
+	r.mu.Unlock()
+	return nil
+}
+
+// DeregisterService 从consul中注销服务
+func (r *MsConsulRegister) DeregisterService(serviceName string, host string, port int) (err error) {
+	defer func() { r.events.emit(instanceEvent(EventDeregister, serviceName, host, port, err)) }()
+	id := consulServiceId(serviceName, host, port)
+	if err = r.cli.Agent().ServiceDeregister(id); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	for i, v := range r.serviceIds {
+		if v == id {
+			r.serviceIds = append(r.serviceIds[:i], r.serviceIds[i+1:]...)
+			break
+		}
+	}
+	r.mu.Unlock()
+	return nil
+}
+
+// SetHealthy 设置实例的健康状态，不健康时开启维护模式，consul 会将实例的健康检查置为 critical
+func (r *MsConsulRegister) SetHealthy(serviceName string, instance Instance, healthy bool) (err error) {
+	defer func() {
+		r.events.emit(Event{Type: EventSetHealthy, ServiceName: serviceName, Instance: instance, Err: err})
+	}()
+	id := consulServiceId(serviceName, instance.Host, instance.Port)
+	if healthy {
+		return r.cli.Agent().DisableServiceMaintenance(id)
+	}
+	return r.cli.Agent().EnableServiceMaintenance(id, "instance reported unhealthy")
+}
+
+// GetInstances 获取服务的全部实例，优先读取本地缓存，缓存未命中时查询consul并开始监听
+func (r *MsConsulRegister) GetInstances(serviceName string) ([]Instance, error) {
+	instances, ok := r.cache.get(serviceName)
+	if !ok {
+		var err error
+		instances, _, err = r.getInstances(serviceName, nil)
+		if err != nil {
+			return nil, err
+		}
+		if r.cache.startWatch(serviceName) {
+			r.cache.set(serviceName, instances)
+			go r.watch(serviceName, nil) // 后台监听变化，保持缓存最新
+		}
+	}
+	return instances, nil
+}
+
+// GetValue 按权重选择一个健康实例，返回 host:port 形式的地址
+func (r *MsConsulRegister) GetValue(serviceName string) (string, error) {
+	instances, err := r.GetInstances(serviceName)
+	if err != nil {
+		return "", err
+	}
+	ins, err := SelectInstance(instances, r.filters...)
+	if err != nil {
+		return "", err
+	}
+	return ins.Addr(), nil
+}
+
+// Watch 使用 consul 的阻塞查询监听服务实例的变化
+func (r *MsConsulRegister) Watch(serviceName string) (<-chan []Instance, error) {
+	ch := make(chan []Instance, 1)
+	go r.watch(serviceName, ch)
+	return ch, nil
+}
+
+// watch 循环执行阻塞查询并刷新缓存，ch 不为 nil 时同时发送给调用方
+func (r *MsConsulRegister) watch(serviceName string, ch chan []Instance) {
+	if ch != nil {
+		defer close(ch)
+	} else {
+		defer r.cache.stopWatch(serviceName)
+	}
+	var lastIndex uint64
+	for {
+		q := (&consulapi.QueryOptions{WaitIndex: lastIndex}).WithContext(r.watchCtx)
+		instances, index, err := r.getInstances(serviceName, q)
+		if r.watchCtx.Err() != nil {
+			return // 注册器已关闭
+		}
+		if err != nil {
+			r.events.emit(Event{Type: EventWatchReconnect, ServiceName: serviceName, Err: err})
+			time.Sleep(time.Second) // 查询失败，稍后重试
+			continue
+		}
+		if index == lastIndex {
+			continue // 阻塞查询超时，没有变化
+		}
+		lastIndex = index
+		r.cache.set(serviceName, instances)
+		if ch != nil {
+			publish(ch, instances)
+		}
+	}
+}
+
+// getInstances 查询consul中通过健康检查的实例列表
+func (r *MsConsulRegister) getInstances(serviceName string, q *consulapi.QueryOptions) ([]Instance, uint64, error) {
+	entries, meta, err := r.cli.Health().Service(serviceName, "", true, q)
+	if err != nil {
+		return nil, 0, err
+	}
+	instances := make([]Instance, 0, len(entries))
+	for _, entry := range entries {
+		host := entry.Service.Address
+		if host == "" {
+			host = entry.Node.Address // 服务未设置地址时使用节点地址
+		}
+		weight := float64(entry.Service.Weights.Passing)
+		if weight <= 0 {
+			weight = 1
+		}
+		instances = append(instances, Instance{
+			Host:     host,
+			Port:     entry.Service.Port,
+			Weight:   weight,
+			Metadata: entry.Service.Meta,
+			Healthy:  true,
+		})
+	}
+	return instances, meta.LastIndex, nil
+}
+
+// Close 注销所有已注册的服务并停止监听
+func (r *MsConsulRegister) Close() error {
+	if r.watchCancel != nil {
+		r.watchCancel() // 停止监听
+	}
+	if r.cli == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range r.serviceIds {
+		_ = r.cli.Agent().ServiceDeregister(id)
+	}
+	r.serviceIds = nil
+	return nil
+}
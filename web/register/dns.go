@@ -0,0 +1,225 @@
+package register
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register("dns", func() MsRegister { return &MsDnsRegister{} })
+}
+
+// defaultDnsTTL 默认的解析结果缓存时间（秒）
+const defaultDnsTTL = 30
+
+// MsDnsRegister 通过 DNS 的 SRV/A 记录解析服务，适用于 docker-compose、ECS 等不需要完整注册中心的环境。
+// 服务名称为 "name" 时查询 SRV 记录，为 "name:port" 时查询 A/AAAA 记录并使用给定的端口；
+// Option.Endpoints 为搜索域名，依次拼接在服务名称后面解析，为空时直接解析服务名称
+type MsDnsRegister struct {
+	resolver    *net.Resolver      // DNS 解析器
+	domains     []string           // 搜索域名
+	ttl         time.Duration      // 解析结果缓存时间
+	filters     []Filter           // 选择实例前使用的过滤器
+	mu          sync.Mutex         // 保护缓存
+	entries     map[string]dnsItem // 服务名称 -> 解析结果
+	watchCtx    context.Context    // 监听使用的上下文
+	watchCancel context.CancelFunc // 关闭时停止所有监听
+}
+
+// dnsItem 缓存的解析结果
+type dnsItem struct {
+	instances []Instance
+	expiry    time.Time
+}
+
+// CreateCli 创建解析器，Option.TTL 为缓存时间（秒）
+func (r *MsDnsRegister) CreateCli(option Option) error {
+	r.resolver = net.DefaultResolver
+	r.domains = option.Endpoints
+	r.filters = option.Filters
+	r.ttl = time.Duration(option.TTL) * time.Second
+	if r.ttl <= 0 {
+		r.ttl = defaultDnsTTL * time.Second
+	}
+	r.entries = make(map[string]dnsItem)
+	r.watchCtx, r.watchCancel = context.WithCancel(context.Background())
+	return nil
+}
+
+// RegisterService DNS 记录由外部维护，这里不做任何操作
+func (r *MsDnsRegister) RegisterService(serviceName string, host string, port int) error {
+	return nil
+}
+
+// DeregisterService DNS 记录由外部维护，这里不做任何操作
+func (r *MsDnsRegister) DeregisterService(serviceName string, host string, port int) error {
+	return nil
+}
+
+// SetHealthy DNS 记录由外部维护，这里不做任何操作
+func (r *MsDnsRegister) SetHealthy(serviceName string, instance Instance, healthy bool) error {
+	return nil
+}
+
+// GetInstances 获取服务的实例列表，缓存过期后重新解析
+func (r *MsDnsRegister) GetInstances(serviceName string) ([]Instance, error) {
+	instances, err := r.getInstances(serviceName)
+	if err != nil {
+		return nil, err
+	}
+	return instances, nil
+}
+
+// GetValue 按权重选择一个健康实例，返回 host:port 形式的地址
+func (r *MsDnsRegister) GetValue(serviceName string) (string, error) {
+	instances, err := r.GetInstances(serviceName)
+	if err != nil {
+		return "", err
+	}
+	ins, err := SelectInstance(instances, r.filters...)
+	if err != nil {
+		return "", err
+	}
+	return ins.Addr(), nil
+}
+
+// Watch 按缓存时间定期解析，实例列表变化时发送最新的列表
+func (r *MsDnsRegister) Watch(serviceName string) (<-chan []Instance, error) {
+	instances, err := r.getInstances(serviceName)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan []Instance, 1)
+	ch <- instances // 先发送当前的实例列表
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(r.ttl)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.watchCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			latest, err := r.getInstances(serviceName)
+			if err != nil || reflect.DeepEqual(latest, instances) {
+				continue
+			}
+			instances = latest
+			publish(ch, instances)
+		}
+	}()
+	return ch, nil
+}
+
+// getInstances 读取缓存，缓存不存在或已过期时重新解析
+func (r *MsDnsRegister) getInstances(serviceName string) ([]Instance, error) {
+	r.mu.Lock()
+	item, ok := r.entries[serviceName]
+	r.mu.Unlock()
+	if ok && time.Now().Before(item.expiry) {
+		return item.instances, nil
+	}
+	instances, err := r.resolve(serviceName)
+	if err != nil {
+		if ok {
+			// 解析失败时继续使用过期的结果，避免 DNS 抖动导致服务不可用
+			return item.instances, nil
+		}
+		return nil, err
+	}
+	r.mu.Lock()
+	r.entries[serviceName] = dnsItem{instances: instances, expiry: time.Now().Add(r.ttl)}
+	r.mu.Unlock()
+	return instances, nil
+}
+
+// resolve 依次在搜索域名下解析服务，返回第一个解析成功的结果
+func (r *MsDnsRegister) resolve(serviceName string) ([]Instance, error) {
+	name, port := serviceName, 0
+	if host, p, err := net.SplitHostPort(serviceName); err == nil {
+		port, err = strconv.Atoi(p)
+		if err != nil {
+			return nil, err
+		}
+		name = host
+	}
+	names := []string{name}
+	if len(r.domains) > 0 {
+		names = make([]string, 0, len(r.domains))
+		for _, domain := range r.domains {
+			names = append(names, name+"."+strings.Trim(domain, "."))
+		}
+	}
+	ctx, cancel := context.WithTimeout(r.watchCtx, 5*time.Second)
+	defer cancel()
+	var lastErr error
+	for _, n := range names {
+		var instances []Instance
+		var err error
+		if port > 0 {
+			instances, err = r.lookupHost(ctx, n, port)
+		} else {
+			instances, err = r.lookupSRV(ctx, n)
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(instances) > 0 {
+			return instances, nil
+		}
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, ErrNoInstance
+}
+
+// lookupSRV 解析 SRV 记录，使用记录中的端口和权重
+func (r *MsDnsRegister) lookupSRV(ctx context.Context, name string) ([]Instance, error) {
+	_, records, err := r.resolver.LookupSRV(ctx, "", "", name)
+	if err != nil {
+		return nil, err
+	}
+	instances := make([]Instance, 0, len(records))
+	for _, srv := range records {
+		weight := float64(srv.Weight)
+		if weight == 0 {
+			weight = 1 // 权重为 0 的记录也参与选择
+		}
+		instances = append(instances, Instance{
+			Host:    strings.TrimSuffix(srv.Target, "."),
+			Port:    int(srv.Port),
+			Weight:  weight,
+			Healthy: true,
+		})
+	}
+	return instances, nil
+}
+
+// lookupHost 解析 A/AAAA 记录，所有地址使用相同的端口
+func (r *MsDnsRegister) lookupHost(ctx context.Context, name string, port int) ([]Instance, error) {
+	addrs, err := r.resolver.LookupHost(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	instances := make([]Instance, 0, len(addrs))
+	for _, addr := range addrs {
+		instances = append(instances, Instance{Host: addr, Port: port, Weight: 1, Healthy: true})
+	}
+	return instances, nil
+}
+
+// Close 停止所有监听
+func (r *MsDnsRegister) Close() error {
+	if r.watchCancel != nil {
+		r.watchCancel()
+	}
+	return nil
+}
@@ -5,9 +5,28 @@ import (
 	"errors"
 	"fmt"
 	clientv3 "go.etcd.io/etcd/client/v3"
+	"strings"
+	"sync"
 	"time"
 )
 
+func init() {
+	Register("etcd", func() MsRegister { return &MsEtcdRegister{} })
+}
+
+// etcdServicePrefix 服务在etcd中的键前缀，实例的键为 services/<name>/<host:port>
+const etcdServicePrefix = "services/"
+
+// etcdServiceKey 返回服务的键前缀 services/<name>/
+func etcdServiceKey(serviceName string) string {
+	return etcdServicePrefix + serviceName + "/"
+}
+
+// etcdInstanceKey 返回实例的键 services/<name>/<host:port>
+func etcdInstanceKey(serviceName string, host string, port int) string {
+	return fmt.Sprintf("%s%s:%d", etcdServiceKey(serviceName), host, port)
+}
+
 // CreateEtcdCli 创建并返回一个etcd客户端
 func CreateEtcdCli(option Option) (*clientv3.Client, error) {
 	// 使用传入的选项创建一个etcd客户端
@@ -23,8 +42,8 @@ func RegEtcdService(cli *clientv3.Client, serviceName string, host string, port
 	// 创建上下文，设置超时时间为1秒
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel() // 确保函数返回前取消上下文
-	// 在etcd中注册服务，键为服务名称，值为服务地址和端口
-	_, err := cli.Put(ctx, serviceName, fmt.Sprintf("%s:%d", host, port))
+	// 在etcd中注册服务，键为 services/<name>/<host:port>，值为服务地址和端口
+	_, err := cli.Put(ctx, etcdInstanceKey(serviceName, host, port), fmt.Sprintf("%s:%d", host, port))
 	return err // 返回注册服务时的错误（如果有）
 }
 
@@ -33,8 +52,8 @@ func GetEtcdValue(cli *clientv3.Client, serviceName string) (string, error) {
 	// 创建上下文，设置超时时间为1秒
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel() // 确保函数返回前取消上下文
-	// 从etcd中获取服务的值
-	v, err := cli.Get(ctx, serviceName)
+	// 按前缀从etcd中获取服务的值
+	v, err := cli.Get(ctx, etcdServiceKey(serviceName), clientv3.WithPrefix())
 	if err != nil {
 		return "", err // 如果获取值失败，返回错误
 	}
@@ -43,12 +62,35 @@ func GetEtcdValue(cli *clientv3.Client, serviceName string) (string, error) {
 	if len(kvs) == 0 {
 		return "", errors.New("no value") // 如果没有值，返回错误
 	}
-	return string(kvs[0].Value), err // 返回第一个键值对的值和错误（如果有）
+	ins, err := decodeInstance(kvs[0].Value)
+	if err != nil {
+		return "", err
+	}
+	return ins.Addr(), nil // 返回第一个实例的地址
 }
 
+// defaultEtcdTTL 默认的租约时间（秒）
+const defaultEtcdTTL = 10
+
+// etcdRegrantMaxBackoff 租约失效后重新申请租约的最大间隔
+const etcdRegrantMaxBackoff = 30 * time.Second
+
 // MsEtcdRegister 代表一个etcd注册器
 type MsEtcdRegister struct {
-	cli *clientv3.Client // etcd客户端
+	cli      *clientv3.Client   // etcd客户端
+	ttl      int64              // 租约时间（秒）
+	mu       sync.Mutex         // 保护 leaseId、keys、cancel、closed，续约失败后在后台重新申请租约
+	leaseId  clientv3.LeaseID   // 注册服务使用的租约
+	keys     map[string]string  // 已注册的键 -> 值，申请新的租约后重新写入，关闭时删除
+	cancel   context.CancelFunc // 停止续约
+	closed   bool               // 已经关闭，不再重新申请租约
+	metadata map[string]string  // 注册实例的元数据
+	filters  []Filter           // 选择实例前使用的过滤器
+	events   eventEmitter       // 注册中心事件
+
+	cache       instanceCache      // 服务实例本地缓存
+	watchCtx    context.Context    // 监听使用的上下文
+	watchCancel context.CancelFunc // 关闭时停止所有监听
 }
 
 // CreateCli 创建etcd客户端
@@ -59,38 +101,299 @@ func (r *MsEtcdRegister) CreateCli(option Option) error {
 		DialTimeout: option.DialTimeout, // 连接超时时间
 	})
 	r.cli = cli // 将创建的客户端赋值给结构体的cli字段
-	return err  // 返回可能的错误
+	r.watchCtx, r.watchCancel = context.WithCancel(context.Background())
+	r.ttl = option.TTL
+	r.filters = option.Filters
+	r.metadata = option.Metadata
+	r.events = newEventEmitter("etcd", option.OnEvent)
+	if r.ttl <= 0 {
+		r.ttl = defaultEtcdTTL // 未设置租约时间时使用默认值
+	}
+	return err // 返回可能的错误
 }
 
-// RegisterService 在etcd中注册服务
-func (r *MsEtcdRegister) RegisterService(serviceName string, host string, port int) error {
+// RegisterService 在etcd中注册服务，键绑定租约并在后台持续续约，进程崩溃后键会自动过期
+func (r *MsEtcdRegister) RegisterService(serviceName string, host string, port int) (err error) {
+	defer func() { r.events.emit(instanceEvent(EventRegister, serviceName, host, port, err)) }()
 	// 创建一个上下文，设置超时时间为1秒
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel() // 确保函数返回前取消上下文
-	// 在etcd中注册服务，键为服务名称，值为服务地址和端口
-	_, err := r.cli.Put(ctx, serviceName, fmt.Sprintf("%s:%d", host, port))
-	return err // 返回注册服务时的错误（如果有）
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// 在etcd中注册服务，每个实例一个键 services/<name>/<host:port>，同名服务的多个实例互不覆盖
+	return r.putLocked(ctx, etcdInstanceKey(serviceName, host, port), r.instanceValue(host, port))
+}
+
+// putLocked 使用当前的租约写入键并记录，没有租约时先申请租约，调用前持有 mu
+func (r *MsEtcdRegister) putLocked(ctx context.Context, key string, value string) error {
+	if r.leaseId == clientv3.NoLease {
+		if err := r.grantLease(ctx); err != nil {
+			return err
+		}
+	}
+	if _, err := r.cli.Put(ctx, key, value, clientv3.WithLease(r.leaseId)); err != nil {
+		return err
+	}
+	if r.keys == nil {
+		r.keys = make(map[string]string)
+	}
+	r.keys[key] = value
+	return nil
+}
+
+// DeregisterService 删除etcd中注册的服务，所有服务都注销后撤销租约
+func (r *MsEtcdRegister) DeregisterService(serviceName string, host string, port int) (err error) {
+	defer func() { r.events.emit(instanceEvent(EventDeregister, serviceName, host, port, err)) }()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	key := etcdInstanceKey(serviceName, host, port)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err = r.cli.Delete(ctx, key); err != nil {
+		return err
+	}
+	delete(r.keys, key)
+	if len(r.keys) == 0 && r.leaseId != clientv3.NoLease {
+		if r.cancel != nil {
+			r.cancel() // 停止续约
+		}
+		_, err = r.cli.Revoke(ctx, r.leaseId) // 撤销租约
+		r.leaseId = clientv3.NoLease
+		return err
+	}
+	return nil
+}
+
+// SetHealthy 设置实例的健康状态，不健康时删除实例的键让调用方不再选择该实例，恢复后重新写入，租约保持不变
+func (r *MsEtcdRegister) SetHealthy(serviceName string, instance Instance, healthy bool) (err error) {
+	defer func() {
+		r.events.emit(Event{Type: EventSetHealthy, ServiceName: serviceName, Instance: instance, Err: err})
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	key := etcdInstanceKey(serviceName, instance.Host, instance.Port)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !healthy {
+		delete(r.keys, key) // 重新申请租约时不再写入该键
+		_, err = r.cli.Delete(ctx, key)
+		return err
+	}
+	return r.putLocked(ctx, key, r.instanceValue(instance.Host, instance.Port))
+}
+
+// instanceValue 返回实例在etcd中的值，包含地址、权重和元数据
+func (r *MsEtcdRegister) instanceValue(host string, port int) string {
+	return string(encodeInstance(Instance{
+		Host:     host,
+		Port:     port,
+		Weight:   1,
+		Metadata: r.metadata,
+		Healthy:  true,
+	}))
+}
+
+// grantLease 申请租约并启动后台续约，已注册的键（之前的租约失效后被删除）使用新的租约重新写入，调用前持有 mu
+func (r *MsEtcdRegister) grantLease(ctx context.Context) error {
+	if r.ttl <= 0 {
+		r.ttl = defaultEtcdTTL
+	}
+	lease, err := r.cli.Grant(ctx, r.ttl) // 申请租约
+	if err != nil {
+		return err
+	}
+	for key, value := range r.keys {
+		if _, err := r.cli.Put(ctx, key, value, clientv3.WithLease(lease.ID)); err != nil {
+			_, _ = r.cli.Revoke(ctx, lease.ID)
+			return err
+		}
+	}
+	keepCtx, keepCancel := context.WithCancel(context.Background())
+	ch, err := r.cli.KeepAlive(keepCtx, lease.ID) // 自动续约
+	if err != nil {
+		keepCancel()
+		_, _ = r.cli.Revoke(ctx, lease.ID)
+		return err
+	}
+	r.leaseId = lease.ID
+	r.cancel = keepCancel
+	go r.keepAlive(keepCtx, lease.ID, ch)
+	return nil
 }
 
-// GetValue 从etcd中获取服务的值
+// keepAlive 消费续约响应，续约意外停止时重新申请租约
+func (r *MsEtcdRegister) keepAlive(keepCtx context.Context, id clientv3.LeaseID, ch <-chan *clientv3.LeaseKeepAliveResponse) {
+	// 必须消费续约响应，否则 etcd 客户端会告警并丢弃
+	for range ch {
+	}
+	if keepCtx.Err() != nil {
+		return // 主动停止续约，注销或关闭
+	}
+	// 租约已经过期或连接长时间中断，已注册的键会被删除
+	r.events.emit(Event{Type: EventKeepAliveFailed, Err: errors.New("etcd lease keepalive stopped")})
+	r.mu.Lock()
+	if r.leaseId == id {
+		r.leaseId = clientv3.NoLease
+		r.cancel()
+	}
+	r.mu.Unlock()
+	r.regrant()
+}
+
+// regrant 按指数退避重新申请租约并写入已注册的键，直到成功、关闭、所有服务都已注销或其他调用已经申请了租约
+func (r *MsEtcdRegister) regrant() {
+	backoff := time.Second
+	for {
+		r.mu.Lock()
+		if r.closed || len(r.keys) == 0 || r.leaseId != clientv3.NoLease {
+			r.mu.Unlock()
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := r.grantLease(ctx)
+		cancel()
+		var restored []Event
+		if err == nil {
+			for key, value := range r.keys {
+				ins, _ := decodeInstance([]byte(value))
+				serviceName := strings.TrimPrefix(key[:strings.LastIndex(key, "/")], etcdServicePrefix)
+				restored = append(restored, Event{Type: EventRegister, ServiceName: serviceName, Instance: ins})
+			}
+		}
+		r.mu.Unlock()
+		if err == nil {
+			for _, e := range restored {
+				r.events.emit(e) // 释放 mu 之后再通知，回调中可以注销服务
+			}
+			return
+		}
+		r.events.emit(Event{Type: EventKeepAliveFailed, Err: fmt.Errorf("etcd regrant lease: %w", err)})
+		select {
+		case <-r.watchCtx.Done():
+			return // 已经关闭
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > etcdRegrantMaxBackoff {
+			backoff = etcdRegrantMaxBackoff
+		}
+	}
+}
+
+// GetInstances 获取服务的全部实例，优先读取本地缓存，缓存未命中时查询etcd并开始监听
+func (r *MsEtcdRegister) GetInstances(serviceName string) ([]Instance, error) {
+	instances, ok := r.cache.get(serviceName)
+	if !ok {
+		var err error
+		instances, err = r.getInstances(serviceName)
+		if err != nil {
+			return nil, err // 如果获取值失败，返回错误
+		}
+		if r.cache.startWatch(serviceName) {
+			r.cache.set(serviceName, instances)
+			go r.watch(serviceName, nil) // 后台监听变化，保持缓存最新
+		}
+	}
+	return instances, nil
+}
+
+// GetValue 按权重选择一个健康实例，返回 host:port 形式的地址
 func (r *MsEtcdRegister) GetValue(serviceName string) (string, error) {
+	instances, err := r.GetInstances(serviceName)
+	if err != nil {
+		return "", err
+	}
+	ins, err := SelectInstance(instances, r.filters...)
+	if err != nil {
+		return "", err
+	}
+	return ins.Addr(), nil
+}
+
+// Watch 监听服务实例的变化，每次变化都会发送最新的实例列表
+func (r *MsEtcdRegister) Watch(serviceName string) (<-chan []Instance, error) {
+	instances, err := r.getInstances(serviceName)
+	if err != nil && !errors.Is(err, ErrNoInstance) {
+		return nil, err
+	}
+	ch := make(chan []Instance, 1)
+	ch <- instances // 先发送当前的实例列表
+	go r.watch(serviceName, ch)
+	return ch, nil
+}
+
+// watch 监听etcd中服务键的变化并刷新缓存，ch 不为 nil 时同时发送给调用方
+func (r *MsEtcdRegister) watch(serviceName string, ch chan []Instance) {
+	if ch != nil {
+		defer close(ch)
+	}
+	wch := r.cli.Watch(r.watchCtx, etcdServiceKey(serviceName), clientv3.WithPrefix())
+	for resp := range wch {
+		if resp.Err() != nil {
+			// etcd 客户端会自动重新建立监听
+			r.events.emit(Event{Type: EventWatchReconnect, ServiceName: serviceName, Err: resp.Err()})
+			continue
+		}
+		instances, err := r.getInstances(serviceName)
+		if err != nil && !errors.Is(err, ErrNoInstance) {
+			continue
+		}
+		r.cache.set(serviceName, instances)
+		if ch != nil {
+			publish(ch, instances)
+		}
+	}
+	if ch == nil {
+		r.cache.stopWatch(serviceName) // 监听结束，缓存不再可信
+	}
+}
+
+// getInstances 按前缀从etcd中查询服务的所有实例
+func (r *MsEtcdRegister) getInstances(serviceName string) ([]Instance, error) {
 	// 创建一个上下文，设置超时时间为1秒
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel() // 确保函数返回前取消上下文
-	// 从etcd中获取服务的值
-	v, err := r.cli.Get(ctx, serviceName)
+	// 按前缀获取所有实例
+	v, err := r.cli.Get(ctx, etcdServiceKey(serviceName), clientv3.WithPrefix())
 	if err != nil {
-		return "", err // 如果获取值失败，返回错误
+		return nil, err
 	}
-	// 获取键值对列表
-	kvs := v.Kvs
-	if len(kvs) == 0 {
-		return "", errors.New("no value") // 如果没有值，返回错误
+	instances := make([]Instance, 0, len(v.Kvs))
+	for _, kv := range v.Kvs {
+		ins, err := decodeInstance(kv.Value)
+		if err != nil {
+			continue
+		}
+		instances = append(instances, ins)
+	}
+	if len(instances) == 0 {
+		return instances, ErrNoInstance
 	}
-	return string(kvs[0].Value), err // 返回第一个键值对的值和错误（如果有）
+	return instances, nil
 }
 
-// Close 关闭etcd客户端
+// Close 删除已注册的键、撤销租约并关闭etcd客户端
 func (r *MsEtcdRegister) Close() error {
+	if r.cli == nil {
+		return nil
+	}
+	if r.watchCancel != nil {
+		r.watchCancel() // 停止监听和重新申请租约
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	r.mu.Lock()
+	r.closed = true
+	if r.cancel != nil {
+		r.cancel() // 停止续约
+	}
+	for key := range r.keys {
+		_, _ = r.cli.Delete(ctx, key) // 主动删除键，不必等待租约过期
+	}
+	r.keys = nil
+	if r.leaseId != clientv3.NoLease {
+		_, _ = r.cli.Revoke(ctx, r.leaseId) // 撤销租约
+		r.leaseId = clientv3.NoLease
+	}
+	r.mu.Unlock()
 	return r.cli.Close() // 关闭etcd客户端
 }
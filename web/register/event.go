@@ -0,0 +1,89 @@
+package register
+
+import (
+	"expvar"
+	"fmt"
+	myLog "github.com/ygb616/web/log"
+	"time"
+)
+
+// EventType 注册中心事件类型
+type EventType string
+
+const (
+	EventRegister        EventType = "register"         // 注册实例
+	EventDeregister      EventType = "deregister"       // 注销实例
+	EventSetHealthy      EventType = "set_healthy"      // 设置实例健康状态
+	EventKeepAliveFailed EventType = "keepalive_failed" // 续约或会话失效，实例可能已经从注册中心消失
+	EventWatchReconnect  EventType = "watch_reconnect"  // 监听断开后重连
+)
+
+// Event 注册中心事件，Err 不为空表示操作失败
+type Event struct {
+	Type        EventType // 事件类型
+	Registry    string    // 注册中心类型，如 nacos、etcd
+	ServiceName string    // 服务名称
+	Instance    Instance  // 相关的实例，监听事件时为空
+	Err         error     // 失败原因
+	Time        time.Time // 发生时间
+}
+
+func (e Event) String() string {
+	s := fmt.Sprintf("[%s] %s service=%s", e.Registry, e.Type, e.ServiceName)
+	if e.Instance.Host != "" {
+		s += " instance=" + e.Instance.Addr()
+	}
+	if e.Err != nil {
+		s += " err=" + e.Err.Error()
+	}
+	return s
+}
+
+// EventHandler 注册中心事件回调
+type EventHandler func(event Event)
+
+// eventMetrics 按 <注册中心>.<事件类型> 统计事件次数，失败的事件另外统计在 <注册中心>.<事件类型>.error，
+// 通过 expvar 在 /debug/vars 中查看
+var eventMetrics = expvar.NewMap("register_events")
+
+// eventEmitter 记录日志、统计次数并调用 Option.OnEvent
+type eventEmitter struct {
+	registry string
+	handler  EventHandler
+	logger   *myLog.Logger
+}
+
+func newEventEmitter(registry string, handler EventHandler) eventEmitter {
+	return eventEmitter{registry: registry, handler: handler, logger: myLog.Default()}
+}
+
+// emit 发送事件，回调 panic 不影响注册中心的运行
+func (e eventEmitter) emit(event Event) {
+	event.Registry = e.registry
+	event.Time = time.Now()
+	key := e.registry + "." + string(event.Type)
+	eventMetrics.Add(key, 1)
+	if event.Err != nil {
+		eventMetrics.Add(key+".error", 1)
+	}
+	if e.logger != nil {
+		if event.Err != nil {
+			e.logger.Error(event.String())
+		} else {
+			e.logger.Info(event.String())
+		}
+	}
+	if e.handler != nil {
+		defer func() {
+			if err := recover(); err != nil && e.logger != nil {
+				e.logger.Error(fmt.Sprintf("register event handler panic: %v", err))
+			}
+		}()
+		e.handler(event)
+	}
+}
+
+// instanceEvent 返回实例相关的事件
+func instanceEvent(t EventType, serviceName string, host string, port int, err error) Event {
+	return Event{Type: t, ServiceName: serviceName, Instance: Instance{Host: host, Port: port}, Err: err}
+}
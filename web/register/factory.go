@@ -0,0 +1,56 @@
+package register
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Constructor 创建一个未初始化的注册中心客户端，New 会调用它的 CreateCli
+type Constructor func() MsRegister
+
+var (
+	constructorsMu sync.RWMutex
+	constructors   = make(map[string]Constructor) // 注册中心名称 -> 构造函数
+)
+
+// Register 注册一种注册中心实现，第三方实现可以在 init 中调用，之后通过 New(name, option) 创建；
+// 名称重复或 constructor 为 nil 时 panic
+func Register(name string, constructor Constructor) {
+	constructorsMu.Lock()
+	defer constructorsMu.Unlock()
+	if constructor == nil {
+		panic("register: Register constructor is nil")
+	}
+	if _, dup := constructors[name]; dup {
+		panic("register: Register called twice for " + name)
+	}
+	constructors[name] = constructor
+}
+
+// New 根据名称创建注册中心客户端并使用 option 初始化
+func New(name string, option Option) (MsRegister, error) {
+	constructorsMu.RLock()
+	constructor, ok := constructors[name]
+	constructorsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("register: unknown register type %q (forgotten import?)", name)
+	}
+	cli := constructor()
+	if err := cli.CreateCli(option); err != nil {
+		return nil, err
+	}
+	return cli, nil
+}
+
+// Registers 返回已注册的注册中心名称
+func Registers() []string {
+	constructorsMu.RLock()
+	defer constructorsMu.RUnlock()
+	names := make([]string, 0, len(constructors))
+	for name := range constructors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
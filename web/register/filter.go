@@ -0,0 +1,58 @@
+package register
+
+// 常用的实例元数据键
+const (
+	MetaZone    = "zone"    // 实例所在的可用区
+	MetaVersion = "version" // 实例的版本
+)
+
+// Filter 实例过滤器，在负载均衡选择实例之前过滤实例列表
+type Filter func(instances []Instance) []Instance
+
+// MetadataFilter 只保留元数据 key 的值等于 value 的实例
+func MetadataFilter(key string, value string) Filter {
+	return func(instances []Instance) []Instance {
+		result := make([]Instance, 0, len(instances))
+		for _, ins := range instances {
+			if ins.Metadata[key] == value {
+				result = append(result, ins)
+			}
+		}
+		return result
+	}
+}
+
+// VersionFilter 只保留指定版本的实例，version 为空时不过滤
+func VersionFilter(version string) Filter {
+	if version == "" {
+		return func(instances []Instance) []Instance { return instances }
+	}
+	return MetadataFilter(MetaVersion, version)
+}
+
+// PreferZone 优先选择同一可用区的实例，同可用区没有健康实例时使用全部实例
+func PreferZone(zone string) Filter {
+	return func(instances []Instance) []Instance {
+		if zone == "" {
+			return instances
+		}
+		same := make([]Instance, 0, len(instances))
+		for _, ins := range instances {
+			if ins.Healthy && ins.Metadata[MetaZone] == zone {
+				same = append(same, ins)
+			}
+		}
+		if len(same) == 0 {
+			return instances
+		}
+		return same
+	}
+}
+
+// SelectInstance 依次应用过滤器，再按权重随机选择一个健康的实例
+func SelectInstance(instances []Instance, filters ...Filter) (Instance, error) {
+	for _, filter := range filters {
+		instances = filter(instances)
+	}
+	return selectInstance(instances)
+}
@@ -0,0 +1,301 @@
+package register
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register("kubernetes", func() MsRegister { return &MsK8sRegister{} })
+}
+
+// 集群内 ServiceAccount 挂载的凭证路径
+const (
+	k8sTokenFile     = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	k8sCAFile        = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	k8sNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// k8sTokenRefresh 重新读取 ServiceAccount token 的间隔，与 client-go 相同；
+// 投射的 token 会被 kubelet 定期轮换，只读一次会在过期后认证失败
+const k8sTokenRefresh = time.Minute
+
+// MsK8sRegister 通过 Kubernetes EndpointSlice 解析服务，运行在集群内时不需要额外的注册中心，
+// 实例的注册与注销由 kubelet 根据 Pod 的 readiness 完成
+type MsK8sRegister struct {
+	cli         *http.Client       // 访问 API Server 的客户端
+	apiServer   string             // API Server 地址
+	tokenMu     sync.Mutex         // 保护 token、tokenRead
+	token       string             // ServiceAccount token
+	tokenRead   time.Time          // 最近一次读取 token 的时间
+	namespace   string             // 服务所在的命名空间
+	portName    string             // 选择的端口名称，为空时使用第一个端口
+	filters     []Filter           // 选择实例前使用的过滤器
+	events      eventEmitter       // 注册中心事件
+	cache       instanceCache      // 服务实例本地缓存
+	watchCtx    context.Context    // 监听使用的上下文
+	watchCancel context.CancelFunc // 关闭时停止所有监听
+}
+
+// CreateCli 使用集群内配置创建客户端，Endpoints 不为空时使用第一个地址作为 API Server 地址
+func (r *MsK8sRegister) CreateCli(option Option) error {
+	token, err := os.ReadFile(k8sTokenFile)
+	if err != nil {
+		return err
+	}
+	r.token, r.tokenRead = strings.TrimSpace(string(token)), time.Now()
+	if len(option.Endpoints) > 0 {
+		r.apiServer = option.Endpoints[0]
+	} else {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return errors.New("not running in kubernetes cluster")
+		}
+		r.apiServer = "https://" + net.JoinHostPort(host, port)
+	}
+	r.namespace = option.Namespace
+	if r.namespace == "" {
+		namespace, err := os.ReadFile(k8sNamespaceFile)
+		if err != nil {
+			return err
+		}
+		r.namespace = strings.TrimSpace(string(namespace))
+	}
+	r.portName = option.PortName
+	r.filters = option.Filters
+	r.events = newEventEmitter("kubernetes", option.OnEvent)
+	tlsConfig := &tls.Config{}
+	if ca, err := os.ReadFile(k8sCAFile); err == nil {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca)
+		tlsConfig.RootCAs = pool
+	}
+	timeout := option.DialTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	r.cli = &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:     tlsConfig,
+			TLSHandshakeTimeout: timeout,
+			DialContext:         (&net.Dialer{Timeout: timeout}).DialContext,
+		},
+	}
+	r.watchCtx, r.watchCancel = context.WithCancel(context.Background())
+	return nil
+}
+
+// RegisterService 在 Kubernetes 中由 kubelet 负责注册，这里不做任何操作
+func (r *MsK8sRegister) RegisterService(serviceName string, host string, port int) error {
+	return nil
+}
+
+// DeregisterService 在 Kubernetes 中由 kubelet 负责注销，这里不做任何操作
+func (r *MsK8sRegister) DeregisterService(serviceName string, host string, port int) error {
+	return nil
+}
+
+// SetHealthy Kubernetes 中实例的就绪状态由 readiness 探针决定，这里不做任何操作，
+// 可以把 Engine.HealthHandler 配置为 readiness 探针
+func (r *MsK8sRegister) SetHealthy(serviceName string, instance Instance, healthy bool) error {
+	return nil
+}
+
+// GetInstances 获取服务的全部实例，优先读取本地缓存，缓存未命中时查询API Server并开始监听
+func (r *MsK8sRegister) GetInstances(serviceName string) ([]Instance, error) {
+	instances, ok := r.cache.get(serviceName)
+	if !ok {
+		var err error
+		instances, err = r.getInstances(r.watchCtx, serviceName)
+		if err != nil {
+			return nil, err
+		}
+		if r.cache.startWatch(serviceName) {
+			r.cache.set(serviceName, instances)
+			go r.watch(serviceName, nil) // 后台监听变化，保持缓存最新
+		}
+	}
+	return instances, nil
+}
+
+// GetValue 按权重选择一个健康实例，返回 host:port 形式的地址
+func (r *MsK8sRegister) GetValue(serviceName string) (string, error) {
+	instances, err := r.GetInstances(serviceName)
+	if err != nil {
+		return "", err
+	}
+	ins, err := SelectInstance(instances, r.filters...)
+	if err != nil {
+		return "", err
+	}
+	return ins.Addr(), nil
+}
+
+// Watch 监听服务 EndpointSlice 的变化，每次变化都会发送最新的实例列表
+func (r *MsK8sRegister) Watch(serviceName string) (<-chan []Instance, error) {
+	instances, err := r.getInstances(r.watchCtx, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan []Instance, 1)
+	ch <- instances // 先发送当前的实例列表
+	go r.watch(serviceName, ch)
+	return ch, nil
+}
+
+// watch 使用 API Server 的 watch 接口监听变化，连接断开后自动重连
+func (r *MsK8sRegister) watch(serviceName string, ch chan []Instance) {
+	if ch != nil {
+		defer close(ch)
+	} else {
+		defer r.cache.stopWatch(serviceName)
+	}
+	for r.watchCtx.Err() == nil {
+		err := r.watchOnce(serviceName, ch)
+		if err != nil && r.watchCtx.Err() == nil {
+			r.events.emit(Event{Type: EventWatchReconnect, ServiceName: serviceName, Err: err})
+			time.Sleep(time.Second) // 连接断开，稍后重连
+		}
+	}
+}
+
+// watchOnce 建立一次 watch 连接，收到事件后重新查询完整的实例列表
+func (r *MsK8sRegister) watchOnce(serviceName string, ch chan []Instance) error {
+	resp, err := r.request(r.watchCtx, serviceName, true)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event struct {
+			Type string `json:"type"`
+		}
+		if err := decoder.Decode(&event); err != nil {
+			return err
+		}
+		instances, err := r.getInstances(r.watchCtx, serviceName)
+		if err != nil {
+			continue
+		}
+		r.cache.set(serviceName, instances)
+		if ch != nil {
+			publish(ch, instances)
+		}
+	}
+}
+
+// endpointSliceList EndpointSlice 列表中用到的字段
+type endpointSliceList struct {
+	Items []struct {
+		Endpoints []struct {
+			Addresses  []string `json:"addresses"`
+			Zone       string   `json:"zone"`
+			NodeName   string   `json:"nodeName"`
+			Conditions struct {
+				Ready *bool `json:"ready"`
+			} `json:"conditions"`
+		} `json:"endpoints"`
+		Ports []struct {
+			Name string `json:"name"`
+			Port int    `json:"port"`
+		} `json:"ports"`
+	} `json:"items"`
+}
+
+// getInstances 查询服务的 EndpointSlice 并转换为实例列表
+func (r *MsK8sRegister) getInstances(ctx context.Context, serviceName string) ([]Instance, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	resp, err := r.request(ctx, serviceName, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var list endpointSliceList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	instances := make([]Instance, 0)
+	for _, item := range list.Items {
+		port := 0
+		for _, p := range item.Ports {
+			if r.portName == "" || p.Name == r.portName {
+				port = p.Port
+				break
+			}
+		}
+		if port == 0 {
+			continue
+		}
+		for _, ep := range item.Endpoints {
+			// ready 为空时视为就绪
+			ready := ep.Conditions.Ready == nil || *ep.Conditions.Ready
+			metadata := map[string]string{MetaZone: ep.Zone, "nodeName": ep.NodeName}
+			for _, addr := range ep.Addresses {
+				instances = append(instances, Instance{Host: addr, Port: port, Weight: 1, Metadata: metadata, Healthy: ready})
+			}
+		}
+	}
+	return instances, nil
+}
+
+// bearerToken 返回 ServiceAccount token，距离上次读取超过 k8sTokenRefresh 时重新读取文件，
+// 读取失败时继续使用之前的 token
+func (r *MsK8sRegister) bearerToken() string {
+	r.tokenMu.Lock()
+	defer r.tokenMu.Unlock()
+	if time.Since(r.tokenRead) < k8sTokenRefresh {
+		return r.token
+	}
+	r.tokenRead = time.Now()
+	if token, err := os.ReadFile(k8sTokenFile); err == nil {
+		if t := strings.TrimSpace(string(token)); t != "" {
+			r.token = t
+		}
+	}
+	return r.token
+}
+
+// request 请求 API Server 的 EndpointSlice 接口
+func (r *MsK8sRegister) request(ctx context.Context, serviceName string, watch bool) (*http.Response, error) {
+	query := url.Values{}
+	query.Set("labelSelector", "kubernetes.io/service-name="+serviceName)
+	if watch {
+		query.Set("watch", "true")
+	}
+	u := fmt.Sprintf("%s/apis/discovery.k8s.io/v1/namespaces/%s/endpointslices?%s", r.apiServer, r.namespace, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+r.bearerToken())
+	resp, err := r.cli.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.New(resp.Status)
+	}
+	return resp, nil
+}
+
+// Close 停止所有监听
+func (r *MsK8sRegister) Close() error {
+	if r.watchCancel != nil {
+		r.watchCancel()
+	}
+	return nil
+}
@@ -1,13 +1,21 @@
 package register
 
 import (
-	"fmt"
 	"github.com/nacos-group/nacos-sdk-go/clients"
 	"github.com/nacos-group/nacos-sdk-go/clients/naming_client"
 	"github.com/nacos-group/nacos-sdk-go/common/constant"
+	"github.com/nacos-group/nacos-sdk-go/model"
 	"github.com/nacos-group/nacos-sdk-go/vo"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 )
 
+func init() {
+	Register("nacos", func() MsRegister { return &MsNacosRegister{} })
+}
+
 func CreateNacosClient() (naming_client.INamingClient, error) {
 	// 创建 clientConfig 的另一种方式
 	clientConfig := *constant.NewClientConfig(
@@ -77,11 +85,24 @@ func GetInstance(namingClient naming_client.INamingClient, serviceName string) (
 
 // CreateCli(option Option)  error
 // RegisterService(serviceName string, host string, port int) error
+// GetInstances(serviceName string) ([]Instance, error)
 // GetValue(serviceName string) (string, error)
+// SetHealthy(serviceName string, instance Instance, healthy bool) error
+// Watch(serviceName string) (<-chan []Instance, error)
+// DeregisterService(serviceName string, host string, port int) error
 // Close() error
 
 type MsNacosRegister struct {
-	cli naming_client.INamingClient // Nacos 客户端
+	cli        naming_client.INamingClient // Nacos 客户端
+	group      string                      // 分组
+	cluster    string                      // 集群
+	weight     float64                     // 注册实例的权重
+	metadata   map[string]string           // 注册实例的元数据
+	filters    []Filter                    // 选择实例前使用的过滤器
+	events     eventEmitter                // 注册中心事件
+	cache      instanceCache               // 服务实例本地缓存
+	mu         sync.Mutex                  // 保护 subscribes
+	subscribes []*vo.SubscribeParam        // 订阅参数，关闭时取消订阅
 }
 
 func (r *MsNacosRegister) CreateCli(option Option) error {
@@ -95,53 +116,275 @@ func (r *MsNacosRegister) CreateCli(option Option) error {
 	//    constant.WithLogLevel("debug"),
 	// )
 
+	// 没有直接设置 Nacos 配置时，根据 Option 中的字段创建
+	clientConfig := option.NacosClientConfig
+	if clientConfig == nil {
+		clientConfig = nacosClientConfig(option)
+	}
+	serverConfigs := option.NacosServerConfig
+	if len(serverConfigs) == 0 {
+		var err error
+		serverConfigs, err = nacosServerConfigs(option.Endpoints)
+		if err != nil {
+			return err
+		}
+	}
+
 	// 创建服务发现客户端
 	// 创建服务发现客户端的另一种方式（推荐）
 	namingClient, err := clients.NewNamingClient(
 		vo.NacosClientParam{
-			ClientConfig:  option.NacosClientConfig, // Nacos 客户端配置
-			ServerConfigs: option.NacosServerConfig, // Nacos 服务器配置
+			ClientConfig:  clientConfig,  // Nacos 客户端配置
+			ServerConfigs: serverConfigs, // Nacos 服务器配置
 		},
 	)
 	if err != nil {
 		return err // 返回错误
 	}
+	r.group = option.Group
+	r.cluster = option.Cluster
+	r.weight = option.Weight
+	if r.weight <= 0 {
+		r.weight = 10 // 默认权重
+	}
+	r.metadata = option.Metadata
+	r.filters = option.Filters
+	r.events = newEventEmitter("nacos", option.OnEvent)
 	r.cli = namingClient // 赋值客户端
 	return nil           // 返回 nil 表示成功
 }
 
+// nacosClientConfig 根据 Option 创建 Nacos 客户端配置
+func nacosClientConfig(option Option) *constant.ClientConfig {
+	timeout := uint64(5000)
+	if option.DialTimeout > 0 {
+		timeout = uint64(option.DialTimeout.Milliseconds())
+	}
+	logDir, cacheDir, logLevel := option.LogDir, option.CacheDir, option.LogLevel
+	if logDir == "" {
+		logDir = "/tmp/nacos/log"
+	}
+	if cacheDir == "" {
+		cacheDir = "/tmp/nacos/cache"
+	}
+	if logLevel == "" {
+		logLevel = "info"
+	}
+	clientConfig := constant.NewClientConfig(
+		constant.WithNamespaceId(option.Namespace), // 当 namespace 是 public 时，此处填空字符串
+		constant.WithTimeoutMs(timeout),            // 请求超时时间
+		constant.WithNotLoadCacheAtStart(true),     // 不在启动时加载缓存
+		constant.WithLogDir(logDir),                // 日志目录
+		constant.WithCacheDir(cacheDir),            // 缓存目录
+		constant.WithLogLevel(logLevel),            // 日志级别
+	)
+	clientConfig.Username = option.Username // 开启鉴权时的用户名
+	clientConfig.Password = option.Password // 开启鉴权时的密码
+	return clientConfig
+}
+
+// nacosServerConfigs 将 Endpoints 转换为 Nacos 服务器配置，
+// 地址可以是 host:port，也可以是 http://host:port/nacos 形式的 URL
+func nacosServerConfigs(endpoints []string) ([]constant.ServerConfig, error) {
+	serverConfigs := make([]constant.ServerConfig, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "http://" + endpoint
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		port := uint64(8848) // nacos 默认端口
+		if p := u.Port(); p != "" {
+			port, err = strconv.ParseUint(p, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+		}
+		contextPath := u.Path
+		if contextPath == "" {
+			contextPath = "/nacos"
+		}
+		serverConfigs = append(serverConfigs, *constant.NewServerConfig(
+			u.Hostname(),                          // 服务器 IP 地址
+			port,                                  // 端口号
+			constant.WithScheme(u.Scheme),         // 协议
+			constant.WithContextPath(contextPath), // 上下文路径
+		))
+	}
+	return serverConfigs, nil
+}
+
+// clusters 返回查询和订阅使用的集群列表
+func (r *MsNacosRegister) clusters() []string {
+	if r.cluster == "" {
+		return nil
+	}
+	return []string{r.cluster}
+}
+
 func (r *MsNacosRegister) RegisterService(serviceName string, host string, port int) error {
 	// 注册服务实例
 	_, err := r.cli.RegisterInstance(vo.RegisterInstanceParam{
-		Ip:          host,                                 // 实例的 IP 地址
-		Port:        uint64(port),                         // 实例的端口号
-		ServiceName: serviceName,                          // 服务名称
-		Weight:      10,                                   // 实例的权重
-		Enable:      true,                                 // 实例是否启用
-		Healthy:     true,                                 // 实例是否健康
-		Ephemeral:   true,                                 // 实例是否为临时实例
-		Metadata:    map[string]string{"idc": "shanghai"}, // 实例的元数据
-		// ClusterName: "cluster-a",            // 集群名称，默认值为 DEFAULT
-		// GroupName:   "group-a",              // 组名称，默认值为 DEFAULT_GROUP
+		Ip:          host,         // 实例的 IP 地址
+		Port:        uint64(port), // 实例的端口号
+		ServiceName: serviceName,  // 服务名称
+		Weight:      r.weight,     // 实例的权重
+		Enable:      true,         // 实例是否启用
+		Healthy:     true,         // 实例是否健康
+		Ephemeral:   true,         // 实例是否为临时实例
+		Metadata:    r.metadata,   // 实例的元数据，由 Option.Metadata 配置
+		ClusterName: r.cluster,    // 集群名称，默认值为 DEFAULT
+		GroupName:   r.group,      // 组名称，默认值为 DEFAULT_GROUP
 	})
+	r.events.emit(instanceEvent(EventRegister, serviceName, host, port, err))
 	return err // 返回注册结果中的错误信息
 }
 
+func (r *MsNacosRegister) DeregisterService(serviceName string, host string, port int) error {
+	// 注销服务实例，网关不再路由到该实例
+	_, err := r.cli.DeregisterInstance(vo.DeregisterInstanceParam{
+		Ip:          host,         // 实例的 IP 地址
+		Port:        uint64(port), // 实例的端口号
+		ServiceName: serviceName,  // 服务名称
+		Cluster:     r.cluster,    // 集群名称
+		GroupName:   r.group,      // 组名称
+		Ephemeral:   true,         // 实例是否为临时实例
+	})
+	r.events.emit(instanceEvent(EventDeregister, serviceName, host, port, err))
+	return err
+}
+
+// SetHealthy 设置实例的启用状态，nacos 临时实例的健康状态由心跳维护，这里通过 Enable 让实例退出或恢复轮询
+func (r *MsNacosRegister) SetHealthy(serviceName string, instance Instance, healthy bool) error {
+	weight := instance.Weight
+	if weight <= 0 {
+		weight = r.weight // 与注册时的权重保持一致
+	}
+	_, err := r.cli.UpdateInstance(vo.UpdateInstanceParam{
+		Ip:          instance.Host,         // 实例的 IP 地址
+		Port:        uint64(instance.Port), // 实例的端口号
+		ServiceName: serviceName,           // 服务名称
+		Weight:      weight,                // 实例的权重
+		Enable:      healthy,               // 实例是否启用
+		Ephemeral:   true,                  // 实例是否为临时实例
+		Metadata:    r.metadata,            // 实例的元数据
+		ClusterName: r.cluster,             // 集群名称
+		GroupName:   r.group,               // 组名称
+	})
+	r.events.emit(Event{Type: EventSetHealthy, ServiceName: serviceName, Instance: instance, Err: err})
+	return err
+}
+
+// GetInstances 获取服务的全部实例，包含权重、元数据和健康状态
+func (r *MsNacosRegister) GetInstances(serviceName string) ([]Instance, error) {
+	// 优先读取本地缓存，缓存未命中时查询 nacos 并订阅变化
+	instances, ok := r.cache.get(serviceName)
+	if !ok {
+		var err error
+		instances, err = r.getInstances(serviceName)
+		if err != nil {
+			return nil, err // 如果获取实例失败，返回错误
+		}
+		if r.cache.startWatch(serviceName) {
+			r.cache.set(serviceName, instances)
+			if err := r.subscribe(serviceName, nil); err != nil {
+				r.cache.stopWatch(serviceName)
+			}
+		}
+	}
+	return instances, nil
+}
+
+// GetValue 按权重选择一个健康实例，返回 host:port 形式的地址
 func (r *MsNacosRegister) GetValue(serviceName string) (string, error) {
-	// 选择一个健康的实例
-	instance, err := r.cli.SelectOneHealthyInstance(vo.SelectOneHealthInstanceParam{
-		ServiceName: serviceName, // 服务名称
-		// GroupName:   "group-a",             // 组名称，默认值为 DEFAULT_GROUP
-		// Clusters:    []string{"cluster-a"}, // 集群名称，默认值为 DEFAULT
+	instances, err := r.GetInstances(serviceName)
+	if err != nil {
+		return "", err
+	}
+	ins, err := SelectInstance(instances, r.filters...)
+	if err != nil {
+		return "", err
+	}
+	return ins.Addr(), nil
+}
+
+// Watch 订阅服务实例的变化，每次变化都会发送最新的实例列表
+func (r *MsNacosRegister) Watch(serviceName string) (<-chan []Instance, error) {
+	ch := make(chan []Instance, 1)
+	instances, err := r.getInstances(serviceName)
+	if err == nil {
+		ch <- instances // 先发送当前的实例列表
+	}
+	if err := r.subscribe(serviceName, ch); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// subscribe 订阅服务变化并刷新缓存，ch 不为 nil 时同时发送给调用方
+func (r *MsNacosRegister) subscribe(serviceName string, ch chan []Instance) error {
+	param := &vo.SubscribeParam{
+		ServiceName: serviceName,  // 服务名称
+		Clusters:    r.clusters(), // 集群名称
+		GroupName:   r.group,      // 组名称
+		SubscribeCallback: func(services []model.SubscribeService, err error) {
+			if err != nil {
+				// 订阅推送失败，nacos 客户端会继续轮询
+				r.events.emit(Event{Type: EventWatchReconnect, ServiceName: serviceName, Err: err})
+				return
+			}
+			// 回调中的实例信息不完整，重新查询完整的实例列表
+			instances, err := r.getInstances(serviceName)
+			if err != nil {
+				return
+			}
+			r.cache.set(serviceName, instances)
+			if ch != nil {
+				publish(ch, instances)
+			}
+		},
+	}
+	if err := r.cli.Subscribe(param); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.subscribes = append(r.subscribes, param)
+	r.mu.Unlock()
+	return nil
+}
+
+// getInstances 从 nacos 查询服务的实例列表
+func (r *MsNacosRegister) getInstances(serviceName string) ([]Instance, error) {
+	list, err := r.cli.SelectAllInstances(vo.SelectAllInstancesParam{
+		ServiceName: serviceName,  // 服务名称
+		Clusters:    r.clusters(), // 集群名称
+		GroupName:   r.group,      // 组名称
 	})
 	if err != nil {
-		return "", err // 如果获取实例失败，返回错误
+		return nil, err
+	}
+	instances := make([]Instance, 0, len(list))
+	for _, ins := range list {
+		instances = append(instances, Instance{
+			Host:     ins.Ip,
+			Port:     int(ins.Port),
+			Weight:   ins.Weight,
+			Metadata: ins.Metadata,
+			Healthy:  ins.Healthy && ins.Enable,
+		})
 	}
-	// 返回实例的 IP 和端口号
-	return fmt.Sprintf("%s:%d", instance.Ip, instance.Port), nil
+	return instances, nil
 }
 
 func (r *MsNacosRegister) Close() error {
-	// 关闭客户端
+	// 取消所有订阅
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, param := range r.subscribes {
+		_ = r.cli.Unsubscribe(param)
+	}
+	r.subscribes = nil
 	return nil
 }
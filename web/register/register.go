@@ -1,13 +1,33 @@
 package register
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/nacos-group/nacos-sdk-go/common/constant"
+	"net"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type Option struct {
-	Endpoints         []string      //节点
-	DialTimeout       time.Duration //超时时间
+	Endpoints         []string          //节点，dns 使用时为搜索域名
+	DialTimeout       time.Duration     //超时时间
+	TTL               int64             //租约时间（秒），etcd 注册使用；dns 使用时为解析结果的缓存时间
+	HealthCheckURL    string            //健康检查地址，consul 注册使用，为空时使用 TCP 检查
+	Namespace         string            //命名空间，nacos 使用时为 namespaceId（public 为空），kubernetes 使用时为空则使用 Pod 所在的命名空间
+	Group             string            //分组，nacos 使用，默认 DEFAULT_GROUP
+	Cluster           string            //集群，nacos 使用，默认 DEFAULT
+	Weight            float64           //注册实例的权重，nacos 使用，默认 10
+	Username          string            //用户名，nacos 开启鉴权时使用
+	Password          string            //密码，nacos 开启鉴权时使用
+	LogDir            string            //日志目录，nacos 使用，默认 /tmp/nacos/log
+	CacheDir          string            //缓存目录，nacos 使用，默认 /tmp/nacos/cache
+	LogLevel          string            //日志级别，nacos 使用，默认 info
+	PortName          string            //端口名称，kubernetes 使用，为空时使用第一个端口
+	Metadata          map[string]string //注册实例的元数据，如 zone、version，服务发现时随实例返回
+	Filters           []Filter          //GetValue 选择实例前使用的过滤器，如 PreferZone、VersionFilter
+	OnEvent           EventHandler      //注册、注销、续约失败、监听重连等事件的回调
 	ServiceName       string
 	Host              string
 	Port              int
@@ -18,6 +38,48 @@ type Option struct {
 type MsRegister interface {
 	CreateCli(option Option) error
 	RegisterService(serviceName string, host string, port int) error
+	DeregisterService(serviceName string, host string, port int) error
+	GetInstances(serviceName string) ([]Instance, error)
 	GetValue(serviceName string) (string, error)
+	SetHealthy(serviceName string, instance Instance, healthy bool) error
+	Watch(serviceName string) (<-chan []Instance, error)
 	Close() error
 }
+
+// Instance 服务实例
+type Instance struct {
+	Host     string            // 主机地址
+	Port     int               // 端口号
+	Weight   float64           // 权重
+	Metadata map[string]string // 元数据
+	Healthy  bool              // 是否健康
+}
+
+// Addr 返回 host:port 形式的地址
+func (i Instance) Addr() string {
+	return fmt.Sprintf("%s:%d", i.Host, i.Port)
+}
+
+// encodeInstance 将实例编码为 JSON，etcd、zookeeper 等以键值存储实例的注册中心使用
+func encodeInstance(instance Instance) []byte {
+	data, _ := json.Marshal(instance)
+	return data
+}
+
+// decodeInstance 解码 encodeInstance 编码的实例，兼容旧版本只保存 host:port 的数据
+func decodeInstance(data []byte) (Instance, error) {
+	if strings.HasPrefix(string(data), "{") {
+		var instance Instance
+		err := json.Unmarshal(data, &instance)
+		return instance, err
+	}
+	host, p, err := net.SplitHostPort(string(data))
+	if err != nil {
+		return Instance{}, err
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return Instance{}, err
+	}
+	return Instance{Host: host, Port: port, Weight: 1, Healthy: true}, nil
+}
@@ -0,0 +1,272 @@
+package register
+
+import (
+	"context"
+	"errors"
+	"github.com/go-zookeeper/zk"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register("zookeeper", func() MsRegister { return &MsZookeeperRegister{} })
+}
+
+// zkServicePrefix 服务在 ZooKeeper 中的根路径，实例节点为 /services/<服务名称>/<host:port>
+const zkServicePrefix = "/services"
+
+// MsZookeeperRegister 基于 ZooKeeper 临时节点的注册中心，会话断开后实例节点自动删除
+type MsZookeeperRegister struct {
+	conn        *zk.Conn           // ZooKeeper 连接
+	cache       instanceCache      // 服务实例本地缓存
+	mu          sync.Mutex         // 保护 nodes
+	nodes       map[string]string  // 已注册的实例节点路径 -> 节点数据，会话过期后重新创建
+	metadata    map[string]string  // 注册实例的元数据
+	filters     []Filter           // 选择实例前使用的过滤器
+	events      eventEmitter       // 注册中心事件
+	watchCtx    context.Context    // 监听使用的上下文
+	watchCancel context.CancelFunc // 关闭时停止所有监听
+}
+
+// zkServicePath 返回服务在 ZooKeeper 中的路径
+func zkServicePath(serviceName string) string {
+	return zkServicePrefix + "/" + serviceName
+}
+
+// CreateCli 连接 ZooKeeper，DialTimeout 作为会话超时时间
+func (r *MsZookeeperRegister) CreateCli(option Option) error {
+	timeout := option.DialTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	conn, sessionEvents, err := zk.Connect(option.Endpoints, timeout)
+	if err != nil {
+		return err
+	}
+	r.conn = conn
+	r.nodes = make(map[string]string)
+	r.metadata = option.Metadata
+	r.filters = option.Filters
+	r.events = newEventEmitter("zookeeper", option.OnEvent)
+	r.watchCtx, r.watchCancel = context.WithCancel(context.Background())
+	go r.keepNodes(sessionEvents)
+	return nil
+}
+
+// keepNodes 处理连接事件，会话过期重建后临时节点已经被删除，需要重新注册
+func (r *MsZookeeperRegister) keepNodes(sessionEvents <-chan zk.Event) {
+	expired := false
+	for event := range sessionEvents {
+		if event.State == zk.StateExpired {
+			expired = true
+			r.events.emit(Event{Type: EventKeepAliveFailed, Err: zk.ErrSessionExpired})
+		}
+		if event.State == zk.StateHasSession && expired {
+			expired = false
+			r.mu.Lock()
+			for path, data := range r.nodes {
+				err := r.createNode(path, data)
+				ins, _ := decodeInstance([]byte(data))
+				serviceName := strings.TrimPrefix(path[:strings.LastIndex(path, "/")], zkServicePrefix+"/")
+				r.events.emit(Event{Type: EventRegister, ServiceName: serviceName, Instance: ins, Err: err})
+			}
+			r.mu.Unlock()
+		}
+	}
+}
+
+// createNode 创建实例的临时节点，父节点不存在时先创建持久化的父节点
+func (r *MsZookeeperRegister) createNode(path string, data string) error {
+	if err := r.ensurePath(path[:strings.LastIndex(path, "/")]); err != nil {
+		return err
+	}
+	_, err := r.conn.Create(path, []byte(data), zk.FlagEphemeral, zk.WorldACL(zk.PermAll))
+	if errors.Is(err, zk.ErrNodeExists) {
+		return nil
+	}
+	return err
+}
+
+// ensurePath 逐级创建持久化节点，节点已存在时忽略
+func (r *MsZookeeperRegister) ensurePath(path string) error {
+	current := ""
+	for _, part := range strings.Split(strings.Trim(path, "/"), "/") {
+		current += "/" + part
+		_, err := r.conn.Create(current, nil, 0, zk.WorldACL(zk.PermAll))
+		if err != nil && !errors.Is(err, zk.ErrNodeExists) {
+			return err
+		}
+	}
+	return nil
+}
+
+// RegisterService 在服务路径下创建实例的临时节点
+func (r *MsZookeeperRegister) RegisterService(serviceName string, host string, port int) (err error) {
+	defer func() { r.events.emit(instanceEvent(EventRegister, serviceName, host, port, err)) }()
+	path := zkServicePath(serviceName) + "/" + net.JoinHostPort(host, strconv.Itoa(port))
+	// 节点名称为 host:port，节点数据保存实例的权重和元数据
+	data := string(encodeInstance(Instance{Host: host, Port: port, Weight: 1, Metadata: r.metadata, Healthy: true}))
+	if err = r.createNode(path, data); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.nodes[path] = data
+	r.mu.Unlock()
+	return nil
+}
+
+// DeregisterService 删除实例的临时节点
+func (r *MsZookeeperRegister) DeregisterService(serviceName string, host string, port int) (err error) {
+	defer func() { r.events.emit(instanceEvent(EventDeregister, serviceName, host, port, err)) }()
+	path := zkServicePath(serviceName) + "/" + net.JoinHostPort(host, strconv.Itoa(port))
+	r.mu.Lock()
+	delete(r.nodes, path)
+	r.mu.Unlock()
+	err = r.conn.Delete(path, -1)
+	if errors.Is(err, zk.ErrNoNode) {
+		return nil
+	}
+	return err
+}
+
+// SetHealthy 设置实例的健康状态，不健康时删除实例节点，恢复后重新创建
+func (r *MsZookeeperRegister) SetHealthy(serviceName string, instance Instance, healthy bool) error {
+	addr := net.JoinHostPort(instance.Host, strconv.Itoa(instance.Port))
+	path := zkServicePath(serviceName) + "/" + addr
+	if healthy {
+		return r.RegisterService(serviceName, instance.Host, instance.Port)
+	}
+	r.mu.Lock()
+	delete(r.nodes, path) // 会话重建时不再恢复该节点
+	r.mu.Unlock()
+	err := r.conn.Delete(path, -1)
+	if errors.Is(err, zk.ErrNoNode) {
+		err = nil
+	}
+	r.events.emit(Event{Type: EventSetHealthy, ServiceName: serviceName, Instance: instance, Err: err})
+	return err
+}
+
+// GetInstances 获取服务的全部实例，优先读取本地缓存，缓存未命中时查询ZooKeeper并开始监听
+func (r *MsZookeeperRegister) GetInstances(serviceName string) ([]Instance, error) {
+	instances, ok := r.cache.get(serviceName)
+	if !ok {
+		var err error
+		instances, err = r.getInstances(serviceName)
+		if err != nil {
+			return nil, err
+		}
+		if r.cache.startWatch(serviceName) {
+			r.cache.set(serviceName, instances)
+			go r.watch(serviceName, nil) // 后台监听变化，保持缓存最新
+		}
+	}
+	return instances, nil
+}
+
+// GetValue 按权重选择一个健康实例，返回 host:port 形式的地址
+func (r *MsZookeeperRegister) GetValue(serviceName string) (string, error) {
+	instances, err := r.GetInstances(serviceName)
+	if err != nil {
+		return "", err
+	}
+	ins, err := SelectInstance(instances, r.filters...)
+	if err != nil {
+		return "", err
+	}
+	return ins.Addr(), nil
+}
+
+// Watch 监听服务子节点的变化，每次变化都会发送最新的实例列表
+func (r *MsZookeeperRegister) Watch(serviceName string) (<-chan []Instance, error) {
+	if err := r.ensurePath(zkServicePath(serviceName)); err != nil {
+		return nil, err
+	}
+	instances, err := r.getInstances(serviceName)
+	if err != nil && !errors.Is(err, ErrNoInstance) {
+		return nil, err
+	}
+	ch := make(chan []Instance, 1)
+	ch <- instances // 先发送当前的实例列表
+	go r.watch(serviceName, ch)
+	return ch, nil
+}
+
+// watch 使用 ChildrenW 监听子节点变化，ZooKeeper 的 watch 只触发一次，每次触发后重新注册
+func (r *MsZookeeperRegister) watch(serviceName string, ch chan []Instance) {
+	if ch != nil {
+		defer close(ch)
+	} else {
+		defer r.cache.stopWatch(serviceName)
+	}
+	path := zkServicePath(serviceName)
+	for r.watchCtx.Err() == nil {
+		children, _, events, err := r.conn.ChildrenW(path)
+		if err != nil {
+			r.events.emit(Event{Type: EventWatchReconnect, ServiceName: serviceName, Err: err})
+			select {
+			case <-r.watchCtx.Done():
+			case <-time.After(time.Second): // 稍后重试
+			}
+			continue
+		}
+		instances := r.zkInstances(path, children)
+		r.cache.set(serviceName, instances)
+		if ch != nil {
+			publish(ch, instances)
+		}
+		select {
+		case <-r.watchCtx.Done():
+			return
+		case <-events:
+		}
+	}
+}
+
+// getInstances 查询服务路径下的所有实例
+func (r *MsZookeeperRegister) getInstances(serviceName string) ([]Instance, error) {
+	path := zkServicePath(serviceName)
+	children, _, err := r.conn.Children(path)
+	if errors.Is(err, zk.ErrNoNode) {
+		return nil, ErrNoInstance
+	}
+	if err != nil {
+		return nil, err
+	}
+	instances := r.zkInstances(path, children)
+	if len(instances) == 0 {
+		return nil, ErrNoInstance
+	}
+	return instances, nil
+}
+
+// zkInstances 读取子节点数据转换为实例列表，节点没有数据时使用节点名称 host:port
+func (r *MsZookeeperRegister) zkInstances(path string, children []string) []Instance {
+	instances := make([]Instance, 0, len(children))
+	for _, child := range children {
+		data, _, err := r.conn.Get(path + "/" + child)
+		if err != nil || len(data) == 0 {
+			data = []byte(child)
+		}
+		ins, err := decodeInstance(data)
+		if err != nil {
+			continue
+		}
+		instances = append(instances, ins)
+	}
+	return instances
+}
+
+// Close 停止监听并关闭连接，临时节点随会话一起删除
+func (r *MsZookeeperRegister) Close() error {
+	if r.watchCancel != nil {
+		r.watchCancel()
+	}
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	myLog "github.com/ygb616/web/log"
+)
+
+// RequestIDHeader 请求 ID 的请求头和响应头，网关转发时传给后端服务
+const RequestIDHeader = "X-Request-Id"
+
+// RequestID 返回请求 ID，优先使用请求头 X-Request-Id（如上游网关生成的），没有或不合法时生成一个，
+// 并设置到响应头中，需要在写响应之前第一次调用，Logging 中间件会在处理请求前调用
+func (c *Context) RequestID() string {
+	if c.requestID == "" {
+		id := c.R.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.requestID = id
+		c.W.Header().Set(RequestIDHeader, id)
+	}
+	return c.requestID
+}
+
+// Log 返回当前请求的 Logger，日志都带上 request_id、route、method、client_ip，
+// 同一个请求的日志可以按 request_id 关联起来
+func (c *Context) Log() *myLog.Logger {
+	if c.log == nil {
+		route := c.fullPath
+		if route == "" {
+			if name, ok := c.Get(GatewayRouteKey); ok {
+				route, _ = name.(string)
+			} else {
+				route = c.R.URL.Path
+			}
+		}
+		c.log = c.Logger.With(
+			"request_id", c.RequestID(),
+			"route", route,
+			"method", c.R.Method,
+			"client_ip", LimitByIP(c),
+		)
+	}
+	return c.log
+}
+
+// validRequestID 上游传来的请求 ID 只接受不超过 128 个可见 ASCII 字符，避免伪造的请求头污染日志
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,44 @@
+package web
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+)
+
+// RouteInfo 注册的路由，见 Engine.Routes
+type RouteInfo struct {
+	Method      string      // 请求方法，Any 注册的路由为 ANY
+	Path        string      // 完整路径，如 /user/get/:id
+	Group       string      // 路由组的名称
+	Handler     string      // 处理函数的名称，如 main.getUser
+	HandlerFunc HandlerFunc // 处理函数
+	Middlewares int         // 路由级中间件的数量，不含路由组和 Engine 的中间件
+}
+
+// Routes 返回所有注册的路由，按注册的顺序，用于调试或生成接口文档
+func (e *Engine) Routes() []RouteInfo {
+	return append([]RouteInfo(nil), e.routes...)
+}
+
+// printRoutes DebugPrintRoutes 为 true 时在启动前打印所有路由
+func (e *Engine) printRoutes() {
+	if !e.DebugPrintRoutes {
+		return
+	}
+	for _, r := range e.routes {
+		handler := r.Handler
+		if r.Middlewares > 0 {
+			handler = fmt.Sprintf("%s (%d middlewares)", handler, r.Middlewares)
+		}
+		e.Logger.Info(fmt.Sprintf("[route] %-7s %-30s --> %s", r.Method, r.Path, handler))
+	}
+}
+
+// nameOfFunction 返回函数的名称
+func nameOfFunction(f any) string {
+	if fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer()); fn != nil {
+		return fn.Name()
+	}
+	return ""
+}
@@ -2,10 +2,16 @@ package rpc
 
 import (
 	"context"
+	"github.com/ygb616/web/breaker"
+	"github.com/ygb616/web/config"
+	"github.com/ygb616/web/register"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
 	"net"
+	"strings"
 	"time"
 )
 
@@ -15,6 +21,7 @@ type MsGrpcServer struct {
 	g        *grpc.Server           // gRPC 服务器实例
 	register []func(g *grpc.Server) // 注册函数切片
 	ops      []grpc.ServerOption    // gRPC 服务器选项切片
+	onStop   []func()               // 停止前执行的钩子，例如从注册中心注销
 }
 
 // NewGrpcServer 创建新的 gRPC 服务器
@@ -41,9 +48,12 @@ func (s *MsGrpcServer) Run() error {
 	return s.g.Serve(s.listen) // 启动 gRPC 服务器
 }
 
-// Stop 方法停止 gRPC 服务器
+// Stop 方法停止 gRPC 服务器，先执行注销钩子再关闭监听
 func (s *MsGrpcServer) Stop() {
-	s.g.Stop() // 停止 gRPC 服务器
+	for _, f := range s.onStop {
+		f()
+	}
+	s.g.GracefulStop() // 等待正在处理的请求结束后停止 gRPC 服务器
 }
 
 // Register 方法用于注册 gRPC 服务
@@ -75,6 +85,20 @@ func WithGrpcOptions(ops ...grpc.ServerOption) MsGrpcOption {
 	}
 }
 
+// WithDeregister 创建 gRPC 选项，服务器停止时从注册中心注销服务实例
+func WithDeregister(cli register.MsRegister, serviceName string, host string, port int) MsGrpcOption {
+	return &DefaultMsGrpcOption{
+		f: func(s *MsGrpcServer) {
+			s.onStop = append(s.onStop, func() {
+				if err := cli.DeregisterService(serviceName, host, port); err != nil {
+					rpcLog().Error(err) // 打印错误日志
+				}
+				_ = cli.Close()
+			})
+		},
+	}
+}
+
 // MsGrpcClient 定义了 gRPC 客户端结构体
 type MsGrpcClient struct {
 	Conn *grpc.ClientConn // gRPC 客户端连接
@@ -96,6 +120,8 @@ func NewGrpcClient(config *MsGrpcClientConfig) (*MsGrpcClient, error) {
 	if config.KeepAlive != nil { // 如果设置了 KeepAlive 参数
 		dialOptions = append(dialOptions, grpc.WithKeepaliveParams(*config.KeepAlive)) // 添加 KeepAlive 参数
 	}
+	// 默认超时、重试和熔断通过一元拦截器实现
+	dialOptions = append(dialOptions, grpc.WithChainUnaryInterceptor(config.unaryInterceptor()))
 	conn, err := grpc.DialContext(ctx, config.Address, dialOptions...) // 创建 gRPC 客户端连接
 	if err != nil {                                                    // 如果连接创建失败
 		return nil, err // 返回错误
@@ -110,12 +136,126 @@ type MsGrpcClientConfig struct {
 	Address     string                      // 服务器地址
 	Block       bool                        // 是否阻塞
 	DialTimeout time.Duration               // 拨号超时时间
-	ReadTimeout time.Duration               // 读取超时时间
+	ReadTimeout time.Duration               // 读取超时时间，作为每次调用的默认 deadline
 	Direct      bool                        // 是否直连
 	KeepAlive   *keepalive.ClientParameters // KeepAlive 参数
+	Retry       *GrpcRetryPolicy            // 重试策略，为 nil 时不重试
+	Breaker     *breaker.Settings           // 熔断器设置，为 nil 时不熔断；IsSuccessful 为 nil 时只有 grpcBreakerFailureCodes 计为失败
 	dialOptions []grpc.DialOption           // 拨号选项切片
 }
 
+// GrpcRetryPolicy 定义了 gRPC 客户端的重试策略
+type GrpcRetryPolicy struct {
+	MaxAttempts    int           // 最大尝试次数（包含第一次调用）
+	Backoff        time.Duration // 初始退避时间，每次重试翻倍
+	MaxBackoff     time.Duration // 最大退避时间
+	RetryableCodes []codes.Code  // 可重试的状态码
+}
+
+// DefaultGrpcRetryPolicy 返回默认的重试策略，与 TCP 客户端的默认重试次数保持一致
+func DefaultGrpcRetryPolicy() *GrpcRetryPolicy {
+	return &GrpcRetryPolicy{
+		MaxAttempts:    3,
+		Backoff:        100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		RetryableCodes: []codes.Code{codes.Unavailable, codes.ResourceExhausted},
+	}
+}
+
+// retryable 判断状态码是否可以重试
+func (p *GrpcRetryPolicy) retryable(code codes.Code) bool {
+	for _, c := range p.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff 计算第 attempt 次重试前的等待时间
+func (p *GrpcRetryPolicy) backoff(attempt int) time.Duration {
+	d := p.Backoff << attempt
+	if p.MaxBackoff > 0 && (d > p.MaxBackoff || d <= 0) {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// grpcBreakerFailureCodes 默认计为熔断失败的状态码，都是服务端或网络的暂时故障；
+// InvalidArgument、NotFound、PermissionDenied、Canceled 等是调用方的问题，不能因此熔断所有调用方
+var grpcBreakerFailureCodes = map[codes.Code]bool{
+	codes.Unavailable:       true,
+	codes.DeadlineExceeded:  true,
+	codes.ResourceExhausted: true,
+	codes.Internal:          true,
+}
+
+// grpcBreakerSuccessful 熔断器默认的 IsSuccessful
+func grpcBreakerSuccessful(err error) bool {
+	return err == nil || !grpcBreakerFailureCodes[status.Code(err)]
+}
+
+// unaryInterceptor 创建一元拦截器，负责默认 deadline、重试以及熔断
+func (c *MsGrpcClientConfig) unaryInterceptor() grpc.UnaryClientInterceptor {
+	var cb *breaker.CircuitBreaker
+	if c.Breaker != nil {
+		st := *c.Breaker
+		name := st.Name
+		if name == "" {
+			name = c.Address
+		}
+		if st.IsSuccessful == nil {
+			st.IsSuccessful = grpcBreakerSuccessful
+		}
+		cb = breaker.Get(name, st) // 连接同一个服务的客户端共用一个熔断器
+	}
+	timeout := c.ReadTimeout
+	retry := c.Retry
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		invoke := func() error {
+			callCtx := ctx
+			// 调用方没有设置 deadline 时使用默认的超时时间
+			if _, ok := ctx.Deadline(); !ok && timeout > 0 {
+				var cancel context.CancelFunc
+				callCtx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			return invoker(callCtx, method, req, reply, cc, opts...)
+		}
+		call := func() error {
+			if retry == nil || retry.MaxAttempts <= 1 {
+				return invoke()
+			}
+			var err error
+			for i := 0; i < retry.MaxAttempts; i++ {
+				err = invoke()
+				if err == nil || !retry.retryable(status.Code(err)) {
+					return err
+				}
+				if i == retry.MaxAttempts-1 {
+					break
+				}
+				// 等待退避时间，调用方取消时立即返回
+				timer := time.NewTimer(retry.backoff(i))
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return err
+				case <-timer.C:
+				}
+			}
+			return err
+		}
+		if cb == nil {
+			return call()
+		}
+		_, err := cb.Execute(func() (any, error) {
+			return nil, call()
+		})
+		return err
+	}
+}
+
 // DefaultGrpcClientConfig 返回默认的 gRPC 客户端配置
 func DefaultGrpcClientConfig() *MsGrpcClientConfig {
 	return &MsGrpcClientConfig{
@@ -127,3 +267,98 @@ func DefaultGrpcClientConfig() *MsGrpcClientConfig {
 		Block:       true,            // 默认阻塞连接
 	}
 }
+
+// GrpcClientConfigByConf 从配置文件中读取指定目标的 gRPC 客户端配置
+// 配置示例：
+//
+//	[grpc.goodscenter]
+//	address="localhost:9111"
+//	timeout="2s"
+//	maxAttempts=3
+//	backoff="100ms"
+//	maxBackoff="1s"
+//	retryableCodes=["Unavailable","DeadlineExceeded"]
+//	breaker=true
+//	breakerWindow="10s"       # 按 10 秒内的失败率熔断，不设置时按连续失败次数
+//	breakerMinRequests=20
+//	breakerFailureRate=0.5
+func GrpcClientConfigByConf(target string) *MsGrpcClientConfig {
+	c := DefaultGrpcClientConfig()
+	m, ok := config.GetToml().Grpc[target].(map[string]any)
+	if !ok {
+		return c // 没有配置时使用默认配置
+	}
+	if v, ok := m["address"].(string); ok {
+		c.Address = v
+	}
+	if v, ok := m["block"].(bool); ok {
+		c.Block = v
+	}
+	if v, ok := confDuration(m["dialTimeout"]); ok {
+		c.DialTimeout = v
+	}
+	if v, ok := confDuration(m["timeout"]); ok {
+		c.ReadTimeout = v
+	}
+	if v, ok := m["maxAttempts"].(int64); ok {
+		retry := DefaultGrpcRetryPolicy()
+		retry.MaxAttempts = int(v)
+		if v, ok := confDuration(m["backoff"]); ok {
+			retry.Backoff = v
+		}
+		if v, ok := confDuration(m["maxBackoff"]); ok {
+			retry.MaxBackoff = v
+		}
+		if v, ok := m["retryableCodes"].([]any); ok {
+			retry.RetryableCodes = retry.RetryableCodes[:0]
+			for _, name := range v {
+				if code, ok := grpcCode(name); ok {
+					retry.RetryableCodes = append(retry.RetryableCodes, code)
+				}
+			}
+		}
+		c.Retry = retry
+	}
+	if v, ok := m["breaker"].(bool); ok && v {
+		c.Breaker = &breaker.Settings{Name: target}
+		if v, ok := confDuration(m["breakerTimeout"]); ok {
+			c.Breaker.Timeout = v
+		}
+		if v, ok := confDuration(m["breakerWindow"]); ok {
+			c.Breaker.Window = v // 按失败率熔断
+		}
+		if v, ok := m["breakerMinRequests"].(int64); ok {
+			c.Breaker.MinRequests = uint32(v)
+		}
+		if v, ok := m["breakerFailureRate"].(float64); ok {
+			c.Breaker.FailureRate = v
+		}
+	}
+	return c
+}
+
+// confDuration 解析配置中的时间，支持 "2s" 这样的字符串或毫秒整数
+func confDuration(v any) (time.Duration, bool) {
+	switch d := v.(type) {
+	case string:
+		duration, err := time.ParseDuration(d)
+		return duration, err == nil
+	case int64:
+		return time.Duration(d) * time.Millisecond, true
+	}
+	return 0, false
+}
+
+// grpcCode 将配置中的状态码名称（如 "Unavailable" 或 "UNAVAILABLE"）转换为 codes.Code
+func grpcCode(v any) (codes.Code, bool) {
+	name, ok := v.(string)
+	if !ok {
+		return 0, false
+	}
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		if strings.EqualFold(strings.ReplaceAll(c.String(), "_", ""), strings.ReplaceAll(name, "_", "")) {
+			return c, true
+		}
+	}
+	return 0, false
+}
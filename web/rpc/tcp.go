@@ -9,19 +9,25 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	myLog "github.com/ygb616/web/log"
 	"github.com/ygb616/web/register"
 	"golang.org/x/time/rate"
 	"google.golang.org/protobuf/types/known/structpb"
 	"io"
-	"log"
 	"net"
 	"reflect"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"google.golang.org/protobuf/proto"
 )
 
+// rpcLog rpc 模块的 Logger，级别可以用 myLog.SetModuleLevel("rpc", level) 单独修改
+func rpcLog() *myLog.Logger {
+	return myLog.Module("rpc")
+}
+
 //TCP 客户端 服务端
 //客户端 1. 连接服务端 2. 发送请求数据 （编码） 二进制 通过网络发送 3. 等待回复 接收到响应（解码）
 //服务端 1. 启动服务 2. 接收请求 （解码），根据请求 调用对应的服务 得到响应数据 3. 将响应数据发送给客户端（编码）
@@ -186,11 +192,13 @@ type MsTcpServer struct {
 	port           int                 // 端口号
 	listen         net.Listener        // 网络监听器
 	serviceMap     map[string]any      // 服务映射表
+	registered     []string            // 已注册到注册中心的服务名称
 	RegisterType   string              // 注册类型
 	RegisterOption register.Option     // 注册选项
-	RegisterCli    register.MsRegister // 注册客户端
+	RegisterCli    register.MsRegister // 注册客户端，未初始化时在第一次注册服务时初始化
 	LimiterTimeOut time.Duration       // 限流超时时间
 	Limiter        *rate.Limiter       // 限流器
+	registerReady  bool                // RegisterCli 是否已经调用过 CreateCli
 }
 
 // NewTcpServer 函数创建新的 TCP 服务器
@@ -219,14 +227,31 @@ func (s *MsTcpServer) Register(name string, service interface{}) {
 	}
 	s.serviceMap[name] = service // 将服务添加到服务映射表
 
-	err := s.RegisterCli.CreateCli(s.RegisterOption) // 创建注册客户端
-	if err != nil {                                  // 如果创建失败
-		panic(err) // 抛出错误
+	if !s.registerReady {
+		if err := s.RegisterCli.CreateCli(s.RegisterOption); err != nil { // 初始化直接设置的注册客户端
+			panic(err) // 抛出错误
+		}
+		s.registerReady = true
 	}
-	err = s.RegisterCli.RegisterService(name, s.host, s.port) // 注册服务
-	if err != nil {                                           // 如果注册失败
+	err := s.RegisterCli.RegisterService(name, s.host, s.port) // 注册服务
+	if err != nil {                                            // 如果注册失败
 		panic(err) // 抛出错误
 	}
+	s.registered = append(s.registered, name) // 记录已注册的服务，停止时注销
+}
+
+// Deregister 方法从注册中心注销所有已注册的服务
+func (s *MsTcpServer) Deregister() {
+	if s.RegisterCli == nil {
+		return
+	}
+	for _, name := range s.registered {
+		err := s.RegisterCli.DeregisterService(name, s.host, s.port) // 注销服务
+		if err != nil {
+			rpcLog().Error(err) // 打印错误日志
+		}
+	}
+	s.registered = nil
 }
 
 // MsTcpConn 定义了 TCP 连接结构体
@@ -264,7 +289,9 @@ func (c MsTcpConn) Send(rsp *MsRpcResponse) error {
 		marshal, _ := json.Marshal(rsp.Data)
 		_ = json.Unmarshal(marshal, &m)
 		value, err := structpb.NewStruct(m)
-		log.Println(err)
+		if err != nil {
+			rpcLog().Error(err)
+		}
 		pRsp.Data = structpb.NewStructValue(value)
 		body, err = se.Serialize(pRsp)
 	} else { // 否则使用默认序列化
@@ -292,11 +319,15 @@ func (c MsTcpConn) Send(rsp *MsRpcResponse) error {
 	return nil // 返回 nil 表示成功
 }
 
-// Stop 方法用于停止 TCP 服务器
+// Stop 方法用于停止 TCP 服务器，先从注册中心注销再关闭监听器
 func (s *MsTcpServer) Stop() {
+	s.Deregister() // 注销服务，避免新的请求被路由到正在停止的实例
+	if s.RegisterCli != nil {
+		_ = s.RegisterCli.Close() // 关闭注册中心客户端
+	}
 	err := s.listen.Close() // 关闭监听器
 	if err != nil {         // 如果关闭监听器时发生错误
-		log.Println(err) // 打印错误日志
+		rpcLog().Error(err) // 打印错误日志
 	}
 }
 
@@ -305,8 +336,8 @@ func (s *MsTcpServer) Run() {
 	for {
 		conn, err := s.listen.Accept() // 接受新的连接
 		if err != nil {                // 如果接受连接时发生错误
-			log.Println(err) // 打印错误日志
-			continue         // 继续接受下一个连接
+			rpcLog().Error(err) // 打印错误日志
+			continue            // 继续接受下一个连接
 		}
 		msConn := &MsTcpConn{conn: conn, rspChan: make(chan *MsRpcResponse, 1)} // 创建新的 MsTcpConn 实例
 		// 1. 一直接收数据 解码工作 请求业务获取结果 发送到rspChan
@@ -320,8 +351,8 @@ func (s *MsTcpServer) Run() {
 func (s *MsTcpServer) readHandle(conn *MsTcpConn) {
 	defer func() {
 		if err := recover(); err != nil {
-			log.Println("readHandle recover ", err) // 打印恢复的错误日志
-			conn.conn.Close()                       // 关闭连接
+			rpcLog().Error(fmt.Sprint("readHandle recover ", err)) // 打印恢复的错误日志
+			conn.conn.Close()                                      // 关闭连接
 		}
 	}()
 	// 在这加一个限流
@@ -449,21 +480,21 @@ func (s *MsTcpServer) writeHandle(conn *MsTcpConn) {
 		// 发送数据
 		err := conn.Send(rsp) // 发送响应
 		if err != nil {
-			log.Println(err) // 打印错误日志
+			rpcLog().Error(err) // 打印错误日志
 		}
 	}
 }
 
-// SetRegister 方法设置注册类型和选项
+// SetRegister 方法设置注册类型和选项，注册类型通过 register.Register 注册
 func (s *MsTcpServer) SetRegister(registerType string, option register.Option) {
-	s.RegisterType = registerType // 设置注册类型
-	s.RegisterOption = option     // 设置注册选项
-	if registerType == "nacos" {  // 如果注册类型是 nacos
-		s.RegisterCli = &register.MsNacosRegister{} // 设置注册客户端为 MsNacosRegister
-	}
-	if registerType == "etcd" { // 如果注册类型是 etcd
-		s.RegisterCli = &register.MsEtcdRegister{} // 设置注册客户端为 MsEtcdRegister
+	s.RegisterType = registerType                  // 设置注册类型
+	s.RegisterOption = option                      // 设置注册选项
+	cli, err := register.New(registerType, option) // 创建并初始化注册客户端
+	if err != nil {                                // 如果创建失败
+		panic(err) // 抛出错误
 	}
+	s.RegisterCli = cli
+	s.registerReady = true
 }
 
 // decodeFrame 函数解码消息帧
@@ -587,10 +618,11 @@ type MsRpcClient interface {
 
 // MsTcpClient 结构体定义了 TCP 客户端
 type MsTcpClient struct {
-	conn        net.Conn            // 网络连接
-	option      TcpClientOption     // 客户端选项
-	ServiceName string              // 服务名称
-	RegisterCli register.MsRegister // 注册客户端
+	conn          net.Conn            // 网络连接
+	option        TcpClientOption     // 客户端选项
+	ServiceName   string              // 服务名称
+	RegisterCli   register.MsRegister // 注册客户端，未初始化时在 Connect 中初始化
+	registerReady bool                // RegisterCli 是否已经调用过 CreateCli
 }
 
 // TcpClientOption 结构体定义了 TCP 客户端的选项
@@ -621,15 +653,25 @@ func NewTcpClient(option TcpClientOption) *MsTcpClient {
 	return &MsTcpClient{option: option} // 返回新的 MsTcpClient 实例
 }
 
-// Connect 方法用于连接到 RPC 服务器
+// Connect 方法用于连接到 RPC 服务器。RegisterCli 为空时按 RegisterType 创建注册客户端；
+// 直接设置的未初始化客户端（如 &register.MsEtcdRegister{}）先用 RegisterOption 调用 CreateCli
 func (c *MsTcpClient) Connect() error {
-	var addr string
-	err := c.RegisterCli.CreateCli(c.option.RegisterOption) // 创建注册客户端
-	if err != nil {                                         // 如果创建注册客户端时发生错误
-		panic(err) // 抛出错误
+	if c.RegisterCli == nil {
+		cli, err := register.New(c.option.RegisterType, c.option.RegisterOption) // 创建注册客户端
+		if err != nil {                                                          // 如果创建注册客户端时发生错误
+			return err // 返回错误
+		}
+		c.RegisterCli = cli
+		c.registerReady = true
 	}
-	addr, err = c.RegisterCli.GetValue(c.ServiceName) // 获取服务地址
-	if err != nil {                                   // 如果获取服务地址时发生错误
+	if !c.registerReady {
+		if err := c.RegisterCli.CreateCli(c.option.RegisterOption); err != nil { // 初始化直接设置的注册客户端
+			return err // 返回错误
+		}
+		c.registerReady = true
+	}
+	addr, err := c.RegisterCli.GetValue(c.ServiceName) // 获取服务地址
+	if err != nil {                                    // 如果获取服务地址时发生错误
 		panic(err) // 抛出错误
 	}
 	conn, err := net.DialTimeout("tcp", addr, c.option.ConnectionTimeout) // 连接到 RPC 服务器
@@ -726,15 +768,15 @@ func (c *MsTcpClient) Invoke(ctx context.Context, serviceName string, methodName
 func (c *MsTcpClient) readHandle(rspChan chan *MsRpcResponse) {
 	defer func() {
 		if err := recover(); err != nil {
-			log.Println("MsTcpClient readHandle recover: ", err) // 打印恢复的错误日志
-			c.conn.Close()                                       // 关闭连接
+			rpcLog().Error(fmt.Sprint("MsTcpClient readHandle recover: ", err)) // 打印恢复的错误日志
+			c.conn.Close()                                                      // 关闭连接
 		}
 	}()
 
 	for {
 		msg, err := decodeFrame(c.conn) // 解码消息
 		if err != nil {
-			log.Println("未解析出任何数据") // 打印错误日志
+			rpcLog().Error("未解析出任何数据") // 打印错误日志
 			rsp := &MsRpcResponse{}
 			rsp.Code = 500        // 错误代码
 			rsp.Msg = err.Error() // 错误信息
@@ -834,8 +876,10 @@ func (c *MsTcpClient) decodeFrame(conn net.Conn) (*MsRpcMessage, error) {
 
 // MsTcpClientProxy 结构体定义了 TCP 客户端代理
 type MsTcpClientProxy struct {
-	client *MsTcpClient    // TCP 客户端
-	option TcpClientOption // 客户端选项
+	client      *MsTcpClient        // TCP 客户端
+	option      TcpClientOption     // 客户端选项
+	mu          sync.Mutex          // 保护 registerCli
+	registerCli register.MsRegister // 注册客户端，所有调用共用，避免每次调用都创建
 }
 
 // NewMsTcpClientProxy 函数创建新的 MsTcpClientProxy 实例
@@ -845,26 +889,27 @@ func NewMsTcpClientProxy(option TcpClientOption) *MsTcpClientProxy {
 
 // Call 方法用于调用远程服务
 func (p *MsTcpClientProxy) Call(ctx context.Context, serviceName string, methodName string, args []any) (any, error) {
-	client := NewTcpClient(p.option)      // 创建新的 TCP 客户端
-	client.ServiceName = serviceName      // 设置服务名称
-	if p.option.RegisterType == "nacos" { // 如果注册类型是 nacos
-		client.RegisterCli = &register.MsNacosRegister{} // 设置注册客户端为 MsNacosRegister
-	}
-	if p.option.RegisterType == "etcd" { // 如果注册类型是 etcd
-		client.RegisterCli = &register.MsEtcdRegister{} // 设置注册客户端为 MsEtcdRegister
-	}
-	p.client = client       // 设置代理的客户端
-	err := client.Connect() // 连接到服务
-	if err != nil {         // 如果连接时发生错误
+	client := NewTcpClient(p.option)       // 创建新的 TCP 客户端
+	client.ServiceName = serviceName       // 设置服务名称
+	registerCli, err := p.getRegisterCli() // 获取注册客户端
+	if err != nil {
+		return nil, err
+	}
+	client.RegisterCli = registerCli
+	// 代理共用的注册客户端已经初始化
+	client.registerReady = true
+	p.client = client      // 设置代理的客户端
+	err = client.Connect() // 连接到服务
+	if err != nil {        // 如果连接时发生错误
 		return nil, err // 返回错误
 	}
 	for i := 0; i < p.option.Retries; i++ { // 重试指定次数
 		result, err := client.Invoke(ctx, serviceName, methodName, args) // 调用远程方法
 		if err != nil {                                                  // 如果调用时发生错误
 			if i >= p.option.Retries-1 { // 如果已达到最大重试次数
-				log.Println(errors.New("already retry all time")) // 打印重试结束的错误日志
-				client.Close()                                    // 关闭客户端连接
-				return nil, err                                   // 返回错误
+				rpcLog().Error(errors.New("already retry all time")) // 打印重试结束的错误日志
+				client.Close()                                       // 关闭客户端连接
+				return nil, err                                      // 返回错误
 			}
 			// 睡眠一小会（可以在此添加实际的睡眠代码，例如 time.Sleep）
 			continue // 继续重试
@@ -874,3 +919,17 @@ func (p *MsTcpClientProxy) Call(ctx context.Context, serviceName string, methodN
 	}
 	return nil, errors.New("retry time is 0") // 如果重试次数为0，返回错误
 }
+
+// getRegisterCli 返回注册客户端，第一次调用时根据注册类型创建
+func (p *MsTcpClientProxy) getRegisterCli() (register.MsRegister, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.registerCli == nil {
+		cli, err := register.New(p.option.RegisterType, p.option.RegisterOption)
+		if err != nil {
+			return nil, err
+		}
+		p.registerCli = cli
+	}
+	return p.registerCli, nil
+}
@@ -0,0 +1,119 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ServerGroup 在一个进程中同时运行多个服务，统一处理信号和优雅关闭，如：
+//
+//	var g web.ServerGroup
+//	g.Add(api, ":8080")    // 对外接口
+//	g.Add(admin, ":8081")  // 管理接口，如 LogLevelAdmin、健康检查
+//	g.Add(api, ":8443")    // 同一个 Engine 也可以在多个端口上运行
+//	err := g.Run(30 * time.Second)
+type ServerGroup struct {
+	mu      sync.Mutex
+	entries []serverEntry
+}
+
+type serverEntry struct {
+	engine *Engine
+	srv    *http.Server
+}
+
+// Add 添加在 addr 上运行的 e，见 AddServer
+func (g *ServerGroup) Add(e *Engine, addr string) *http.Server {
+	srv := &http.Server{Addr: addr, Handler: e}
+	g.AddServer(e, srv)
+	return srv
+}
+
+// AddServer 添加使用 srv 运行的 e，可以设置超时、TLS 等，见 Engine.RunServer
+func (g *ServerGroup) AddServer(e *Engine, srv *http.Server) {
+	if srv.Handler == nil {
+		srv.Handler = e
+	}
+	// 先保存到 Engine 中，还没有启动时调用 Shutdown 也能关闭
+	e.setServer(srv)
+	g.mu.Lock()
+	g.entries = append(g.entries, serverEntry{engine: e, srv: srv})
+	g.mu.Unlock()
+}
+
+// Run 同时启动所有服务并阻塞，收到 SIGINT、SIGTERM，某个服务监听失败，或调用 Shutdown 后关闭所有服务，
+// 最多等待 timeout（小于等于 0 时为 DefaultShutdownTimeout）让正在处理的请求结束。
+// 所有服务都退出后返回：有服务监听失败时返回监听的错误，否则返回 Shutdown 的错误
+func (g *ServerGroup) Run(timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	g.mu.Lock()
+	entries := append([]serverEntry(nil), g.entries...)
+	g.mu.Unlock()
+	errCh := make(chan error, len(entries))
+	for _, entry := range entries {
+		go func(entry serverEntry) {
+			errCh <- entry.engine.RunServer(entry.srv)
+		}(entry)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var runErr error
+	received := 0
+	select {
+	case runErr = <-errCh:
+		received++ // 监听失败或已经调用了 Shutdown
+	case <-ctx.Done():
+	}
+	stop() // 再次收到信号时按默认行为直接退出
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := g.Shutdown(shutdownCtx)
+	for ; received < len(entries); received++ {
+		if e := <-errCh; e != nil && runErr == nil {
+			runErr = e
+		}
+	}
+	if runErr != nil {
+		return runErr
+	}
+	return err
+}
+
+// Shutdown 同时关闭所有的 Engine，见 Engine.Shutdown，返回第一个错误
+func (g *ServerGroup) Shutdown(ctx context.Context) error {
+	g.mu.Lock()
+	engines := make([]*Engine, 0, len(g.entries))
+	seen := make(map[*Engine]bool)
+	for _, entry := range g.entries {
+		if !seen[entry.engine] {
+			seen[entry.engine] = true
+			engines = append(engines, entry.engine)
+		}
+	}
+	g.mu.Unlock()
+	errs := make([]error, len(engines))
+	var wg sync.WaitGroup
+	for i, e := range engines {
+		wg.Add(1)
+		go func(i int, e *Engine) {
+			defer wg.Done()
+			errs[i] = e.Shutdown(ctx)
+		}(i, e)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ygb616/web/pool"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultShutdownTimeout RunWithGracefulShutdown 等待请求处理完的默认时间
+const DefaultShutdownTimeout = 30 * time.Second
+
+// newServer 创建并保存 http.Server
+func (e *Engine) newServer(addr string, handler http.Handler) *http.Server {
+	srv := &http.Server{Addr: addr, Handler: handler}
+	e.setServer(srv)
+	return srv
+}
+
+// setServer 保存启动的服务，同一个 Engine 可以在多个端口上启动，Shutdown 时全部关闭
+func (e *Engine) setServer(srv *http.Server) {
+	e.serverMu.Lock()
+	defer e.serverMu.Unlock()
+	for _, s := range e.servers {
+		if s == srv {
+			return
+		}
+	}
+	e.servers = append(e.servers, srv)
+}
+
+// RunServer 使用 srv 启动服务，可以设置超时和限制，如：
+//
+//	err := engine.RunServer(&http.Server{
+//		Addr:           ":8080",
+//		ReadTimeout:    10 * time.Second,
+//		WriteTimeout:   30 * time.Second,
+//		IdleTimeout:    120 * time.Second,
+//		MaxHeaderBytes: 1 << 20,
+//	})
+//
+// srv.Handler 为空时设置为 Engine；srv.TLSConfig 中有证书（Certificates 或 GetCertificate）时启动 HTTPS，
+// 否则 EnableH2C 为 true 时同时支持 h2c。
+// 与 Run 不同，监听失败时返回错误，不退出进程；调用 Shutdown 关闭后返回 nil
+func (e *Engine) RunServer(srv *http.Server) error {
+	return e.serve(srv, nil)
+}
+
+// RunListener 在 l 上启动服务，如 systemd socket activation 传入的监听：
+//
+//	f := os.NewFile(3, "listener") // LISTEN_FDS 的第一个
+//	l, _ := net.FileListener(f)
+//	err := engine.RunListener(l)
+//
+// 监听的关闭由 Shutdown 完成，其他与 RunServer 相同
+func (e *Engine) RunListener(l net.Listener) error {
+	return e.serve(&http.Server{Handler: e}, l)
+}
+
+// RunUnix 在 unix domain socket 上启动服务，如 nginx 的 proxy_pass http://unix:/run/app.sock。
+// path 已经存在且是 socket 时先删除（上次异常退出留下的），不是 socket 时返回错误；
+// 关闭后删除 socket 文件。需要其他用户（如 nginx）访问时自行修改文件的权限或所在目录的权限
+func (e *Engine) RunUnix(path string) error {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	return e.RunListener(l)
+}
+
+// serve 启动 srv，l 不为 nil 时在 l 上启动，否则监听 srv.Addr
+func (e *Engine) serve(srv *http.Server, l net.Listener) error {
+	if srv.Handler == nil {
+		srv.Handler = e
+	}
+	useTLS := srv.TLSConfig != nil && (len(srv.TLSConfig.Certificates) > 0 || srv.TLSConfig.GetCertificate != nil)
+	if e.EnableH2C && !useTLS {
+		if err := enableH2C(srv); err != nil {
+			return err
+		}
+	}
+	e.setServer(srv)
+	e.printRoutes()
+	var err error
+	switch {
+	case l != nil && useTLS:
+		err = srv.ServeTLS(l, "", "")
+	case l != nil:
+		err = srv.Serve(l)
+	case useTLS:
+		err = srv.ListenAndServeTLS("", "")
+	default:
+		err = srv.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Server 返回 Run、RunTLS 等最后启动的 http.Server，还没有启动时返回 nil
+func (e *Engine) Server() *http.Server {
+	e.serverMu.Lock()
+	defer e.serverMu.Unlock()
+	if len(e.servers) == 0 {
+		return nil
+	}
+	return e.servers[len(e.servers)-1]
+}
+
+// Servers 返回所有启动的 http.Server，按启动的顺序
+func (e *Engine) Servers() []*http.Server {
+	e.serverMu.Lock()
+	defer e.serverMu.Unlock()
+	return append([]*http.Server(nil), e.servers...)
+}
+
+// Shutdown 优雅关闭服务，依次：
+//
+//  1. 从注册中心注销，网关和客户端不再把新请求路由到该实例
+//  2. 关闭所有端口的监听，等待正在处理的请求结束（http.Server.Shutdown）
+//  3. 释放处理请求的协程池（WithHandlerPool）和 pool.DefaultManager 中的 pool，等待其中的任务执行完
+//  4. 关闭网关转发的空闲连接，写完剩下的日志并关闭日志文件
+//
+// ctx 结束时不再等待，返回 ctx 的错误，后面的步骤仍然执行；各步骤的错误记录日志，返回第一个错误
+func (e *Engine) Shutdown(ctx context.Context) error {
+	var first error
+	record := func(err error) {
+		if err == nil {
+			return
+		}
+		e.Logger.Error(err)
+		if first == nil {
+			first = err
+		}
+	}
+	e.Deregister()
+	servers := e.Servers()
+	errs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, srv := range servers {
+		wg.Add(1)
+		go func(i int, srv *http.Server) {
+			defer wg.Done()
+			errs[i] = srv.Shutdown(ctx)
+		}(i, srv)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		record(err)
+	}
+	timeout := DefaultShutdownTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	if e.handlerPool != nil {
+		record(e.handlerPool.ReleaseTimeout(timeout))
+	}
+	record(pool.ReleaseAll(timeout))
+	if e.gatewayTransport != nil {
+		e.gatewayTransport.CloseIdleConnections()
+	}
+	if err := e.Logger.Close(); err != nil && first == nil {
+		first = err // 日志已经关闭，不再记录
+	}
+	return first
+}
+
+// RunWithGracefulShutdown 与 Run 相同，收到 SIGINT、SIGTERM 后调用 Shutdown，
+// 最多等待 timeout（小于等于 0 时为 DefaultShutdownTimeout）让正在处理的请求结束。
+// 监听失败时返回错误；正常关闭后返回 Shutdown 的错误
+func (e *Engine) RunWithGracefulShutdown(port int, timeout time.Duration) error {
+	return e.RunServerWithGracefulShutdown(&http.Server{Addr: ":" + strconv.Itoa(port)}, timeout)
+}
+
+// enableH2C 让 srv 支持不加密的 HTTP/2：客户端直接发送 HTTP/2 前言（prior knowledge，如 gRPC 客户端），
+// 或者通过 HTTP/1.1 的 Upgrade: h2c 升级；其他请求仍按 HTTP/1.1 处理。
+// http2.ConfigureServer 让 Shutdown 时 HTTP/2 连接也能发送 GOAWAY 优雅关闭
+func enableH2C(srv *http.Server) error {
+	h2s := &http2.Server{IdleTimeout: srv.IdleTimeout}
+	if err := http2.ConfigureServer(srv, h2s); err != nil {
+		return err
+	}
+	srv.Handler = h2c.NewHandler(srv.Handler, h2s)
+	return nil
+}
+
+// RunServerWithGracefulShutdown 与 RunWithGracefulShutdown 相同，使用 srv 启动服务，见 RunServer
+func (e *Engine) RunServerWithGracefulShutdown(srv *http.Server, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- e.RunServer(srv)
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	select {
+	case err := <-errCh:
+		return err // 监听失败，或其他地方调用了 Shutdown
+	case <-ctx.Done():
+	}
+	stop() // 再次收到信号时按默认行为直接退出
+	e.Logger.Info("shutting down, waiting for active requests")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return e.Shutdown(shutdownCtx)
+}
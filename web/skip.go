@@ -0,0 +1,35 @@
+package web
+
+import (
+	"path"
+	"strings"
+)
+
+// SkipRequest 判断中间件是否跳过请求，用于在需要认证的路由组中放行 /login、/healthz、静态资源等公开路由：
+// 请求路径匹配 paths 中任意一个，或 skip 返回 true 时跳过。
+// paths 支持精确路径、以 /* 结尾的前缀（/static/* 匹配 /static/ 下的所有路径）和 path.Match 的通配符
+func SkipRequest(ctx *Context, paths []string, skip func(ctx *Context) bool) bool {
+	if skip != nil && skip(ctx) {
+		return true
+	}
+	return MatchPaths(ctx.R.URL.Path, paths)
+}
+
+// MatchPaths 判断 p 是否匹配 patterns 中任意一个，规则同 SkipRequest
+func MatchPaths(p string, patterns []string) bool {
+	for _, pattern := range patterns {
+		switch {
+		case strings.HasSuffix(pattern, "/*"):
+			if strings.HasPrefix(p, pattern[:len(pattern)-1]) {
+				return true
+			}
+		case strings.ContainsAny(pattern, "*?["):
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+		case pattern == p:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package web
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"os"
+)
+
+// ServerTLS 服务端的 TLS 配置，配置 ClientCAFile 后要求客户端证书（mTLS），用于内部服务之间的调用：
+//
+//	conf, err := (&web.ServerTLS{CertFile: "server.pem", KeyFile: "server.key", ClientCAFile: "ca.pem"}).ServerConfig()
+//	err = engine.RunTLSConfig(":8443", conf)
+type ServerTLS struct {
+	CertFile     string             // 服务端证书
+	KeyFile      string             // 服务端私钥
+	ClientCAFile string             // 校验客户端证书的 CA，配置后默认要求并校验客户端证书
+	ClientAuth   tls.ClientAuthType // 客户端证书的要求，默认配置 ClientCAFile 时为 tls.RequireAndVerifyClientCert
+	MinVersion   uint16             // 最低的 TLS 版本，默认 TLS 1.2
+	CipherSuites []uint16           // TLS 1.2 使用的加密套件，为空时使用 Go 的默认值
+}
+
+// ServerConfig 根据配置生成 tls.Config
+func (t *ServerTLS) ServerConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:   t.MinVersion,
+		CipherSuites: t.CipherSuites,
+		ClientAuth:   t.ClientAuth,
+	}
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	config.Certificates = []tls.Certificate{cert}
+	if t.ClientCAFile != "" {
+		pem, err := os.ReadFile(t.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("web: no certificates found in " + t.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		if config.ClientAuth == tls.NoClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return config, nil
+}
+
+// RunTLSConfig 使用 config 在 addr 上启动 HTTPS，可以设置客户端 CA、最低版本、加密套件等，
+// config 中需要有证书（Certificates 或 GetCertificate），见 ServerTLS。
+// 客户端证书可以从 ctx.R.TLS.PeerCertificates 读取；监听失败时返回错误，调用 Shutdown 关闭后返回 nil
+func (e *Engine) RunTLSConfig(addr string, config *tls.Config) error {
+	if config == nil || len(config.Certificates) == 0 && config.GetCertificate == nil {
+		return errors.New("web: tls config has no certificate")
+	}
+	return e.RunServer(&http.Server{Addr: addr, Handler: e, TLSConfig: config})
+}
@@ -0,0 +1,185 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/ygb616/web"
+	"net/http"
+	"strings"
+)
+
+// ErrForbidden 已经认证但没有需要的角色或权限
+var ErrForbidden = errors.New("token: forbidden")
+
+// PermissionResolver 根据 claims 获取用户的权限，如从数据库、缓存中按用户查询
+type PermissionResolver interface {
+	Permissions(ctx *web.Context, claims jwt.MapClaims) ([]string, error)
+}
+
+// PermissionResolverFunc 函数形式的 PermissionResolver
+type PermissionResolverFunc func(ctx *web.Context, claims jwt.MapClaims) ([]string, error)
+
+func (f PermissionResolverFunc) Permissions(ctx *web.Context, claims jwt.MapClaims) ([]string, error) {
+	return f(ctx, claims)
+}
+
+// ClaimPermissions 从 claims 中读取权限，claim 的值为字符串数组或逗号分隔的字符串
+func ClaimPermissions(claim string) PermissionResolver {
+	return PermissionResolverFunc(func(_ *web.Context, claims jwt.MapClaims) ([]string, error) {
+		return claimStrings(claims[claim]), nil
+	})
+}
+
+// RolePermissions 按角色映射权限，用户的权限为所有角色的权限之和
+func RolePermissions(roleClaim string, permissions map[string][]string) PermissionResolver {
+	return PermissionResolverFunc(func(_ *web.Context, claims jwt.MapClaims) ([]string, error) {
+		var perms []string
+		for _, role := range claimStrings(claims[roleClaim]) {
+			perms = append(perms, permissions[role]...)
+		}
+		return perms, nil
+	})
+}
+
+// Authorizer 基于 jwt claims 的路由级授权，需要放在 AuthInterceptor 或 GatewayInterceptor 之后
+type Authorizer struct {
+	// RoleClaim 角色所在的 claim，默认 roles
+	RoleClaim string
+	// Resolver 获取用户的权限，默认从 permissions claim 中读取
+	Resolver PermissionResolver
+	// ErrorHandler 授权失败的处理函数，默认没有 claims 时返回 401，没有权限时返回 403
+	ErrorHandler func(ctx *web.Context, err error)
+}
+
+// DefaultAuthorizer 默认的 Authorizer，RequireRoles、RequirePermissions 使用
+var DefaultAuthorizer = &Authorizer{}
+
+// RequireRoles 使用 DefaultAuthorizer 要求用户具有 roles 中的任意一个角色
+func RequireRoles(roles ...string) web.MiddlewareFunc {
+	return DefaultAuthorizer.RequireRoles(roles...)
+}
+
+// RequirePermissions 使用 DefaultAuthorizer 要求用户具有 perms 中的所有权限
+func RequirePermissions(perms ...string) web.MiddlewareFunc {
+	return DefaultAuthorizer.RequirePermissions(perms...)
+}
+
+// RequireRoles 要求用户具有 roles 中的任意一个角色，如：
+//
+//	g.Use(jwt.AuthInterceptor, token.RequireRoles("admin"))
+func (a *Authorizer) RequireRoles(roles ...string) web.MiddlewareFunc {
+	return func(next web.HandlerFunc) web.HandlerFunc {
+		return func(ctx *web.Context) {
+			claims, ok := Claims(ctx)
+			if !ok {
+				a.fail(ctx, ErrNoClaims)
+				return
+			}
+			if !containsAny(claimStrings(claims[a.roleClaim()]), roles) {
+				a.fail(ctx, fmt.Errorf("%w: requires role %s", ErrForbidden, strings.Join(roles, "|")))
+				return
+			}
+			next(ctx)
+		}
+	}
+}
+
+// RequirePermissions 要求用户具有 perms 中的所有权限，用户的权限 * 表示拥有所有权限，
+// 以 :* 结尾表示拥有该前缀下的所有权限，如 order:* 包含 order:read
+func (a *Authorizer) RequirePermissions(perms ...string) web.MiddlewareFunc {
+	return func(next web.HandlerFunc) web.HandlerFunc {
+		return func(ctx *web.Context) {
+			claims, ok := Claims(ctx)
+			if !ok {
+				a.fail(ctx, ErrNoClaims)
+				return
+			}
+			granted, err := a.resolver().Permissions(ctx, claims)
+			if err != nil {
+				a.fail(ctx, err)
+				return
+			}
+			for _, perm := range perms {
+				if !hasPermission(granted, perm) {
+					a.fail(ctx, fmt.Errorf("%w: requires permission %s", ErrForbidden, perm))
+					return
+				}
+			}
+			next(ctx)
+		}
+	}
+}
+
+func (a *Authorizer) roleClaim() string {
+	if a.RoleClaim == "" {
+		return "roles"
+	}
+	return a.RoleClaim
+}
+
+func (a *Authorizer) resolver() PermissionResolver {
+	if a.Resolver == nil {
+		return ClaimPermissions("permissions")
+	}
+	return a.Resolver
+}
+
+func (a *Authorizer) fail(ctx *web.Context, err error) {
+	if a.ErrorHandler != nil {
+		a.ErrorHandler(ctx, err)
+		return
+	}
+	switch {
+	case errors.Is(err, ErrNoClaims):
+		ctx.W.WriteHeader(http.StatusUnauthorized)
+	case errors.Is(err, ErrForbidden):
+		ctx.W.WriteHeader(http.StatusForbidden)
+	default:
+		ctx.W.WriteHeader(http.StatusInternalServerError) // 查询权限失败
+	}
+}
+
+// claimStrings 将 claim 转为字符串数组，支持数组和逗号分隔的字符串
+func claimStrings(value any) []string {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return nil
+		}
+		return strings.Split(v, ",")
+	case []string:
+		return v
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, claimValue(item))
+		}
+		return values
+	}
+	return nil
+}
+
+func containsAny(values, wanted []string) bool {
+	for _, v := range values {
+		for _, w := range wanted {
+			if strings.TrimSpace(v) == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasPermission(granted []string, perm string) bool {
+	for _, g := range granted {
+		g = strings.TrimSpace(g)
+		if g == perm || g == "*" {
+			return true
+		}
+		if strings.HasSuffix(g, ":*") && strings.HasPrefix(perm, g[:len(g)-1]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package token
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/ygb616/web"
+	"github.com/ygb616/web/binding"
+	"reflect"
+)
+
+// ClaimsKey AuthInterceptor、GatewayInterceptor 把解析出的 claims 保存到上下文中使用的 key
+const ClaimsKey = "jwt_claims"
+
+// ErrNoClaims 上下文中没有 claims，请求没有经过 AuthInterceptor 或 GatewayInterceptor
+var ErrNoClaims = errors.New("token: no jwt claims in context")
+
+// Claims 返回上下文中的 jwt.MapClaims
+func Claims(ctx *web.Context) (jwt.MapClaims, bool) {
+	v, ok := ctx.Get(ClaimsKey)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := v.(jwt.MapClaims)
+	return claims, ok
+}
+
+// ClaimsFromCtx 把上下文中的 claims 按 json 标签映射到 T，T 为结构体时使用 binding.Validator 校验，如：
+//
+//	type UserClaims struct {
+//		UserId int64    `json:"userId" validate:"required"`
+//		Roles  []string `json:"roles"`
+//	}
+//	claims, err := token.ClaimsFromCtx[UserClaims](ctx)
+func ClaimsFromCtx[T any](ctx *web.Context) (*T, error) {
+	claims, ok := Claims(ctx)
+	if !ok {
+		return nil, ErrNoClaims
+	}
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	obj := new(T)
+	if err := json.Unmarshal(data, obj); err != nil {
+		return nil, err
+	}
+	if reflect.TypeOf(obj).Elem().Kind() == reflect.Struct && binding.Validator != nil {
+		if err := binding.Validator.ValidateStruct(obj); err != nil {
+			return nil, err
+		}
+	}
+	return obj, nil
+}
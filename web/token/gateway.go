@@ -0,0 +1,66 @@
+package token
+
+import (
+	"fmt"
+	"github.com/ygb616/web"
+	"strconv"
+	"strings"
+)
+
+// DefaultClaimHeaders 默认转发给后端服务的 claims，claim 名称 -> 请求头
+var DefaultClaimHeaders = map[string]string{
+	"userId": "X-User-Id",
+	"roles":  "X-Roles",
+}
+
+// GatewayInterceptor 网关 jwt 中间件，通过 Engine.GatewayUse 挂到网关路由上：
+// 转发前校验 token，未认证的请求直接拒绝；校验通过后把 claimHeaders 中的 claims 设置为请求头转发给后端，
+// claimHeaders 为 nil 时使用 DefaultClaimHeaders
+func (j *JwtHandler) GatewayInterceptor(claimHeaders map[string]string) web.MiddlewareFunc {
+	if claimHeaders == nil {
+		claimHeaders = DefaultClaimHeaders
+	}
+	return func(next web.HandlerFunc) web.HandlerFunc {
+		return func(ctx *web.Context) {
+			// 删除客户端传入的同名请求头，防止伪造身份
+			for _, header := range claimHeaders {
+				ctx.R.Header.Del(header)
+			}
+			// 公开的路由不需要认证，直接转发
+			if web.SkipRequest(ctx, j.SkipPaths, j.SkipFunc) {
+				next(ctx)
+				return
+			}
+			claims, err := j.parseToken(ctx)
+			if err != nil {
+				j.AuthErrorHandler(ctx, err)
+				return
+			}
+			ctx.Set(ClaimsKey, claims)
+			for claim, header := range claimHeaders {
+				if value, ok := claims[claim]; ok {
+					ctx.R.Header.Set(header, claimValue(value))
+				}
+			}
+			next(ctx)
+		}
+	}
+}
+
+// claimValue 将 claim 转为请求头的值，数组用逗号连接
+func claimValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64) // json 数字解析为 float64，避免输出科学计数法
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, claimValue(item))
+		}
+		return strings.Join(values, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
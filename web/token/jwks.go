@@ -0,0 +1,239 @@
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// jwksMinRefresh 遇到未知 kid 时重新获取 JWKS 的最小间隔，防止伪造的 kid 让每个请求都去访问 JWKS
+const jwksMinRefresh = 10 * time.Second
+
+// jwksOnce 第一次使用时创建 JWKS
+type jwksOnce struct {
+	once  sync.Once
+	cache *JWKS
+}
+
+func (j *JwtHandler) jwksCache() *JWKS {
+	j.jwks.once.Do(func() {
+		j.jwks.cache = NewJWKS(j.JWKSURL, j.JWKSRefresh)
+	})
+	return j.jwks.cache
+}
+
+// JWKS 缓存从 JWKS 地址获取的公钥，超过 ttl 时在后台重新获取，遇到未知的 kid 时重新获取并等待结果；
+// 获取期间继续使用缓存的公钥，同一时间只有一个获取请求
+type JWKS struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	mu       sync.Mutex
+	keys     map[string]any
+	fetched  time.Time
+	inflight *jwksFetch // 正在进行的获取，没有时为 nil
+}
+
+// jwksFetch 一次获取 JWKS 的结果，done 关闭后 err 可读
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// NewJWKS 创建 JWKS，refresh 为缓存时间，默认 1 小时
+func NewJWKS(url string, refresh time.Duration) *JWKS {
+	if refresh <= 0 {
+		refresh = time.Hour
+	}
+	return &JWKS{
+		url:    url,
+		ttl:    refresh,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Keyfunc 按 token 头部的 kid 返回公钥，用于 jwt.Parse，只接受 RSA、ECDSA 签名的 token
+func (c *JWKS) Keyfunc(token *jwt.Token) (any, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+	default:
+		return nil, fmt.Errorf("token: unexpected signing method %s", token.Method.Alg())
+	}
+	kid, _ := token.Header["kid"].(string)
+	return c.Key(kid)
+}
+
+// Key 返回 kid 对应的公钥，token 没有 kid 且 JWKS 中只有一个公钥时使用该公钥
+func (c *JWKS) Key(kid string) (any, error) {
+	c.mu.Lock()
+	keys, fetched := c.keys, c.fetched
+	c.mu.Unlock()
+	now := time.Now()
+	if keys == nil {
+		// 还没有公钥，只能等待获取的结果
+		if err := c.refresh().wait(); err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		keys, fetched = c.keys, c.fetched
+		c.mu.Unlock()
+	} else if now.Sub(fetched) > c.ttl {
+		c.refresh() // 后台获取，获取失败时继续使用之前的公钥
+	}
+	if k, ok := lookup(keys, kid); ok {
+		return k, nil
+	}
+	// 可能已经轮换了密钥，重新获取一次
+	if now.Sub(fetched) >= jwksMinRefresh {
+		if err := c.refresh().wait(); err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		keys = c.keys
+		c.mu.Unlock()
+		if k, ok := lookup(keys, kid); ok {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("token: unknown kid %q", kid)
+}
+
+func lookup(keys map[string]any, kid string) (any, bool) {
+	if kid == "" && len(keys) == 1 {
+		for _, k := range keys {
+			return k, true
+		}
+	}
+	k, ok := keys[kid]
+	return k, ok
+}
+
+// refresh 在后台获取 JWKS，已经在获取时返回正在进行的获取
+func (c *JWKS) refresh() *jwksFetch {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inflight != nil {
+		return c.inflight
+	}
+	f := &jwksFetch{done: make(chan struct{})}
+	c.inflight = f
+	c.fetched = time.Now() // 失败时也记录时间，避免每个请求都重试
+	go func() {
+		keys, err := c.fetch()
+		c.mu.Lock()
+		if err == nil {
+			c.keys = keys
+		}
+		c.inflight = nil
+		c.mu.Unlock()
+		f.err = err
+		close(f.done)
+	}()
+	return f
+}
+
+// wait 等待获取结束
+func (f *jwksFetch) wait() error {
+	<-f.done
+	return f.err
+}
+
+// fetch 请求 JWKS 地址并解析公钥，不持有锁
+func (c *JWKS) fetch() (map[string]any, error) {
+	resp, err := c.client.Get(c.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token: fetch jwks: %s", resp.Status)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use == "enc" {
+			continue // 只使用签名的公钥
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			continue // 跳过不支持的公钥
+		}
+		keys[k.Kid] = pub
+	}
+	return keys, nil
+}
+
+// jwk JWKS 中的一个公钥，支持 RSA 和 EC
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.New("token: unsupported curve " + k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("token: invalid ec key")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, errors.New("token: unsupported kty " + k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,138 @@
+package token
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"strings"
+	"sync"
+)
+
+// jwtKeys 从 PEM 解析出来的签名私钥和验证公钥，第一次使用时解析
+type jwtKeys struct {
+	once   sync.Once
+	sign   crypto.PrivateKey
+	verify crypto.PublicKey
+	err    error
+}
+
+// alg 返回签名算法，没有指定时默认 HS256
+func (j *JwtHandler) alg() string {
+	if j.Alg == "" {
+		return "HS256"
+	}
+	return j.Alg
+}
+
+// 判断是否使用公钥算法
+func (j *JwtHandler) usingPublicKeyAlgo() bool {
+	switch {
+	case strings.HasPrefix(j.alg(), "RS"), strings.HasPrefix(j.alg(), "PS"), strings.HasPrefix(j.alg(), "ES"), j.alg() == "EdDSA":
+		return true // 使用公钥算法
+	}
+	return false // 不使用公钥算法
+}
+
+// parseKeys 解析 PrivateKey、PublicKey，已经设置了 SigningKey、VerifyKey 时不解析；
+// 没有公钥时从私钥中获取
+func (j *JwtHandler) parseKeys() (*jwtKeys, error) {
+	j.keys.once.Do(func() {
+		k := &j.keys
+		k.sign, k.verify = j.SigningKey, j.VerifyKey
+		if k.sign == nil && j.PrivateKey != "" {
+			k.sign, k.err = parsePrivateKey(j.alg(), []byte(j.PrivateKey))
+			if k.err != nil {
+				return
+			}
+		}
+		if k.verify == nil && j.PublicKey != "" {
+			k.verify, k.err = parsePublicKey(j.alg(), []byte(j.PublicKey))
+			if k.err != nil {
+				return
+			}
+		}
+		if k.verify == nil && k.sign != nil {
+			if signer, ok := k.sign.(crypto.Signer); ok {
+				k.verify = signer.Public()
+			}
+		}
+	})
+	return &j.keys, j.keys.err
+}
+
+// signingKey 返回签名使用的密钥，HS 算法为 Key，公钥算法为私钥
+func (j *JwtHandler) signingKey() (any, error) {
+	if !j.usingPublicKeyAlgo() {
+		return j.Key, nil
+	}
+	keys, err := j.parseKeys()
+	if err != nil {
+		return nil, err
+	}
+	if keys.sign == nil {
+		return nil, fmt.Errorf("token: %s needs PrivateKey or SigningKey", j.alg())
+	}
+	return keys.sign, nil
+}
+
+// keyFunc 返回验证签名使用的密钥，token 的算法必须与 Alg 相同，防止用公钥作为 HMAC 密钥伪造 token；
+// 设置了 JWKSURL 时按 token 头部的 kid 从 JWKS 中获取公钥
+func (j *JwtHandler) keyFunc(token *jwt.Token) (any, error) {
+	if token.Method.Alg() != j.alg() {
+		return nil, fmt.Errorf("token: unexpected signing method %s", token.Method.Alg())
+	}
+	if !j.usingPublicKeyAlgo() {
+		return j.Key, nil
+	}
+	if j.JWKSURL != "" {
+		kid, _ := token.Header["kid"].(string)
+		return j.jwksCache().Key(kid)
+	}
+	keys, err := j.parseKeys()
+	if err != nil {
+		return nil, err
+	}
+	if keys.verify == nil {
+		return nil, fmt.Errorf("token: %s needs PublicKey, VerifyKey or JWKSURL", j.alg())
+	}
+	return keys.verify, nil
+}
+
+// sign 签名 token，设置了 KeyID 时写入头部的 kid
+func (j *JwtHandler) sign(token *jwt.Token) (string, error) {
+	key, err := j.signingKey()
+	if err != nil {
+		return "", err
+	}
+	if j.KeyID != "" {
+		token.Header["kid"] = j.KeyID
+	}
+	return token.SignedString(key)
+}
+
+// parsePrivateKey 按算法解析 PEM 格式的私钥
+func parsePrivateKey(alg string, pem []byte) (crypto.PrivateKey, error) {
+	switch {
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+		return jwt.ParseRSAPrivateKeyFromPEM(pem)
+	case strings.HasPrefix(alg, "ES"):
+		return jwt.ParseECPrivateKeyFromPEM(pem)
+	case alg == "EdDSA":
+		return jwt.ParseEdPrivateKeyFromPEM(pem)
+	}
+	return nil, errors.New("token: unsupported alg " + alg)
+}
+
+// parsePublicKey 按算法解析 PEM 格式的公钥或证书
+func parsePublicKey(alg string, pem []byte) (crypto.PublicKey, error) {
+	switch {
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+		return jwt.ParseRSAPublicKeyFromPEM(pem)
+	case strings.HasPrefix(alg, "ES"):
+		return jwt.ParseECPublicKeyFromPEM(pem)
+	case alg == "EdDSA":
+		return jwt.ParseEdPublicKeyFromPEM(pem)
+	}
+	return nil, errors.New("token: unsupported alg " + alg)
+}
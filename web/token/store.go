@@ -0,0 +1,228 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/ygb616/web/internal/redis"
+	"sync"
+	"time"
+)
+
+// ErrTokenRevoked token 已经被撤销，如已退出登录或刷新令牌已经使用过
+var ErrTokenRevoked = errors.New("token: token has been revoked")
+
+// TokenStore 保存已撤销的 token 的 jti，设置 JwtHandler.Store 后签发的 token 都带有 jti，
+// AuthInterceptor 拒绝已撤销的 token，LogoutHandler、RefreshHandler 撤销旧的 token
+type TokenStore interface {
+	// Revoke 撤销 jti，until 为 token 的过期时间，过期后可以删除
+	Revoke(ctx context.Context, jti string, until time.Time) error
+	// IsRevoked 判断 jti 是否已经撤销
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+	// RevokeIfNew 原子地检查并撤销 jti，jti 已经撤销时返回 false，用于刷新令牌只能使用一次
+	RevokeIfNew(ctx context.Context, jti string, until time.Time) (bool, error)
+}
+
+// storeTimeout 访问 TokenStore 的超时时间
+const storeTimeout = time.Second
+
+// newJTI 生成随机的 jti
+func newJTI() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// claimsExpiry 返回 claims 中的过期时间，没有 exp 时返回 fallback
+func claimsExpiry(claims jwt.MapClaims, fallback time.Time) time.Time {
+	if exp, ok := claims["exp"].(float64); ok {
+		return time.Unix(int64(exp), 0)
+	}
+	return fallback
+}
+
+// checkRevoked 检查 claims 的 jti 是否已经撤销，没有设置 Store 时不检查
+func (j *JwtHandler) checkRevoked(claims jwt.MapClaims) error {
+	if j.Store == nil {
+		return nil
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return ErrTokenRevoked // 设置 Store 后签发的 token 都有 jti，没有 jti 的无法撤销，不接受
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	revoked, err := j.Store.IsRevoked(ctx, jti)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// useOnce 撤销 claims 的 jti，已经撤销时返回 ErrTokenRevoked，并发使用同一个刷新令牌时只有一个成功；
+// 没有设置 Store 时不检查
+func (j *JwtHandler) useOnce(claims jwt.MapClaims) error {
+	if j.Store == nil {
+		return nil
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return ErrTokenRevoked
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	ok, err := j.Store.RevokeIfNew(ctx, jti, claimsExpiry(claims, time.Now().Add(j.RefreshTimeOut)))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// revokeClaims 撤销 claims 的 jti，没有设置 Store 或没有 jti 时不处理
+func (j *JwtHandler) revokeClaims(claims jwt.MapClaims) error {
+	if j.Store == nil {
+		return nil
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	return j.Store.Revoke(ctx, jti, claimsExpiry(claims, time.Now().Add(j.RefreshTimeOut)))
+}
+
+// Revoke 撤销已经签发的 token，如修改密码、封禁用户后强制 token 失效，需要设置 Store
+func (j *JwtHandler) Revoke(tokenString string) error {
+	if j.Store == nil {
+		return errors.New("token: JwtHandler.Store is nil")
+	}
+	claims := jwt.MapClaims{}
+	// 只校验签名，已经过期的 token 不需要撤销
+	t, err := jwt.ParseWithClaims(tokenString, claims, j.keyFunc)
+	if err != nil {
+		var ve *jwt.ValidationError
+		if errors.As(err, &ve) && ve.Errors&jwt.ValidationErrorExpired != 0 {
+			return nil
+		}
+		return err
+	}
+	return j.revokeClaims(t.Claims.(jwt.MapClaims))
+}
+
+// MemoryTokenStore 进程内的 TokenStore，只适合单副本部署或测试，多副本使用 RedisTokenStore
+type MemoryTokenStore struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+	sweep   time.Time
+}
+
+// NewMemoryTokenStore 创建 MemoryTokenStore
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{revoked: make(map[string]time.Time)}
+}
+
+func (s *MemoryTokenStore) Revoke(_ context.Context, jti string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revokeLocked(jti, until)
+	return nil
+}
+
+func (s *MemoryTokenStore) RevokeIfNew(_ context.Context, jti string, until time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if exp, ok := s.revoked[jti]; ok && exp.After(time.Now()) {
+		return false, nil
+	}
+	s.revokeLocked(jti, until)
+	return true, nil
+}
+
+// revokeLocked 记录撤销的 jti，调用前持有 mu
+func (s *MemoryTokenStore) revokeLocked(jti string, until time.Time) {
+	now := time.Now()
+	// 每分钟清理一次已经过期的 jti
+	if now.Sub(s.sweep) > time.Minute {
+		s.sweep = now
+		for k, exp := range s.revoked {
+			if !exp.After(now) {
+				delete(s.revoked, k)
+			}
+		}
+	}
+	if until.After(now) {
+		s.revoked[jti] = until
+	}
+}
+
+func (s *MemoryTokenStore) IsRevoked(_ context.Context, jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	until, ok := s.revoked[jti]
+	return ok && until.After(time.Now()), nil
+}
+
+// RedisClient 执行 Redis 命令，key 不存在时返回 (nil, nil)，用法同 breaker.RedisClient
+type RedisClient = redis.Client
+
+// RedisFunc 函数形式的 RedisClient
+type RedisFunc = redis.Func
+
+// RedisTokenStore 使用 Redis 保存已撤销的 jti，每个 jti 一个 key，token 过期后自动删除
+type RedisTokenStore struct {
+	Client RedisClient
+	Prefix string // key 的前缀，默认 jwt:revoked:
+}
+
+// NewRedisTokenStore 创建 RedisTokenStore
+func NewRedisTokenStore(client RedisClient) *RedisTokenStore {
+	return &RedisTokenStore{Client: client}
+}
+
+func (s *RedisTokenStore) key(jti string) string {
+	prefix := s.Prefix
+	if prefix == "" {
+		prefix = "jwt:revoked:"
+	}
+	return prefix + jti
+}
+
+func (s *RedisTokenStore) Revoke(ctx context.Context, jti string, until time.Time) error {
+	ttl := time.Until(until).Milliseconds()
+	if ttl <= 0 {
+		return nil
+	}
+	_, err := s.Client.Do(ctx, "SET", s.key(jti), "1", "PX", ttl)
+	return err
+}
+
+func (s *RedisTokenStore) RevokeIfNew(ctx context.Context, jti string, until time.Time) (bool, error) {
+	ttl := time.Until(until).Milliseconds()
+	if ttl <= 0 {
+		ttl = 1 // 已经过期的 token 解析时会失败，这里只是避免 PX 的参数不合法
+	}
+	// SET NX 只在 key 不存在时设置，返回 OK；已经存在时返回 nil
+	v, err := s.Client.Do(ctx, "SET", s.key(jti), "1", "NX", "PX", ttl)
+	if err != nil {
+		return false, err
+	}
+	return v != nil, nil
+}
+
+func (s *RedisTokenStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	v, err := s.Client.Do(ctx, "EXISTS", s.key(jti))
+	if err != nil {
+		return false, err
+	}
+	n, _ := v.(int64)
+	return n > 0, nil
+}
@@ -1,15 +1,29 @@
 package token
 
 import (
+	"crypto"
+	"encoding/json"
 	"errors"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/ygb616/web"
 	"net/http"
+	"strings"
 	"time"
 )
 
 const JWTToken = "web_token"
 
+// JWTRefreshToken 刷新令牌默认的 Cookie 名称
+const JWTRefreshToken = "web_refresh_token"
+
+// TokenTypeClaim 区分访问令牌和刷新令牌的 claim，刷新令牌不能作为访问令牌使用，访问令牌也不能用于刷新
+const TokenTypeClaim = "token_type"
+
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
 type JwtHandler struct {
 	//jwt的算法
 	Alg string
@@ -21,10 +35,26 @@ type JwtHandler struct {
 	TimeFuc func() time.Time
 	//Key
 	Key []byte
-	//刷新key
+	//刷新令牌在请求体、表单中的字段名，默认 refresh_token
 	RefreshKey string
-	//私钥
+	//刷新令牌的 Cookie 名称，默认 web_refresh_token，SendCookie 时使用
+	RefreshCookieName string
+	//私钥，PEM 格式，RS*、PS*、ES*、EdDSA 算法使用
 	PrivateKey string
+	//公钥，PEM 格式的公钥或证书，为空时从私钥中获取
+	PublicKey string
+	//已经解析好的签名私钥，如 *rsa.PrivateKey、*ecdsa.PrivateKey，设置后不解析 PrivateKey
+	SigningKey crypto.PrivateKey
+	//已经解析好的验证公钥，如 *rsa.PublicKey、*ecdsa.PublicKey，设置后不解析 PublicKey
+	VerifyKey crypto.PublicKey
+	//JWKS 地址，设置后按 token 头部的 kid 从 JWKS 中获取验证公钥
+	JWKSURL string
+	//JWKS 的缓存时间，默认 1 小时
+	JWKSRefresh time.Duration
+	//写入 token 头部的 kid
+	KeyID string
+	//已撤销 token 的存储，设置后签发的 token 带有 jti，退出登录、刷新后旧的 token 失效
+	Store TokenStore
 	//
 	SendCookie    bool
 	Authenticator func(ctx *web.Context) (map[string]any, error)
@@ -36,8 +66,18 @@ type JwtHandler struct {
 	CookieHTTPOnly bool
 	Header         string
 	AuthHandler    func(ctx *web.Context, err error)
+	//不需要认证的路径，如 /login、/static/*，规则同 web.SkipRequest
+	SkipPaths []string
+	//返回 true 时不需要认证
+	SkipFunc func(ctx *web.Context) bool
+
+	keys jwtKeys
+	jwks jwksOnce
 }
 
+// ErrTokenType token 类型不对，如用刷新令牌访问接口或用访问令牌刷新
+var ErrTokenType = errors.New("token: wrong token type")
+
 // JwtResponse 结构体用于存储 JWT 和刷新令牌
 type JwtResponse struct {
 	Token        string // 主 JWT
@@ -51,7 +91,12 @@ func (j *JwtHandler) LoginHandler(ctx *web.Context) (*JwtResponse, error) {
 	if err != nil {
 		return nil, err // 如果认证失败，返回 nil 和错误信息
 	}
+	return j.Issue(ctx, data)
+}
 
+// Issue 为已经认证的用户签发 JWT 和刷新令牌，data 加入到 claims 中；
+// 用于 Authenticator 之外的认证方式，如 OIDC 登录后签发本地的 token
+func (j *JwtHandler) Issue(ctx *web.Context, data map[string]any) (*JwtResponse, error) {
 	// 如果没有指定算法，默认使用 HS256
 	if j.Alg == "" {
 		j.Alg = "HS256"
@@ -80,15 +125,13 @@ func (j *JwtHandler) LoginHandler(ctx *web.Context) (*JwtResponse, error) {
 	expire := j.TimeFuc().Add(j.TimeOut)
 	claims["exp"] = expire.Unix()      // 设置过期时间（exp）
 	claims["iat"] = j.TimeFuc().Unix() // 设置签发时间（iat）
-
-	// 根据算法选择使用公钥或密钥进行签名，并生成 token 字符串
-	var tokenString string
-	var tokenErr error
-	if j.usingPublicKeyAlgo() {
-		tokenString, tokenErr = token.SignedString(j.PrivateKey) // 使用私钥进行签名
-	} else {
-		tokenString, tokenErr = token.SignedString(j.Key) // 使用密钥进行签名
+	claims[TokenTypeClaim] = TokenTypeAccess
+	if j.Store != nil {
+		claims["jti"] = newJTI() // 设置 token 编号（jti），用于撤销
 	}
+
+	// 根据算法使用私钥或密钥进行签名，并生成 token 字符串
+	tokenString, tokenErr := j.sign(token)
 	if tokenErr != nil {
 		return nil, tokenErr // 如果签名失败，返回 nil 和错误信息
 	}
@@ -115,43 +158,52 @@ func (j *JwtHandler) LoginHandler(ctx *web.Context) (*JwtResponse, error) {
 		}
 		// 设置 Cookie
 		ctx.SetCookie(j.CookieName, tokenString, int(j.CookieMaxAge), "/", j.CookieDomain, j.SecureCookie, j.CookieHTTPOnly)
+		// 刷新令牌只通过 HttpOnly 的 Cookie 发送，不能被脚本读取
+		ctx.SetCookie(j.refreshCookieName(), jr.RefreshToken, int(j.RefreshTimeOut.Seconds()), "/", j.CookieDomain, j.SecureCookie, true)
 	}
 
 	return jr, nil // 返回生成的 JwtResponse 结构体实例
 }
 
-// 判断是否使用公钥算法
-func (j *JwtHandler) usingPublicKeyAlgo() bool {
-	switch j.Alg {
-	case "RS256", "RS512", "RS384":
-		return true // 使用公钥算法
-	}
-	return false // 不使用公钥算法
-}
-
 // refreshToken 方法用于生成新的刷新令牌
 func (j *JwtHandler) refreshToken(token *jwt.Token) (string, error) {
 	// 获取 token 的声明（claims）
 	claims := token.Claims.(jwt.MapClaims)
 	// 设置新的过期时间为当前时间加上刷新过期时间
 	claims["exp"] = j.TimeFuc().Add(j.RefreshTimeOut).Unix()
-
-	// 根据算法选择使用公钥或密钥进行签名，并生成 token 字符串
-	var tokenString string
-	var tokenErr error
-	if j.usingPublicKeyAlgo() {
-		tokenString, tokenErr = token.SignedString(j.PrivateKey) // 使用私钥进行签名
-	} else {
-		tokenString, tokenErr = token.SignedString(j.Key) // 使用密钥进行签名
+	claims[TokenTypeClaim] = TokenTypeRefresh
+	if j.Store != nil {
+		claims["jti"] = newJTI() // 刷新令牌使用单独的 jti，可以单独撤销
 	}
+
+	// 根据算法使用私钥或密钥进行签名，并生成 token 字符串
+	tokenString, tokenErr := j.sign(token)
 	if tokenErr != nil {
 		return "", tokenErr // 如果签名失败，返回空字符串和错误信息
 	}
 	return tokenString, nil // 返回生成的刷新令牌
 }
 
-// LogoutHandler 退出登录
+// LogoutHandler 退出登录，设置了 Store 时撤销请求中的 token 和刷新令牌，刷新令牌的来源同 RefreshHandler
 func (j *JwtHandler) LogoutHandler(ctx *web.Context) error {
+	// 设置了 Store 时撤销当前的 token 和刷新令牌，否则刷新令牌仍然可以换取新的 token；
+	// 没有 token 或 token 已经无效时不需要撤销
+	if j.Store != nil {
+		if claims, err := j.parseToken(ctx); err == nil {
+			if err := j.revokeClaims(claims); err != nil {
+				return err
+			}
+		}
+		if rToken := j.refreshFromRequest(ctx); rToken != "" {
+			if t, err := jwt.Parse(rToken, j.keyFunc); err == nil {
+				if claims := t.Claims.(jwt.MapClaims); claims[TokenTypeClaim] == TokenTypeRefresh {
+					if err := j.revokeClaims(claims); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
 	// 如果配置了发送 Cookie 的选项
 	if j.SendCookie {
 		if j.CookieName == "" {
@@ -159,6 +211,7 @@ func (j *JwtHandler) LogoutHandler(ctx *web.Context) error {
 		}
 		// 设置 Cookie，值为空，过期时间为负数表示删除该 Cookie
 		ctx.SetCookie(j.CookieName, "", -1, "/", j.CookieDomain, j.SecureCookie, j.CookieHTTPOnly)
+		ctx.SetCookie(j.refreshCookieName(), "", -1, "/", j.CookieDomain, j.SecureCookie, true)
 		return nil // 返回 nil 表示成功
 	}
 	return nil // 返回 nil 表示成功
@@ -166,9 +219,9 @@ func (j *JwtHandler) LogoutHandler(ctx *web.Context) error {
 
 // RefreshHandler 刷新 token
 func (j *JwtHandler) RefreshHandler(ctx *web.Context) (*JwtResponse, error) {
-	// 获取刷新令牌
-	rToken, ok := ctx.Get(j.RefreshKey)
-	if !ok {
+	// 从 Cookie 或请求体中获取刷新令牌
+	rToken := j.refreshFromRequest(ctx)
+	if rToken == "" {
 		return nil, errors.New("refresh token is null") // 如果没有刷新令牌，返回错误
 	}
 	// 如果没有指定算法，默认使用 HS256
@@ -176,18 +229,19 @@ func (j *JwtHandler) RefreshHandler(ctx *web.Context) (*JwtResponse, error) {
 		j.Alg = "HS256"
 	}
 	// 解析 token
-	t, err := jwt.Parse(rToken.(string), func(token *jwt.Token) (interface{}, error) {
-		if j.usingPublicKeyAlgo() {
-			return j.PrivateKey, nil // 使用私钥进行验证
-		} else {
-			return j.Key, nil // 使用密钥进行验证
-		}
-	})
+	t, err := jwt.Parse(rToken, j.keyFunc)
 	if err != nil {
 		return nil, err // 如果解析失败，返回错误
 	}
-	// 获取 token 的声明（claims）
+	// 获取 token 的声明（claims），只接受刷新令牌
 	claims := t.Claims.(jwt.MapClaims)
+	if claims[TokenTypeClaim] != TokenTypeRefresh {
+		return nil, ErrTokenType
+	}
+	// 刷新令牌只能使用一次，检查和撤销是原子的，并发重放时只有一个请求成功（需要设置 Store）
+	if err := j.useOnce(claims); err != nil {
+		return nil, err
+	}
 
 	// 如果没有指定时间函数，默认使用当前时间
 	if j.TimeFuc == nil {
@@ -199,15 +253,13 @@ func (j *JwtHandler) RefreshHandler(ctx *web.Context) (*JwtResponse, error) {
 	expire := j.TimeFuc().Add(j.TimeOut)
 	claims["exp"] = expire.Unix()      // 设置过期时间（exp）
 	claims["iat"] = j.TimeFuc().Unix() // 设置签发时间（iat）
-
-	// 根据算法选择使用公钥或密钥进行签名，并生成新的 token 字符串
-	var tokenString string
-	var tokenErr error
-	if j.usingPublicKeyAlgo() {
-		tokenString, tokenErr = t.SignedString(j.PrivateKey) // 使用私钥进行签名
-	} else {
-		tokenString, tokenErr = t.SignedString(j.Key) // 使用密钥进行签名
+	claims[TokenTypeClaim] = TokenTypeAccess
+	if j.Store != nil {
+		claims["jti"] = newJTI() // 新的 token 使用新的 jti
 	}
+
+	// 根据算法使用私钥或密钥进行签名，并生成新的 token 字符串
+	tokenString, tokenErr := j.sign(t)
 	if tokenErr != nil {
 		return nil, tokenErr // 如果签名失败，返回错误
 	}
@@ -234,51 +286,96 @@ func (j *JwtHandler) RefreshHandler(ctx *web.Context) (*JwtResponse, error) {
 		}
 		// 设置 Cookie
 		ctx.SetCookie(j.CookieName, tokenString, int(j.CookieMaxAge), "/", j.CookieDomain, j.SecureCookie, j.CookieHTTPOnly)
+		// 刷新令牌只通过 HttpOnly 的 Cookie 发送，不能被脚本读取
+		ctx.SetCookie(j.refreshCookieName(), jr.RefreshToken, int(j.RefreshTimeOut.Seconds()), "/", j.CookieDomain, j.SecureCookie, true)
 	}
 
 	return jr, nil // 返回生成的 JwtResponse 结构体实例
 }
 
+// refreshFromRequest 从 Cookie、表单或 json 请求体中获取刷新令牌
+func (j *JwtHandler) refreshFromRequest(ctx *web.Context) string {
+	if j.SendCookie {
+		if cookie, err := ctx.R.Cookie(j.refreshCookieName()); err == nil && cookie.Value != "" {
+			return cookie.Value
+		}
+	}
+	key := j.RefreshKey
+	if key == "" {
+		key = "refresh_token"
+	}
+	if strings.HasPrefix(ctx.R.Header.Get("Content-Type"), "application/json") {
+		var body map[string]any
+		if err := json.NewDecoder(ctx.R.Body).Decode(&body); err != nil {
+			return ""
+		}
+		v, _ := body[key].(string)
+		return v
+	}
+	v, _ := ctx.GetPostForm(key)
+	return v
+}
+
+func (j *JwtHandler) refreshCookieName() string {
+	if j.RefreshCookieName == "" {
+		return JWTRefreshToken
+	}
+	return j.RefreshCookieName
+}
+
 // AuthInterceptor jwt 登录中间件，检查请求头或 Cookie 中是否有有效的 token
 func (j *JwtHandler) AuthInterceptor(next web.HandlerFunc) web.HandlerFunc {
 	return func(ctx *web.Context) {
-		if j.Header == "" {
-			j.Header = "Authorization" // 如果未指定头部字段名称，使用默认值
-		}
-		// 从请求头中获取 token
-		token := ctx.R.Header.Get(j.Header)
-		if token == "" {
-			if j.SendCookie {
-				cookie, err := ctx.R.Cookie(j.CookieName)
-				if err != nil {
-					j.AuthErrorHandler(ctx, err) // 如果获取 Cookie 失败，调用错误处理函数
-					return
-				}
-				token = cookie.String()
-			}
+		// 公开的路由不需要认证
+		if web.SkipRequest(ctx, j.SkipPaths, j.SkipFunc) {
+			next(ctx)
+			return
 		}
-		if token == "" {
-			j.AuthErrorHandler(ctx, errors.New("token is null")) // 如果没有 token，调用错误处理函数
+		claims, err := j.parseToken(ctx)
+		if err != nil {
+			j.AuthErrorHandler(ctx, err) // token 不存在或解析失败，调用错误处理函数
 			return
 		}
+		ctx.Set(ClaimsKey, claims) // 将 claims 设置到上下文中
+		next(ctx)                  // 调用下一个处理函数
+	}
+}
 
-		// 解析 token
-		t, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-			if j.usingPublicKeyAlgo() {
-				return j.PrivateKey, nil // 使用私钥进行验证
-			} else {
-				return j.Key, nil // 使用密钥进行验证
+// parseToken 从请求头或 Cookie 中获取 token 并解析出 claims
+func (j *JwtHandler) parseToken(ctx *web.Context) (jwt.MapClaims, error) {
+	if j.Header == "" {
+		j.Header = "Authorization" // 如果未指定头部字段名称，使用默认值
+	}
+	// 从请求头中获取 token
+	token := ctx.R.Header.Get(j.Header)
+	if token == "" {
+		if j.SendCookie {
+			cookie, err := ctx.R.Cookie(j.CookieName)
+			if err != nil {
+				return nil, err // 获取 Cookie 失败
 			}
-		})
-		if err != nil {
-			j.AuthErrorHandler(ctx, err) // 如果解析失败，调用错误处理函数
-			return
+			token = cookie.Value
 		}
-		// 获取 token 的声明（claims）
-		claims := t.Claims.(jwt.MapClaims)
-		ctx.Set("jwt_claims", claims) // 将 claims 设置到上下文中
-		next(ctx)                     // 调用下一个处理函数
 	}
+	token = strings.TrimPrefix(token, "Bearer ") // 兼容 Authorization: Bearer <token>
+	if token == "" {
+		return nil, errors.New("token is null")
+	}
+
+	// 解析 token
+	t, err := jwt.Parse(token, j.keyFunc)
+	if err != nil {
+		return nil, err
+	}
+	// 获取 token 的声明（claims），只接受访问令牌，检查是否已经撤销
+	claims := t.Claims.(jwt.MapClaims)
+	if claims[TokenTypeClaim] != TokenTypeAccess {
+		return nil, ErrTokenType
+	}
+	if err := j.checkRevoked(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
 }
 
 // AuthErrorHandler 认证错误处理函数
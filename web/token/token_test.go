@@ -0,0 +1,137 @@
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"github.com/ygb616/web"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestSkipPathDoesNotSeeStaleClaims 跳过认证的请求不能读到复用的上下文中上一个请求的 claims
+func TestSkipPathDoesNotSeeStaleClaims(t *testing.T) {
+	j := &JwtHandler{Key: []byte("secret"), TimeOut: time.Minute, RefreshTimeOut: time.Hour, SkipPaths: []string{"/public"}}
+	jr, err := j.Issue(nil, map[string]any{"role": "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := web.New()
+	g := e.Group("")
+	g.Use(j.AuthInterceptor)
+	g.Get("/private", func(ctx *web.Context) {
+		if _, ok := Claims(ctx); !ok {
+			t.Error("authenticated request has no claims")
+		}
+	})
+	g.Get("/public", func(ctx *web.Context) {
+		if claims, ok := Claims(ctx); ok {
+			t.Errorf("skipped request sees claims %v", claims)
+		}
+	})
+	// sync.Pool 不保证复用同一个上下文，多请求几次
+	for i := 0; i < 20; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/private", nil)
+		r.Header.Set("Authorization", "Bearer "+jr.Token)
+		e.ServeHTTP(httptest.NewRecorder(), r)
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/public", nil))
+	}
+}
+
+// TestLogoutRevokesRefreshToken 退出登录后刷新令牌不能再换取新的 token
+func TestLogoutRevokesRefreshToken(t *testing.T) {
+	j := &JwtHandler{Key: []byte("secret"), TimeOut: time.Minute, RefreshTimeOut: time.Hour, Store: NewMemoryTokenStore()}
+	jr, err := j.Issue(nil, map[string]any{"uid": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/logout", strings.NewReader("refresh_token="+jr.RefreshToken))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Authorization", "Bearer "+jr.Token)
+	if err := j.LogoutHandler(&web.Context{W: httptest.NewRecorder(), R: r}); err != nil {
+		t.Fatal(err)
+	}
+	r = httptest.NewRequest(http.MethodPost, "/refresh", strings.NewReader("refresh_token="+jr.RefreshToken))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if _, err := j.RefreshHandler(&web.Context{W: httptest.NewRecorder(), R: r}); err != ErrTokenRevoked {
+		t.Fatalf("refresh after logout: got %v, want %v", err, ErrTokenRevoked)
+	}
+}
+
+// TestRefreshTokenUsedOnce 并发使用同一个刷新令牌时只有一个请求成功
+func TestRefreshTokenUsedOnce(t *testing.T) {
+	j := &JwtHandler{Key: []byte("secret"), TimeOut: time.Minute, RefreshTimeOut: time.Hour, Store: NewMemoryTokenStore()}
+	jr, err := j.Issue(nil, map[string]any{"uid": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.TimeFuc = time.Now
+	var wg sync.WaitGroup
+	var ok atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest(http.MethodPost, "/refresh", strings.NewReader("refresh_token="+jr.RefreshToken))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if _, err := j.RefreshHandler(&web.Context{W: httptest.NewRecorder(), R: r}); err == nil {
+				ok.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := ok.Load(); n != 1 {
+		t.Fatalf("refresh succeeded %d times, want 1", n)
+	}
+}
+
+// TestJWKSServesCachedKeysDuringRefresh 缓存过期后在后台获取 JWKS，获取期间不阻塞使用缓存的公钥
+func TestJWKSServesCachedKeysDuringRefresh(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := base64.RawURLEncoding.EncodeToString
+	body := fmt.Sprintf(`{"keys":[{"kty":"EC","kid":"k1","crv":"P-256","x":%q,"y":%q}]}`,
+		enc(priv.X.Bytes()), enc(priv.Y.Bytes()))
+	var slow atomic.Bool
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow.Load() {
+			<-release
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	c := NewJWKS(srv.URL, time.Hour)
+	if _, err := c.Key("k1"); err != nil {
+		t.Fatal(err)
+	}
+	slow.Store(true)
+	c.mu.Lock()
+	c.fetched = time.Now().Add(-2 * time.Hour) // 缓存过期
+	c.mu.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Key("k1")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Key blocked on the jwks refresh")
+	}
+}
@@ -1,20 +1,26 @@
 package web
 
 import (
+	"errors"
 	"fmt"
 	"github.com/ygb616/web/config"
 	"github.com/ygb616/web/gateway"
+	"github.com/ygb616/web/internal/tree"
 	myLog "github.com/ygb616/web/log"
+	"github.com/ygb616/web/pool"
 	"github.com/ygb616/web/register"
 	"github.com/ygb616/web/render"
-	"github.com/ygb616/web/util"
+	"golang.org/x/net/http2"
 	"html/template"
 	"log"
+	"net"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
+	"path"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 const ANY = "ANY"
@@ -26,6 +32,27 @@ type MiddlewareFunc func(handler HandlerFunc) HandlerFunc //定义中间件函
 type router struct {
 	groups []*routerGroup
 	engine *Engine
+	// tree 所有路由组共用的路由树，保存完整路径，尾节点的 Value 为 *route
+	tree *tree.Node
+	// routes 按注册顺序保存的路由，见 Engine.Routes
+	routes []RouteInfo
+}
+
+// route 路由树尾节点保存的路由，同一个完整路径的不同方法可以注册在不同的路由组中
+type route struct {
+	fullPath string
+	methods  map[string]routeHandle // 方法（含 ANY） -> 注册的路由组
+}
+
+// routeHandle 注册路由的路由组和组内的路径
+type routeHandle struct {
+	group *routerGroup
+	name  string
+}
+
+// joinPath 拼接路由组的名称和组内的路径，如 user + /get/:id 为 /user/get/:id
+func joinPath(groupName, name string) string {
+	return strings.TrimSuffix("/"+groupName, "/") + name
 }
 
 func (r *router) Group(name string) *routerGroup {
@@ -34,7 +61,7 @@ func (r *router) Group(name string) *routerGroup {
 		handlerMap:         make(map[string]map[string]HandlerFunc),
 		middlewaresFuncMap: make(map[string]map[string][]MiddlewareFunc),
 		handlerMethodMap:   make(map[string][]string),
-		treeNode:           &treeNode{name: "/", children: make([]*treeNode, 0)},
+		router:             r,
 	}
 	g.Use(r.engine.Middles...)
 	r.groups = append(r.groups, g)
@@ -57,8 +84,29 @@ func (r *routerGroup) handle(name string, method string, handlerFunc HandlerFunc
 	r.handlerMap[name][method] = handlerFunc
 	// 将路由名称添加到 handlerMethodMap 中
 	r.middlewaresFuncMap[name][method] = append(r.middlewaresFuncMap[name][method], middlewareFunc...)
-	// 将路由名称插入到 treeNode 中，以便进行路由匹配
-	r.treeNode.Put(name)
+	// 将完整路径插入到路由树中，以便进行路由匹配
+	fullPath := joinPath(r.groupName, name)
+	node, _, err := r.router.tree.Put(fullPath)
+	if err != nil {
+		panic(err)
+	}
+	rt, _ := node.Value.(*route)
+	if rt == nil {
+		rt = &route{fullPath: fullPath, methods: make(map[string]routeHandle)}
+		node.Value = rt
+	}
+	if _, ok := rt.methods[method]; ok {
+		panic("有重复路由") // 其他路由组已经注册了相同的完整路径和方法
+	}
+	rt.methods[method] = routeHandle{group: r, name: name}
+	r.router.routes = append(r.router.routes, RouteInfo{
+		Method:      method,
+		Path:        fullPath,
+		Group:       r.groupName,
+		Handler:     nameOfFunction(handlerFunc),
+		HandlerFunc: handlerFunc,
+		Middlewares: len(middlewareFunc),
+	})
 }
 
 func (r *routerGroup) Use(middlewares ...MiddlewareFunc) {
@@ -98,6 +146,7 @@ func (r *routerGroup) Head(name string, handlerFunc HandlerFunc, middlewareFunc
 
 // methodHandle 处理中间件逻辑
 func (r *routerGroup) methodHandle(name string, method string, h HandlerFunc, ctx *Context) {
+	ctx.fullPath = joinPath(r.groupName, name)
 	//通用中间件
 	if r.middlewares != nil {
 		for _, middlewareFunc := range r.middlewares {
@@ -126,8 +175,8 @@ type routerGroup struct {
 	// handlerMethodMap 保存每个路由路径支持的 HTTP 方法列表
 	// 键是路由路径，值是该路径支持的 HTTP 方法的切片
 	handlerMethodMap map[string][]string
-	// treeNode 是该路由组的树节点，用于存储路由树结构，实现高效路由匹配
-	treeNode *treeNode
+	// router 路由组所属的 router，路由注册到 router 共用的路由树中
+	router *router
 	//路由中间件集合
 	middlewares []MiddlewareFunc
 }
@@ -136,24 +185,54 @@ type ErrorHandler func(err error) (int, any)
 
 // Engine 结构体定义
 type Engine struct {
-	*router                                      // 内嵌的 router，用于路由功能
-	funcMap          template.FuncMap            // 模板函数映射，用于渲染 HTML 模板
-	HTMLRender       render.HTMLRender           // HTML 渲染器，用于渲染 HTML
-	pool             sync.Pool                   // 协程池，用于复用对象，减少内存分配
-	Logger           *myLog.Logger               // 日志记录器，用于记录日志
-	Middles          []MiddlewareFunc            // 中间件函数列表，用于处理请求和响应的中间件
-	errorHandler     ErrorHandler                // 错误处理器，用于处理错误
-	OpenGateway      bool                        // 是否开启网关功能
-	gatewayConfigs   []gateway.GWConfig          // 网关配置列表，用于配置网关
-	gatewayTreeNode  *gateway.TreeNode           // 网关树节点，用于组织网关路由
-	gatewayConfigMap map[string]gateway.GWConfig // 网关配置映射表，保存配置名称与配置实例的映射关系
-	RegisterType     string                      // 注册中心类型（如 Nacos 或 Etcd）
-	RegisterOption   register.Option             // 注册中心选项配置
-	RegisterCli      register.MsRegister         // 服务注册中心接口
+	*router                                               // 内嵌的 router，用于路由功能
+	funcMap                 template.FuncMap              // 模板函数映射，用于渲染 HTML 模板
+	HTMLRender              render.HTMLRender             // HTML 渲染器，用于渲染 HTML
+	pool                    sync.Pool                     // 协程池，用于复用对象，减少内存分配
+	Logger                  *myLog.Logger                 // 日志记录器，用于记录日志
+	Config                  *config.WebConfig             // 创建时使用的配置，见 DefaultWithConfig，热加载后的配置用 config.GetToml 读取
+	Middles                 []MiddlewareFunc              // 中间件函数列表，用于处理请求和响应的中间件
+	errorHandler            ErrorHandler                  // 错误处理器，用于处理错误
+	OpenGateway             bool                          // 是否开启网关功能
+	gatewayTable            atomic.Pointer[gateway.Table] // 网关路由表，动态更新时整体替换
+	gatewayMu               sync.Mutex                    // 保证路由表的更新串行执行
+	gatewayTransport        *http.Transport               // 网关转发共用的 Transport，按实例复用连接
+	gatewayGRPC             *http2.Transport              // 网关转发 gRPC 共用的 HTTP/2 Transport
+	gatewayGRPCOnce         sync.Once
+	gatewayMiddles          map[string][]MiddlewareFunc // 网关路由级中间件，网关配置名称 -> 中间件
+	DisableGatewayAccessLog bool                        // 关闭网关访问日志，指标不受影响
+	RegisterType            string                      // 注册中心类型（如 nacos、etcd），见 register.Registers
+	RegisterOption          register.Option             // 注册中心选项配置
+	RegisterCli             register.MsRegister         // 服务注册中心接口
+	instances               []serviceInstance           // 当前引擎注册到注册中心的服务实例
+	instanceMu              sync.Mutex                  // 保护 instances
+	healthCheckers          map[string]HealthChecker    // 健康检查，名称 -> 检查函数
+	healthMu                sync.Mutex                  // 保护 healthCheckers
+	handlerPool             *pool.Pool                  // 处理请求的协程池，为空时在 net/http 的 goroutine 中处理
+	noRoute                 HandlerFunc                 // 没有匹配到路由时的处理函数，见 NoRoute
+	noRouteMiddles          []MiddlewareFunc            // noRoute 的中间件
+	noMethod                HandlerFunc                 // 路由不支持请求方法时的处理函数，见 NoMethod
+	noMethodMiddles         []MiddlewareFunc            // noMethod 的中间件
+	DebugPrintRoutes        bool                        // Run、RunTLS 启动前打印所有路由，见 Routes
+	servers                 []*http.Server              // Run、RunTLS 等启动的服务器，可以有多个端口，Shutdown 时关闭
+	serverMu                sync.Mutex                  // 保护 servers
+	AutoTLSCacheDir         string                      // RunAutoTLS 保存证书的目录，默认 DefaultAutoTLSCacheDir
+	MethodOverride          *MethodOverrideConf         // 不为 nil 时 POST 请求可以通过 X-HTTP-Method-Override 请求头或 _method 表单字段覆盖方法
+	EnableH2C               bool                        // Run、RunServer 不使用 TLS 时同时支持 h2c（不加密的 HTTP/2），包括 Upgrade: h2c
+	RedirectTrailingSlash   bool                        // 没有匹配的路由、但去掉或加上结尾的 / 后可以匹配时重定向，如 /user/get/ 到 /user/get
+	RedirectFixedPath       bool                        // 没有匹配的路由时清理路径中多余的 /、..，并按不区分大小写匹配，可以匹配时重定向到注册的路径
+	trustedProxies          []*net.IPNet                // 信任的代理，见 SetTrustedProxies
+}
+
+// serviceInstance 记录注册到注册中心的服务实例，用于停止时注销
+type serviceInstance struct {
+	serviceName string
+	host        string
+	port        int
 }
 
 func New() *Engine {
-	r := &router{}
+	r := &router{tree: tree.New()}
 	engine := &Engine{
 		router:     r,
 		funcMap:    nil,
@@ -167,22 +246,48 @@ func New() *Engine {
 	return engine
 }
 
-// Default 函数创建并返回一个默认配置的 Engine 实例
+// Default 函数创建并返回一个默认配置的 Engine 实例，使用 config 包当前的配置，见 DefaultWithConfig
 func Default() *Engine {
+	return DefaultWithConfig(config.GetToml())
+}
+
+// DefaultWithConfig 使用 cfg 创建默认配置的 Engine 实例，cfg 一般由 config.Load 加载，为 nil 时使用当前的配置。
+// cfg 会设置为 config 包当前的配置，连接池、网关路由等按当前配置读取的模块也使用 cfg
+func DefaultWithConfig(cfg *config.WebConfig) *Engine {
+	if cfg == nil {
+		cfg = config.GetToml()
+	} else if cfg != config.GetToml() {
+		config.SetCurrent(cfg)
+	}
 	// 创建一个新的 Engine 实例
 	engine := New()
+	engine.Config = cfg
 
 	// 设置 Logger 为默认日志记录器
 	engine.Logger = myLog.Default()
 
 	// 从配置中获取日志路径，如果存在则设置日志路径
-	logPath, ok := config.GetToml().Log["path"]
-	if ok {
-		engine.Logger.SetLogPath(logPath.(string))
+	// 按 [log] 配置日志级别、文件和按级别的输出
+	if err := engine.Logger.LoadConf(cfg.Log); err != nil {
+		engine.Logger.Error(err)
 	}
+	// 配置热加载后 [log] level 变化时修改日志级别，不需要重启
+	config.OnChange("log.level", func(_, level any) {
+		if s, ok := level.(string); ok {
+			if lv, err := myLog.ParseLevel(s); err == nil {
+				engine.Logger.SetLevel(lv)
+			}
+		}
+	})
+	// 注册 gateway 模块的 Logger，启动后就可以通过 LogLevelAdmin 单独修改级别
+	engine.ModuleLogger("gateway")
 
-	// 使用中间件 Logging 和 Recovery
-	engine.Use(Logging, Recovery)
+	// 使用访问日志和 Recovery 中间件，访问日志的格式和输出按 [log.access] 配置
+	access, err := LoggingConfigFromMap(cfg.Log)
+	if err != nil {
+		engine.Logger.Error(err)
+	}
+	engine.Use(LoggingMiddleware(access), Recovery)
 
 	// 设置 router 的 engine 字段为当前的 engine 实例
 	engine.router.engine = engine
@@ -218,20 +323,30 @@ func (e *Engine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx.W = w
 	ctx.R = r
 	ctx.Logger = e.Logger
-	e.httpRequestHandler(ctx, w, r)
+	ctx.fullPath = ""
+	ctx.StatusCode = 0
+	ctx.Params = ctx.Params[:0]
+	ctx.Keys = nil // 不能复用，否则跳过认证的请求会读到上一个请求的 claims、会话
+	ctx.requestID = ""
+	ctx.log = nil
+	if e.handlerPool != nil {
+		runInPool(e.handlerPool, ctx, func(ctx *Context) {
+			e.httpRequestHandler(ctx, ctx.W, ctx.R)
+		})
+	} else {
+		e.httpRequestHandler(ctx, w, r)
+	}
 	e.pool.Put(ctx)
 }
 
 // Run 启动 HTTP 服务器，监听指定的端口
 func (e *Engine) Run(port int) {
-	// 将根 URL ("/") 与当前的 Engine 实例关联，这样所有的请求都会由该实例处理
-	http.Handle("/", e)
-
-	// 使用指定的端口启动 HTTP 服务器
+	// 使用指定的端口启动 HTTP 服务器，所有的请求都由当前的 Engine 实例处理，
+	// 不注册到 http.DefaultServeMux，同一个进程中可以运行多个 Engine
 	// strconv.Itoa(port) 将端口号转换为字符串形式，组合成 ":port" 格式的地址
-	err := http.ListenAndServe(":"+strconv.Itoa(port), nil)
+	err := e.RunServer(&http.Server{Addr: ":" + strconv.Itoa(port), Handler: e})
 
-	// 如果启动服务器时发生错误，记录并终止程序
+	// 如果启动服务器时发生错误，记录并终止程序；调用 Shutdown 关闭时正常返回
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -239,95 +354,151 @@ func (e *Engine) Run(port int) {
 
 func (e *Engine) httpRequestHandler(ctx *Context, w http.ResponseWriter, r *http.Request) {
 	if e.OpenGateway {
-		// 如果开启了网关功能
-		// 请求过来，具体转发到哪？
-		path := r.URL.Path                  // 获取请求的URL路径
-		node := e.gatewayTreeNode.Get(path) // 根据路径在网关树中获取对应节点
-		if node == nil {
-			ctx.W.WriteHeader(http.StatusNotFound)             // 如果没有找到对应节点，返回404状态码
-			fmt.Fprintln(ctx.W, ctx.R.RequestURI+" not found") // 返回未找到的请求URI
+		// 如果开启了网关功能，按网关配置转发请求
+		e.gatewayHandle(ctx)
+		return
+	}
+	// HTML 表单和不支持其他方法的客户端用 POST 请求 PUT、DELETE 等路由
+	if e.MethodOverride != nil {
+		e.MethodOverride.overrideMethod(r)
+	}
+	// 获取请求的方法 (GET, POST, etc.)
+	method := r.Method
+	// 在所有路由组共用的路由树中匹配完整路径，同时记录路径参数
+	node, params := e.tree.Match(r.URL.Path, ctx.Params[:0])
+	ctx.Params = params
+	if node != nil {
+		rt := node.Value.(*route)
+		// 尝试获取通配符(ANY)的处理函数
+		if h, ok := rt.methods[ANY]; ok {
+			// 如果找到了通配符处理函数，调用并返回
+			h.group.methodHandle(h.name, ANY, h.group.handlerMap[h.name][ANY], ctx)
 			return
 		}
-		gwConfig := e.gatewayConfigMap[node.GwName]               // 根据节点名称获取网关配置
-		gwConfig.Header(ctx.R)                                    // 设置请求头信息
-		addr, err := e.RegisterCli.GetValue(gwConfig.ServiceName) // 从注册中心获取服务地址
-		if err != nil {
-			ctx.W.WriteHeader(http.StatusInternalServerError) // 如果获取服务地址出错，返回500状态码
-			fmt.Fprintln(ctx.W, err.Error())                  // 返回错误信息
+		// 尝试获取具体方法(GET, POST等)的处理函数
+		if h, ok := rt.methods[method]; ok {
+			// 如果找到了具体方法的处理函数，调用并返回
+			h.group.methodHandle(h.name, method, h.group.handlerMap[h.name][method], ctx)
 			return
 		}
-		target, err := url.Parse(fmt.Sprintf("http://%s%s", addr, path)) // 解析目标地址
-		if err != nil {
-			ctx.W.WriteHeader(http.StatusInternalServerError) // 如果解析目标地址出错，返回500状态码
-			fmt.Fprintln(ctx.W, err.Error())                  // 返回错误信息
+		// 如果没有找到匹配的处理函数，返回405 Method Not Allowed，Allow 中是路由支持的方法
+		methods := make([]string, 0, len(rt.methods))
+		for m := range rt.methods {
+			methods = append(methods, m)
+		}
+		sort.Strings(methods)
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		ctx.fullPath = rt.fullPath
+		e.handleUnmatched(ctx, e.noMethod, defaultNoMethod, e.noMethodMiddles)
+		return
+	}
+	// 路径多了或少了结尾的 /、大小写不同时重定向到注册的路径
+	if method != http.MethodConnect {
+		if fixed, ok := e.fixedPath(r.URL.Path); ok {
+			e.handleUnmatched(ctx, redirectTo(fixed), nil, nil)
 			return
 		}
-		// 网关的处理逻辑
-		director := func(req *http.Request) {
-			req.Host = target.Host         // 设置请求的Host
-			req.URL.Host = target.Host     // 设置请求URL的Host
-			req.URL.Path = target.Path     // 设置请求URL的Path
-			req.URL.Scheme = target.Scheme // 设置请求URL的Scheme
-			if _, ok := req.Header["User-Agent"]; !ok {
-				req.Header.Set("User-Agent", "") // 如果请求头中没有User-Agent，设置为空字符串
-			}
+	}
+	// 如果没有匹配的路由，返回404 Not Found
+	e.handleUnmatched(ctx, e.noRoute, defaultNoRoute, e.noRouteMiddles)
+}
+
+// fixedPath 按 RedirectTrailingSlash、RedirectFixedPath 查找可以重定向的路径
+func (e *Engine) fixedPath(p string) (string, bool) {
+	if e.RedirectTrailingSlash && p != "/" {
+		if alt := toggleTrailingSlash(p); e.tree.Get(alt) != nil {
+			return alt, true
 		}
-		response := func(response *http.Response) error {
-			log.Println("响应修改") // 响应修改日志
-			return nil
+	}
+	if e.RedirectFixedPath {
+		// 去掉多余的 /、. 和 ..，保留结尾的 /
+		cleaned := path.Clean(p)
+		if strings.HasSuffix(p, "/") && cleaned != "/" {
+			cleaned += "/"
 		}
-		handler := func(writer http.ResponseWriter, request *http.Request, err error) {
-			log.Println(err)    // 打印错误日志
-			log.Println("错误处理") // 错误处理日志
+		candidates := []string{cleaned}
+		if e.RedirectTrailingSlash && cleaned != "/" {
+			candidates = append(candidates, toggleTrailingSlash(cleaned))
 		}
-		proxy := httputil.ReverseProxy{
-			Director:       director, // 设置请求重定向逻辑
-			ModifyResponse: response, // 设置响应修改逻辑
-			ErrorHandler:   handler,  // 设置错误处理逻辑
+		for _, c := range candidates {
+			if fixed, ok := e.tree.FixedPath(c); ok && fixed != p {
+				return fixed, true
+			}
 		}
-		proxy.ServeHTTP(w, r) // 反向代理处理请求
-		return                // 返回，结束当前函数执行
 	}
-	// 获取请求的方法 (GET, POST, etc.)
-	method := r.Method
-	// 遍历所有路由组
-	for _, group := range e.groups {
-		// 获取路由名，这里使用了自定义的函数 SubStringLast
-		// 比如：从请求URI中提取路由组的名称
-		routerName := util.SubStringLast(r.URL.Path, "/"+group.groupName)
-		// 获取匹配的路由节点
-		node := group.treeNode.Get(routerName)
-		if node != nil && node.isEnd {
-			// 尝试获取通配符(ANY)的处理函数
-			handle, ok := group.handlerMap[node.routerName][ANY]
-			if ok {
-				// 如果找到了通配符处理函数，调用并返回
-				group.methodHandle(node.routerName, ANY, handle, ctx)
-				return
-			}
-			// 尝试获取具体方法(GET, POST等)的处理函数
-			handle, ok = group.handlerMap[node.routerName][method]
-			if ok {
-				// 如果找到了具体方法的处理函数，调用并返回
-				group.methodHandle(node.routerName, method, handle, ctx)
-				return
-			}
-			// 如果没有找到匹配的处理函数，返回405 Method Not Allowed
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			fmt.Fprintf(w, "%s %s not allowed \n", r.RequestURI, method)
-			return
+	return "", false
+}
+
+// toggleTrailingSlash 有结尾的 / 时去掉，没有时加上
+func toggleTrailingSlash(p string) string {
+	if strings.HasSuffix(p, "/") {
+		return p[:len(p)-1]
+	}
+	return p + "/"
+}
+
+// redirectTo 重定向到 p，保留查询参数；GET、HEAD 返回 301，其他方法返回 308，浏览器重新提交时不改变方法和请求体
+func redirectTo(p string) HandlerFunc {
+	return func(ctx *Context) {
+		code := http.StatusMovedPermanently
+		if ctx.R.Method != http.MethodGet && ctx.R.Method != http.MethodHead {
+			code = http.StatusPermanentRedirect
+		}
+		location := p
+		if ctx.R.URL.RawQuery != "" {
+			location += "?" + ctx.R.URL.RawQuery
 		}
+		ctx.StatusCode = code
+		http.Redirect(ctx.W, ctx.R, location, code)
 	}
-	// 如果没有匹配的路由，返回404 Not Found
-	w.WriteHeader(http.StatusNotFound)
-	_, err := fmt.Fprintf(w, "%s  not found \n", r.RequestURI)
-	if err != nil {
-		return
+}
+
+// NoRoute 设置没有匹配到路由时的处理函数，默认返回 404 和文本，可以返回 JSON 格式的错误，如：
+//
+//	engine.NoRoute(func(ctx *web.Context) {
+//		_ = ctx.JSON(http.StatusNotFound, map[string]any{"code": 404, "msg": "not found"})
+//	})
+//
+// 处理函数先经过 middlewares，再经过 Engine 的中间件（见 Use），与普通路由一样记录访问日志、恢复 panic
+func (e *Engine) NoRoute(handler HandlerFunc, middlewares ...MiddlewareFunc) {
+	e.noRoute = handler
+	e.noRouteMiddles = middlewares
+}
+
+// NoMethod 设置路由存在但不支持请求方法时的处理函数，默认返回 405 和文本，
+// 调用前响应头 Allow 已经设置为路由支持的方法，中间件与 NoRoute 相同
+func (e *Engine) NoMethod(handler HandlerFunc, middlewares ...MiddlewareFunc) {
+	e.noMethod = handler
+	e.noMethodMiddles = middlewares
+}
+
+// handleUnmatched 调用 NoRoute、NoMethod 设置的处理函数，没有设置时使用 def
+func (e *Engine) handleUnmatched(ctx *Context, h HandlerFunc, def HandlerFunc, middlewares []MiddlewareFunc) {
+	if h == nil {
+		h = def
+	}
+	for _, middlewareFunc := range middlewares {
+		h = middlewareFunc(h)
 	}
+	for _, middlewareFunc := range e.Middles {
+		h = middlewareFunc(h)
+	}
+	h(ctx)
+}
+
+func defaultNoRoute(ctx *Context) {
+	_ = ctx.String(http.StatusNotFound, "%s  not found \n", ctx.R.RequestURI)
+}
+
+func defaultNoMethod(ctx *Context) {
+	_ = ctx.String(http.StatusMethodNotAllowed, "%s %s not allowed \n", ctx.R.RequestURI, ctx.R.Method)
 }
 
 func (c *Context) ErrorHandle(err error) {
 	code, data := c.E.errorHandler(err)
+	if code >= http.StatusInternalServerError {
+		c.Log().Error(err)
+	}
 	_ = c.JSON(code, data)
 }
 
@@ -336,15 +507,16 @@ func (e *Engine) RegisterErrorHandler(err ErrorHandler) {
 }
 
 func (e *Engine) RunTLS(addr, certFile, keyFile string) {
-	err := http.ListenAndServeTLS(addr, certFile, keyFile, e.Handler())
-	// 调用 http.ListenAndServeTLS 开启一个 HTTPS 服务
+	e.printRoutes()
+	err := e.newServer(addr, e.Handler()).ListenAndServeTLS(certFile, keyFile)
+	// 调用 http.Server.ListenAndServeTLS 开启一个 HTTPS 服务，调用 Shutdown 关闭时正常返回
 	// 参数：
 	// addr：服务监听的地址（如 ":443"）
 	// certFile：证书文件路径
 	// keyFile：私钥文件路径
 	// e.Handler()：用于处理 HTTP 请求的处理器
 
-	if err != nil {
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal(err)
 		// 如果出现错误，记录错误并终止程序
 	}
@@ -357,22 +529,102 @@ func (e *Engine) Handler() http.Handler {
 // LoadTemplateGlobByConf 从配置文件中加载模板文件
 func (e *Engine) LoadTemplateGlobByConf() {
 	// 从配置中获取模板文件的匹配模式
-	pattern, ok := config.GetToml().Template["pattern"]
-	if !ok {
+	pattern := config.GetString("template.pattern", "")
+	if pattern == "" {
 		// 如果配置中没有找到 pattern，抛出异常
 		panic("config pattern not exist")
 	}
 	// 解析匹配模式下的所有模板文件，并将解析后的模板赋给 t
-	t := template.Must(template.New("").Funcs(e.funcMap).ParseGlob(pattern.(string)))
+	t := template.Must(template.New("").Funcs(e.funcMap).ParseGlob(pattern))
 	// 设置 HTML 模板
 	e.SetHtmlTemplate(t)
 }
 
-func (e *Engine) SetGatewayConfig(configs []gateway.GWConfig) {
-	e.gatewayConfigs = configs
-	//把这个路径 存储起来 访问的时候 去匹配这里面的路由 如果匹配，就拿出来相应的匹配结果
-	for _, v := range e.gatewayConfigs {
-		e.gatewayTreeNode.Put(v.Path, v.Name)
-		e.gatewayConfigMap[v.Name] = v
+// SetRegister 根据注册类型创建注册中心客户端，注册类型通过 register.Register 注册
+func (e *Engine) SetRegister(registerType string, option register.Option) error {
+	cli, err := register.New(registerType, option)
+	if err != nil {
+		return err
+	}
+	e.RegisterType = registerType
+	e.RegisterOption = option
+	e.RegisterCli = cli
+	return nil
+}
+
+// RegisterService 将当前服务注册到注册中心，停止时通过 Deregister 注销
+func (e *Engine) RegisterService(serviceName string, host string, port int) error {
+	if e.RegisterCli == nil {
+		return errors.New("register client not set")
+	}
+	err := e.RegisterCli.RegisterService(serviceName, host, port)
+	if err != nil {
+		return err
+	}
+	e.instanceMu.Lock()
+	e.instances = append(e.instances, serviceInstance{serviceName: serviceName, host: host, port: port})
+	e.instanceMu.Unlock()
+	return nil
+}
+
+// registeredInstances 返回已注册实例的副本
+func (e *Engine) registeredInstances() []serviceInstance {
+	e.instanceMu.Lock()
+	defer e.instanceMu.Unlock()
+	return append([]serviceInstance(nil), e.instances...)
+}
+
+// Deregister 从注册中心注销所有已注册的服务实例，应在关闭监听之前调用，让网关不再路由到该实例
+func (e *Engine) Deregister() {
+	if e.RegisterCli == nil {
+		return
+	}
+	for _, ins := range e.registeredInstances() {
+		err := e.RegisterCli.DeregisterService(ins.serviceName, ins.host, ins.port)
+		if err != nil {
+			e.Logger.Error(err)
+		}
+	}
+	e.instanceMu.Lock()
+	e.instances = nil
+	e.instanceMu.Unlock()
+}
+
+// SetGatewayTransport 设置网关转发使用的 Transport，默认为 gateway.NewTransport()，所有网关路由共用
+func (e *Engine) SetGatewayTransport(transport *http.Transport) {
+	e.gatewayTransport = transport
+}
+
+// SetGatewaySplit 运行时调整名称为 name 的网关路由的灰度规则
+func (e *Engine) SetGatewaySplit(name string, splits ...gateway.Split) error {
+	gwConfig, ok := e.gatewayTable.Load().Config(name)
+	if !ok {
+		return fmt.Errorf("gateway route %s not found", name)
+	}
+	gwConfig.Split.Set(splits...)
+	return nil
+}
+
+// GatewayUse 为名称为 name 的网关路由添加中间件，如鉴权、限流、日志，
+// 引擎级中间件（Use）对所有网关路由生效
+func (e *Engine) GatewayUse(name string, middles ...MiddlewareFunc) {
+	if e.gatewayMiddles == nil {
+		e.gatewayMiddles = make(map[string][]MiddlewareFunc)
+	}
+	e.gatewayMiddles[name] = append(e.gatewayMiddles[name], middles...)
+}
+
+// SetGatewayConfig 设置网关路由，路由名称重复或路径冲突时返回错误，原来的路由保持不变
+func (e *Engine) SetGatewayConfig(configs []gateway.GWConfig) error {
+	e.gatewayMu.Lock()
+	defer e.gatewayMu.Unlock()
+	if e.gatewayTransport == nil {
+		e.gatewayTransport = gateway.NewTransport()
+	}
+	table, err := gateway.NewTable(configs, e.gatewayTable.Load())
+	if err != nil {
+		return err
 	}
+	e.gatewayTable.Store(table)
+	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/ygb616/web"
+	_ "github.com/ygb616/web/config/autoload"
 	myLog "github.com/ygb616/web/log"
 	"github.com/ygb616/web/pool"
 	"github.com/ygb616/web/token"